@@ -1,15 +1,32 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
 
 	"auth-service/internal/config"
 	"auth-service/internal/handler"
+	"auth-service/internal/jobs"
 	"auth-service/internal/logger"
+	"auth-service/internal/mailer"
+	"auth-service/internal/oidc"
+	"auth-service/internal/password"
 	"auth-service/internal/repository"
 	"auth-service/internal/service"
+	"auth-service/internal/signing"
+	grpctransport "auth-service/internal/transport/grpc"
 )
 
 // @title           Auth Service API
@@ -47,10 +64,281 @@ func main() {
 
 	userRepo := repository.NewUserRepository(db)
 	tokenRepo := repository.NewTokenRepository(db)
-	authService := service.NewAuthService(userRepo, tokenRepo, cfg)
-	authHandler := handler.NewAuthHandler(authService)
+	roleRepo := repository.NewRoleRepository(db)
+	eventRepo := repository.NewSecurityEventRepository(db)
+	if cfg.AuditLogFile != "" {
+		auditLog, err := os.OpenFile(cfg.AuditLogFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("Failed to open audit log file")
+		}
+		defer auditLog.Close()
+		eventRepo = repository.NewFileSecurityEventRepository(eventRepo, auditLog)
+	}
+	mfaRepo := repository.NewMFARepository(db)
+	patRepo := repository.NewPersonalAccessTokenRepository(db)
+	revokedRepo := repository.NewRevokedTokenRepository(db)
+	inviteRepo := repository.NewInviteCodeRepository(db)
+
+	attemptRepo := repository.NewLoginAttemptRepository(db)
+	if cfg.LoginAttemptStore == "memory" {
+		attemptRepo = repository.NewInMemoryLoginAttemptRepository()
+	}
+
+	keys, err := signing.Load(cfg, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to load signing keys")
+	}
+
+	passwords, err := password.Load(cfg)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to configure password hashing")
+	}
+
+	clientRepo := repository.NewOAuthClientRepository(db)
+	authService := service.NewAuthService(userRepo, tokenRepo, roleRepo, eventRepo, mfaRepo, attemptRepo, patRepo, revokedRepo, inviteRepo, clientRepo, keys, passwords, cfg)
+
+	mail, err := mailer.New(cfg, logger)
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to configure mailer")
+	}
+	resetRepo := repository.NewPasswordResetRepository(db)
+	verifyRepo := repository.NewEmailVerificationRepository(db)
+	accountService := service.NewAccountService(userRepo, tokenRepo, resetRepo, verifyRepo, eventRepo, mail, passwords, cfg)
+	emailChangeRepo := repository.NewEmailChangeRepository(db)
+	identityRepo := repository.NewExternalIdentityRepository(db)
+	profileService := service.NewProfileService(authService, accountService, emailChangeRepo, identityRepo)
+	magicLinkRepo := repository.NewMagicLinkRepository(db)
+	magicLinkService := service.NewMagicLinkService(authService, magicLinkRepo, mail, cfg)
+
+	codeRepo := repository.NewAuthorizationCodeRepository(db)
+	oauthService := service.NewOAuthService(authService, clientRepo, codeRepo, cfg)
+	scimService := service.NewSCIMService(authService, profileService, cfg)
+
+	authHandler := handler.NewAuthHandler(authService, accountService)
+	adminHandler := handler.NewAdminHandler(authService, accountService)
+	accountHandler := handler.NewAccountHandler(accountService)
+	profileHandler := handler.NewProfileHandler(profileService)
+	magicLinkHandler := handler.NewMagicLinkHandler(magicLinkService)
+	oauthHandler := handler.NewOAuthHandler(oauthService)
+	scimHandler := handler.NewSCIMHandler(scimService, authService)
+
+	var externalLoginHandler *handler.ExternalLoginHandler
+	if cfg.OIDCIssuer != "" {
+		provider := oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDCIssuer,
+			ClientID:     cfg.OIDCClientID,
+			ClientSecret: cfg.OIDCClientSecret,
+			RedirectURL:  cfg.OIDCRedirectURL,
+			Scopes:       cfg.OIDCScopes,
+		})
+		externalLoginService := service.NewExternalLoginService(authService, identityRepo, provider, cfg)
+		externalLoginHandler = handler.NewExternalLoginHandler(externalLoginService, strings.HasPrefix(cfg.OIDCRedirectURL, "https://"))
+	}
+
+	if cfg.BootstrapAdmin != "" {
+		if err := authService.BootstrapAdmin(context.Background(), cfg.BootstrapAdmin); err != nil {
+			logger.Warn().Err(err).Str("username", cfg.BootstrapAdmin).Msg("Failed to bootstrap admin")
+		}
+	}
 
 	r := gin.Default()
+	r.Use(handler.ClientInfo())
+
+	// @Summary JSON Web Key Set
+	// @Description Public keys for verifying access tokens locally. Tokens name their key in the kid header.
+	// @Tags auth
+	// @Produce json
+	// @Success 200 {object} signing.JWKS
+	// @Router /.well-known/jwks.json [get]
+	r.GET("/.well-known/jwks.json", authHandler.JWKS)
+
+	// @Summary OpenID Connect discovery
+	// @Description OpenID Provider metadata for clients of the built-in OAuth2 / OpenID Connect provider
+	// @Tags oauth
+	// @Produce json
+	// @Success 200 {object} service.Discovery
+	// @Router /.well-known/openid-configuration [get]
+	r.GET("/.well-known/openid-configuration", oauthHandler.Discovery)
+
+	oauth := r.Group("/oauth")
+	{
+		// @Summary Authorization endpoint
+		// @Description Start an authorization code flow. Valid requests are redirected to the login page with the same query.
+		// @Tags oauth
+		// @Success 302
+		// @Failure 400 {object} handler.ErrorResponse
+		// @Router /oauth/authorize [get]
+		oauth.GET("/authorize", oauthHandler.Authorize)
+
+		// @Summary Token endpoint
+		// @Description Exchange an authorization code, client credentials or a refresh token for tokens
+		// @Tags oauth
+		// @Accept x-www-form-urlencoded
+		// @Produce json
+		// @Success 200 {object} handler.TokenResponse
+		// @Failure 400 {object} handler.OAuthErrorResponse
+		// @Failure 401 {object} handler.OAuthErrorResponse
+		// @Router /oauth/token [post]
+		oauth.POST("/token", oauthHandler.Token)
+
+		// @Summary OpenID Connect userinfo
+		// @Description Return the claims about the user released by the access token's scopes
+		// @Tags oauth
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.UserInfo
+		// @Failure 401 {object} handler.OAuthErrorResponse
+		// @Router /oauth/userinfo [get]
+		oauth.GET("/userinfo", oauthHandler.UserInfo)
+		oauth.POST("/userinfo", oauthHandler.UserInfo)
+
+		// @Summary Token introspection
+		// @Description Describe an access token, personal access token or refresh token (RFC 7662). Confidential clients only.
+		// @Tags oauth
+		// @Accept x-www-form-urlencoded
+		// @Produce json
+		// @Success 200 {object} handler.IntrospectionResponse
+		// @Failure 401 {object} handler.OAuthErrorResponse
+		// @Router /oauth/introspect [post]
+		oauth.POST("/introspect", oauthHandler.Introspect)
+
+		// @Summary Token revocation
+		// @Description Revoke an access token, personal access token or refresh token (RFC 7009)
+		// @Tags oauth
+		// @Accept x-www-form-urlencoded
+		// @Success 200
+		// @Failure 400 {object} handler.OAuthErrorResponse
+		// @Router /oauth/revoke [post]
+		oauth.POST("/revoke", oauthHandler.Revoke)
+	}
+
+	// SCIM 2.0 provisioning for company directories. Callers use a personal
+	// access token with the scim scope, owned by a user with scim:provision.
+	scim := r.Group("/scim/v2", scimHandler.Authenticate())
+	{
+		// @Summary SCIM service provider configuration
+		// @Tags scim
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} handler.SCIMServiceProviderConfig
+		// @Router /scim/v2/ServiceProviderConfig [get]
+		scim.GET("/ServiceProviderConfig", scimHandler.ServiceProviderConfig)
+
+		// @Summary List SCIM users
+		// @Description List accounts, filtered by userName, emails or id with eq
+		// @Tags scim
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMListResponse
+		// @Failure 400 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users [get]
+		scim.GET("/Users", scimHandler.ListUsers)
+
+		// @Summary Get SCIM user
+		// @Tags scim
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMUser
+		// @Failure 404 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users/{id} [get]
+		scim.GET("/Users/:id", scimHandler.GetUser)
+
+		// @Summary Provision SCIM user
+		// @Description Create an account with a verified email address
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 201 {object} service.SCIMUser
+		// @Failure 409 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users [post]
+		scim.POST("/Users", scimHandler.CreateUser)
+
+		// @Summary Replace SCIM user
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMUser
+		// @Failure 404 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users/{id} [put]
+		scim.PUT("/Users/:id", scimHandler.ReplaceUser)
+
+		// @Summary Patch SCIM user
+		// @Description Change attributes of an account; active=false suspends it
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMUser
+		// @Failure 404 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users/{id} [patch]
+		scim.PATCH("/Users/:id", scimHandler.PatchUser)
+
+		// @Summary Delete SCIM user
+		// @Tags scim
+		// @Security BearerAuth
+		// @Success 204
+		// @Failure 404 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Users/{id} [delete]
+		scim.DELETE("/Users/:id", scimHandler.DeleteUser)
+
+		// @Summary List SCIM groups
+		// @Description List roles as groups, filtered by displayName or id with eq
+		// @Tags scim
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMListResponse
+		// @Router /scim/v2/Groups [get]
+		scim.GET("/Groups", scimHandler.ListGroups)
+
+		// @Summary Get SCIM group
+		// @Tags scim
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMGroup
+		// @Failure 404 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Groups/{id} [get]
+		scim.GET("/Groups/:id", scimHandler.GetGroup)
+
+		// @Summary Provision SCIM group
+		// @Description Create a role without permissions for the group
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 201 {object} service.SCIMGroup
+		// @Failure 409 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Groups [post]
+		scim.POST("/Groups", scimHandler.CreateGroup)
+
+		// @Summary Replace SCIM group
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMGroup
+		// @Router /scim/v2/Groups/{id} [put]
+		scim.PUT("/Groups/:id", scimHandler.ReplaceGroup)
+
+		// @Summary Patch SCIM group
+		// @Description Add or remove members, granting or revoking the role
+		// @Tags scim
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Success 200 {object} service.SCIMGroup
+		// @Router /scim/v2/Groups/{id} [patch]
+		scim.PATCH("/Groups/:id", scimHandler.PatchGroup)
+
+		// @Summary Delete SCIM group
+		// @Tags scim
+		// @Security BearerAuth
+		// @Success 204
+		// @Failure 400 {object} handler.SCIMErrorResponse
+		// @Router /scim/v2/Groups/{id} [delete]
+		scim.DELETE("/Groups/:id", scimHandler.DeleteGroup)
+	}
 
 	// API routes
 	v1 := r.Group("/api/v1")
@@ -75,7 +363,10 @@ func main() {
 			// @Produce json
 			// @Param input body handler.LoginRequest true "Login credentials"
 			// @Success 200 {object} handler.LoginResponse
+			// @Success 202 {object} handler.MFAChallengeResponse
 			// @Failure 400 {object} handler.ErrorResponse
+			// @Failure 403 {object} handler.ErrorResponse
+			// @Failure 429 {object} handler.RateLimitResponse
 			// @Router /auth/login [post]
 			auth.POST("/login", authHandler.Login)
 
@@ -102,7 +393,7 @@ func main() {
 			auth.POST("/logout", authHandler.Logout)
 
 			// @Summary Validate token
-			// @Description Validate JWT token and return user information
+			// @Description Validate a JWT or personal access token and return user information
 			// @Tags auth
 			// @Accept json
 			// @Produce json
@@ -111,10 +402,742 @@ func main() {
 			// @Failure 401 {object} handler.ErrorResponse
 			// @Router /auth/validate [get]
 			auth.GET("/validate", authHandler.ValidateToken)
+
+			// @Summary Complete two-factor login
+			// @Description Exchange the mfa_token returned by login and a TOTP or recovery code for JWT tokens
+			// @Tags mfa
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.VerifyMFARequest true "Challenge token and code"
+			// @Success 200 {object} handler.LoginResponse
+			// @Failure 401 {object} handler.ErrorResponse
+			// @Failure 429 {object} handler.RateLimitResponse
+			// @Router /auth/mfa/verify [post]
+			auth.POST("/mfa/verify", authHandler.VerifyMFA)
+
+			// @Summary Request a login link
+			// @Description Send a single-use login link to the given email address
+			// @Tags auth
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.MagicLinkRequest true "Email address"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Failure 404 {object} handler.ErrorResponse
+			// @Failure 429 {object} handler.RateLimitResponse
+			// @Router /auth/magic-link [post]
+			auth.POST("/magic-link", magicLinkHandler.RequestLink)
+
+			// @Summary Log in with a login link
+			// @Description Exchange the token from a login link for JWT tokens
+			// @Tags auth
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.MagicLinkLoginRequest true "Token from the link"
+			// @Success 200 {object} handler.LoginResponse
+			// @Success 202 {object} handler.MFAChallengeResponse
+			// @Failure 401 {object} handler.ErrorResponse
+			// @Failure 404 {object} handler.ErrorResponse
+			// @Router /auth/magic-link/login [post]
+			auth.POST("/magic-link/login", magicLinkHandler.Login)
+
+			// @Summary Request password reset
+			// @Description Send a password reset link to the given email address
+			// @Tags account
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.ForgotPasswordRequest true "Email address"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /auth/forgot-password [post]
+			auth.POST("/forgot-password", accountHandler.ForgotPassword)
+
+			// @Summary Reset password
+			// @Description Set a new password using a reset token
+			// @Tags account
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.ResetPasswordRequest true "Reset token and new password"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /auth/reset-password [post]
+			auth.POST("/reset-password", accountHandler.ResetPassword)
+
+			// @Summary Verify email address
+			// @Description Confirm the user's email address using the token from the verification link
+			// @Tags account
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.VerifyEmailRequest true "Verification token"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /auth/verify-email [post]
+			auth.POST("/verify-email", accountHandler.VerifyEmail)
+
+			// @Summary Resend verification email
+			// @Description Send a new email verification link to the given address
+			// @Tags account
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.ResendVerificationRequest true "Email address"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /auth/resend-verification [post]
+			auth.POST("/resend-verification", accountHandler.ResendVerification)
+
+			// @Summary Confirm email change
+			// @Description Switch to the new email address using the token from the confirmation link
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Param input body handler.ConfirmEmailChangeRequest true "Confirmation token"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Failure 409 {object} handler.ErrorResponse
+			// @Router /auth/confirm-email [post]
+			auth.POST("/confirm-email", profileHandler.ConfirmEmailChange)
+
+			sessions := auth.Group("", authHandler.RequireAuth())
+			{
+				// @Summary Log out everywhere
+				// @Description Revoke every refresh token of the current user, including the current session
+				// @Tags sessions
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {object} handler.Response
+				// @Failure 401 {object} handler.ErrorResponse
+				// @Router /auth/logout-all [post]
+				sessions.POST("/logout-all", authHandler.LogoutAll)
+
+				// @Summary List sessions
+				// @Description List the active sessions of the current user
+				// @Tags sessions
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {array} handler.SessionResponse
+				// @Failure 401 {object} handler.ErrorResponse
+				// @Router /auth/sessions [get]
+				sessions.GET("/sessions", authHandler.ListSessions)
+
+				// @Summary Log out other sessions
+				// @Description Log the current user out of every session except the current one
+				// @Tags sessions
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {object} handler.Response
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Router /auth/sessions/revoke-others [post]
+				sessions.POST("/sessions/revoke-others", authHandler.RevokeOtherSessions)
+
+				// @Summary Revoke session
+				// @Description Log the current user out of one session
+				// @Tags sessions
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "Session ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /auth/sessions/{id} [delete]
+				sessions.DELETE("/sessions/:id", authHandler.RevokeSession)
+
+				// @Summary Start two-factor enrollment
+				// @Description Generate a TOTP secret and otpauth:// URI for an authenticator app
+				// @Tags mfa
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {object} handler.MFAEnrollResponse
+				// @Failure 409 {object} handler.ErrorResponse
+				// @Router /auth/mfa/enroll [post]
+				sessions.POST("/mfa/enroll", authHandler.EnrollMFA)
+
+				// @Summary Confirm two-factor enrollment
+				// @Description Enable two-factor authentication with a code from the authenticator app
+				// @Tags mfa
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.MFACodeRequest true "TOTP code"
+				// @Success 200 {object} handler.RecoveryCodesResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Router /auth/mfa/confirm [post]
+				sessions.POST("/mfa/confirm", authHandler.ConfirmMFA)
+
+				// @Summary Disable two-factor authentication
+				// @Description Turn two-factor authentication off using a TOTP or recovery code
+				// @Tags mfa
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.MFACodeRequest true "TOTP or recovery code"
+				// @Success 200 {object} handler.Response
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Router /auth/mfa/disable [post]
+				sessions.POST("/mfa/disable", authHandler.DisableMFA)
+
+				// @Summary Regenerate recovery codes
+				// @Description Replace all recovery codes with a new set
+				// @Tags mfa
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.MFACodeRequest true "TOTP or recovery code"
+				// @Success 200 {object} handler.RecoveryCodesResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Router /auth/mfa/recovery-codes [post]
+				sessions.POST("/mfa/recovery-codes", authHandler.RegenerateRecoveryCodes)
+
+				// @Summary Create personal access token
+				// @Description Create a long-lived token for bots and scripts, limited to the given scopes (chat:read, chat:write, posts:read, posts:write, scim). The token is only shown once.
+				// @Tags tokens
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.CreateAccessTokenRequest true "Token name, scopes and lifetime"
+				// @Success 201 {object} handler.CreateAccessTokenResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 401 {object} handler.ErrorResponse
+				// @Router /auth/tokens [post]
+				sessions.POST("/tokens", authHandler.CreateAccessToken)
+
+				// @Summary List personal access tokens
+				// @Description List the personal access tokens of the current user
+				// @Tags tokens
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {array} handler.AccessTokenResponse
+				// @Failure 401 {object} handler.ErrorResponse
+				// @Router /auth/tokens [get]
+				sessions.GET("/tokens", authHandler.ListAccessTokens)
+
+				// @Summary Revoke personal access token
+				// @Description Delete one of the current user's personal access tokens
+				// @Tags tokens
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "Token ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 401 {object} handler.ErrorResponse
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /auth/tokens/{id} [delete]
+				sessions.DELETE("/tokens/:id", authHandler.RevokeAccessToken)
+			}
+
+			if externalLoginHandler != nil {
+				// @Summary Log in with the external provider
+				// @Description Redirect to the configured OpenID provider. New users are registered on their first login.
+				// @Tags oidc
+				// @Success 302
+				// @Router /auth/oidc/login [get]
+				auth.GET("/oidc/login", externalLoginHandler.Login)
+
+				// @Summary External login callback
+				// @Description The OpenID provider redirects here after the user logged in. Returns tokens for a login, or a message when an identity was linked.
+				// @Tags oidc
+				// @Produce json
+				// @Param state query string true "State"
+				// @Param code query string true "Authorization code"
+				// @Success 200 {object} handler.LoginResponse
+				// @Success 202 {object} handler.MFAChallengeResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 409 {object} handler.ErrorResponse
+				// @Router /auth/oidc/callback [get]
+				auth.GET("/oidc/callback", externalLoginHandler.Callback)
+
+				identities := auth.Group("", authHandler.RequireAuth())
+				{
+					// @Summary Link an external identity
+					// @Description Start linking an identity at the configured OpenID provider to the current user
+					// @Tags oidc
+					// @Produce json
+					// @Security BearerAuth
+					// @Success 200 {object} handler.LinkIdentityResponse
+					// @Router /auth/oidc/link [post]
+					identities.POST("/oidc/link", externalLoginHandler.Link)
+
+					// @Summary List external identities
+					// @Description List the external identities linked to the current user
+					// @Tags oidc
+					// @Produce json
+					// @Security BearerAuth
+					// @Success 200 {array} handler.ExternalIdentityResponse
+					// @Router /auth/identities [get]
+					identities.GET("/identities", externalLoginHandler.ListIdentities)
+
+					// @Summary Unlink external identity
+					// @Description Remove an external identity from the current user
+					// @Tags oidc
+					// @Produce json
+					// @Security BearerAuth
+					// @Param id path string true "Identity ID"
+					// @Success 200 {object} handler.Response
+					// @Failure 400 {object} handler.ErrorResponse
+					// @Failure 404 {object} handler.ErrorResponse
+					// @Router /auth/identities/{id} [delete]
+					identities.DELETE("/identities/:id", externalLoginHandler.UnlinkIdentity)
+				}
+			}
 		}
+
+		me := v1.Group("/users/me", authHandler.RequireAuth())
+		{
+			// @Summary Get own profile
+			// @Description Get the profile of the authenticated user
+			// @Tags profile
+			// @Produce json
+			// @Security BearerAuth
+			// @Success 200 {object} handler.ProfileResponse
+			// @Failure 401 {object} handler.ErrorResponse
+			// @Router /users/me [get]
+			me.GET("", profileHandler.GetProfile)
+
+			// @Summary Update own profile
+			// @Description Change the display name, bio or avatar URL
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Security BearerAuth
+			// @Param input body handler.UpdateProfileRequest true "Profile fields"
+			// @Success 200 {object} handler.ProfileResponse
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /users/me [patch]
+			me.PATCH("", profileHandler.UpdateProfile)
+
+			// @Summary Delete own account
+			// @Description Delete the authenticated user's account and, through the forum, their content
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Security BearerAuth
+			// @Param input body handler.DeleteAccountRequest true "Current password"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /users/me [delete]
+			me.DELETE("", profileHandler.DeleteAccount)
+
+			// @Summary Download account data
+			// @Description Download everything the auth service stores about the authenticated user
+			// @Tags profile
+			// @Produce json
+			// @Security BearerAuth
+			// @Success 200 {object} service.AccountExport
+			// @Router /users/me/export [get]
+			me.GET("/export", profileHandler.ExportData)
+
+			// @Summary Change password
+			// @Description Set a new password after confirming the current one
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Security BearerAuth
+			// @Param input body handler.ChangePasswordRequest true "Current and new password"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Router /users/me/password [put]
+			me.PUT("/password", profileHandler.ChangePassword)
+
+			// @Summary Change username
+			// @Description Rename the authenticated user
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Security BearerAuth
+			// @Param input body handler.ChangeUsernameRequest true "New username"
+			// @Success 200 {object} handler.ProfileResponse
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Failure 409 {object} handler.ErrorResponse
+			// @Router /users/me/username [put]
+			me.PUT("/username", profileHandler.ChangeUsername)
+
+			// @Summary Change email address
+			// @Description Send a confirmation link to the new address
+			// @Tags profile
+			// @Accept json
+			// @Produce json
+			// @Security BearerAuth
+			// @Param input body handler.ChangeEmailRequest true "New email address"
+			// @Success 200 {object} handler.Response
+			// @Failure 400 {object} handler.ErrorResponse
+			// @Failure 409 {object} handler.ErrorResponse
+			// @Router /users/me/email [put]
+			me.PUT("/email", profileHandler.ChangeEmail)
+
+			// @Summary Username history
+			// @Description List the previous usernames of the authenticated user
+			// @Tags profile
+			// @Produce json
+			// @Security BearerAuth
+			// @Success 200 {array} handler.UsernameChangeResponse
+			// @Router /users/me/username-history [get]
+			me.GET("/username-history", profileHandler.UsernameHistory)
+		}
+
+		// @Summary Approve authorization request
+		// @Description Called by the login page once the user has logged in. Returns the client URI to redirect the browser to.
+		// @Tags oauth
+		// @Accept json
+		// @Produce json
+		// @Security BearerAuth
+		// @Param input body handler.AuthorizeParams true "Parameters of the authorization request"
+		// @Success 200 {object} handler.AuthorizeResponse
+		// @Failure 400 {object} handler.ErrorResponse
+		// @Router /oauth/authorize [post]
+		v1.POST("/oauth/authorize", authHandler.RequireAuth(), oauthHandler.ApproveAuthorization)
+
+		admin := v1.Group("/admin", authHandler.RequireAuth())
+		{
+			roles := admin.Group("", authHandler.RequirePermission(service.PermissionRolesManage))
+			{
+				// @Summary List roles
+				// @Description List all roles with their permissions
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {array} handler.RoleResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/roles [get]
+				roles.GET("/roles", adminHandler.ListRoles)
+
+				// @Summary Get user roles
+				// @Description Get the roles and effective permissions of a user
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.UserRolesResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/roles [get]
+				roles.GET("/users/:id/roles", adminHandler.GetUserRoles)
+
+				// @Summary Assign role
+				// @Description Grant a role to a user
+				// @Tags admin
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Param input body handler.AssignRoleRequest true "Role"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/roles [post]
+				roles.POST("/users/:id/roles", adminHandler.AssignRole)
+
+				// @Summary Revoke role
+				// @Description Remove a role from a user
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Param role path string true "Role name"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/roles/{role} [delete]
+				roles.DELETE("/users/:id/roles/:role", adminHandler.RevokeRole)
+			}
+
+			usersRead := admin.Group("/users", authHandler.RequirePermission(service.PermissionUsersRead))
+			{
+				// @Summary List users
+				// @Description Search users by username or email, newest first
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param q query string false "Part of the username or email"
+				// @Param suspended query bool false "Only currently suspended users"
+				// @Param pending query bool false "Only users waiting for approval"
+				// @Param limit query int false "Page size, at most 100"
+				// @Param offset query int false "Number of users to skip"
+				// @Success 200 {object} handler.UserListResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/users [get]
+				usersRead.GET("", adminHandler.ListUsers)
+
+				// @Summary Get user
+				// @Description Get a user with their roles and active sessions
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.UserDetailsResponse
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id} [get]
+				usersRead.GET("/:id", adminHandler.GetUser)
+			}
+
+			users := admin.Group("/users", authHandler.RequirePermission(service.PermissionUsersManage))
+			{
+				// @Summary Suspend user
+				// @Description Suspend a user until expires_at, or ban them if it is omitted
+				// @Tags admin
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Param input body handler.SuspendUserRequest true "Reason and end of the suspension"
+				// @Success 200 {object} handler.Response
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/suspension [post]
+				users.POST("/:id/suspension", adminHandler.SuspendUser)
+
+				// @Summary Unsuspend user
+				// @Description Lift a suspension or ban
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/suspension [delete]
+				users.DELETE("/:id/suspension", adminHandler.UnsuspendUser)
+
+				// @Summary Approve user
+				// @Description Approve an account registered while registration needs admin approval
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/approval [post]
+				users.POST("/:id/approval", adminHandler.ApproveUser)
+
+				// @Summary Force password reset
+				// @Description Clear the user's password, log them out everywhere and email them a reset link
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/password-reset [post]
+				users.POST("/:id/password-reset", adminHandler.ForcePasswordReset)
+
+				// @Summary Delete user
+				// @Description Delete a user with their sessions, roles and tokens. The forum deletes or anonymizes their content.
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id} [delete]
+				users.DELETE("/:id", adminHandler.DeleteUser)
+			}
+
+			impersonation := admin.Group("/users", authHandler.RequirePermission(service.PermissionUsersImpersonate))
+			{
+				// @Summary Impersonate user
+				// @Description Get a short-lived access token that acts as the user. It names the admin in its act claim and has no refresh token.
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "User ID"
+				// @Success 200 {object} handler.ImpersonationResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/users/{id}/impersonation [post]
+				impersonation.POST("/:id/impersonation", adminHandler.ImpersonateUser)
+			}
+
+			invites := admin.Group("/invites", authHandler.RequirePermission(service.PermissionInvitesManage))
+			{
+				// @Summary Create invite code
+				// @Description Create an invite code for registration. The code is only shown in this response.
+				// @Tags admin
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.CreateInviteRequest true "Invite settings"
+				// @Success 201 {object} handler.CreateInviteResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/invites [post]
+				invites.POST("", adminHandler.CreateInvite)
+
+				// @Summary List invite codes
+				// @Description List invite codes with how often each has been used
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {array} handler.InviteResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/invites [get]
+				invites.GET("", adminHandler.ListInvites)
+
+				// @Summary Delete invite code
+				// @Description Delete an invite code so that it can no longer be used
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "Invite ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/invites/{id} [delete]
+				invites.DELETE("/:id", adminHandler.DeleteInvite)
+			}
+
+			audit := admin.Group("/audit-events", authHandler.RequirePermission(service.PermissionAuditRead))
+			{
+				// @Summary List audit events
+				// @Description Search the authentication audit log, newest first
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param user_id query string false "Only events of this user"
+				// @Param type query string false "Only events of this type"
+				// @Param since query string false "Events at or after this RFC 3339 time"
+				// @Param until query string false "Events before this RFC 3339 time"
+				// @Param limit query int false "Page size, at most 1000"
+				// @Param offset query int false "Number of events to skip"
+				// @Success 200 {object} handler.AuditEventListResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/audit-events [get]
+				audit.GET("", adminHandler.ListAuditEvents)
+			}
+
+			clients := admin.Group("/oauth/clients", authHandler.RequirePermission(service.PermissionClientsManage))
+			{
+				// @Summary Register OAuth client
+				// @Description Register an application that signs users in through this service
+				// @Tags admin
+				// @Accept json
+				// @Produce json
+				// @Security BearerAuth
+				// @Param input body handler.CreateOAuthClientRequest true "Client settings"
+				// @Success 201 {object} handler.CreateOAuthClientResponse
+				// @Failure 400 {object} handler.ErrorResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/oauth/clients [post]
+				clients.POST("", oauthHandler.CreateClient)
+
+				// @Summary List OAuth clients
+				// @Description List the registered OAuth clients
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Success 200 {array} handler.OAuthClientResponse
+				// @Failure 403 {object} handler.ErrorResponse
+				// @Router /admin/oauth/clients [get]
+				clients.GET("", oauthHandler.ListClients)
+
+				// @Summary Delete OAuth client
+				// @Description Remove an OAuth client and revoke every token issued to it
+				// @Tags admin
+				// @Produce json
+				// @Security BearerAuth
+				// @Param id path string true "Client ID"
+				// @Success 200 {object} handler.Response
+				// @Failure 404 {object} handler.ErrorResponse
+				// @Router /admin/oauth/clients/{id} [delete]
+				clients.DELETE("/:id", oauthHandler.DeleteClient)
+			}
+		}
+	}
+
+	grpcLogger, err := zap.NewProduction()
+	if err != nil {
+		logger.Fatal().Err(err).Msg("Failed to create gRPC logger")
+	}
+	defer grpcLogger.Sync()
+
+	grpcServer := grpctransport.NewServer(grpcLogger)
+	grpctransport.NewAuthServer(authService, accountService, profileService, grpcLogger).RegisterGRPC(grpcServer)
+
+	grpcListener, err := net.Listen("tcp", cfg.GRPCAddr)
+	if err != nil {
+		logger.Fatal().Err(err).Str("addr", cfg.GRPCAddr).Msg("Failed to listen for gRPC")
+	}
+
+	httpServer := &http.Server{
+		Addr:    cfg.HTTPAddr,
+		Handler: r,
 	}
 
-	if err := r.Run(":8080"); err != nil {
-		logger.Fatal().Err(err).Msg("Failed to start server")
+	scheduler := jobs.NewScheduler(repository.NewAdvisoryJobLock(db), cfg.JobJitter, logger)
+	scheduler.Add(jobs.ExpiredTokens(tokenRepo, revokedRepo, cfg.TokenSweepInterval))
+	scheduler.Add(jobs.OneTimeTokens(cfg.OneTimeTokenSweepInterval, resetRepo, verifyRepo, emailChangeRepo, magicLinkRepo))
+	// Login link requests are counted in the same store, over their own
+	// window, so counters are kept for the longer of the two
+	attemptWindow := max(cfg.LoginFailureWindow, cfg.MagicLinkWindow)
+	scheduler.Add(jobs.LoginAttempts(attemptRepo, attemptWindow, cfg.LoginAttemptSweepInterval, cfg.LoginAttemptStore != "memory"))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Either server failing takes the other one down with it
+	serveErr := make(chan error, 3)
+	go func() {
+		logger.Info().Str("addr", cfg.GRPCAddr).Msg("Starting gRPC server")
+		serveErr <- grpcServer.Serve(grpcListener)
+	}()
+	go func() {
+		logger.Info().Str("addr", cfg.HTTPAddr).Msg("Starting HTTP server")
+		if err := httpServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- err
+		}
+	}()
+
+	// Metrics are served apart from the API so that they need not be public
+	var metricsServer *http.Server
+	if cfg.MetricsAddr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/debug/vars", expvar.Handler())
+		metricsServer = &http.Server{Addr: cfg.MetricsAddr, Handler: mux}
+		go func() {
+			logger.Info().Str("addr", cfg.MetricsAddr).Msg("Starting metrics server")
+			if err := metricsServer.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- err
+			}
+		}()
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	jobsDone := make(chan struct{})
+	go func() {
+		scheduler.Run(jobsCtx)
+		close(jobsDone)
+	}()
+
+	select {
+	case <-ctx.Done():
+		logger.Info().Msg("Shutting down")
+	case err := <-serveErr:
+		logger.Error().Err(err).Msg("Server stopped, shutting down")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	// Jobs in progress are cancelled; they only delete what a later run
+	// would delete as well
+	stopJobs()
+	<-jobsDone
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("HTTP server did not shut down cleanly")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := grpcServer.Shutdown(shutdownCtx); err != nil {
+			logger.Error().Err(err).Msg("gRPC server did not shut down cleanly")
+		}
+	}()
+	if metricsServer != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := metricsServer.Shutdown(shutdownCtx); err != nil {
+				logger.Error().Err(err).Msg("Metrics server did not shut down cleanly")
+			}
+		}()
 	}
+	wg.Wait()
 }
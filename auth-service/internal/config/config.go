@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,120 @@ type Config struct {
 	RefreshTokenTTL time.Duration
 	GRPCAddr        string
 	HTTPAddr        string
+	// ShutdownTimeout bounds how long in-flight requests may take to finish
+	// after SIGTERM before they are cut off.
+	ShutdownTimeout time.Duration
+	// BootstrapAdmin is the username granted the admin role on startup.
+	BootstrapAdmin string
+	// AppURL is the base URL used in links sent by email.
+	AppURL           string
+	PasswordResetTTL time.Duration
+	// EmailVerification is "off", "login" (unverified users cannot log in)
+	// or "write" (unverified users can log in but not post in the forum).
+	EmailVerification    string
+	EmailVerificationTTL time.Duration
+	// RegistrationMode is "open", "invite" (an invite code is required),
+	// "domain" (only AllowedEmailDomains) or "approval" (new accounts wait
+	// for an admin).
+	RegistrationMode    string
+	AllowedEmailDomains []string
+	// MagicLinkEnabled lets users log in with a single-use link emailed to
+	// them instead of their password.
+	MagicLinkEnabled bool
+	MagicLinkTTL     time.Duration
+	// At most MagicLinkMaxRequests links are sent to one address per
+	// MagicLinkWindow.
+	MagicLinkMaxRequests int
+	MagicLinkWindow      time.Duration
+	// MagicLinkAdmins allows accounts with the admin role to log in with a
+	// link. It is off by default so that an admin's mailbox alone is not
+	// enough to take over the service.
+	MagicLinkAdmins bool
+	// ImpersonationTTL is the lifetime of the access token an admin gets to
+	// act as another user. It cannot be refreshed.
+	ImpersonationTTL time.Duration
+	// MFAIssuer is the account issuer shown in authenticator apps.
+	MFAIssuer       string
+	MFAChallengeTTL time.Duration
+
+	// JWTSigningKeyFiles are PEM files with RSA or Ed25519 private keys. The
+	// first one signs new access tokens; all of them are published in the
+	// JWKS and accepted. JWTSecretKey now only signs internal tokens such as
+	// two-factor challenges.
+	JWTSigningKeyFiles []string
+	// JWTVerificationKeyFiles are retired keys that are still published and
+	// accepted until the tokens they signed have expired.
+	JWTVerificationKeyFiles []string
+
+	// OAuthIssuer is the public base URL of the OAuth2/OpenID Connect
+	// provider, used as the iss of ID tokens and in discovery.
+	OAuthIssuer string
+	// OAuthLoginURL is the login page the authorization endpoint sends users
+	// to. It receives the original authorization request as its query.
+	OAuthLoginURL string
+	OAuthCodeTTL  time.Duration
+
+	// OIDCIssuer enables logging in with an external OpenID provider, such as
+	// a corporate identity provider. It is empty when disabled.
+	OIDCIssuer       string
+	OIDCClientID     string
+	OIDCClientSecret string
+	// OIDCRedirectURL is this service's callback registered at the provider.
+	OIDCRedirectURL string
+	OIDCScopes      []string
+
+	// LoginAttemptStore selects where failed login counters live: "postgres"
+	// (shared by all replicas) or "memory".
+	LoginAttemptStore string
+	// LoginFailureWindow is how long a failure counts towards throttling.
+	LoginFailureWindow time.Duration
+	// After LoginFreeAttempts failures each further attempt is delayed by
+	// LoginBackoffBase, doubling up to LoginBackoffMax.
+	LoginFreeAttempts int
+	LoginBackoffBase  time.Duration
+	LoginBackoffMax   time.Duration
+	// LoginLockoutThreshold failures lock the account for LoginLockoutDuration.
+	LoginLockoutThreshold int
+	LoginLockoutDuration  time.Duration
+	// Per-IP limits are higher since many users can share an address.
+	LoginIPFreeAttempts     int
+	LoginIPLockoutThreshold int
+
+	// PasswordHasher is the algorithm new password hashes use: "argon2id"
+	// or "bcrypt". Hashes made by the other one still verify and are
+	// replaced on the next login.
+	PasswordHasher string
+	// Argon2Memory is in KiB.
+	Argon2Memory      int
+	Argon2Iterations  int
+	Argon2Parallelism int
+	BcryptCost        int
+	// BreachedPasswordsFile lists passwords, or their SHA-1 hashes, that
+	// cannot be chosen. It is optional.
+	BreachedPasswordsFile string
+
+	// AuditLogFile, when set, receives every security event as a line of
+	// JSON in addition to the database, for shipping to a SIEM.
+	AuditLogFile string
+
+	// Background jobs run every interval plus a random delay of up to
+	// JobJitter. An interval of 0 disables the job.
+	TokenSweepInterval        time.Duration
+	OneTimeTokenSweepInterval time.Duration
+	LoginAttemptSweepInterval time.Duration
+	JobJitter                 time.Duration
+	// MetricsAddr serves expvar metrics, including those of background
+	// jobs, at /debug/vars. It is empty when disabled.
+	MetricsAddr string
+
+	// Mailer selects how emails are delivered: "smtp", "file" or "log".
+	Mailer       string
+	MailFrom     string
+	MailFile     string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUsername string
+	SMTPPassword string
 }
 
 func Load() (*Config, error) {
@@ -21,7 +137,75 @@ func Load() (*Config, error) {
 		AccessTokenTTL:  15 * time.Minute,
 		RefreshTokenTTL: 7 * 24 * time.Hour, // 7 days
 		GRPCAddr:        getEnv("GRPC_ADDR", ":50051"),
-		HTTPAddr:        getEnv("HTTP_ADDR", ":8082"),
+		HTTPAddr:        getEnv("HTTP_ADDR", ":8080"),
+		ShutdownTimeout: getDuration("SHUTDOWN_TIMEOUT", 15*time.Second),
+		BootstrapAdmin:  getEnv("BOOTSTRAP_ADMIN", ""),
+
+		AppURL:           getEnv("APP_URL", "http://localhost:8080"),
+		PasswordResetTTL: getDuration("PASSWORD_RESET_TTL", time.Hour),
+
+		EmailVerification:    getEnv("EMAIL_VERIFICATION", "off"),
+		EmailVerificationTTL: getDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+
+		RegistrationMode:    getEnv("REGISTRATION_MODE", "open"),
+		AllowedEmailDomains: getList("ALLOWED_EMAIL_DOMAINS"),
+
+		MagicLinkEnabled:     getBool("MAGIC_LINK_ENABLED", false),
+		MagicLinkTTL:         getDuration("MAGIC_LINK_TTL", 15*time.Minute),
+		MagicLinkMaxRequests: getInt("MAGIC_LINK_MAX_REQUESTS", 3),
+		MagicLinkWindow:      getDuration("MAGIC_LINK_WINDOW", time.Hour),
+		MagicLinkAdmins:      getBool("MAGIC_LINK_ADMINS", false),
+
+		ImpersonationTTL: getDuration("IMPERSONATION_TTL", 15*time.Minute),
+
+		MFAIssuer:       getEnv("MFA_ISSUER", "Go Forum"),
+		MFAChallengeTTL: getDuration("MFA_CHALLENGE_TTL", 5*time.Minute),
+
+		JWTSigningKeyFiles:      getList("JWT_SIGNING_KEYS"),
+		JWTVerificationKeyFiles: getList("JWT_VERIFICATION_KEYS"),
+
+		OAuthIssuer:   getEnv("OAUTH_ISSUER", "http://localhost:8080"),
+		OAuthLoginURL: getEnv("OAUTH_LOGIN_URL", "http://localhost:8080/login"),
+		OAuthCodeTTL:  getDuration("OAUTH_CODE_TTL", time.Minute),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", "http://localhost:8080/api/v1/auth/oidc/callback"),
+		OIDCScopes:       strings.Fields(getEnv("OIDC_SCOPES", "openid profile email")),
+
+		LoginAttemptStore:       getEnv("LOGIN_ATTEMPT_STORE", "postgres"),
+		LoginFailureWindow:      getDuration("LOGIN_FAILURE_WINDOW", time.Hour),
+		LoginFreeAttempts:       getInt("LOGIN_FREE_ATTEMPTS", 3),
+		LoginBackoffBase:        getDuration("LOGIN_BACKOFF_BASE", time.Second),
+		LoginBackoffMax:         getDuration("LOGIN_BACKOFF_MAX", 5*time.Minute),
+		LoginLockoutThreshold:   getInt("LOGIN_LOCKOUT_THRESHOLD", 10),
+		LoginLockoutDuration:    getDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginIPFreeAttempts:     getInt("LOGIN_IP_FREE_ATTEMPTS", 20),
+		LoginIPLockoutThreshold: getInt("LOGIN_IP_LOCKOUT_THRESHOLD", 100),
+
+		PasswordHasher:        getEnv("PASSWORD_HASHER", "argon2id"),
+		Argon2Memory:          getInt("ARGON2_MEMORY", 64*1024),
+		Argon2Iterations:      getInt("ARGON2_ITERATIONS", 3),
+		Argon2Parallelism:     getInt("ARGON2_PARALLELISM", 4),
+		BcryptCost:            getInt("BCRYPT_COST", 10),
+		BreachedPasswordsFile: getEnv("BREACHED_PASSWORDS_FILE", ""),
+
+		AuditLogFile: getEnv("AUDIT_LOG_FILE", ""),
+
+		TokenSweepInterval:        getDuration("TOKEN_SWEEP_INTERVAL", time.Hour),
+		OneTimeTokenSweepInterval: getDuration("ONE_TIME_TOKEN_SWEEP_INTERVAL", 6*time.Hour),
+		LoginAttemptSweepInterval: getDuration("LOGIN_ATTEMPT_SWEEP_INTERVAL", 15*time.Minute),
+		JobJitter:                 getDuration("JOB_JITTER", time.Minute),
+		MetricsAddr:               getEnv("METRICS_ADDR", ""),
+
+		Mailer:       getEnv("MAILER", "log"),
+		MailFrom:     getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailFile:     getEnv("MAIL_FILE", "mail.log"),
+		SMTPHost:     getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:     getEnv("SMTP_PORT", "25"),
+		SMTPUsername: getEnv("SMTP_USERNAME", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
 	}
 	return config, nil
 }
@@ -41,3 +225,32 @@ func getDuration(key string, defaultValue time.Duration) time.Duration {
 	}
 	return defaultValue
 }
+
+func getInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
+
+func getBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return defaultValue
+}
+
+// getList reads a comma-separated list, ignoring empty entries.
+func getList(key string) []string {
+	var list []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
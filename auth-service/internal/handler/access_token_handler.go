@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAccessTokenRequest struct {
+	Name   string   `json:"name" binding:"required"`
+	Scopes []string `json:"scopes" binding:"required"`
+	// ExpiresInDays is optional; tokens without it never expire.
+	ExpiresInDays int `json:"expires_in_days" binding:"min=0"`
+}
+
+type AccessTokenResponse struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type CreateAccessTokenResponse struct {
+	AccessTokenResponse
+	// Token is only returned when the token is created.
+	Token string `json:"token"`
+}
+
+// CreateAccessToken godoc
+// @Summary Create personal access token
+// @Description Create a long-lived token for bots and scripts, limited to the given scopes (chat:read, chat:write, posts:read, posts:write, scim). The token is only shown once.
+// @Tags tokens
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body CreateAccessTokenRequest true "Token name, scopes and lifetime"
+// @Success 201 {object} CreateAccessTokenResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/tokens [post]
+func (h *AuthHandler) CreateAccessToken(c *gin.Context) {
+	var req CreateAccessTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	ttl := time.Duration(req.ExpiresInDays) * 24 * time.Hour
+	token, pat, err := h.authService.CreateAccessToken(c.Request.Context(), c.GetString(userIDKey), req.Name, req.Scopes, ttl)
+	if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidTokenName) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create token"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAccessTokenResponse{
+		AccessTokenResponse: toAccessTokenResponse(*pat),
+		Token:               token,
+	})
+}
+
+// ListAccessTokens godoc
+// @Summary List personal access tokens
+// @Description List the personal access tokens of the current user
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} AccessTokenResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/tokens [get]
+func (h *AuthHandler) ListAccessTokens(c *gin.Context) {
+	tokens, err := h.authService.ListAccessTokens(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list tokens"})
+		return
+	}
+
+	resp := make([]AccessTokenResponse, len(tokens))
+	for i, token := range tokens {
+		resp[i] = toAccessTokenResponse(token)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeAccessToken godoc
+// @Summary Revoke personal access token
+// @Description Delete one of the current user's personal access tokens
+// @Tags tokens
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Token ID"
+// @Success 200 {object} Response
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/tokens/{id} [delete]
+func (h *AuthHandler) RevokeAccessToken(c *gin.Context) {
+	err := h.authService.RevokeAccessToken(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "token not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to revoke token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "token revoked successfully"})
+}
+
+func toAccessTokenResponse(token repository.PersonalAccessToken) AccessTokenResponse {
+	return AccessTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     token.Scopes,
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AccountHandler struct {
+	accountService *service.AccountService
+}
+
+func NewAccountHandler(accountService *service.AccountService) *AccountHandler {
+	return &AccountHandler{
+		accountService: accountService,
+	}
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword godoc
+// @Summary Request password reset
+// @Description Send a password reset link to the given email address. The response is the same whether or not the address is registered.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body ForgotPasswordRequest true "Email address"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/forgot-password [post]
+func (h *AccountHandler) ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to send reset email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "if the email is registered, a reset link has been sent"})
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Set a new password using a reset token. All sessions of the user are logged out.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body ResetPasswordRequest true "Reset token and new password"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/reset-password [post]
+func (h *AccountHandler) ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.accountService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword)
+	if errors.Is(err, service.ErrInvalidResetToken) || isRejectedPassword(err) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "password reset successfully"})
+}
+
+// VerifyEmail godoc
+// @Summary Verify email address
+// @Description Confirm the user's email address using the token from the verification link
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body VerifyEmailRequest true "Verification token"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/verify-email [post]
+func (h *AccountHandler) VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.accountService.VerifyEmail(c.Request.Context(), req.Token)
+	if errors.Is(err, service.ErrInvalidVerificationToken) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary Resend verification email
+// @Description Send a new email verification link. The response is the same whether or not the address is registered or already verified.
+// @Tags account
+// @Accept json
+// @Produce json
+// @Param input body ResendVerificationRequest true "Email address"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Router /auth/resend-verification [post]
+func (h *AccountHandler) ResendVerification(c *gin.Context) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestEmailVerification(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "if the email is registered and unverified, a verification link has been sent"})
+}
+
+// isRejectedPassword reports whether a new password was refused by the
+// password policy.
+func isRejectedPassword(err error) bool {
+	return errors.Is(err, service.ErrWeakPassword) || errors.Is(err, service.ErrBreachedPassword)
+}
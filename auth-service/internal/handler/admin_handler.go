@@ -0,0 +1,665 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AdminHandler struct {
+	authService    *service.AuthService
+	accountService *service.AccountService
+}
+
+func NewAdminHandler(authService *service.AuthService, accountService *service.AccountService) *AdminHandler {
+	return &AdminHandler{
+		authService:    authService,
+		accountService: accountService,
+	}
+}
+
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+type UserRolesResponse struct {
+	UserID      string   `json:"user_id"`
+	Roles       []string `json:"roles"`
+	Permissions []string `json:"permissions"`
+}
+
+type AssignRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type ListUsersQuery struct {
+	// Query matches part of the username or email address.
+	Query     string `form:"q"`
+	Suspended bool   `form:"suspended"`
+	Pending   bool   `form:"pending"`
+	Limit     int    `form:"limit" binding:"min=0"`
+	Offset    int    `form:"offset" binding:"min=0"`
+}
+
+type AdminUserResponse struct {
+	ID               string     `json:"id"`
+	Username         string     `json:"username"`
+	Email            string     `json:"email"`
+	EmailVerified    bool       `json:"email_verified"`
+	CreatedAt        time.Time  `json:"created_at"`
+	SuspendedAt      *time.Time `json:"suspended_at,omitempty"`
+	SuspendedUntil   *time.Time `json:"suspended_until,omitempty"`
+	SuspensionReason string     `json:"suspension_reason,omitempty"`
+	InviteCodeID     string     `json:"invite_code_id,omitempty"`
+	PendingApproval  bool       `json:"pending_approval"`
+}
+
+type UserListResponse struct {
+	Users []AdminUserResponse `json:"users"`
+	Total int                 `json:"total"`
+}
+
+type UserDetailsResponse struct {
+	AdminUserResponse
+	Roles    []string          `json:"roles"`
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+type SuspendUserRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	// ExpiresAt ends the suspension; without it the user is banned until
+	// unsuspended.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type ImpersonationResponse struct {
+	// AccessToken acts as the user until ExpiresAt and cannot be refreshed.
+	AccessToken string    `json:"access_token"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+type CreateInviteRequest struct {
+	// Note says who or what the invite is for.
+	Note string `json:"note"`
+	// MaxUses defaults to a single use.
+	MaxUses int `json:"max_uses" binding:"min=0"`
+	// ExpiresAt is optional; invites without it do not expire.
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type InviteResponse struct {
+	ID        string     `json:"id"`
+	Note      string     `json:"note"`
+	MaxUses   int        `json:"max_uses"`
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type CreateInviteResponse struct {
+	InviteResponse
+	// Code is only returned when the invite is created.
+	Code string `json:"code"`
+}
+
+type ListAuditEventsQuery struct {
+	UserID string `form:"user_id"`
+	Type   string `form:"type"`
+	// Since and Until are RFC 3339 timestamps; Until is exclusive.
+	Since  *time.Time `form:"since" time_format:"2006-01-02T15:04:05Z07:00"`
+	Until  *time.Time `form:"until" time_format:"2006-01-02T15:04:05Z07:00"`
+	Limit  int        `form:"limit" binding:"min=0"`
+	Offset int        `form:"offset" binding:"min=0"`
+}
+
+type AuditEventResponse struct {
+	ID        string            `json:"id"`
+	UserID    string            `json:"user_id,omitempty"`
+	Type      string            `json:"type"`
+	Details   map[string]string `json:"details"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+type AuditEventListResponse struct {
+	Events []AuditEventResponse `json:"events"`
+	Total  int                  `json:"total"`
+}
+
+// ListRoles godoc
+// @Summary List roles
+// @Description List all roles with their permissions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} RoleResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/roles [get]
+func (h *AdminHandler) ListRoles(c *gin.Context) {
+	roles, err := h.authService.ListRoles(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list roles"})
+		return
+	}
+
+	resp := make([]RoleResponse, len(roles))
+	for i, role := range roles {
+		resp[i] = RoleResponse{
+			Name:        role.Name,
+			Description: role.Description,
+			Permissions: role.Permissions,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetUserRoles godoc
+// @Summary Get user roles
+// @Description Get the roles and effective permissions of a user
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} UserRolesResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/users/{id}/roles [get]
+func (h *AdminHandler) GetUserRoles(c *gin.Context) {
+	userID := c.Param("id")
+
+	roles, err := h.authService.GetUserRoles(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get roles"})
+		return
+	}
+
+	permissions, err := h.authService.GetUserPermissions(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get permissions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserRolesResponse{
+		UserID:      userID,
+		Roles:       roles,
+		Permissions: permissions,
+	})
+}
+
+// AssignRole godoc
+// @Summary Assign role
+// @Description Grant a role to a user
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param input body AssignRoleRequest true "Role"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/roles [post]
+func (h *AdminHandler) AssignRole(c *gin.Context) {
+	var req AssignRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.authService.AssignRole(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), req.Role)
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user or role not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to assign role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "role assigned successfully"})
+}
+
+// RevokeRole godoc
+// @Summary Revoke role
+// @Description Remove a role from a user
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param role path string true "Role name"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/roles/{role} [delete]
+func (h *AdminHandler) RevokeRole(c *gin.Context) {
+	err := h.authService.RevokeRole(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), c.Param("role"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "role assignment not found"})
+		return
+	}
+	if errors.Is(err, service.ErrRevokeOwnAdmin) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to revoke role"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "role revoked successfully"})
+}
+
+// ListUsers godoc
+// @Summary List users
+// @Description Search users by username or email, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param q query string false "Part of the username or email"
+// @Param suspended query bool false "Only currently suspended users"
+// @Param pending query bool false "Only users waiting for approval"
+// @Param limit query int false "Page size, at most 100" default(20)
+// @Param offset query int false "Number of users to skip"
+// @Success 200 {object} UserListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/users [get]
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	var query ListUsersQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	users, total, err := h.authService.ListUsers(c.Request.Context(), repository.UserFilter{
+		Query:         query.Query,
+		SuspendedOnly: query.Suspended,
+		PendingOnly:   query.Pending,
+		Limit:         query.Limit,
+		Offset:        query.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list users"})
+		return
+	}
+
+	resp := UserListResponse{Users: make([]AdminUserResponse, len(users)), Total: total}
+	for i := range users {
+		resp.Users[i] = toAdminUserResponse(&users[i])
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ListAuditEvents godoc
+// @Summary List audit events
+// @Description Search the authentication audit log, newest first
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param user_id query string false "Only events of this user"
+// @Param type query string false "Only events of this type"
+// @Param since query string false "Events at or after this RFC 3339 time"
+// @Param until query string false "Events before this RFC 3339 time"
+// @Param limit query int false "Page size, at most 1000" default(100)
+// @Param offset query int false "Number of events to skip"
+// @Success 200 {object} AuditEventListResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/audit-events [get]
+func (h *AdminHandler) ListAuditEvents(c *gin.Context) {
+	var query ListAuditEventsQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	events, total, err := h.authService.ListSecurityEvents(c.Request.Context(), repository.SecurityEventFilter{
+		UserID: query.UserID,
+		Type:   query.Type,
+		Since:  query.Since,
+		Until:  query.Until,
+		Limit:  query.Limit,
+		Offset: query.Offset,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list audit events"})
+		return
+	}
+
+	resp := AuditEventListResponse{Events: make([]AuditEventResponse, len(events)), Total: total}
+	for i, event := range events {
+		resp.Events[i] = AuditEventResponse{
+			ID:        event.ID,
+			UserID:    event.UserID,
+			Type:      event.Type,
+			Details:   event.Details,
+			IPAddress: event.IPAddress,
+			UserAgent: event.UserAgent,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// GetUser godoc
+// @Summary Get user
+// @Description Get a user with their roles and active sessions
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} UserDetailsResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id} [get]
+func (h *AdminHandler) GetUser(c *gin.Context) {
+	details, err := h.authService.GetUserDetails(c.Request.Context(), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, UserDetailsResponse{
+		AdminUserResponse: toAdminUserResponse(details.User),
+		Roles:             details.Roles,
+		Sessions:          toSessionResponses(details.Sessions, ""),
+	})
+}
+
+// SuspendUser godoc
+// @Summary Suspend user
+// @Description Suspend a user until expires_at, or ban them if it is omitted. The user is logged out of every session.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param input body SuspendUserRequest true "Reason and end of the suspension"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/suspension [post]
+func (h *AdminHandler) SuspendUser(c *gin.Context) {
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.authService.SuspendUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), req.Reason, req.ExpiresAt)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrSuspensionReason), errors.Is(err, service.ErrSuspensionExpired), errors.Is(err, service.ErrManageSelf):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to suspend user"})
+	default:
+		c.JSON(http.StatusOK, Response{Message: "user suspended successfully"})
+	}
+}
+
+// UnsuspendUser godoc
+// @Summary Unsuspend user
+// @Description Lift a suspension or ban
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/suspension [delete]
+func (h *AdminHandler) UnsuspendUser(c *gin.Context) {
+	err := h.authService.UnsuspendUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to unsuspend user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "user unsuspended successfully"})
+}
+
+// ApproveUser godoc
+// @Summary Approve user
+// @Description Approve an account registered while registration needs admin approval
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/approval [post]
+func (h *AdminHandler) ApproveUser(c *gin.Context) {
+	err := h.authService.ApproveUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "no user waiting for approval with this ID"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to approve user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "user approved successfully"})
+}
+
+// ImpersonateUser godoc
+// @Summary Impersonate user
+// @Description Get a short-lived access token that acts as the user, to see the forum as they do. The token names the admin in its act claim, has no refresh token and cannot be used for the account or admin endpoints. Admins cannot be impersonated.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} ImpersonationResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/impersonation [post]
+func (h *AdminHandler) ImpersonateUser(c *gin.Context) {
+	impersonation, err := h.authService.Impersonate(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if accountSuspended(c, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrImpersonateSelf), errors.Is(err, service.ErrImpersonateAdmin):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to impersonate user"})
+	default:
+		c.JSON(http.StatusOK, ImpersonationResponse{
+			AccessToken: impersonation.AccessToken,
+			ExpiresAt:   impersonation.ExpiresAt,
+		})
+	}
+}
+
+// ForcePasswordReset godoc
+// @Summary Force password reset
+// @Description Clear the user's password, log them out everywhere and email them a reset link
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id}/password-reset [post]
+func (h *AdminHandler) ForcePasswordReset(c *gin.Context) {
+	err := h.accountService.ForcePasswordReset(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "password reset successfully"})
+}
+
+// DeleteUser godoc
+// @Summary Delete user
+// @Description Delete a user with their sessions, roles and tokens. The forum deletes or anonymizes their content.
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/users/{id} [delete]
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	err := h.authService.DeleteUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrManageSelf):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to delete user"})
+	default:
+		c.JSON(http.StatusOK, Response{Message: "user deleted successfully"})
+	}
+}
+
+// CreateInvite godoc
+// @Summary Create invite code
+// @Description Create an invite code for registration. The code is only shown in this response.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body CreateInviteRequest true "Invite settings"
+// @Success 201 {object} CreateInviteResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/invites [post]
+func (h *AdminHandler) CreateInvite(c *gin.Context) {
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+
+	code, invite, err := h.authService.CreateInvite(c.Request.Context(), c.GetString(userIDKey), req.Note, req.MaxUses, req.ExpiresAt)
+	if errors.Is(err, service.ErrInvalidInvite) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to create invite"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateInviteResponse{
+		InviteResponse: toInviteResponse(invite),
+		Code:           code,
+	})
+}
+
+// ListInvites godoc
+// @Summary List invite codes
+// @Description List invite codes with how often each has been used
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} InviteResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/invites [get]
+func (h *AdminHandler) ListInvites(c *gin.Context) {
+	invites, err := h.authService.ListInvites(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list invites"})
+		return
+	}
+
+	resp := make([]InviteResponse, len(invites))
+	for i := range invites {
+		resp[i] = toInviteResponse(&invites[i])
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteInvite godoc
+// @Summary Delete invite code
+// @Description Delete an invite code so that it can no longer be used
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Invite ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/invites/{id} [delete]
+func (h *AdminHandler) DeleteInvite(c *gin.Context) {
+	err := h.authService.DeleteInvite(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "invite not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to delete invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "invite deleted successfully"})
+}
+
+func toInviteResponse(invite *repository.InviteCode) InviteResponse {
+	return InviteResponse{
+		ID:        invite.ID,
+		Note:      invite.Note,
+		MaxUses:   invite.MaxUses,
+		Uses:      invite.Uses,
+		ExpiresAt: invite.ExpiresAt,
+		CreatedBy: invite.CreatedBy,
+		CreatedAt: invite.CreatedAt,
+	}
+}
+
+func toAdminUserResponse(user *repository.User) AdminUserResponse {
+	return AdminUserResponse{
+		ID:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		CreatedAt:        user.CreatedAt,
+		SuspendedAt:      user.SuspendedAt,
+		SuspendedUntil:   user.SuspendedUntil,
+		SuspensionReason: user.SuspensionReason,
+		InviteCodeID:     user.InviteCodeID,
+		PendingApproval:  user.PendingApproval,
+	}
+}
@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"errors"
+	"math"
 	"net/http"
-	"strings"
+	"strconv"
 
 	"auth-service/internal/service"
 
@@ -10,12 +12,14 @@ import (
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
+	authService    *service.AuthService
+	accountService *service.AccountService
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
+func NewAuthHandler(authService *service.AuthService, accountService *service.AccountService) *AuthHandler {
 	return &AuthHandler{
-		authService: authService,
+		authService:    authService,
+		accountService: accountService,
 	}
 }
 
@@ -23,6 +27,8 @@ type RegisterRequest struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
+	// InviteCode is required when registration is invite-only.
+	InviteCode string `json:"invite_code"`
 }
 
 type LoginRequest struct {
@@ -40,9 +46,23 @@ type LoginResponse struct {
 }
 
 type ValidateResponse struct {
-	UserID   string `json:"user_id"`
-	Username string `json:"username"`
-	IsValid  bool   `json:"is_valid"`
+	UserID        string   `json:"user_id"`
+	Username      string   `json:"username"`
+	Roles         []string `json:"roles"`
+	EmailVerified bool     `json:"email_verified"`
+	// CanWrite is false when the user must verify their email before posting.
+	CanWrite bool `json:"can_write"`
+	IsValid  bool `json:"is_valid"`
+	// Scopes is set for personal access tokens and OAuth client tokens only.
+	Scopes []string `json:"scopes,omitempty"`
+	// PendingApproval is set while the account waits for admin approval.
+	PendingApproval bool `json:"pending_approval,omitempty"`
+	// Actor names the admin acting as the user with an impersonation token.
+	Actor *service.Actor `json:"act,omitempty"`
+	// ServiceAccount is set for client credentials tokens of service
+	// accounts, which have no user; ClientID names the account.
+	ServiceAccount bool   `json:"service_account,omitempty"`
+	ClientID       string `json:"client_id,omitempty"`
 }
 
 type Response struct {
@@ -53,15 +73,24 @@ type ErrorResponse struct {
 	Error string `json:"error"`
 }
 
+// RateLimitResponse is returned with 429 Too Many Requests. RetryAfter is in
+// seconds and matches the Retry-After header.
+type RateLimitResponse struct {
+	Error      string `json:"error"`
+	RetryAfter int    `json:"retry_after"`
+}
+
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with username, email and password
+// @Description Register a new user with username, email and password. The password needs at least 8 characters with upper and lower case letters, a digit and a symbol, and must not be on the breached password list. A verification link is sent to the email address. Depending on the registration mode an invite code or an allowed email domain is required, or the account waits for admin approval.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param input body RegisterRequest true "Registration details"
 // @Success 200 {object} Response
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 500 {object} ErrorResponse
 // @Router /auth/register [post]
 func (h *AuthHandler) Register(c *gin.Context) {
 	var req RegisterRequest
@@ -70,24 +99,36 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	err := h.authService.Register(c.Request.Context(), req.Username, req.Email, req.Password)
+	err := h.authService.Register(c.Request.Context(), req.Username, req.Email, req.Password, req.InviteCode)
+	if errors.Is(err, service.ErrInviteRequired) || errors.Is(err, service.ErrEmailDomainNotAllowed) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
 	}
 
+	if err := h.accountService.RequestEmailVerification(c.Request.Context(), req.Email); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "user registered but the verification email could not be sent"})
+		return
+	}
+
 	c.JSON(http.StatusOK, Response{Message: "user registered successfully"})
 }
 
 // Login godoc
 // @Summary Login user
-// @Description Login with username and password to get JWT tokens
+// @Description Login with username and password to get JWT tokens. Accounts with two-factor authentication get an mfa_required challenge instead, to be completed with /auth/mfa/verify.
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Param input body LoginRequest true "Login credentials"
 // @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 429 {object} RateLimitResponse
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var req LoginRequest
@@ -97,6 +138,21 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	tokens, err := h.authService.Login(c.Request.Context(), req.Username, req.Password)
+	if rateLimited(c, err) || accountSuspended(c, err) {
+		return
+	}
+	var mfaErr *service.MFARequiredError
+	if errors.As(err, &mfaErr) {
+		c.JSON(http.StatusAccepted, MFAChallengeResponse{
+			Status:   mfaErr.Error(),
+			MFAToken: mfaErr.ChallengeToken,
+		})
+		return
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
@@ -117,6 +173,8 @@ func (h *AuthHandler) Login(c *gin.Context) {
 // @Param input body RefreshRequest true "Refresh token"
 // @Success 200 {object} LoginResponse
 // @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /auth/refresh [post]
 func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	var req RefreshRequest
@@ -126,6 +184,13 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	tokens, err := h.authService.RefreshTokens(c.Request.Context(), req.RefreshToken)
+	if accountSuspended(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrRefreshTokenReuse) {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
 		return
@@ -165,42 +230,92 @@ func (h *AuthHandler) Logout(c *gin.Context) {
 
 // ValidateToken godoc
 // @Summary Validate token
-// @Description Validate JWT token and return user information
+// @Description Validate a JWT or personal access token and return user information
 // @Tags auth
 // @Accept json
 // @Produce json
 // @Security BearerAuth
 // @Success 200 {object} ValidateResponse
 // @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
 // @Router /auth/validate [get]
 func (h *AuthHandler) ValidateToken(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "authorization header is required"})
+	token, ok := bearerToken(c)
+	if !ok {
 		return
 	}
 
-	parts := strings.Split(authHeader, " ")
-	if len(parts) != 2 || parts[0] != "Bearer" {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid authorization header format"})
+	claims, user, err := h.authService.ValidateToken(c.Request.Context(), token)
+	if accountSuspended(c, err) {
 		return
 	}
-
-	userID, err := h.authService.ValidateToken(c.Request.Context(), parts[1])
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "invalid token"})
 		return
 	}
 
-	user, err := h.authService.GetUserByID(c.Request.Context(), userID)
-	if err != nil {
-		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "user not found"})
+	if user == nil {
+		c.JSON(http.StatusOK, ValidateResponse{
+			Username:       claims.Username,
+			CanWrite:       claims.CanWrite,
+			IsValid:        true,
+			Scopes:         claims.Scopes,
+			ServiceAccount: true,
+			ClientID:       claims.ClientID,
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, ValidateResponse{
-		UserID:   user.ID,
-		Username: user.Username,
-		IsValid:  true,
+		UserID:          user.ID,
+		Username:        user.Username,
+		Roles:           claims.Roles,
+		EmailVerified:   user.EmailVerifiedAt != nil,
+		CanWrite:        h.authService.CanWrite(user),
+		IsValid:         true,
+		Scopes:          claims.Scopes,
+		PendingApproval: user.PendingApproval,
+		Actor:           claims.Actor,
+	})
+}
+
+// JWKS godoc
+// @Summary JSON Web Key Set
+// @Description Public keys for verifying access tokens locally. Tokens name their key in the kid header.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} signing.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	// Keys change rarely, but verifiers must see a new key before it is used
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.authService.JWKS())
+}
+
+// rateLimited writes a 429 response if err is a RateLimitError.
+func rateLimited(c *gin.Context, err error) bool {
+	var rateErr *service.RateLimitError
+	if !errors.As(err, &rateErr) {
+		return false
+	}
+
+	seconds := int(math.Ceil(rateErr.RetryAfter.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, RateLimitResponse{
+		Error:      rateErr.Error(),
+		RetryAfter: seconds,
 	})
+	return true
+}
+
+// accountSuspended writes a 403 response and returns true if err says the
+// account is suspended.
+func accountSuspended(c *gin.Context, err error) bool {
+	var suspendedErr *service.AccountSuspendedError
+	if !errors.As(err, &suspendedErr) {
+		return false
+	}
+
+	c.JSON(http.StatusForbidden, ErrorResponse{Error: suspendedErr.Error()})
+	return true
 }
@@ -0,0 +1,211 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// externalLoginCookie holds the state of an external login between the
+	// redirect to the provider and the callback.
+	externalLoginCookie     = "oidc_flow"
+	externalLoginCookiePath = "/api/v1/auth/oidc"
+)
+
+type ExternalLoginHandler struct {
+	externalLoginService *service.ExternalLoginService
+	secureCookie         bool
+}
+
+// NewExternalLoginHandler creates the handler. secureCookie should be set when
+// the callback is served over HTTPS.
+func NewExternalLoginHandler(externalLoginService *service.ExternalLoginService, secureCookie bool) *ExternalLoginHandler {
+	return &ExternalLoginHandler{
+		externalLoginService: externalLoginService,
+		secureCookie:         secureCookie,
+	}
+}
+
+type LinkIdentityResponse struct {
+	// AuthorizationURL is the provider URL to send the browser to.
+	AuthorizationURL string `json:"authorization_url"`
+}
+
+type ExternalIdentityResponse struct {
+	ID          string     `json:"id"`
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email,omitempty"`
+	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Login godoc
+// @Summary Log in with the external provider
+// @Description Redirect to the configured OpenID provider. New users are registered on their first login.
+// @Tags oidc
+// @Success 302
+// @Failure 500 {object} ErrorResponse
+// @Router /auth/oidc/login [get]
+func (h *ExternalLoginHandler) Login(c *gin.Context) {
+	authURL, flowToken, err := h.externalLoginService.Start(c.Request.Context(), "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to start login"})
+		return
+	}
+
+	h.setFlowCookie(c, flowToken)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+// Link godoc
+// @Summary Link an external identity
+// @Description Start linking an identity at the configured OpenID provider to the current user. Send the browser to the returned URL; the flow finishes at the callback.
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} LinkIdentityResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/oidc/link [post]
+func (h *ExternalLoginHandler) Link(c *gin.Context) {
+	authURL, flowToken, err := h.externalLoginService.Start(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to start linking"})
+		return
+	}
+
+	h.setFlowCookie(c, flowToken)
+	c.JSON(http.StatusOK, LinkIdentityResponse{AuthorizationURL: authURL})
+}
+
+// Callback godoc
+// @Summary External login callback
+// @Description The OpenID provider redirects here after the user logged in. Returns tokens for a login, or a message when an identity was linked.
+// @Tags oidc
+// @Produce json
+// @Param state query string true "State"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/oidc/callback [get]
+func (h *ExternalLoginHandler) Callback(c *gin.Context) {
+	if providerErr := c.Query("error"); providerErr != "" {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "login failed at the identity provider: " + providerErr})
+		return
+	}
+
+	flowToken, _ := c.Cookie(externalLoginCookie)
+	h.setFlowCookie(c, "")
+
+	result, err := h.externalLoginService.Complete(c.Request.Context(), flowToken, c.Query("state"), c.Query("code"))
+	if accountSuspended(c, err) {
+		return
+	}
+	var mfaErr *service.MFARequiredError
+	switch {
+	case errors.As(err, &mfaErr):
+		c.JSON(http.StatusAccepted, MFAChallengeResponse{
+			Status:   mfaErr.Error(),
+			MFAToken: mfaErr.ChallengeToken,
+		})
+		return
+	case errors.Is(err, service.ErrEmailNotVerified):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, service.ErrExternalAccountExists), errors.Is(err, service.ErrIdentityAlreadyLinked):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	if result.Identity != nil {
+		c.JSON(http.StatusOK, Response{Message: "identity linked successfully"})
+		return
+	}
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  result.Tokens.AccessToken,
+		RefreshToken: result.Tokens.RefreshToken,
+	})
+}
+
+// ListIdentities godoc
+// @Summary List external identities
+// @Description List the external identities linked to the current user
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} ExternalIdentityResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/identities [get]
+func (h *ExternalLoginHandler) ListIdentities(c *gin.Context) {
+	identities, err := h.externalLoginService.ListIdentities(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list identities"})
+		return
+	}
+
+	response := make([]ExternalIdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		response = append(response, ExternalIdentityResponse{
+			ID:          identity.ID,
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: identity.LastLoginAt,
+			CreatedAt:   identity.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UnlinkIdentity godoc
+// @Summary Unlink external identity
+// @Description Remove an external identity from the current user. The last identity of an account without a password cannot be removed.
+// @Tags oidc
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Identity ID"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/identities/{id} [delete]
+func (h *ExternalLoginHandler) UnlinkIdentity(c *gin.Context) {
+	err := h.externalLoginService.UnlinkIdentity(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "identity not found"})
+		return
+	}
+	if errors.Is(err, service.ErrLastLoginMethod) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to unlink identity"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "identity unlinked successfully"})
+}
+
+// setFlowCookie stores the flow token, or clears the cookie if it is empty.
+// Lax is needed for the cookie to be sent on the provider's redirect back.
+func (h *ExternalLoginHandler) setFlowCookie(c *gin.Context, flowToken string) {
+	maxAge := int((10 * time.Minute).Seconds())
+	if flowToken == "" {
+		maxAge = -1
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(externalLoginCookie, flowToken, maxAge, externalLoginCookiePath, "", h.secureCookie, true)
+}
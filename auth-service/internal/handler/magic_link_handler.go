@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type MagicLinkHandler struct {
+	magicLinkService *service.MagicLinkService
+}
+
+func NewMagicLinkHandler(magicLinkService *service.MagicLinkService) *MagicLinkHandler {
+	return &MagicLinkHandler{
+		magicLinkService: magicLinkService,
+	}
+}
+
+type MagicLinkRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type MagicLinkLoginRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// RequestLink godoc
+// @Summary Request a login link
+// @Description Send a single-use login link to the given email address. The response is the same whether or not the address is registered. Admin accounts cannot log in with a link unless MAGIC_LINK_ADMINS is set.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body MagicLinkRequest true "Email address"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Failure 429 {object} RateLimitResponse
+// @Router /auth/magic-link [post]
+func (h *MagicLinkHandler) RequestLink(c *gin.Context) {
+	var req MagicLinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.magicLinkService.RequestLink(c.Request.Context(), req.Email)
+	if rateLimited(c, err) {
+		return
+	}
+	if errors.Is(err, service.ErrMagicLinkDisabled) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to send login link"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "if the email is registered, a login link has been sent"})
+}
+
+// Login godoc
+// @Summary Log in with a login link
+// @Description Exchange the token from a login link for JWT tokens. The link works once, and also verifies the email address. Users with two-factor authentication get an MFA challenge instead.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param input body MagicLinkLoginRequest true "Token from the link"
+// @Success 200 {object} LoginResponse
+// @Success 202 {object} MFAChallengeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/magic-link/login [post]
+func (h *MagicLinkHandler) Login(c *gin.Context) {
+	var req MagicLinkLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	tokens, err := h.magicLinkService.Login(c.Request.Context(), req.Token)
+	if accountSuspended(c, err) {
+		return
+	}
+	var mfaErr *service.MFARequiredError
+	switch {
+	case errors.As(err, &mfaErr):
+		c.JSON(http.StatusAccepted, MFAChallengeResponse{
+			Status:   mfaErr.Error(),
+			MFAToken: mfaErr.ChallengeToken,
+		})
+		return
+	case errors.Is(err, service.ErrMagicLinkDisabled):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+		return
+	case errors.Is(err, service.ErrInvalidMagicLink):
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to log in"})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	})
+}
@@ -0,0 +1,509 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type OAuthHandler struct {
+	oauthService *service.OAuthService
+}
+
+func NewOAuthHandler(oauthService *service.OAuthService) *OAuthHandler {
+	return &OAuthHandler{
+		oauthService: oauthService,
+	}
+}
+
+// AuthorizeParams are the parameters of an authorization request, sent as
+// the query of /oauth/authorize and passed on as JSON by the login page.
+type AuthorizeParams struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id" binding:"required"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri" binding:"required"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	Nonce               string `form:"nonce" json:"nonce"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+type AuthorizeResponse struct {
+	// RedirectURI carries either the authorization code or an OAuth error.
+	RedirectURI string `json:"redirect_uri"`
+}
+
+// TokenResponse is the token endpoint response from RFC 6749 section 5.1.
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+}
+
+// IntrospectionResponse is the introspection response from RFC 7662
+// section 2.2.
+type IntrospectionResponse struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Username  string `json:"username,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+}
+
+// OAuthErrorResponse is the error format of RFC 6749 section 5.2.
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name" binding:"required"`
+	RedirectURIs []string `json:"redirect_uris"`
+	GrantTypes   []string `json:"grant_types" binding:"required"`
+	Scopes       []string `json:"scopes" binding:"required"`
+	Public       bool     `json:"public"`
+	// ServiceAccount registers a machine identity for an internal service.
+	// It needs grant_types ["client_credentials"].
+	ServiceAccount bool `json:"service_account"`
+}
+
+type OAuthClientResponse struct {
+	ID             string    `json:"id"`
+	Name           string    `json:"name"`
+	RedirectURIs   []string  `json:"redirect_uris"`
+	GrantTypes     []string  `json:"grant_types"`
+	Scopes         []string  `json:"scopes"`
+	Public         bool      `json:"public"`
+	ServiceAccount bool      `json:"service_account"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type CreateOAuthClientResponse struct {
+	OAuthClientResponse
+	// ClientSecret is only returned when a confidential client is created.
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+// Discovery godoc
+// @Summary OpenID Connect discovery
+// @Description OpenID Provider metadata for clients of the built-in OAuth2 / OpenID Connect provider
+// @Tags oauth
+// @Produce json
+// @Success 200 {object} service.Discovery
+// @Router /.well-known/openid-configuration [get]
+func (h *OAuthHandler) Discovery(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, h.oauthService.Discovery())
+}
+
+// Authorize godoc
+// @Summary Authorization endpoint
+// @Description Start an authorization code flow. Valid requests are redirected to the login page with the same query; errors are redirected back to the client, except for an unknown client or redirect_uri.
+// @Tags oauth
+// @Param response_type query string true "Must be code"
+// @Param client_id query string true "Client ID"
+// @Param redirect_uri query string true "Registered redirect URI"
+// @Param scope query string false "Space-separated scopes"
+// @Param state query string false "Opaque value returned to the client"
+// @Param nonce query string false "Copied into the ID token"
+// @Param code_challenge query string false "PKCE S256 challenge, required for public clients"
+// @Param code_challenge_method query string false "Must be S256"
+// @Success 302
+// @Failure 400 {object} ErrorResponse
+// @Router /oauth/authorize [get]
+func (h *OAuthHandler) Authorize(c *gin.Context) {
+	var params AuthorizeParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	req := toAuthorizeRequest(params)
+	err := h.oauthService.CheckAuthorizeRequest(c.Request.Context(), req)
+	if errors.Is(err, service.ErrInvalidRedirectURI) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.Redirect(http.StatusFound, service.ErrorRedirectURI(req, oauthErr))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to check authorization request"})
+		return
+	}
+
+	c.Redirect(http.StatusFound, h.oauthService.LoginURL(c.Request.URL.Query()))
+}
+
+// ApproveAuthorization godoc
+// @Summary Approve authorization request
+// @Description Called by the login page once the user has logged in. Issues an authorization code for the current user and returns the client URI to redirect the browser to.
+// @Tags oauth
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body AuthorizeParams true "Parameters of the authorization request"
+// @Success 200 {object} AuthorizeResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /oauth/authorize [post]
+func (h *OAuthHandler) ApproveAuthorization(c *gin.Context) {
+	var params AuthorizeParams
+	if err := c.ShouldBindJSON(&params); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	req := toAuthorizeRequest(params)
+	redirectURI, err := h.oauthService.Authorize(c.Request.Context(), c.GetString(userIDKey), req)
+	if errors.Is(err, service.ErrInvalidRedirectURI) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		c.JSON(http.StatusOK, AuthorizeResponse{RedirectURI: service.ErrorRedirectURI(req, oauthErr)})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to authorize client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, AuthorizeResponse{RedirectURI: redirectURI})
+}
+
+// Token godoc
+// @Summary Token endpoint
+// @Description Exchange an authorization code, client credentials or a refresh token for tokens. Confidential clients authenticate with HTTP Basic or client_id and client_secret form fields; public clients send only client_id.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "authorization_code, client_credentials or refresh_token"
+// @Param code formData string false "Authorization code"
+// @Param redirect_uri formData string false "Redirect URI the code was issued for"
+// @Param code_verifier formData string false "PKCE verifier"
+// @Param refresh_token formData string false "Refresh token"
+// @Param scope formData string false "Space-separated scopes for client_credentials"
+// @Success 200 {object} TokenResponse
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
+// @Router /oauth/token [post]
+func (h *OAuthHandler) Token(c *gin.Context) {
+	// Token responses must never be cached (RFC 6749 section 5.1)
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	req := service.TokenRequest{
+		GrantType:    c.PostForm("grant_type"),
+		Code:         c.PostForm("code"),
+		RedirectURI:  c.PostForm("redirect_uri"),
+		CodeVerifier: c.PostForm("code_verifier"),
+		RefreshToken: c.PostForm("refresh_token"),
+		Scope:        c.PostForm("scope"),
+	}
+
+	var basic, ok bool
+	req.ClientID, req.ClientSecret, basic, ok = clientCredentials(c)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.oauthService.Token(c.Request.Context(), req)
+	if err != nil {
+		clientError(c, err, basic)
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{
+		AccessToken:  tokens.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    tokens.ExpiresIn,
+		RefreshToken: tokens.RefreshToken,
+		IDToken:      tokens.IDToken,
+		Scope:        strings.Join(tokens.Scopes, " "),
+	})
+}
+
+// Introspect godoc
+// @Summary Token introspection
+// @Description Describe an access token, personal access token or refresh token (RFC 7662). Only confidential clients may call this endpoint. Invalid, expired and revoked tokens return only active=false.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to describe"
+// @Param token_type_hint formData string false "access_token or refresh_token; not needed, as the type is recognized from the token"
+// @Success 200 {object} IntrospectionResponse
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
+// @Router /oauth/introspect [post]
+func (h *OAuthHandler) Introspect(c *gin.Context) {
+	clientID, secret, basic, ok := clientCredentials(c)
+	if !ok {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, OAuthErrorResponse{Error: service.OAuthInvalidRequest, ErrorDescription: "token is required"})
+		return
+	}
+
+	introspection, err := h.oauthService.Introspect(c.Request.Context(), clientID, secret, token)
+	if err != nil {
+		clientError(c, err, basic)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	response := IntrospectionResponse{
+		Active:    introspection.Active,
+		Scope:     strings.Join(introspection.Scopes, " "),
+		ClientID:  introspection.ClientID,
+		Username:  introspection.Username,
+		TokenType: introspection.TokenType,
+		Subject:   introspection.Subject,
+	}
+	if introspection.ExpiresAt != nil {
+		response.ExpiresAt = introspection.ExpiresAt.Unix()
+	}
+	if introspection.IssuedAt != nil {
+		response.IssuedAt = introspection.IssuedAt.Unix()
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// Revoke godoc
+// @Summary Token revocation
+// @Description Revoke an access token, personal access token or refresh token (RFC 7009). Clients authenticate as at the token endpoint and may only revoke their own tokens; without client credentials only tokens from first-party logins can be revoked. Revoking a refresh token ends its session. Unknown tokens are ignored.
+// @Tags oauth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "Token to revoke"
+// @Param token_type_hint formData string false "access_token or refresh_token; not needed, as the type is recognized from the token"
+// @Success 200
+// @Failure 400 {object} OAuthErrorResponse
+// @Failure 401 {object} OAuthErrorResponse
+// @Router /oauth/revoke [post]
+func (h *OAuthHandler) Revoke(c *gin.Context) {
+	clientID, secret, basic, ok := clientCredentials(c)
+	if !ok {
+		return
+	}
+	token := c.PostForm("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, OAuthErrorResponse{Error: service.OAuthInvalidRequest, ErrorDescription: "token is required"})
+		return
+	}
+
+	if err := h.oauthService.Revoke(c.Request.Context(), clientID, secret, token); err != nil {
+		clientError(c, err, basic)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// UserInfo godoc
+// @Summary OpenID Connect userinfo
+// @Description Return the claims about the user released by the access token's scopes. The token must have been granted the openid scope.
+// @Tags oauth
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} service.UserInfo
+// @Failure 401 {object} OAuthErrorResponse
+// @Failure 403 {object} OAuthErrorResponse
+// @Router /oauth/userinfo [get]
+func (h *OAuthHandler) UserInfo(c *gin.Context) {
+	token, ok := bearerToken(c)
+	if !ok {
+		return
+	}
+
+	info, err := h.oauthService.UserInfo(c.Request.Context(), token)
+	var oauthErr *service.OAuthError
+	if errors.As(err, &oauthErr) {
+		status := http.StatusUnauthorized
+		if oauthErr.Code == service.OAuthInsufficientScope {
+			status = http.StatusForbidden
+		}
+		c.Header("WWW-Authenticate", `Bearer error="`+oauthErr.Code+`"`)
+		c.JSON(status, OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, info)
+}
+
+// CreateClient godoc
+// @Summary Register OAuth client
+// @Description Register an application that signs users in through this service. Public clients get no secret and must use PKCE; the secret of a confidential client is only shown once. Service accounts are machine identities for internal services: they only use the client_credentials grant and their tokens act as the service account in the forum's gRPC API.
+// @Tags admin
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body CreateOAuthClientRequest true "Client settings"
+// @Success 201 {object} CreateOAuthClientResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/oauth/clients [post]
+func (h *OAuthHandler) CreateClient(c *gin.Context) {
+	var req CreateOAuthClientRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	client, secret, err := h.oauthService.RegisterClient(c.Request.Context(), c.GetString(userIDKey), service.NewOAuthClient{
+		Name:           req.Name,
+		RedirectURIs:   req.RedirectURIs,
+		GrantTypes:     req.GrantTypes,
+		Scopes:         req.Scopes,
+		Public:         req.Public,
+		ServiceAccount: req.ServiceAccount,
+	})
+	if errors.Is(err, service.ErrInvalidClientName) || errors.Is(err, service.ErrInvalidGrantTypes) ||
+		errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidClientURIs) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to register client"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateOAuthClientResponse{
+		OAuthClientResponse: toOAuthClientResponse(*client),
+		ClientSecret:        secret,
+	})
+}
+
+// ListClients godoc
+// @Summary List OAuth clients
+// @Description List the registered OAuth clients
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} OAuthClientResponse
+// @Failure 403 {object} ErrorResponse
+// @Router /admin/oauth/clients [get]
+func (h *OAuthHandler) ListClients(c *gin.Context) {
+	clients, err := h.oauthService.ListClients(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list clients"})
+		return
+	}
+
+	resp := make([]OAuthClientResponse, len(clients))
+	for i, client := range clients {
+		resp[i] = toOAuthClientResponse(client)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// DeleteClient godoc
+// @Summary Delete OAuth client
+// @Description Remove an OAuth client and revoke every token issued to it
+// @Tags admin
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Client ID"
+// @Success 200 {object} Response
+// @Failure 403 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /admin/oauth/clients/{id} [delete]
+func (h *OAuthHandler) DeleteClient(c *gin.Context) {
+	err := h.oauthService.DeleteClient(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "client not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to delete client"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "client deleted successfully"})
+}
+
+// clientCredentials reads the client's credentials from the Basic header or
+// the client_id and client_secret form fields. It writes an error response
+// and returns ok false when the header is malformed.
+func clientCredentials(c *gin.Context) (clientID, secret string, basic, ok bool) {
+	username, password, basic := c.Request.BasicAuth()
+	if !basic {
+		return c.PostForm("client_id"), c.PostForm("client_secret"), false, true
+	}
+
+	// Credentials in the Basic header are form-encoded (RFC 6749 section 2.3.1)
+	clientID, err1 := url.QueryUnescape(username)
+	secret, err2 := url.QueryUnescape(password)
+	if err1 != nil || err2 != nil {
+		c.JSON(http.StatusBadRequest, OAuthErrorResponse{Error: service.OAuthInvalidRequest, ErrorDescription: "malformed client credentials"})
+		return "", "", true, false
+	}
+	return clientID, secret, true, true
+}
+
+// clientError writes err in the format of RFC 6749 section 5.2.
+func clientError(c *gin.Context, err error, basic bool) {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		c.JSON(http.StatusInternalServerError, OAuthErrorResponse{Error: "server_error"})
+		return
+	}
+
+	status := http.StatusBadRequest
+	if oauthErr.Code == service.OAuthInvalidClient {
+		status = http.StatusUnauthorized
+		if basic {
+			c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+	}
+	c.JSON(status, OAuthErrorResponse{Error: oauthErr.Code, ErrorDescription: oauthErr.Description})
+}
+
+func toAuthorizeRequest(params AuthorizeParams) service.AuthorizeRequest {
+	return service.AuthorizeRequest{
+		ResponseType:        params.ResponseType,
+		ClientID:            params.ClientID,
+		RedirectURI:         params.RedirectURI,
+		Scope:               params.Scope,
+		State:               params.State,
+		Nonce:               params.Nonce,
+		CodeChallenge:       params.CodeChallenge,
+		CodeChallengeMethod: params.CodeChallengeMethod,
+	}
+}
+
+func toOAuthClientResponse(client repository.OAuthClient) OAuthClientResponse {
+	return OAuthClientResponse{
+		ID:             client.ID,
+		Name:           client.Name,
+		RedirectURIs:   client.RedirectURIs,
+		GrantTypes:     client.GrantTypes,
+		Scopes:         client.Scopes,
+		Public:         client.SecretHash == "",
+		ServiceAccount: client.ServiceAccount,
+		CreatedAt:      client.CreatedAt,
+	}
+}
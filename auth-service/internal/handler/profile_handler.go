@@ -0,0 +1,361 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ProfileHandler struct {
+	profileService *service.ProfileService
+}
+
+func NewProfileHandler(profileService *service.ProfileService) *ProfileHandler {
+	return &ProfileHandler{
+		profileService: profileService,
+	}
+}
+
+type ProfileResponse struct {
+	ID            string `json:"id"`
+	Username      string `json:"username"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	// PendingEmail is the address waiting for confirmation, if any.
+	PendingEmail string    `json:"pending_email,omitempty"`
+	DisplayName  string    `json:"display_name"`
+	Bio          string    `json:"bio"`
+	AvatarURL    string    `json:"avatar_url"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// UpdateProfileRequest changes only the fields that are present; an empty
+// string clears a field.
+type UpdateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeUsernameRequest struct {
+	Username string `json:"username" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+type DeleteAccountRequest struct {
+	// Password is required for accounts that have one.
+	Password string `json:"password"`
+}
+
+type UsernameChangeResponse struct {
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+// GetProfile godoc
+// @Summary Get own profile
+// @Description Get the profile of the authenticated user
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} ProfileResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me [get]
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	user, err := h.profileService.GetProfile(c.Request.Context(), c.GetString(userIDKey))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get profile"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toProfileResponse(user))
+}
+
+// UpdateProfile godoc
+// @Summary Update own profile
+// @Description Change the display name, bio or avatar URL. Omitted fields are left unchanged.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body UpdateProfileRequest true "Profile fields"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me [patch]
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := h.profileService.UpdateProfile(c.Request.Context(), c.GetString(userIDKey), service.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		AvatarURL:   req.AvatarURL,
+	})
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrInvalidDisplayName), errors.Is(err, service.ErrInvalidBio), errors.Is(err, service.ErrInvalidAvatarURL):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to update profile"})
+	default:
+		c.JSON(http.StatusOK, toProfileResponse(user))
+	}
+}
+
+// ChangePassword godoc
+// @Summary Change password
+// @Description Set a new password after confirming the current one. Every other session is logged out.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body ChangePasswordRequest true "Current and new password"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me/password [put]
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.profileService.ChangePassword(c.Request.Context(), c.GetString(userIDKey), currentClaims(c).SessionID, req.CurrentPassword, req.NewPassword)
+	if errors.Is(err, service.ErrWrongPassword) || isRejectedPassword(err) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to change password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "password changed successfully"})
+}
+
+// ChangeUsername godoc
+// @Summary Change username
+// @Description Rename the authenticated user. Usernames given up by other users cannot be taken.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body ChangeUsernameRequest true "New username"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /users/me/username [put]
+func (h *ProfileHandler) ChangeUsername(c *gin.Context) {
+	var req ChangeUsernameRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	user, err := h.profileService.ChangeUsername(c.Request.Context(), c.GetString(userIDKey), req.Username)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrInvalidUsername):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrUsernameTaken):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to change username"})
+	default:
+		c.JSON(http.StatusOK, toProfileResponse(user))
+	}
+}
+
+// ChangeEmail godoc
+// @Summary Change email address
+// @Description Send a confirmation link to the new address. The email address changes once the link is opened.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body ChangeEmailRequest true "New email address"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /users/me/email [put]
+func (h *ProfileHandler) ChangeEmail(c *gin.Context) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.profileService.RequestEmailChange(c.Request.Context(), c.GetString(userIDKey), req.Email)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrEmailUnchanged):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to send confirmation email"})
+	default:
+		c.JSON(http.StatusOK, Response{Message: "a confirmation link has been sent to the new address"})
+	}
+}
+
+// ConfirmEmailChange godoc
+// @Summary Confirm email change
+// @Description Switch to the new email address using the token from the confirmation link
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Param input body ConfirmEmailChangeRequest true "Confirmation token"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 409 {object} ErrorResponse
+// @Router /auth/confirm-email [post]
+func (h *ProfileHandler) ConfirmEmailChange(c *gin.Context) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.profileService.ConfirmEmailChange(c.Request.Context(), req.Token)
+	switch {
+	case errors.Is(err, service.ErrInvalidEmailChange):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrEmailTaken):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to change email"})
+	default:
+		c.JSON(http.StatusOK, Response{Message: "email changed successfully"})
+	}
+}
+
+// UsernameHistory godoc
+// @Summary Username history
+// @Description List the previous usernames of the authenticated user, most recent first
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} UsernameChangeResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me/username-history [get]
+func (h *ProfileHandler) UsernameHistory(c *gin.Context) {
+	changes, err := h.profileService.UsernameHistory(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to get username history"})
+		return
+	}
+
+	resp := make([]UsernameChangeResponse, len(changes))
+	for i, change := range changes {
+		resp[i] = UsernameChangeResponse{
+			OldUsername: change.OldUsername,
+			NewUsername: change.NewUsername,
+			ChangedAt:   change.ChangedAt,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ExportData godoc
+// @Summary Download account data
+// @Description Download everything the auth service stores about the authenticated user as JSON. The forum's export includes this together with the user's posts, comments and messages.
+// @Tags profile
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} service.AccountExport
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me/export [get]
+func (h *ProfileHandler) ExportData(c *gin.Context) {
+	export, err := h.profileService.ExportData(c.Request.Context(), c.GetString(userIDKey))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to export account data"})
+		return
+	}
+
+	c.Header("Content-Disposition", `attachment; filename="account.json"`)
+	c.JSON(http.StatusOK, export)
+}
+
+// DeleteAccount godoc
+// @Summary Delete own account
+// @Description Delete the authenticated user's account. The forum deletes or anonymizes their posts, comments and messages shortly after.
+// @Tags profile
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param input body DeleteAccountRequest true "Current password"
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /users/me [delete]
+func (h *ProfileHandler) DeleteAccount(c *gin.Context) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	err := h.profileService.DeleteAccount(c.Request.Context(), c.GetString(userIDKey), req.Password)
+	switch {
+	case errors.Is(err, repository.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "user not found"})
+	case errors.Is(err, service.ErrWrongPassword):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to delete account"})
+	default:
+		c.JSON(http.StatusOK, Response{Message: "account deleted successfully"})
+	}
+}
+
+func toProfileResponse(user *repository.User) ProfileResponse {
+	return ProfileResponse{
+		ID:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		PendingEmail:  user.PendingEmail,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarURL:     user.AvatarURL,
+		CreatedAt:     user.CreatedAt,
+	}
+}
@@ -0,0 +1,512 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+const scimContentType = "application/scim+json"
+
+type SCIMHandler struct {
+	scimService *service.SCIMService
+	authService *service.AuthService
+}
+
+func NewSCIMHandler(scimService *service.SCIMService, authService *service.AuthService) *SCIMHandler {
+	return &SCIMHandler{
+		scimService: scimService,
+		authService: authService,
+	}
+}
+
+// SCIMErrorResponse is the error format of RFC 7644 section 3.12.
+type SCIMErrorResponse struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// SCIMListQuery are the paging and filtering parameters of RFC 7644
+// section 3.4.2.
+type SCIMListQuery struct {
+	Filter             string `form:"filter"`
+	StartIndex         int    `form:"startIndex"`
+	Count              *int   `form:"count"`
+	ExcludedAttributes string `form:"excludedAttributes"`
+}
+
+type SCIMSupported struct {
+	Supported bool `json:"supported"`
+}
+
+type SCIMFilterSupported struct {
+	Supported  bool `json:"supported"`
+	MaxResults int  `json:"maxResults"`
+}
+
+type SCIMBulkSupported struct {
+	Supported      bool `json:"supported"`
+	MaxOperations  int  `json:"maxOperations"`
+	MaxPayloadSize int  `json:"maxPayloadSize"`
+}
+
+type SCIMAuthenticationScheme struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SCIMServiceProviderConfig is the resource of RFC 7643 section 5.
+type SCIMServiceProviderConfig struct {
+	Schemas               []string                   `json:"schemas"`
+	Patch                 SCIMSupported              `json:"patch"`
+	Bulk                  SCIMBulkSupported          `json:"bulk"`
+	Filter                SCIMFilterSupported        `json:"filter"`
+	ChangePassword        SCIMSupported              `json:"changePassword"`
+	Sort                  SCIMSupported              `json:"sort"`
+	ETag                  SCIMSupported              `json:"etag"`
+	AuthenticationSchemes []SCIMAuthenticationScheme `json:"authenticationSchemes"`
+}
+
+// Authenticate accepts personal access tokens limited to the scim scope
+// whose owner may provision accounts. Other tokens are refused so that a
+// token handed to a directory cannot be used for anything else, nor a
+// user's own login for provisioning.
+func (h *SCIMHandler) Authenticate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		token, ok := strings.CutPrefix(authHeader, "Bearer ")
+		if !ok || token == "" {
+			scimError(c, http.StatusUnauthorized, "", "a bearer token is required")
+			c.Abort()
+			return
+		}
+
+		claims, err := h.authService.ParseToken(c.Request.Context(), token)
+		if err != nil {
+			scimError(c, http.StatusUnauthorized, "", "invalid token")
+			c.Abort()
+			return
+		}
+		if claims.Scopes == nil || !claims.HasScope(service.ScopeSCIM) || claims.Actor != nil {
+			scimError(c, http.StatusForbidden, "", "a token with the scim scope is required")
+			c.Abort()
+			return
+		}
+
+		allowed, err := h.authService.HasPermission(c.Request.Context(), claims.UserID, service.PermissionSCIMProvision)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", "failed to check permissions")
+			c.Abort()
+			return
+		}
+		if !allowed {
+			scimError(c, http.StatusForbidden, "", "permission denied")
+			c.Abort()
+			return
+		}
+
+		c.Set(userIDKey, claims.UserID)
+		c.Next()
+	}
+}
+
+// ListUsers godoc
+// @Summary List SCIM users
+// @Description List accounts for a directory. The only supported filters are userName, emails and id with eq, as used to look a user up.
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param filter query string false "Filter, such as userName eq \"alice\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Results per page, at most 100"
+// @Success 200 {object} service.SCIMListResponse
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Router /scim/v2/Users [get]
+func (h *SCIMHandler) ListUsers(c *gin.Context) {
+	query, ok := bindSCIMListQuery(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.scimService.ListUsers(c.Request.Context(), query.Filter, query.StartIndex, *query.Count)
+	if err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+// GetUser godoc
+// @Summary Get SCIM user
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 200 {object} service.SCIMUser
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [get]
+func (h *SCIMHandler) GetUser(c *gin.Context) {
+	user, err := h.scimService.GetUser(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+// CreateUser godoc
+// @Summary Provision SCIM user
+// @Description Create an account with a verified email address and the user role. Registration modes do not apply. Without a password the user logs in with a reset link, a login link or an external provider. active=false creates the account deactivated.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.SCIMUser true "User"
+// @Success 201 {object} service.SCIMUser
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 409 {object} SCIMErrorResponse
+// @Router /scim/v2/Users [post]
+func (h *SCIMHandler) CreateUser(c *gin.Context) {
+	var req service.SCIMUser
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.CreateUser(c.Request.Context(), c.GetString(userIDKey), &req)
+	if err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	c.Header("Location", user.Meta.Location)
+	scimJSON(c, http.StatusCreated, user)
+}
+
+// ReplaceUser godoc
+// @Summary Replace SCIM user
+// @Description Set the userName, email address, display name, password and active state of an account. Deactivating suspends the user and ends their sessions; reactivating only lifts a suspension made by deactivation.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body service.SCIMUser true "User"
+// @Success 200 {object} service.SCIMUser
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Failure 409 {object} SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [put]
+func (h *SCIMHandler) ReplaceUser(c *gin.Context) {
+	var req service.SCIMUser
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.ReplaceUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), &req)
+	if err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+// PatchUser godoc
+// @Summary Patch SCIM user
+// @Description Apply add, replace and remove operations to userName, emails, displayName, name.formatted, password and active. Other attributes are ignored.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Param request body service.SCIMPatchRequest true "Patch operations"
+// @Success 200 {object} service.SCIMUser
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Failure 409 {object} SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [patch]
+func (h *SCIMHandler) PatchUser(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	user, err := h.scimService.PatchUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), &req)
+	if err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	scimJSON(c, http.StatusOK, user)
+}
+
+// DeleteUser godoc
+// @Summary Delete SCIM user
+// @Description Delete an account. Setting active to false deactivates it instead, keeping its content.
+// @Tags scim
+// @Security BearerAuth
+// @Param id path string true "User ID"
+// @Success 204
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Users/{id} [delete]
+func (h *SCIMHandler) DeleteUser(c *gin.Context) {
+	if err := h.scimService.DeleteUser(c.Request.Context(), c.GetString(userIDKey), c.Param("id")); err != nil {
+		h.handleError(c, err, "User")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ListGroups godoc
+// @Summary List SCIM groups
+// @Description List roles as groups. The only supported filters are displayName and id with eq.
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param filter query string false "Filter, such as displayName eq \"engineering\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Results per page, at most 100"
+// @Param excludedAttributes query string false "members to leave out the members"
+// @Success 200 {object} service.SCIMListResponse
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups [get]
+func (h *SCIMHandler) ListGroups(c *gin.Context) {
+	query, ok := bindSCIMListQuery(c)
+	if !ok {
+		return
+	}
+
+	list, err := h.scimService.ListGroups(c.Request.Context(), query.Filter, query.StartIndex, *query.Count, includeMembers(query.ExcludedAttributes))
+	if err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	scimJSON(c, http.StatusOK, list)
+}
+
+// GetGroup godoc
+// @Summary Get SCIM group
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role name"
+// @Param excludedAttributes query string false "members to leave out the members"
+// @Success 200 {object} service.SCIMGroup
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [get]
+func (h *SCIMHandler) GetGroup(c *gin.Context) {
+	group, err := h.scimService.GetGroup(c.Request.Context(), c.Param("id"), includeMembers(c.Query("excludedAttributes")))
+	if err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+// CreateGroup godoc
+// @Summary Provision SCIM group
+// @Description Create a role without permissions named after the group, with its members. Permissions can then be granted to the role.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param request body service.SCIMGroup true "Group"
+// @Success 201 {object} service.SCIMGroup
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 409 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups [post]
+func (h *SCIMHandler) CreateGroup(c *gin.Context) {
+	var req service.SCIMGroup
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.CreateGroup(c.Request.Context(), c.GetString(userIDKey), &req)
+	if err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	c.Header("Location", group.Meta.Location)
+	scimJSON(c, http.StatusCreated, group)
+}
+
+// ReplaceGroup godoc
+// @Summary Replace SCIM group
+// @Description Set the members of a group. Groups cannot be renamed.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role name"
+// @Param request body service.SCIMGroup true "Group"
+// @Success 200 {object} service.SCIMGroup
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [put]
+func (h *SCIMHandler) ReplaceGroup(c *gin.Context) {
+	var req service.SCIMGroup
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.ReplaceGroup(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), &req)
+	if err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+// PatchGroup godoc
+// @Summary Patch SCIM group
+// @Description Add, remove or replace members of a group, granting or revoking the role.
+// @Tags scim
+// @Accept json
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Role name"
+// @Param request body service.SCIMPatchRequest true "Patch operations"
+// @Success 200 {object} service.SCIMGroup
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [patch]
+func (h *SCIMHandler) PatchGroup(c *gin.Context) {
+	var req service.SCIMPatchRequest
+	if !bindSCIM(c, &req) {
+		return
+	}
+
+	group, err := h.scimService.PatchGroup(c.Request.Context(), c.GetString(userIDKey), c.Param("id"), &req)
+	if err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	scimJSON(c, http.StatusOK, group)
+}
+
+// DeleteGroup godoc
+// @Summary Delete SCIM group
+// @Description Delete a role created for a group, revoking it from its members. Roles that grant permissions cannot be deleted.
+// @Tags scim
+// @Security BearerAuth
+// @Param id path string true "Role name"
+// @Success 204
+// @Failure 400 {object} SCIMErrorResponse
+// @Failure 401 {object} SCIMErrorResponse
+// @Failure 403 {object} SCIMErrorResponse
+// @Failure 404 {object} SCIMErrorResponse
+// @Router /scim/v2/Groups/{id} [delete]
+func (h *SCIMHandler) DeleteGroup(c *gin.Context) {
+	if err := h.scimService.DeleteGroup(c.Request.Context(), c.GetString(userIDKey), c.Param("id")); err != nil {
+		h.handleError(c, err, "Group")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// ServiceProviderConfig godoc
+// @Summary SCIM service provider configuration
+// @Description Describe the SCIM features supported by this service
+// @Tags scim
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} SCIMServiceProviderConfig
+// @Router /scim/v2/ServiceProviderConfig [get]
+func (h *SCIMHandler) ServiceProviderConfig(c *gin.Context) {
+	scimJSON(c, http.StatusOK, SCIMServiceProviderConfig{
+		Schemas: []string{"urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"},
+		Patch:   SCIMSupported{Supported: true},
+		Filter:  SCIMFilterSupported{Supported: true, MaxResults: service.SCIMMaxResults},
+		AuthenticationSchemes: []SCIMAuthenticationScheme{{
+			Type:        "oauthbearertoken",
+			Name:        "Personal access token",
+			Description: "A personal access token limited to the scim scope, owned by a user with the scim:provision permission",
+		}},
+	})
+}
+
+func (h *SCIMHandler) handleError(c *gin.Context, err error, resourceType string) {
+	var scimErr *service.SCIMError
+	switch {
+	case errors.As(err, &scimErr):
+		scimError(c, scimErr.Status, scimErr.Type, scimErr.Detail)
+	case errors.Is(err, repository.ErrNotFound):
+		scimError(c, http.StatusNotFound, "", resourceType+" not found")
+	default:
+		scimError(c, http.StatusInternalServerError, "", "internal error")
+	}
+}
+
+// bindSCIM decodes a SCIM request body, which directories send as
+// application/scim+json.
+func bindSCIM(c *gin.Context, obj interface{}) bool {
+	if err := c.ShouldBindJSON(obj); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", "the request body is not valid JSON")
+		return false
+	}
+	return true
+}
+
+func bindSCIMListQuery(c *gin.Context) (SCIMListQuery, bool) {
+	var query SCIMListQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", "startIndex and count must be integers")
+		return query, false
+	}
+	if query.Count == nil {
+		count := service.SCIMMaxResults
+		query.Count = &count
+	}
+	return query, true
+}
+
+func includeMembers(excludedAttributes string) bool {
+	for _, attribute := range strings.Split(excludedAttributes, ",") {
+		if strings.EqualFold(strings.TrimSpace(attribute), "members") {
+			return false
+		}
+	}
+	return true
+}
+
+func scimJSON(c *gin.Context, status int, obj interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(status, obj)
+}
+
+func scimError(c *gin.Context, status int, scimType, detail string) {
+	scimJSON(c, status, SCIMErrorResponse{
+		Schemas:  []string{service.SCIMErrorSchema},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
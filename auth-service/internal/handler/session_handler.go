@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"auth-service/internal/repository"
+	"auth-service/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// ListSessions godoc
+// @Summary List sessions
+// @Description List the active sessions of the current user
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {array} SessionResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/sessions [get]
+func (h *AuthHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.authService.ListSessions(c.Request.Context(), c.GetString(userIDKey))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to list sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, toSessionResponses(sessions, currentClaims(c).SessionID))
+}
+
+// RevokeSession godoc
+// @Summary Revoke session
+// @Description Log the current user out of one session
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Param id path string true "Session ID"
+// @Success 200 {object} Response
+// @Failure 401 {object} ErrorResponse
+// @Failure 404 {object} ErrorResponse
+// @Router /auth/sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(c *gin.Context) {
+	err := h.authService.RevokeSession(c.Request.Context(), c.GetString(userIDKey), c.Param("id"))
+	if errors.Is(err, repository.ErrNotFound) {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "session not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to revoke session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "session revoked successfully"})
+}
+
+// RevokeOtherSessions godoc
+// @Summary Log out other sessions
+// @Description Log the current user out of every session except the current one
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response
+// @Failure 400 {object} ErrorResponse
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/sessions/revoke-others [post]
+func (h *AuthHandler) RevokeOtherSessions(c *gin.Context) {
+	err := h.authService.RevokeOtherSessions(c.Request.Context(), c.GetString(userIDKey), currentClaims(c).SessionID)
+	if errors.Is(err, service.ErrUnknownSession) {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to revoke sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "other sessions revoked successfully"})
+}
+
+// LogoutAll godoc
+// @Summary Log out everywhere
+// @Description Revoke every refresh token of the current user, including the current session
+// @Tags sessions
+// @Produce json
+// @Security BearerAuth
+// @Success 200 {object} Response
+// @Failure 401 {object} ErrorResponse
+// @Router /auth/logout-all [post]
+func (h *AuthHandler) LogoutAll(c *gin.Context) {
+	if err := h.authService.LogoutAll(c.Request.Context(), c.GetString(userIDKey)); err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{Message: "logged out of all sessions"})
+}
+
+func toSessionResponses(sessions []repository.Session, currentSessionID string) []SessionResponse {
+	resp := make([]SessionResponse, len(sessions))
+	for i, session := range sessions {
+		resp[i] = SessionResponse{
+			ID:         session.ID,
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentSessionID,
+		}
+	}
+	return resp
+}
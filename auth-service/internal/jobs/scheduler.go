@@ -0,0 +1,176 @@
+// Package jobs runs periodic background work, such as purging expired
+// tokens, next to the servers.
+package jobs
+
+import (
+	"context"
+	"expvar"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/rs/zerolog"
+)
+
+// Job is work run periodically in the background.
+type Job struct {
+	Name string
+	// Interval is the time between runs. Jobs without one are not run.
+	Interval time.Duration
+	// Exclusive jobs work on state shared by all replicas and are run by one
+	// replica at a time, under a lock named after the job. Other jobs run on
+	// every replica.
+	Exclusive bool
+	// Run returns how many items it handled, such as rows deleted.
+	Run func(ctx context.Context) (int64, error)
+}
+
+// Scheduler runs jobs at their intervals. A random delay of up to jitter is
+// added to every interval so that replicas started together do not all
+// compete for the same locks.
+type Scheduler struct {
+	lock   repository.JobLock
+	jitter time.Duration
+	logger zerolog.Logger
+	jobs   []Job
+}
+
+func NewScheduler(lock repository.JobLock, jitter time.Duration, logger zerolog.Logger) *Scheduler {
+	return &Scheduler{
+		lock:   lock,
+		jitter: jitter,
+		logger: logger,
+	}
+}
+
+// Add registers job. Jobs must be added before Run is called.
+func (s *Scheduler) Add(job Job) {
+	if job.Interval <= 0 {
+		s.logger.Info().Str("job", job.Name).Msg("Background job disabled")
+		return
+	}
+	s.jobs = append(s.jobs, job)
+}
+
+// Run runs the jobs until ctx is cancelled and then waits for runs in
+// progress, which see the cancellation, to return.
+func (s *Scheduler) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, job := range s.jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.loop(ctx, job)
+		}()
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, job Job) {
+	timer := time.NewTimer(s.delay(job.Interval))
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		s.run(ctx, job)
+		timer.Reset(s.delay(job.Interval))
+	}
+}
+
+func (s *Scheduler) delay(interval time.Duration) time.Duration {
+	if s.jitter <= 0 {
+		return interval
+	}
+	return interval + rand.N(s.jitter)
+}
+
+// run runs job once, unless another replica is running it.
+func (s *Scheduler) run(ctx context.Context, job Job) {
+	m := metricsFor(job.Name)
+	logger := s.logger.With().Str("job", job.Name).Logger()
+
+	if job.Exclusive {
+		release, ok, err := s.lock.TryLock(ctx, job.Name)
+		if err != nil {
+			m.failures.Add(1)
+			m.lastError.Set(err.Error())
+			logger.Error().Err(err).Msg("Failed to lock background job")
+			return
+		}
+		if !ok {
+			m.skipped.Add(1)
+			logger.Debug().Msg("Background job is running on another replica")
+			return
+		}
+		defer release()
+	}
+
+	start := time.Now()
+	items, err := job.Run(ctx)
+	duration := time.Since(start)
+
+	m.runs.Add(1)
+	m.lastRun.Set(start.UTC().Format(time.RFC3339))
+	m.lastDuration.Set(duration.Seconds())
+	if err != nil {
+		m.failures.Add(1)
+		m.lastError.Set(err.Error())
+		logger.Error().Err(err).Dur("duration", duration).Msg("Background job failed")
+		return
+	}
+	m.items.Add(items)
+	m.lastError.Set("")
+	logger.Info().Int64("items", items).Dur("duration", duration).Msg("Background job finished")
+}
+
+// metrics holds the counters of every job by name. It is published by
+// expvar as "jobs".
+var metrics = expvar.NewMap("jobs")
+
+var metricsMu sync.Mutex
+
+type jobMetrics struct {
+	runs     *expvar.Int
+	failures *expvar.Int
+	// skipped counts runs left to another replica holding the lock.
+	skipped      *expvar.Int
+	items        *expvar.Int
+	lastRun      *expvar.String
+	lastDuration *expvar.Float
+	lastError    *expvar.String
+}
+
+func metricsFor(name string) *jobMetrics {
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	vars, ok := metrics.Get(name).(*expvar.Map)
+	if !ok {
+		vars = new(expvar.Map).Init()
+		vars.Set("runs", new(expvar.Int))
+		vars.Set("failures", new(expvar.Int))
+		vars.Set("skipped", new(expvar.Int))
+		vars.Set("items", new(expvar.Int))
+		vars.Set("last_run", new(expvar.String))
+		vars.Set("last_duration_seconds", new(expvar.Float))
+		vars.Set("last_error", new(expvar.String))
+		metrics.Set(name, vars)
+	}
+
+	return &jobMetrics{
+		runs:         vars.Get("runs").(*expvar.Int),
+		failures:     vars.Get("failures").(*expvar.Int),
+		skipped:      vars.Get("skipped").(*expvar.Int),
+		items:        vars.Get("items").(*expvar.Int),
+		lastRun:      vars.Get("last_run").(*expvar.String),
+		lastDuration: vars.Get("last_duration_seconds").(*expvar.Float),
+		lastError:    vars.Get("last_error").(*expvar.String),
+	}
+}
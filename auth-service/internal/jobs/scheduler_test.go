@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeJobLock is a JobLock for a single process.
+type fakeJobLock struct {
+	mu       sync.Mutex
+	held     map[string]bool
+	released int
+}
+
+func newFakeJobLock() *fakeJobLock {
+	return &fakeJobLock{held: make(map[string]bool)}
+}
+
+func (l *fakeJobLock) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.held[name] {
+		return nil, false, nil
+	}
+	l.held[name] = true
+	return func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		delete(l.held, name)
+		l.released++
+	}, true, nil
+}
+
+// counters returns a function reporting how much the counters of job have
+// grown since, as metrics are global and outlive a test.
+func counters(job string) func() map[string]int64 {
+	values := func() map[string]int64 {
+		m := metricsFor(job)
+		return map[string]int64{
+			"runs":     m.runs.Value(),
+			"failures": m.failures.Value(),
+			"skipped":  m.skipped.Value(),
+			"items":    m.items.Value(),
+		}
+	}
+	before := values()
+	return func() map[string]int64 {
+		after := values()
+		for name := range after {
+			after[name] -= before[name]
+		}
+		return after
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("runs are recorded in the metrics", func(t *testing.T) {
+		lock := newFakeJobLock()
+		scheduler := NewScheduler(lock, 0, zerolog.Nop())
+		job := Job{Name: "test_recorded", Interval: time.Hour, Exclusive: true, Run: func(ctx context.Context) (int64, error) {
+			return 3, nil
+		}}
+		since := counters(job.Name)
+
+		scheduler.run(ctx, job)
+		scheduler.run(ctx, job)
+		assert.Equal(t, map[string]int64{"runs": 2, "failures": 0, "skipped": 0, "items": 6}, since())
+		assert.Equal(t, 2, lock.released)
+		assert.NotEmpty(t, metricsFor(job.Name).lastRun.Value())
+	})
+
+	t.Run("exclusive jobs are skipped while another replica holds the lock", func(t *testing.T) {
+		lock := newFakeJobLock()
+		scheduler := NewScheduler(lock, 0, zerolog.Nop())
+		ran := false
+		job := Job{Name: "test_locked", Interval: time.Hour, Exclusive: true, Run: func(ctx context.Context) (int64, error) {
+			ran = true
+			return 0, nil
+		}}
+		since := counters(job.Name)
+
+		release, ok, err := lock.TryLock(ctx, job.Name)
+		require.NoError(t, err)
+		require.True(t, ok)
+
+		scheduler.run(ctx, job)
+		assert.False(t, ran)
+		assert.Equal(t, int64(1), since()["skipped"])
+
+		// Jobs that are not exclusive ignore the lock
+		job.Exclusive = false
+		scheduler.run(ctx, job)
+		assert.True(t, ran)
+		release()
+	})
+
+	t.Run("failures are recorded", func(t *testing.T) {
+		scheduler := NewScheduler(newFakeJobLock(), 0, zerolog.Nop())
+		job := Job{Name: "test_failing", Interval: time.Hour, Run: func(ctx context.Context) (int64, error) {
+			return 0, errors.New("database is down")
+		}}
+		since := counters(job.Name)
+
+		scheduler.run(ctx, job)
+		assert.Equal(t, int64(1), since()["failures"])
+		assert.Equal(t, "database is down", metricsFor(job.Name).lastError.Value())
+	})
+
+	t.Run("jobs run at their interval until cancelled", func(t *testing.T) {
+		scheduler := NewScheduler(newFakeJobLock(), time.Millisecond, zerolog.Nop())
+		var runs atomic.Int64
+		scheduler.Add(Job{Name: "test_interval", Interval: time.Millisecond, Exclusive: true, Run: func(ctx context.Context) (int64, error) {
+			runs.Add(1)
+			return 0, nil
+		}})
+		scheduler.Add(Job{Name: "test_disabled", Run: func(ctx context.Context) (int64, error) {
+			t.Error("jobs without an interval must not run")
+			return 0, nil
+		}})
+
+		ctx, cancel := context.WithCancel(ctx)
+		done := make(chan struct{})
+		go func() {
+			scheduler.Run(ctx)
+			close(done)
+		}()
+
+		assert.Eventually(t, func() bool { return runs.Load() >= 3 }, time.Second, time.Millisecond)
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("Run did not return after cancellation")
+		}
+	})
+}
+
+func TestScheduler_Delay(t *testing.T) {
+	scheduler := NewScheduler(newFakeJobLock(), time.Minute, zerolog.Nop())
+	for i := 0; i < 100; i++ {
+		delay := scheduler.delay(time.Hour)
+		assert.GreaterOrEqual(t, delay, time.Hour)
+		assert.Less(t, delay, time.Hour+time.Minute)
+	}
+
+	assert.Equal(t, time.Hour, NewScheduler(newFakeJobLock(), 0, zerolog.Nop()).delay(time.Hour))
+}
+
+func TestLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	repo := repository.NewInMemoryLoginAttemptRepository()
+
+	_, err := repo.RecordFailure(ctx, "user:stale", time.Hour)
+	require.NoError(t, err)
+	_, err = repo.RecordFailure(ctx, "user:locked", time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, repo.Lock(ctx, "user:locked", time.Now().Add(time.Hour)))
+
+	job := LoginAttempts(repo, 0, time.Minute, false)
+	deleted, err := job.Run(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	// Locked keys stay until the lock ends
+	attempt, err := repo.Get(ctx, "user:locked")
+	require.NoError(t, err)
+	assert.Equal(t, 1, attempt.Failures)
+	attempt, err = repo.Get(ctx, "user:stale")
+	require.NoError(t, err)
+	assert.Equal(t, 0, attempt.Failures)
+}
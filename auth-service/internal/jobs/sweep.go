@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"time"
+
+	"auth-service/internal/repository"
+)
+
+// ExpiredTokens purges expired refresh tokens, which are otherwise only
+// deleted when presented, and entries of the revocation list for access
+// tokens that have expired anyway.
+func ExpiredTokens(tokenRepo repository.TokenRepository, revokedRepo repository.RevokedTokenRepository, interval time.Duration) Job {
+	return Job{
+		Name:      "expired_tokens",
+		Interval:  interval,
+		Exclusive: true,
+		Run: func(ctx context.Context) (int64, error) {
+			refreshTokens, err := tokenRepo.DeleteExpired(ctx)
+			if err != nil {
+				return 0, err
+			}
+			revoked, err := revokedRepo.DeleteExpired(ctx)
+			return refreshTokens + revoked, err
+		},
+	}
+}
+
+// OneTimeTokens purges the expired and used tokens behind emailed links,
+// such as password reset and email verification links.
+func OneTimeTokens(interval time.Duration, repos ...repository.OneTimeTokenRepository) Job {
+	return Job{
+		Name:      "one_time_tokens",
+		Interval:  interval,
+		Exclusive: true,
+		Run: func(ctx context.Context) (int64, error) {
+			var total int64
+			for _, repo := range repos {
+				deleted, err := repo.DeleteExpired(ctx)
+				if err != nil {
+					return total, err
+				}
+				total += deleted
+			}
+			return total, nil
+		},
+	}
+}
+
+// LoginAttempts purges failed login counters that have gone stale. Counters
+// kept in memory belong to each replica, so the job is only exclusive when
+// they are kept in Postgres.
+func LoginAttempts(attemptRepo repository.LoginAttemptRepository, window, interval time.Duration, shared bool) Job {
+	return Job{
+		Name:      "login_attempts",
+		Interval:  interval,
+		Exclusive: shared,
+		Run: func(ctx context.Context) (int64, error) {
+			return attemptRepo.DeleteStale(ctx, window)
+		},
+	}
+}
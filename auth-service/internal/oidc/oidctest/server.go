@@ -0,0 +1,154 @@
+// Package oidctest runs an in-process OpenID provider for tests.
+package oidctest
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+
+	"auth-service/internal/oidc"
+	"auth-service/internal/signing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ClientID     = "auth-service"
+	ClientSecret = "mock-secret"
+)
+
+// Identity is the user the mock provider logs in.
+type Identity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+}
+
+type pendingCode struct {
+	identity      Identity
+	nonce         string
+	codeChallenge string
+	redirectURI   string
+}
+
+// Server is a mock OpenID provider. Authorize stands in for the user logging
+// in at the provider: it issues a code for an identity without any UI.
+type Server struct {
+	*httptest.Server
+	keys *signing.KeySet
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+}
+
+func NewServer() *Server {
+	key, err := signing.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	keys, err := signing.NewKeySet([]*signing.Key{key}, nil)
+	if err != nil {
+		panic(err)
+	}
+
+	s := &Server{keys: keys, codes: make(map[string]pendingCode)}
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/.well-known/openid-configuration", s.discovery)
+	r.GET("/jwks", func(c *gin.Context) { c.JSON(http.StatusOK, s.keys.JWKS()) })
+	r.POST("/token", s.token)
+	s.Server = httptest.NewServer(r)
+	return s
+}
+
+// Config returns a relying party registration for the server.
+func (s *Server) Config(redirectURL string) oidc.Config {
+	return oidc.Config{
+		Issuer:       s.URL,
+		ClientID:     ClientID,
+		ClientSecret: ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       []string{"openid", "profile", "email"},
+	}
+}
+
+// Authorize simulates identity logging in at the provider's authorization
+// URL authURL and returns the code the provider would redirect back with.
+func (s *Server) Authorize(authURL string, identity Identity) (code, state string) {
+	req, err := http.NewRequest(http.MethodGet, authURL, nil)
+	if err != nil {
+		panic(err)
+	}
+	query := req.URL.Query()
+
+	code = "code-" + identity.Subject + "-" + time.Now().Format(time.RFC3339Nano)
+	s.mu.Lock()
+	s.codes[code] = pendingCode{
+		identity:      identity,
+		nonce:         query.Get("nonce"),
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+	}
+	s.mu.Unlock()
+	return code, query.Get("state")
+}
+
+func (s *Server) discovery(c *gin.Context) {
+	c.JSON(http.StatusOK, oidc.Metadata{
+		Issuer:                s.URL,
+		AuthorizationEndpoint: s.URL + "/authorize",
+		TokenEndpoint:         s.URL + "/token",
+		JWKSURI:               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) token(c *gin.Context) {
+	clientID, secret, ok := c.Request.BasicAuth()
+	if !ok || clientID != ClientID || secret != ClientSecret {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	pending, ok := s.codes[c.PostForm("code")]
+	delete(s.codes, c.PostForm("code"))
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(c.PostForm("code_verifier")))
+	if !ok || pending.redirectURI != c.PostForm("redirect_uri") ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != pending.codeChallenge {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_grant"})
+		return
+	}
+
+	idToken, err := s.keys.Sign(oidc.Claims{
+		Nonce:             pending.nonce,
+		Email:             pending.identity.Email,
+		EmailVerified:     pending.identity.EmailVerified,
+		PreferredUsername: pending.identity.PreferredUsername,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    s.URL,
+			Subject:   pending.identity.Subject,
+			Audience:  jwt.ClaimStrings{ClientID},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"access_token": "mock-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
@@ -0,0 +1,90 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+
+	"auth-service/internal/oidc"
+	"auth-service/internal/oidc/oidctest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const redirectURL = "https://auth.example.com/callback"
+
+func TestProvider_Exchange(t *testing.T) {
+	idp := oidctest.NewServer()
+	defer idp.Close()
+
+	identity := oidctest.Identity{Subject: "sub-1", Email: "jane@example.com", EmailVerified: true}
+	verifier := strings.Repeat("v", 43)
+	sum := sha256.Sum256([]byte(verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+	ctx := context.Background()
+
+	t.Run("verified claims are returned", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Config(redirectURL))
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+		require.NoError(t, err)
+
+		u, err := url.Parse(authURL)
+		require.NoError(t, err)
+		assert.Equal(t, oidctest.ClientID, u.Query().Get("client_id"))
+		assert.Equal(t, "S256", u.Query().Get("code_challenge_method"))
+
+		code, state := idp.Authorize(authURL, identity)
+		assert.Equal(t, "state", state)
+
+		claims, err := provider.Exchange(ctx, code, verifier, "nonce")
+		require.NoError(t, err)
+		assert.Equal(t, identity.Subject, claims.Subject)
+		assert.Equal(t, identity.Email, claims.Email)
+		assert.True(t, claims.EmailVerified)
+	})
+
+	t.Run("nonce must match", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Config(redirectURL))
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+		require.NoError(t, err)
+		code, _ := idp.Authorize(authURL, identity)
+
+		_, err = provider.Exchange(ctx, code, verifier, "other")
+		assert.ErrorIs(t, err, oidc.ErrInvalidNonce)
+	})
+
+	t.Run("wrong code verifier is rejected", func(t *testing.T) {
+		provider := oidc.NewProvider(idp.Config(redirectURL))
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+		require.NoError(t, err)
+		code, _ := idp.Authorize(authURL, identity)
+
+		_, err = provider.Exchange(ctx, code, strings.Repeat("w", 43), "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("tokens for another client are rejected", func(t *testing.T) {
+		config := idp.Config(redirectURL)
+		config.ClientID = "other-client"
+		provider := oidc.NewProvider(config)
+		authURL, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+		require.NoError(t, err)
+		code, _ := idp.Authorize(authURL, identity)
+
+		_, err = provider.Exchange(ctx, code, verifier, "nonce")
+		assert.Error(t, err)
+	})
+
+	t.Run("issuer must match discovery", func(t *testing.T) {
+		config := idp.Config(redirectURL)
+		config.Issuer = strings.Replace(idp.URL, "127.0.0.1", "localhost", 1)
+		provider := oidc.NewProvider(config)
+
+		_, err := provider.AuthCodeURL(ctx, "state", "nonce", challenge)
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,100 @@
+package password
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var testArgon2Params = Argon2Params{
+	Memory:      1024,
+	Iterations:  1,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+func TestArgon2id(t *testing.T) {
+	hasher := NewArgon2id(testArgon2Params)
+
+	hash, err := hasher.Hash("Passw0rd!")
+	require.NoError(t, err)
+	assert.True(t, hasher.Recognizes(hash))
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	ok, err := hasher.Verify(hash, "Passw0rd!")
+	require.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = hasher.Verify(hash, "wrong")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	other, err := hasher.Hash("Passw0rd!")
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other, "every hash gets its own salt")
+
+	stronger := testArgon2Params
+	stronger.Iterations = 2
+	assert.True(t, NewArgon2id(stronger).NeedsRehash(hash))
+
+	_, err = hasher.Verify("$argon2id$v=19$m=1024$broken", "Passw0rd!")
+	assert.Error(t, err)
+}
+
+func TestPolicy_Verify(t *testing.T) {
+	argon := NewArgon2id(testArgon2Params)
+	policy := NewPolicy(argon, NewBcrypt(bcrypt.MinCost))
+
+	t.Run("preferred hasher", func(t *testing.T) {
+		hash, err := policy.Hash("Passw0rd!")
+		require.NoError(t, err)
+		assert.True(t, argon.Recognizes(hash))
+
+		ok, rehash := policy.Verify(hash, "Passw0rd!")
+		assert.True(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("other accepted hasher", func(t *testing.T) {
+		hash, err := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		ok, rehash := policy.Verify(string(hash), "Passw0rd!")
+		assert.True(t, ok)
+		assert.True(t, rehash)
+
+		ok, rehash = policy.Verify(string(hash), "wrong")
+		assert.False(t, ok)
+		assert.False(t, rehash)
+	})
+
+	t.Run("unknown or missing hash", func(t *testing.T) {
+		ok, _ := policy.Verify("", "")
+		assert.False(t, ok)
+		ok, _ = policy.Verify("plaintext", "plaintext")
+		assert.False(t, ok)
+	})
+}
+
+func TestPolicy_Check(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	// The SHA-1 line is "Summer2024!" in the Have I Been Pwned format
+	list := "P@ssw0rd\r\n\n7E8B0A3433F1210A9699D85420E363A1B162ECAC:12\n"
+	require.NoError(t, os.WriteFile(path, []byte(list), 0o600))
+
+	policy := NewPolicy(NewBcrypt(bcrypt.MinCost))
+	require.NoError(t, policy.LoadBreachedList(path))
+
+	assert.ErrorIs(t, policy.Check("short"), ErrTooWeak)
+	assert.ErrorIs(t, policy.Check("password123"), ErrTooWeak)
+	assert.ErrorIs(t, policy.Check("P@ssw0rd"), ErrBreached)
+	assert.ErrorIs(t, policy.Check("Summer2024!"), ErrBreached)
+	assert.NoError(t, policy.Check("Correct-h0rse"))
+
+	assert.Error(t, policy.LoadBreachedList(filepath.Join(t.TempDir(), "missing.txt")))
+}
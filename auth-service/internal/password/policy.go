@@ -0,0 +1,141 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"auth-service/internal/config"
+
+	"github.com/greygn/go-final/pkg/common/validator"
+)
+
+var (
+	ErrTooWeak  = errors.New("password must be at least 8 characters and contain upper and lower case letters, a digit and a symbol")
+	ErrBreached = errors.New("password has appeared in a data breach, choose another one")
+)
+
+// Policy decides which passwords are acceptable and how they are stored.
+// New passwords are hashed with the preferred hasher; hashes made by the
+// other accepted hashers still verify and are flagged for rehashing.
+type Policy struct {
+	preferred Hasher
+	accepted  []Hasher
+	breached  map[[sha1.Size]byte]struct{}
+}
+
+// NewPolicy creates a policy that hashes with preferred and also verifies
+// hashes made by accepted.
+func NewPolicy(preferred Hasher, accepted ...Hasher) *Policy {
+	return &Policy{
+		preferred: preferred,
+		accepted:  append([]Hasher{preferred}, accepted...),
+	}
+}
+
+// Load creates the policy described by the configuration.
+func Load(cfg *config.Config) (*Policy, error) {
+	argon := NewArgon2id(Argon2Params{
+		Memory:      uint32(cfg.Argon2Memory),
+		Iterations:  uint32(cfg.Argon2Iterations),
+		Parallelism: uint8(cfg.Argon2Parallelism),
+		SaltLength:  DefaultArgon2Params.SaltLength,
+		KeyLength:   DefaultArgon2Params.KeyLength,
+	})
+	bcrypt := NewBcrypt(cfg.BcryptCost)
+
+	var policy *Policy
+	switch cfg.PasswordHasher {
+	case "argon2id":
+		policy = NewPolicy(argon, bcrypt)
+	case "bcrypt":
+		policy = NewPolicy(bcrypt, argon)
+	default:
+		return nil, fmt.Errorf("unknown password hasher %q", cfg.PasswordHasher)
+	}
+
+	if cfg.BreachedPasswordsFile != "" {
+		if err := policy.LoadBreachedList(cfg.BreachedPasswordsFile); err != nil {
+			return nil, err
+		}
+	}
+	return policy, nil
+}
+
+// LoadBreachedList reads passwords that must not be used, one per line.
+// Lines may also hold the hex SHA-1 of a password, optionally followed by
+// ":count" as in the Have I Been Pwned downloads.
+func (p *Policy) LoadBreachedList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	breached := make(map[[sha1.Size]byte]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		breached[breachedKey(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.breached = breached
+	return nil
+}
+
+func breachedKey(line string) [sha1.Size]byte {
+	digest := line
+	if i := strings.IndexByte(digest, ':'); i == 2*sha1.Size {
+		digest = digest[:i]
+	}
+	if len(digest) == 2*sha1.Size {
+		var key [sha1.Size]byte
+		if _, err := hex.Decode(key[:], []byte(digest)); err == nil {
+			return key
+		}
+	}
+	return sha1.Sum([]byte(line))
+}
+
+// Check rejects passwords that are too weak or known to be breached.
+func (p *Policy) Check(password string) error {
+	if validator.ValidatePassword(password) != nil {
+		return ErrTooWeak
+	}
+	if _, ok := p.breached[sha1.Sum([]byte(password))]; ok {
+		return ErrBreached
+	}
+	return nil
+}
+
+// Hash hashes a new password with the preferred hasher.
+func (p *Policy) Hash(password string) (string, error) {
+	return p.preferred.Hash(password)
+}
+
+// Verify reports whether password matches hash, and whether the hash should
+// be replaced by a fresh one from Hash because it was made by another hasher
+// or with other parameters.
+func (p *Policy) Verify(hash, password string) (ok, rehash bool) {
+	for _, hasher := range p.accepted {
+		if !hasher.Recognizes(hash) {
+			continue
+		}
+		ok, err := hasher.Verify(hash, password)
+		if err != nil || !ok {
+			return false, false
+		}
+		return true, hasher != p.preferred || hasher.NeedsRehash(hash)
+	}
+	return false, false
+}
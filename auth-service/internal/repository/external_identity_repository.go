@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// uniqueViolation is the PostgreSQL error code for a failed unique constraint.
+const uniqueViolation = "23505"
+
+type externalIdentityRepository struct {
+	db *sql.DB
+}
+
+func NewExternalIdentityRepository(db *sql.DB) ExternalIdentityRepository {
+	return &externalIdentityRepository{db: db}
+}
+
+func (r *externalIdentityRepository) Create(ctx context.Context, identity *ExternalIdentity) error {
+	query := `
+		INSERT INTO external_identities (user_id, issuer, subject, email)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at`
+
+	err := r.db.QueryRowContext(ctx, query,
+		identity.UserID,
+		identity.Issuer,
+		identity.Subject,
+		identity.Email,
+	).Scan(&identity.ID, &identity.CreatedAt)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *externalIdentityRepository) GetBySubject(ctx context.Context, issuer, subject string) (*ExternalIdentity, error) {
+	query := `
+		SELECT id, user_id, issuer, subject, email, last_login_at, created_at
+		FROM external_identities
+		WHERE issuer = $1 AND subject = $2`
+
+	identity, err := scanExternalIdentity(r.db.QueryRowContext(ctx, query, issuer, subject))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return identity, nil
+}
+
+func (r *externalIdentityRepository) ListForUser(ctx context.Context, userID string) ([]ExternalIdentity, error) {
+	query := `
+		SELECT id, user_id, issuer, subject, email, last_login_at, created_at
+		FROM external_identities
+		WHERE user_id = $1
+		ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []ExternalIdentity
+	for rows.Next() {
+		identity, err := scanExternalIdentity(rows)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, *identity)
+	}
+	return identities, rows.Err()
+}
+
+func (r *externalIdentityRepository) Delete(ctx context.Context, userID, id string) error {
+	query := `DELETE FROM external_identities WHERE user_id = $1 AND id = $2`
+	result, err := r.db.ExecContext(ctx, query, userID, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *externalIdentityRepository) MarkUsed(ctx context.Context, id string) error {
+	query := `UPDATE external_identities SET last_login_at = CURRENT_TIMESTAMP WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func scanExternalIdentity(row rowScanner) (*ExternalIdentity, error) {
+	identity := &ExternalIdentity{}
+	var lastLoginAt sql.NullTime
+	err := row.Scan(
+		&identity.ID,
+		&identity.UserID,
+		&identity.Issuer,
+		&identity.Subject,
+		&identity.Email,
+		&lastLoginAt,
+		&identity.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if lastLoginAt.Valid {
+		identity.LastLoginAt = &lastLoginAt.Time
+	}
+	return identity, nil
+}
@@ -10,23 +10,267 @@ type User struct {
 	Username     string
 	Email        string
 	PasswordHash string
-	CreatedAt    time.Time
-	UpdatedAt    time.Time
+	// EmailVerifiedAt is nil until the user follows the verification link.
+	EmailVerifiedAt *time.Time
+	// SuspendedAt is set while the account is suspended. A suspension
+	// without SuspendedUntil is a ban that lasts until it is lifted.
+	SuspendedAt      *time.Time
+	SuspendedUntil   *time.Time
+	SuspensionReason string
+	DisplayName      string
+	Bio              string
+	AvatarURL        string
+	// PendingEmail is an address the user asked to change to and has not
+	// confirmed yet.
+	PendingEmail string
+	// InviteCodeID is the invite code the user registered with, if any.
+	InviteCodeID string
+	// PendingApproval is set while an account registered under the approval
+	// mode waits for an admin.
+	PendingApproval bool
+	// TokensValidAfter is set when the user's access tokens were revoked.
+	// Tokens issued at or before it are no longer accepted.
+	TokensValidAfter *time.Time
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+}
+
+// UsernameChange is one rename. IDs increase with every rename, so they can
+// be used to follow renames across all users.
+type UsernameChange struct {
+	ID          int64
+	UserID      string
+	OldUsername string
+	NewUsername string
+	ChangedAt   time.Time
+}
+
+// UserDeletion records that a user was deleted. Like UsernameChange, IDs
+// increase so that other services can follow deletions.
+type UserDeletion struct {
+	ID        int64
+	UserID    string
+	DeletedAt time.Time
+}
+
+// UserFilter selects a page of users. Query matches part of the username or
+// email address; SuspendedOnly leaves out suspensions that have run out.
+type UserFilter struct {
+	Query         string
+	SuspendedOnly bool
+	PendingOnly   bool
+	Limit         int
+	Offset        int
 }
 
 type RefreshToken struct {
 	ID        string
 	UserID    string
 	Token     string
+	FamilyID  string
+	UserAgent string
+	IPAddress string
+	// SessionStartedAt is when the login that started the family happened.
+	SessionStartedAt time.Time
+	// RotatedAt is set once the token has been exchanged for a new one.
+	RotatedAt *time.Time
 	ExpiresAt time.Time
 	CreatedAt time.Time
+	// ClientID and Scopes are set for tokens issued to OAuth clients.
+	ClientID string
+	Scopes   []string
+}
+
+// Session is a login as seen by the user: the live token of one token family.
+type Session struct {
+	ID         string
+	UserID     string
+	UserAgent  string
+	IPAddress  string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time
+}
+
+type SecurityEvent struct {
+	ID        string
+	UserID    string
+	Type      string
+	Details   map[string]string
+	IPAddress string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+// SecurityEventFilter selects a page of events. Empty fields match every
+// event; Since and Until bound created_at when they are set.
+type SecurityEventFilter struct {
+	UserID string
+	Type   string
+	Since  *time.Time
+	Until  *time.Time
+	Limit  int
+	Offset int
+}
+
+type Role struct {
+	Name        string
+	Description string
+	Permissions []string
+}
+
+// RoleMember is a user holding a role.
+type RoleMember struct {
+	UserID   string
+	Username string
+}
+
+// OneTimeToken is a single-use secret mailed to a user, such as a password
+// reset or email verification link. Only the SHA-256 hash of the secret is stored.
+type OneTimeToken struct {
+	ID        string
+	UserID    string
+	TokenHash string
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// MFASecret is a user's TOTP enrollment.
+type MFASecret struct {
+	UserID string
+	Secret string
+	// EnabledAt is nil while enrollment is pending confirmation.
+	EnabledAt    *time.Time
+	LastUsedStep int64
+	CreatedAt    time.Time
+}
+
+// PersonalAccessToken is a long-lived token for bots and scripts, limited to
+// its scopes. Only the SHA-256 hash of the token is stored.
+type PersonalAccessToken struct {
+	ID        string
+	UserID    string
+	Name      string
+	TokenHash string
+	Scopes    []string
+	// ExpiresAt is nil for tokens that do not expire.
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+}
+
+// InviteCode lets people register while registration is invite-only. Only
+// the SHA-256 hash of the code is stored.
+type InviteCode struct {
+	ID       string
+	CodeHash string
+	Note     string
+	MaxUses  int
+	Uses     int
+	// ExpiresAt is nil for codes that do not expire.
+	ExpiresAt *time.Time
+	CreatedBy string
+	CreatedAt time.Time
+}
+
+// OAuthClient is an application registered to use the auth service as its
+// OAuth2 authorization server.
+type OAuthClient struct {
+	ID string
+	// SecretHash is empty for public clients, which cannot keep a secret.
+	SecretHash   string
+	Name         string
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+	// ServiceAccount marks a client that calls other services as itself. It
+	// only uses the client credentials grant.
+	ServiceAccount bool
+	CreatedAt      time.Time
+}
+
+// AuthorizationCode is an OAuth2 authorization code waiting to be exchanged
+// for tokens. Only the SHA-256 hash of the code is stored.
+type AuthorizationCode struct {
+	CodeHash    string
+	ClientID    string
+	UserID      string
+	RedirectURI string
+	Scopes      []string
+	// CodeChallenge is the PKCE S256 challenge, empty if none was sent.
+	CodeChallenge string
+	Nonce         string
+	ExpiresAt     time.Time
+	CreatedAt     time.Time
+}
+
+// ExternalIdentity links a user to their account at an external OpenID
+// provider. A user can have several.
+type ExternalIdentity struct {
+	ID      string
+	UserID  string
+	Issuer  string
+	Subject string
+	Email   string
+	// LastLoginAt is nil until the identity is first used to log in.
+	LastLoginAt *time.Time
+	CreatedAt   time.Time
+}
+
+// LoginAttempt is the failed login state of one throttling key.
+type LoginAttempt struct {
+	Key           string
+	Failures      int
+	LastFailureAt time.Time
+	// LockedUntil is zero when the key is not locked.
+	LockedUntil time.Time
 }
 
 type UserRepository interface {
 	Create(ctx context.Context, user *User) error
+	// CreateWithRole inserts the user together with their first role, in
+	// one transaction.
+	CreateWithRole(ctx context.Context, user *User, role, grantedBy string) error
 	GetByUsername(ctx context.Context, username string) (*User, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
 	GetByID(ctx context.Context, id string) (*User, error)
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	MarkEmailVerified(ctx context.Context, id string) error
+	List(ctx context.Context, filter UserFilter) ([]User, int, error)
+	// Suspend suspends the user until the given time, or indefinitely if
+	// until is nil.
+	Suspend(ctx context.Context, id, reason string, until *time.Time) error
+	Unsuspend(ctx context.Context, id string) error
+	// SetTokensValidAfter revokes the access tokens issued to the user at
+	// or before the given time.
+	SetTokensValidAfter(ctx context.Context, id string, at time.Time) error
+	// Delete removes the user with everything that belongs to them and
+	// records the deletion for ListDeletions.
+	Delete(ctx context.Context, id string) error
+	// ListDeletions returns deleted users after the deletion with ID afterID,
+	// oldest first.
+	ListDeletions(ctx context.Context, afterID int64, limit int) ([]UserDeletion, error)
+	UpdateProfile(ctx context.Context, id, displayName, bio, avatarURL string) error
+	// Rename changes the username and records the change. It returns
+	// ErrConflict if the username is taken.
+	Rename(ctx context.Context, id, username string) (*UsernameChange, error)
+	// UsernameHistory returns the user's renames, most recent first.
+	UsernameHistory(ctx context.Context, id string) ([]UsernameChange, error)
+	// ListUsernameChanges returns up to limit renames of any user with an ID
+	// greater than afterID, oldest first.
+	ListUsernameChanges(ctx context.Context, afterID int64, limit int) ([]UsernameChange, error)
+	// PreviousOwner returns the ID of the last user to rename away from
+	// username, or ErrNotFound if nobody has.
+	PreviousOwner(ctx context.Context, username string) (string, error)
+	SetPendingEmail(ctx context.Context, id, email string) error
+	// ConfirmPendingEmail makes the pending address the user's verified
+	// email. It returns ErrNotFound if there is no pending address and
+	// ErrConflict if another account has taken it since.
+	ConfirmPendingEmail(ctx context.Context, id string) error
+	// Approve clears PendingApproval, returning ErrNotFound if the user is
+	// not waiting for approval.
+	Approve(ctx context.Context, id string) error
 }
 
 type TokenRepository interface {
@@ -34,4 +278,145 @@ type TokenRepository interface {
 	Get(ctx context.Context, token string) (*RefreshToken, error)
 	Delete(ctx context.Context, token string) error
 	DeleteAllForUser(ctx context.Context, userID string) error
+	// MarkRotated flags a token as used. It returns ErrConflict if the token
+	// had already been rotated.
+	MarkRotated(ctx context.Context, id string) error
+	DeleteFamily(ctx context.Context, familyID string) error
+	ListSessions(ctx context.Context, userID string) ([]Session, error)
+	// DeleteSession revokes one of the user's sessions. It returns ErrNotFound
+	// if the session does not exist or belongs to someone else.
+	DeleteSession(ctx context.Context, userID, sessionID string) error
+	DeleteOtherSessions(ctx context.Context, userID, keepSessionID string) error
+	// DeleteExpired removes expired refresh tokens, which can no longer be
+	// used or reveal reuse, and returns how many there were.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type RoleRepository interface {
+	List(ctx context.Context) ([]Role, error)
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+	Assign(ctx context.Context, userID, role, grantedBy string) error
+	Revoke(ctx context.Context, userID, role string) error
+	// Create adds a role without permissions. It returns ErrConflict if the
+	// name is taken.
+	Create(ctx context.Context, role *Role) error
+	// Delete removes a role from everyone holding it and then the role.
+	Delete(ctx context.Context, name string) error
+	// ListMembers returns the users holding role, ordered by username.
+	ListMembers(ctx context.Context, role string) ([]RoleMember, error)
+}
+
+type SecurityEventRepository interface {
+	Create(ctx context.Context, event *SecurityEvent) error
+	// ListForUser returns the user's events, newest first.
+	ListForUser(ctx context.Context, userID string) ([]SecurityEvent, error)
+	// List returns a page of events matching filter, newest first, and the
+	// number of matching events.
+	List(ctx context.Context, filter SecurityEventFilter) ([]SecurityEvent, int, error)
+}
+
+// OneTimeTokenRepository stores the tokens behind emailed links. Password
+// reset and email verification tokens live in separate tables.
+type OneTimeTokenRepository interface {
+	Create(ctx context.Context, token *OneTimeToken) error
+	// Consume marks an unexpired, unused token as used and returns it. It
+	// returns ErrNotFound if no such token exists.
+	Consume(ctx context.Context, tokenHash string) (*OneTimeToken, error)
+	DeleteAllForUser(ctx context.Context, userID string) error
+	// DeleteExpired removes tokens that have expired or been used.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type MFARepository interface {
+	Get(ctx context.Context, userID string) (*MFASecret, error)
+	// Save stores a new pending enrollment, replacing any previous one.
+	Save(ctx context.Context, secret *MFASecret) error
+	Enable(ctx context.Context, userID string) error
+	// Delete removes the enrollment together with its recovery codes.
+	Delete(ctx context.Context, userID string) error
+	// UseStep records that the TOTP code for step was accepted. It returns
+	// ErrConflict if that step or a later one was already used.
+	UseStep(ctx context.Context, userID string, step int64) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+	// UseRecoveryCode marks an unused recovery code as used. It returns
+	// ErrNotFound if there is no such code.
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) error
+}
+
+// LoginAttemptRepository stores failed login counters. The Postgres
+// implementation is shared by all replicas; the in-memory one is for single
+// instance deployments and tests.
+type LoginAttemptRepository interface {
+	// Get returns the state of key, or a zero LoginAttempt if it has no failures.
+	Get(ctx context.Context, key string) (*LoginAttempt, error)
+	// RecordFailure increments the failure count of key and returns the new
+	// count. Counts older than window start again from one.
+	RecordFailure(ctx context.Context, key string, window time.Duration) (int, error)
+	Lock(ctx context.Context, key string, until time.Time) error
+	Reset(ctx context.Context, key string) error
+	// DeleteStale removes keys whose last failure is older than window and
+	// which are not locked, as their count would start again anyway.
+	DeleteStale(ctx context.Context, window time.Duration) (int64, error)
+}
+
+type PersonalAccessTokenRepository interface {
+	Create(ctx context.Context, token *PersonalAccessToken) error
+	GetByHash(ctx context.Context, tokenHash string) (*PersonalAccessToken, error)
+	ListForUser(ctx context.Context, userID string) ([]PersonalAccessToken, error)
+	// Delete removes a token owned by userID, returning ErrNotFound otherwise.
+	Delete(ctx context.Context, userID, id string) error
+	MarkUsed(ctx context.Context, id string) error
+}
+
+type InviteCodeRepository interface {
+	Create(ctx context.Context, invite *InviteCode) error
+	List(ctx context.Context) ([]InviteCode, error)
+	Delete(ctx context.Context, id string) error
+	// Redeem uses up one use of the code, returning ErrNotFound if it does
+	// not exist, has expired or has no uses left.
+	Redeem(ctx context.Context, codeHash string) (*InviteCode, error)
+	// Release gives back a use taken by Redeem when registration fails.
+	Release(ctx context.Context, id string) error
+}
+
+type OAuthClientRepository interface {
+	Create(ctx context.Context, client *OAuthClient) error
+	Get(ctx context.Context, id string) (*OAuthClient, error)
+	List(ctx context.Context) ([]OAuthClient, error)
+	Delete(ctx context.Context, id string) error
+}
+
+type AuthorizationCodeRepository interface {
+	Create(ctx context.Context, code *AuthorizationCode) error
+	// Consume marks an unexpired, unused code as used and returns it. It
+	// returns ErrNotFound if no such code exists.
+	Consume(ctx context.Context, codeHash string) (*AuthorizationCode, error)
+}
+
+type ExternalIdentityRepository interface {
+	// Create returns ErrConflict if the identity is already linked.
+	Create(ctx context.Context, identity *ExternalIdentity) error
+	GetBySubject(ctx context.Context, issuer, subject string) (*ExternalIdentity, error)
+	ListForUser(ctx context.Context, userID string) ([]ExternalIdentity, error)
+	Delete(ctx context.Context, userID, id string) error
+	MarkUsed(ctx context.Context, id string) error
+}
+
+// RevokedTokenRepository is the list of access tokens revoked before they
+// expire. Entries are only kept until the token's own expiry.
+type RevokedTokenRepository interface {
+	// Revoke adds jti to the list. Revoking a token twice is not an error.
+	Revoke(ctx context.Context, jti string, expiresAt time.Time) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+	// DeleteExpired removes entries for tokens that have expired anyway.
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+// JobLock makes sure that only one replica runs a background job at a time.
+type JobLock interface {
+	// TryLock takes the lock called name without waiting. It returns false
+	// if another replica holds it. Otherwise release must be called once the
+	// job is done.
+	TryLock(ctx context.Context, name string) (release func(), ok bool, err error)
 }
@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+type inviteCodeRepository struct {
+	db *sql.DB
+}
+
+func NewInviteCodeRepository(db *sql.DB) InviteCodeRepository {
+	return &inviteCodeRepository{db: db}
+}
+
+const inviteCodeColumns = `id, code_hash, note, max_uses, uses, expires_at, COALESCE(created_by::text, ''), created_at`
+
+func (r *inviteCodeRepository) Create(ctx context.Context, invite *InviteCode) error {
+	query := `
+		INSERT INTO invite_codes (code_hash, note, max_uses, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::uuid)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		invite.CodeHash,
+		invite.Note,
+		invite.MaxUses,
+		invite.ExpiresAt,
+		invite.CreatedBy,
+	).Scan(&invite.ID, &invite.CreatedAt)
+}
+
+func (r *inviteCodeRepository) List(ctx context.Context) ([]InviteCode, error) {
+	query := `
+		SELECT ` + inviteCodeColumns + `
+		FROM invite_codes
+		ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invites []InviteCode
+	for rows.Next() {
+		invite, err := scanInviteCode(rows)
+		if err != nil {
+			return nil, err
+		}
+		invites = append(invites, *invite)
+	}
+	return invites, rows.Err()
+}
+
+func (r *inviteCodeRepository) Delete(ctx context.Context, id string) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM invite_codes WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *inviteCodeRepository) Redeem(ctx context.Context, codeHash string) (*InviteCode, error) {
+	// The use is counted in the same statement that checks the limit, so
+	// concurrent registrations cannot overdraw a code
+	query := `
+		UPDATE invite_codes
+		SET uses = uses + 1
+		WHERE code_hash = $1
+		  AND uses < max_uses
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+		RETURNING id, code_hash, note, max_uses, uses, expires_at, COALESCE(created_by::text, ''), created_at`
+
+	invite, err := scanInviteCode(r.db.QueryRowContext(ctx, query, codeHash))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return invite, nil
+}
+
+func (r *inviteCodeRepository) Release(ctx context.Context, id string) error {
+	query := `UPDATE invite_codes SET uses = uses - 1 WHERE id = $1 AND uses > 0`
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+func scanInviteCode(row rowScanner) (*InviteCode, error) {
+	var invite InviteCode
+	err := row.Scan(
+		&invite.ID,
+		&invite.CodeHash,
+		&invite.Note,
+		&invite.MaxUses,
+		&invite.Uses,
+		&invite.ExpiresAt,
+		&invite.CreatedBy,
+		&invite.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+)
+
+// advisoryJobLock implements JobLock with Postgres advisory locks. They
+// belong to a session, so each lock holds on to a connection of its own.
+type advisoryJobLock struct {
+	db *sql.DB
+}
+
+func NewAdvisoryJobLock(db *sql.DB) JobLock {
+	return &advisoryJobLock{db: db}
+}
+
+func (l *advisoryJobLock) TryLock(ctx context.Context, name string) (func(), bool, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock(hashtext($1))`, name).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		return nil, false, err
+	}
+
+	release := func() {
+		_, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock(hashtext($1))`, name)
+		if err != nil {
+			// Closing the session is the only other way to release the lock,
+			// so the connection must not go back to the pool
+			conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+		}
+		conn.Close()
+	}
+	return release, true, nil
+}
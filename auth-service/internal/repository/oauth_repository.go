@@ -0,0 +1,163 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type oauthClientRepository struct {
+	db *sql.DB
+}
+
+func NewOAuthClientRepository(db *sql.DB) OAuthClientRepository {
+	return &oauthClientRepository{db: db}
+}
+
+func (r *oauthClientRepository) Create(ctx context.Context, client *OAuthClient) error {
+	query := `
+		INSERT INTO oauth_clients (id, secret_hash, name, redirect_uris, grant_types, scopes, service_account)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		client.ID,
+		client.SecretHash,
+		client.Name,
+		pq.Array(client.RedirectURIs),
+		pq.Array(client.GrantTypes),
+		pq.Array(client.Scopes),
+		client.ServiceAccount,
+	).Scan(&client.CreatedAt)
+}
+
+func (r *oauthClientRepository) Get(ctx context.Context, id string) (*OAuthClient, error) {
+	query := `
+		SELECT id, secret_hash, name, redirect_uris, grant_types, scopes, service_account, created_at
+		FROM oauth_clients
+		WHERE id = $1`
+
+	client, err := scanOAuthClient(r.db.QueryRowContext(ctx, query, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+func (r *oauthClientRepository) List(ctx context.Context) ([]OAuthClient, error) {
+	query := `
+		SELECT id, secret_hash, name, redirect_uris, grant_types, scopes, service_account, created_at
+		FROM oauth_clients
+		ORDER BY created_at`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var clients []OAuthClient
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, *client)
+	}
+	return clients, rows.Err()
+}
+
+func (r *oauthClientRepository) Delete(ctx context.Context, id string) error {
+	query := `DELETE FROM oauth_clients WHERE id = $1`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func scanOAuthClient(row rowScanner) (*OAuthClient, error) {
+	client := &OAuthClient{}
+	err := row.Scan(
+		&client.ID,
+		&client.SecretHash,
+		&client.Name,
+		pq.Array(&client.RedirectURIs),
+		pq.Array(&client.GrantTypes),
+		pq.Array(&client.Scopes),
+		&client.ServiceAccount,
+		&client.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return client, nil
+}
+
+type authorizationCodeRepository struct {
+	db *sql.DB
+}
+
+func NewAuthorizationCodeRepository(db *sql.DB) AuthorizationCodeRepository {
+	return &authorizationCodeRepository{db: db}
+}
+
+func (r *authorizationCodeRepository) Create(ctx context.Context, code *AuthorizationCode) error {
+	query := `
+		INSERT INTO oauth_authorization_codes (code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		code.CodeHash,
+		code.ClientID,
+		code.UserID,
+		code.RedirectURI,
+		pq.Array(code.Scopes),
+		code.CodeChallenge,
+		code.Nonce,
+		code.ExpiresAt,
+	).Scan(&code.CreatedAt)
+}
+
+func (r *authorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*AuthorizationCode, error) {
+	code := &AuthorizationCode{}
+	query := `
+		UPDATE oauth_authorization_codes
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE code_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING code_hash, client_id, user_id, redirect_uri, scopes, code_challenge, nonce, expires_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, codeHash).Scan(
+		&code.CodeHash,
+		&code.ClientID,
+		&code.UserID,
+		&code.RedirectURI,
+		pq.Array(&code.Scopes),
+		&code.CodeChallenge,
+		&code.Nonce,
+		&code.ExpiresAt,
+		&code.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return code, nil
+}
@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// oneTimeTokenRepository implements OneTimeTokenRepository on top of one of
+// the tables that share the one-time token layout.
+type oneTimeTokenRepository struct {
+	db    *sql.DB
+	table string
+}
+
+func NewPasswordResetRepository(db *sql.DB) OneTimeTokenRepository {
+	return &oneTimeTokenRepository{db: db, table: "password_reset_tokens"}
+}
+
+func NewEmailVerificationRepository(db *sql.DB) OneTimeTokenRepository {
+	return &oneTimeTokenRepository{db: db, table: "email_verification_tokens"}
+}
+
+func NewEmailChangeRepository(db *sql.DB) OneTimeTokenRepository {
+	return &oneTimeTokenRepository{db: db, table: "email_change_tokens"}
+}
+
+func NewMagicLinkRepository(db *sql.DB) OneTimeTokenRepository {
+	return &oneTimeTokenRepository{db: db, table: "magic_link_tokens"}
+}
+
+func (r *oneTimeTokenRepository) Create(ctx context.Context, token *OneTimeToken) error {
+	query := `
+		INSERT INTO ` + r.table + ` (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		token.UserID,
+		token.TokenHash,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+}
+
+func (r *oneTimeTokenRepository) Consume(ctx context.Context, tokenHash string) (*OneTimeToken, error) {
+	token := &OneTimeToken{}
+	var usedAt time.Time
+	query := `
+		UPDATE ` + r.table + `
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING id, user_id, token_hash, expires_at, used_at, created_at`
+
+	err := r.db.QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&usedAt,
+		&token.CreatedAt,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	token.UsedAt = &usedAt
+	return token, nil
+}
+
+func (r *oneTimeTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	query := `DELETE FROM ` + r.table + ` WHERE user_id = $1`
+	_, err := r.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (r *oneTimeTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM ` + r.table + ` WHERE expires_at < CURRENT_TIMESTAMP OR used_at IS NOT NULL`
+
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
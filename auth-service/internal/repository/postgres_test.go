@@ -1,9 +1,12 @@
 package repository
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -73,6 +76,262 @@ func TestUserRepository_Integration(t *testing.T) {
 	})
 }
 
+func TestUserRepository_Admin_Integration(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	ctx := context.Background()
+
+	suffix := uuid.New().String()[:8]
+	user := &User{Username: "admin-list-" + suffix, Email: "admin-list-" + suffix + "@example.com", PasswordHash: "hash"}
+	require.NoError(t, repo.Create(ctx, user))
+
+	t.Run("search and page", func(t *testing.T) {
+		users, total, err := repo.List(ctx, UserFilter{Query: "ADMIN-LIST-" + suffix, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		require.Len(t, users, 1)
+		assert.Equal(t, user.ID, users[0].ID)
+
+		users, total, err = repo.List(ctx, UserFilter{Query: suffix, Limit: 10, Offset: 1})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+		assert.Empty(t, users)
+	})
+
+	t.Run("suspend and unsuspend", func(t *testing.T) {
+		until := time.Now().Add(time.Hour).Truncate(time.Microsecond)
+		require.NoError(t, repo.Suspend(ctx, user.ID, "spam", &until))
+
+		found, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, found.SuspendedAt)
+		require.NotNil(t, found.SuspendedUntil)
+		assert.True(t, until.Equal(*found.SuspendedUntil))
+		assert.Equal(t, "spam", found.SuspensionReason)
+
+		_, total, err := repo.List(ctx, UserFilter{Query: suffix, SuspendedOnly: true, Limit: 10})
+		require.NoError(t, err)
+		assert.Equal(t, 1, total)
+
+		require.NoError(t, repo.Unsuspend(ctx, user.ID))
+		found, err = repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, found.SuspendedAt)
+		assert.Empty(t, found.SuspensionReason)
+
+		_, total, err = repo.List(ctx, UserFilter{Query: suffix, SuspendedOnly: true, Limit: 10})
+		require.NoError(t, err)
+		assert.Zero(t, total)
+	})
+
+	t.Run("revoke tokens", func(t *testing.T) {
+		found, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Nil(t, found.TokensValidAfter)
+
+		at := time.Now().Truncate(time.Microsecond)
+		require.NoError(t, repo.SetTokensValidAfter(ctx, user.ID, at))
+		found, err = repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		require.NotNil(t, found.TokensValidAfter)
+		assert.True(t, at.Equal(*found.TokensValidAfter))
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, user.ID))
+		assert.ErrorIs(t, repo.Delete(ctx, user.ID), ErrNotFound)
+		assert.ErrorIs(t, repo.Suspend(ctx, user.ID, "spam", nil), ErrNotFound)
+
+		_, err := repo.GetByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repo.GetByUsername(ctx, user.Username)
+		assert.ErrorIs(t, err, ErrNotFound)
+		_, err = repo.GetByEmail(ctx, user.Email)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestUserRepository_Profile_Integration(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	ctx := context.Background()
+
+	suffix := uuid.New().String()[:8]
+	user := &User{Username: "profile-" + suffix, Email: "profile-" + suffix + "@example.com", PasswordHash: "hash"}
+	require.NoError(t, repo.Create(ctx, user))
+	other := &User{Username: "profile-other-" + suffix, Email: "profile-other-" + suffix + "@example.com", PasswordHash: "hash"}
+	require.NoError(t, repo.Create(ctx, other))
+	defer repo.Delete(ctx, user.ID)
+	defer repo.Delete(ctx, other.ID)
+
+	t.Run("update profile", func(t *testing.T) {
+		require.NoError(t, repo.UpdateProfile(ctx, user.ID, "Profile", "bio", "https://example.com/a.png"))
+
+		found, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Profile", found.DisplayName)
+		assert.Equal(t, "bio", found.Bio)
+		assert.Equal(t, "https://example.com/a.png", found.AvatarURL)
+	})
+
+	t.Run("rename", func(t *testing.T) {
+		change, err := repo.Rename(ctx, user.ID, "renamed-"+suffix)
+		require.NoError(t, err)
+		assert.Equal(t, "profile-"+suffix, change.OldUsername)
+
+		_, err = repo.Rename(ctx, user.ID, other.Username)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		history, err := repo.UsernameHistory(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, history, 1)
+		assert.Equal(t, change.ID, history[0].ID)
+
+		owner, err := repo.PreviousOwner(ctx, "profile-"+suffix)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, owner)
+
+		changes, err := repo.ListUsernameChanges(ctx, change.ID-1, 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, changes)
+		assert.Equal(t, change.ID, changes[0].ID)
+	})
+
+	t.Run("pending email", func(t *testing.T) {
+		assert.ErrorIs(t, repo.ConfirmPendingEmail(ctx, user.ID), ErrNotFound)
+
+		require.NoError(t, repo.SetPendingEmail(ctx, user.ID, other.Email))
+		assert.ErrorIs(t, repo.ConfirmPendingEmail(ctx, user.ID), ErrConflict)
+
+		require.NoError(t, repo.SetPendingEmail(ctx, user.ID, "new-"+suffix+"@example.com"))
+		require.NoError(t, repo.ConfirmPendingEmail(ctx, user.ID))
+
+		found, err := repo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "new-"+suffix+"@example.com", found.Email)
+		assert.Empty(t, found.PendingEmail)
+		assert.NotNil(t, found.EmailVerifiedAt)
+	})
+}
+
+func TestUserRepository_Deletion_Integration(t *testing.T) {
+	repo := NewUserRepository(testDB)
+	eventRepo := NewSecurityEventRepository(testDB)
+	ctx := context.Background()
+
+	suffix := uuid.New().String()[:8]
+	user := &User{Username: "deleted-" + suffix, Email: "deleted-" + suffix + "@example.com", PasswordHash: "hash"}
+	require.NoError(t, repo.Create(ctx, user))
+
+	require.NoError(t, eventRepo.Create(ctx, &SecurityEvent{UserID: user.ID, Type: "login", Details: map[string]string{"ip": "203.0.113.1"}}))
+	events, err := eventRepo.ListForUser(ctx, user.ID)
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, "203.0.113.1", events[0].Details["ip"])
+
+	require.NoError(t, repo.Delete(ctx, user.ID))
+	assert.ErrorIs(t, repo.Delete(ctx, user.ID), ErrNotFound)
+
+	events, err = eventRepo.ListForUser(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Len(t, events, 1, "the audit log keeps events of deleted users")
+
+	deletions, err := repo.ListDeletions(ctx, 0, 1000)
+	require.NoError(t, err)
+	var deleted []string
+	for _, deletion := range deletions {
+		deleted = append(deleted, deletion.UserID)
+	}
+	assert.Contains(t, deleted, user.ID)
+}
+
+func TestSecurityEventRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	var sink bytes.Buffer
+	eventRepo := NewFileSecurityEventRepository(NewSecurityEventRepository(testDB), &sink)
+	ctx := context.Background()
+
+	suffix := uuid.New().String()[:8]
+	user := &User{Username: "audited-" + suffix, Email: "audited-" + suffix + "@example.com", PasswordHash: "hash"}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	start := time.Now().Add(-time.Second)
+	require.NoError(t, eventRepo.Create(ctx, &SecurityEvent{UserID: user.ID, Type: "login_succeeded", IPAddress: "203.0.113.1", UserAgent: "curl/8.5"}))
+	require.NoError(t, eventRepo.Create(ctx, &SecurityEvent{UserID: user.ID, Type: "logged_out"}))
+	require.NoError(t, eventRepo.Create(ctx, &SecurityEvent{Type: "login_failed", Details: map[string]string{"username": "audited-" + suffix}}))
+
+	events, total, err := eventRepo.List(ctx, SecurityEventFilter{UserID: user.ID, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 2, total)
+	require.Len(t, events, 2)
+	assert.Equal(t, "logged_out", events[0].Type)
+
+	events, total, err = eventRepo.List(ctx, SecurityEventFilter{UserID: user.ID, Type: "login_succeeded", Since: &start, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, total)
+	require.Len(t, events, 1)
+	assert.Equal(t, "203.0.113.1", events[0].IPAddress)
+	assert.Equal(t, "curl/8.5", events[0].UserAgent)
+
+	_, total, err = eventRepo.List(ctx, SecurityEventFilter{UserID: user.ID, Until: &start, Limit: 10})
+	require.NoError(t, err)
+	assert.Zero(t, total)
+
+	lines := strings.Split(strings.TrimSpace(sink.String()), "\n")
+	require.Len(t, lines, 3)
+	var line map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(lines[2]), &line))
+	assert.Equal(t, "login_failed", line["type"])
+	assert.NotContains(t, line, "user_id")
+}
+
+func TestInviteCodeRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	inviteRepo := NewInviteCodeRepository(testDB)
+	ctx := context.Background()
+
+	invite := &InviteCode{CodeHash: uuid.New().String(), Note: "book club", MaxUses: 1}
+	require.NoError(t, inviteRepo.Create(ctx, invite))
+
+	redeemed, err := inviteRepo.Redeem(ctx, invite.CodeHash)
+	require.NoError(t, err)
+	assert.Equal(t, 1, redeemed.Uses)
+
+	_, err = inviteRepo.Redeem(ctx, invite.CodeHash)
+	assert.ErrorIs(t, err, ErrNotFound, "used up")
+
+	require.NoError(t, inviteRepo.Release(ctx, invite.ID))
+	_, err = inviteRepo.Redeem(ctx, invite.CodeHash)
+	require.NoError(t, err)
+
+	expired := time.Now().Add(-time.Minute)
+	old := &InviteCode{CodeHash: uuid.New().String(), MaxUses: 5, ExpiresAt: &expired}
+	require.NoError(t, inviteRepo.Create(ctx, old))
+	_, err = inviteRepo.Redeem(ctx, old.CodeHash)
+	assert.ErrorIs(t, err, ErrNotFound, "expired")
+
+	suffix := uuid.New().String()[:8]
+	user := &User{Username: "invited-" + suffix, Email: "invited-" + suffix + "@example.com", PasswordHash: "hash", InviteCodeID: invite.ID, PendingApproval: true}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	found, err := userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, invite.ID, found.InviteCodeID)
+	assert.True(t, found.PendingApproval)
+
+	pending, _, err := userRepo.List(ctx, UserFilter{PendingOnly: true, Query: user.Username, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	require.NoError(t, userRepo.Approve(ctx, user.ID))
+	assert.ErrorIs(t, userRepo.Approve(ctx, user.ID), ErrNotFound)
+
+	require.NoError(t, inviteRepo.Delete(ctx, invite.ID))
+	assert.ErrorIs(t, inviteRepo.Delete(ctx, invite.ID), ErrNotFound)
+	found, err = userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Empty(t, found.InviteCodeID)
+	assert.False(t, found.PendingApproval)
+}
+
 func TestTokenRepository_Integration(t *testing.T) {
 	userRepo := NewUserRepository(testDB)
 	tokenRepo := NewTokenRepository(testDB)
@@ -91,6 +350,7 @@ func TestTokenRepository_Integration(t *testing.T) {
 		token := &RefreshToken{
 			UserID:    user.ID,
 			Token:     "testtoken",
+			FamilyID:  uuid.New().String(),
 			ExpiresAt: time.Now().Add(time.Hour),
 		}
 
@@ -131,11 +391,13 @@ func TestTokenRepository_Integration(t *testing.T) {
 		token1 := &RefreshToken{
 			UserID:    user.ID,
 			Token:     "token1",
+			FamilyID:  uuid.New().String(),
 			ExpiresAt: time.Now().Add(time.Hour),
 		}
 		token2 := &RefreshToken{
 			UserID:    user.ID,
 			Token:     "token2",
+			FamilyID:  uuid.New().String(),
 			ExpiresAt: time.Now().Add(time.Hour),
 		}
 
@@ -154,4 +416,797 @@ func TestTokenRepository_Integration(t *testing.T) {
 		_, err = tokenRepo.Get(ctx, token2.Token)
 		assert.Error(t, err)
 	})
+
+	t.Run("rotate and delete token family", func(t *testing.T) {
+		user := &User{
+			Username:     "familyuser",
+			Email:        "family@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		err := userRepo.Create(ctx, user)
+		require.NoError(t, err)
+
+		familyID := uuid.New().String()
+		first := &RefreshToken{
+			UserID:    user.ID,
+			Token:     "family-token1",
+			FamilyID:  familyID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		second := &RefreshToken{
+			UserID:    user.ID,
+			Token:     "family-token2",
+			FamilyID:  familyID,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, tokenRepo.Create(ctx, first))
+		require.NoError(t, tokenRepo.Create(ctx, second))
+
+		err = tokenRepo.MarkRotated(ctx, first.ID)
+		require.NoError(t, err)
+
+		// Rotating twice is reported as a conflict
+		err = tokenRepo.MarkRotated(ctx, first.ID)
+		assert.ErrorIs(t, err, ErrConflict)
+
+		found, err := tokenRepo.Get(ctx, first.Token)
+		require.NoError(t, err)
+		assert.NotNil(t, found.RotatedAt)
+		assert.Equal(t, familyID, found.FamilyID)
+
+		err = tokenRepo.DeleteFamily(ctx, familyID)
+		require.NoError(t, err)
+
+		_, err = tokenRepo.Get(ctx, first.Token)
+		assert.Error(t, err)
+		_, err = tokenRepo.Get(ctx, second.Token)
+		assert.Error(t, err)
+	})
+
+	t.Run("delete expired tokens", func(t *testing.T) {
+		user := &User{
+			Username:     "expireduser",
+			Email:        "expired@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		require.NoError(t, userRepo.Create(ctx, user))
+
+		expired := &RefreshToken{
+			UserID:    user.ID,
+			Token:     "expired-token",
+			FamilyID:  uuid.New().String(),
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}
+		valid := &RefreshToken{
+			UserID:    user.ID,
+			Token:     "unexpired-token",
+			FamilyID:  uuid.New().String(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, tokenRepo.Create(ctx, expired))
+		require.NoError(t, tokenRepo.Create(ctx, valid))
+
+		deleted, err := tokenRepo.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, int64(1))
+
+		_, err = tokenRepo.Get(ctx, expired.Token)
+		assert.Error(t, err)
+		_, err = tokenRepo.Get(ctx, valid.Token)
+		assert.NoError(t, err)
+	})
+}
+
+func TestTokenRepository_Sessions_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	tokenRepo := NewTokenRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "sessionuser",
+		Email:        "session@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	laptop := &RefreshToken{
+		UserID:           user.ID,
+		Token:            "laptop-token",
+		FamilyID:         uuid.New().String(),
+		UserAgent:        "laptop",
+		IPAddress:        "10.0.0.1",
+		SessionStartedAt: time.Now(),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	phone := &RefreshToken{
+		UserID:           user.ID,
+		Token:            "phone-token",
+		FamilyID:         uuid.New().String(),
+		UserAgent:        "phone",
+		IPAddress:        "10.0.0.2",
+		SessionStartedAt: time.Now(),
+		ExpiresAt:        time.Now().Add(time.Hour),
+	}
+	require.NoError(t, tokenRepo.Create(ctx, laptop))
+	require.NoError(t, tokenRepo.Create(ctx, phone))
+
+	t.Run("list sessions", func(t *testing.T) {
+		sessions, err := tokenRepo.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+
+		agents := []string{sessions[0].UserAgent, sessions[1].UserAgent}
+		assert.ElementsMatch(t, []string{"laptop", "phone"}, agents)
+	})
+
+	t.Run("rotated tokens are not listed", func(t *testing.T) {
+		require.NoError(t, tokenRepo.MarkRotated(ctx, phone.ID))
+		replacement := &RefreshToken{
+			UserID:           user.ID,
+			Token:            "phone-token-2",
+			FamilyID:         phone.FamilyID,
+			UserAgent:        "phone",
+			IPAddress:        "10.0.0.3",
+			SessionStartedAt: phone.SessionStartedAt,
+			ExpiresAt:        time.Now().Add(time.Hour),
+		}
+		require.NoError(t, tokenRepo.Create(ctx, replacement))
+
+		sessions, err := tokenRepo.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 2)
+	})
+
+	t.Run("delete other sessions", func(t *testing.T) {
+		err := tokenRepo.DeleteSession(ctx, uuid.New().String(), laptop.FamilyID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		err = tokenRepo.DeleteOtherSessions(ctx, user.ID, laptop.FamilyID)
+		require.NoError(t, err)
+
+		sessions, err := tokenRepo.ListSessions(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, sessions, 1)
+		assert.Equal(t, laptop.FamilyID, sessions[0].ID)
+
+		err = tokenRepo.DeleteSession(ctx, user.ID, laptop.FamilyID)
+		require.NoError(t, err)
+	})
+}
+
+func TestRoleRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	roleRepo := NewRoleRepository(testDB)
+	ctx := context.Background()
+
+	t.Run("assign, list and revoke roles", func(t *testing.T) {
+		user := &User{
+			Username:     "roleuser",
+			Email:        "role@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		err := userRepo.Create(ctx, user)
+		require.NoError(t, err)
+
+		err = roleRepo.Assign(ctx, user.ID, "moderator", "")
+		require.NoError(t, err)
+
+		// Assigning twice is a no-op
+		err = roleRepo.Assign(ctx, user.ID, "moderator", "")
+		require.NoError(t, err)
+
+		roles, err := roleRepo.GetUserRoles(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"moderator"}, roles)
+
+		permissions, err := roleRepo.GetUserPermissions(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Contains(t, permissions, "posts:moderate")
+		assert.NotContains(t, permissions, "roles:manage")
+
+		err = roleRepo.Revoke(ctx, user.ID, "moderator")
+		require.NoError(t, err)
+
+		err = roleRepo.Revoke(ctx, user.ID, "moderator")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("unknown role", func(t *testing.T) {
+		user := &User{
+			Username:     "unknownroleuser",
+			Email:        "unknownrole@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		err := userRepo.Create(ctx, user)
+		require.NoError(t, err)
+
+		err = roleRepo.Assign(ctx, user.ID, "superuser", "")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("create with role", func(t *testing.T) {
+		user := &User{
+			Username:     "firstroleuser",
+			Email:        "firstrole@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		require.NoError(t, userRepo.CreateWithRole(ctx, user, "user", ""))
+
+		roles, err := roleRepo.GetUserRoles(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"user"}, roles)
+
+		// Provisioned users are stored verified, named and suspended as given
+		now := time.Now()
+		user = &User{
+			Username:         "provisioneduser",
+			Email:            "provisioned@example.com",
+			EmailVerifiedAt:  &now,
+			SuspendedAt:      &now,
+			SuspensionReason: "Deactivated by the directory",
+			DisplayName:      "Provisioned User",
+		}
+		require.NoError(t, userRepo.CreateWithRole(ctx, user, "user", ""))
+		found, err := userRepo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, found.EmailVerifiedAt)
+		assert.NotNil(t, found.SuspendedAt)
+		assert.Equal(t, "Deactivated by the directory", found.SuspensionReason)
+		assert.Equal(t, "Provisioned User", found.DisplayName)
+
+		// The user is not created when the role cannot be granted
+		user = &User{
+			Username:     "norolesuser",
+			Email:        "noroles@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		assert.ErrorIs(t, userRepo.CreateWithRole(ctx, user, "superuser", ""), ErrNotFound)
+		_, err = userRepo.GetByUsername(ctx, "norolesuser")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("list roles", func(t *testing.T) {
+		roles, err := roleRepo.List(ctx)
+		require.NoError(t, err)
+		require.Len(t, roles, 3)
+		assert.Equal(t, "admin", roles[0].Name)
+		assert.Contains(t, roles[0].Permissions, "roles:manage")
+	})
+
+	t.Run("create, list members and delete role", func(t *testing.T) {
+		user := &User{
+			Username:     "groupmember",
+			Email:        "groupmember@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		require.NoError(t, userRepo.Create(ctx, user))
+
+		require.NoError(t, roleRepo.Create(ctx, &Role{Name: "engineering", Description: "Directory group"}))
+		assert.ErrorIs(t, roleRepo.Create(ctx, &Role{Name: "engineering"}), ErrConflict)
+		require.NoError(t, roleRepo.Assign(ctx, user.ID, "engineering", ""))
+
+		members, err := roleRepo.ListMembers(ctx, "engineering")
+		require.NoError(t, err)
+		assert.Equal(t, []RoleMember{{UserID: user.ID, Username: "groupmember"}}, members)
+
+		require.NoError(t, roleRepo.Delete(ctx, "engineering"))
+		assert.ErrorIs(t, roleRepo.Delete(ctx, "engineering"), ErrNotFound)
+		roles, err := roleRepo.GetUserRoles(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Empty(t, roles)
+	})
+}
+
+func TestPasswordResetRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	resetRepo := NewPasswordResetRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "resetuser",
+		Email:        "reset@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	t.Run("token can be consumed once", func(t *testing.T) {
+		token := &OneTimeToken{
+			UserID:    user.ID,
+			TokenHash: "reset-hash-1",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		err := resetRepo.Create(ctx, token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, token.ID)
+
+		consumed, err := resetRepo.Consume(ctx, token.TokenHash)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, consumed.UserID)
+		assert.NotNil(t, consumed.UsedAt)
+
+		_, err = resetRepo.Consume(ctx, token.TokenHash)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("expired token cannot be consumed", func(t *testing.T) {
+		token := &OneTimeToken{
+			UserID:    user.ID,
+			TokenHash: "reset-hash-2",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		}
+		require.NoError(t, resetRepo.Create(ctx, token))
+
+		_, err := resetRepo.Consume(ctx, token.TokenHash)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("expired and used tokens are deleted", func(t *testing.T) {
+		valid := &OneTimeToken{
+			UserID:    user.ID,
+			TokenHash: "reset-hash-3",
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		require.NoError(t, resetRepo.Create(ctx, valid))
+
+		// The tokens of the subtests above are used or expired
+		deleted, err := resetRepo.DeleteExpired(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, deleted, int64(2))
+
+		_, err = resetRepo.Consume(ctx, valid.TokenHash)
+		assert.NoError(t, err)
+	})
+
+	t.Run("update password", func(t *testing.T) {
+		err := userRepo.UpdatePassword(ctx, user.ID, "newhash")
+		require.NoError(t, err)
+
+		found, err := userRepo.GetByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "newhash", found.PasswordHash)
+
+		err = userRepo.UpdatePassword(ctx, uuid.New().String(), "newhash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestEmailVerification_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	verifyRepo := NewEmailVerificationRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "verifyuser",
+		Email:        "verify@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	found, err := userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.Nil(t, found.EmailVerifiedAt)
+
+	token := &OneTimeToken{
+		UserID:    user.ID,
+		TokenHash: "verify-hash-1",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	require.NoError(t, verifyRepo.Create(ctx, token))
+
+	consumed, err := verifyRepo.Consume(ctx, token.TokenHash)
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, consumed.UserID)
+
+	require.NoError(t, userRepo.MarkEmailVerified(ctx, user.ID))
+
+	found, err = userRepo.GetByID(ctx, user.ID)
+	require.NoError(t, err)
+	assert.NotNil(t, found.EmailVerifiedAt)
+}
+
+func TestMFARepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	mfaRepo := NewMFARepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "mfauser",
+		Email:        "mfa@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	t.Run("enroll and enable", func(t *testing.T) {
+		_, err := mfaRepo.Get(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		require.NoError(t, mfaRepo.Save(ctx, &MFASecret{UserID: user.ID, Secret: "SECRET"}))
+
+		secret, err := mfaRepo.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "SECRET", secret.Secret)
+		assert.Nil(t, secret.EnabledAt)
+
+		require.NoError(t, mfaRepo.Enable(ctx, user.ID))
+
+		secret, err = mfaRepo.Get(ctx, user.ID)
+		require.NoError(t, err)
+		assert.NotNil(t, secret.EnabledAt)
+	})
+
+	t.Run("steps cannot be reused", func(t *testing.T) {
+		require.NoError(t, mfaRepo.UseStep(ctx, user.ID, 100))
+		assert.ErrorIs(t, mfaRepo.UseStep(ctx, user.ID, 100), ErrConflict)
+		assert.ErrorIs(t, mfaRepo.UseStep(ctx, user.ID, 99), ErrConflict)
+		require.NoError(t, mfaRepo.UseStep(ctx, user.ID, 101))
+	})
+
+	t.Run("recovery codes", func(t *testing.T) {
+		require.NoError(t, mfaRepo.ReplaceRecoveryCodes(ctx, user.ID, []string{"hash-a", "hash-b"}))
+
+		require.NoError(t, mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-a"))
+		assert.ErrorIs(t, mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-a"), ErrNotFound)
+
+		// Replacing invalidates the old set
+		require.NoError(t, mfaRepo.ReplaceRecoveryCodes(ctx, user.ID, []string{"hash-c"}))
+		assert.ErrorIs(t, mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-b"), ErrNotFound)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, mfaRepo.Delete(ctx, user.ID))
+
+		_, err := mfaRepo.Get(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		assert.ErrorIs(t, mfaRepo.UseRecoveryCode(ctx, user.ID, "hash-c"), ErrNotFound)
+	})
+}
+
+func TestLoginAttemptRepository_Integration(t *testing.T) {
+	ctx := context.Background()
+
+	repos := map[string]LoginAttemptRepository{
+		"postgres": NewLoginAttemptRepository(testDB),
+		"memory":   NewInMemoryLoginAttemptRepository(),
+	}
+	for name, repo := range repos {
+		t.Run(name, func(t *testing.T) {
+			key := "user:attempts-" + name
+
+			attempt, err := repo.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, 0, attempt.Failures)
+			assert.True(t, attempt.LockedUntil.IsZero())
+
+			for i := 1; i <= 3; i++ {
+				failures, err := repo.RecordFailure(ctx, key, time.Hour)
+				require.NoError(t, err)
+				assert.Equal(t, i, failures)
+			}
+
+			until := time.Now().Add(time.Minute)
+			require.NoError(t, repo.Lock(ctx, key, until))
+
+			attempt, err = repo.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, 3, attempt.Failures)
+			assert.WithinDuration(t, until, attempt.LockedUntil, time.Second)
+
+			// Failures outside the window start a new count
+			failures, err := repo.RecordFailure(ctx, key, 0)
+			require.NoError(t, err)
+			assert.Equal(t, 1, failures)
+
+			require.NoError(t, repo.Reset(ctx, key))
+			attempt, err = repo.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, 0, attempt.Failures)
+
+			// Only stale keys without a lock are deleted
+			locked := key + "-locked"
+			_, err = repo.RecordFailure(ctx, key, time.Hour)
+			require.NoError(t, err)
+			_, err = repo.RecordFailure(ctx, locked, time.Hour)
+			require.NoError(t, err)
+			require.NoError(t, repo.Lock(ctx, locked, time.Now().Add(time.Minute)))
+
+			_, err = repo.DeleteStale(ctx, time.Hour)
+			require.NoError(t, err)
+			attempt, err = repo.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, 1, attempt.Failures)
+
+			_, err = repo.DeleteStale(ctx, 0)
+			require.NoError(t, err)
+			attempt, err = repo.Get(ctx, key)
+			require.NoError(t, err)
+			assert.Equal(t, 0, attempt.Failures)
+			attempt, err = repo.Get(ctx, locked)
+			require.NoError(t, err)
+			assert.Equal(t, 1, attempt.Failures)
+			require.NoError(t, repo.Reset(ctx, locked))
+		})
+	}
+}
+
+func TestPersonalAccessTokenRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	patRepo := NewPersonalAccessTokenRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "patuser",
+		Email:        "pat@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	expiresAt := time.Now().Add(time.Hour)
+	token := &PersonalAccessToken{
+		UserID:    user.ID,
+		Name:      "chat bot",
+		TokenHash: "pat-hash",
+		Scopes:    []string{"chat:read", "chat:write"},
+		ExpiresAt: &expiresAt,
+	}
+	require.NoError(t, patRepo.Create(ctx, token))
+	assert.NotEmpty(t, token.ID)
+
+	t.Run("get by hash", func(t *testing.T) {
+		found, err := patRepo.GetByHash(ctx, "pat-hash")
+		require.NoError(t, err)
+		assert.Equal(t, token.ID, found.ID)
+		assert.Equal(t, []string{"chat:read", "chat:write"}, found.Scopes)
+		assert.WithinDuration(t, expiresAt, *found.ExpiresAt, time.Second)
+		assert.Nil(t, found.LastUsedAt)
+
+		_, err = patRepo.GetByHash(ctx, "other-hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("mark used and list", func(t *testing.T) {
+		require.NoError(t, patRepo.MarkUsed(ctx, token.ID))
+
+		tokens, err := patRepo.ListForUser(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		assert.NotNil(t, tokens[0].LastUsedAt)
+	})
+
+	t.Run("delete only by owner", func(t *testing.T) {
+		other := &User{
+			Username:     "patother",
+			Email:        "patother@example.com",
+			PasswordHash: "hashedpassword",
+		}
+		require.NoError(t, userRepo.Create(ctx, other))
+
+		assert.ErrorIs(t, patRepo.Delete(ctx, other.ID, token.ID), ErrNotFound)
+		require.NoError(t, patRepo.Delete(ctx, user.ID, token.ID))
+
+		_, err := patRepo.GetByHash(ctx, "pat-hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+}
+
+func TestOAuthRepositories_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	tokenRepo := NewTokenRepository(testDB)
+	clientRepo := NewOAuthClientRepository(testDB)
+	codeRepo := NewAuthorizationCodeRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username:     "oauthuser",
+		Email:        "oauth@example.com",
+		PasswordHash: "hashedpassword",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	client := &OAuthClient{
+		ID:           uuid.New().String(),
+		SecretHash:   "secret-hash",
+		Name:         "Wiki",
+		RedirectURIs: []string{"https://wiki.example.com/callback"},
+		GrantTypes:   []string{"authorization_code", "refresh_token"},
+		Scopes:       []string{"openid", "email"},
+	}
+	require.NoError(t, clientRepo.Create(ctx, client))
+
+	t.Run("get and list clients", func(t *testing.T) {
+		found, err := clientRepo.Get(ctx, client.ID)
+		require.NoError(t, err)
+		assert.Equal(t, client.RedirectURIs, found.RedirectURIs)
+		assert.Equal(t, client.GrantTypes, found.GrantTypes)
+		assert.Equal(t, client.Scopes, found.Scopes)
+
+		assert.False(t, found.ServiceAccount)
+
+		clients, err := clientRepo.List(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, clients)
+
+		_, err = clientRepo.Get(ctx, "unknown")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("service account flag is stored", func(t *testing.T) {
+		account := &OAuthClient{
+			ID:             uuid.New().String(),
+			SecretHash:     "account-secret-hash",
+			Name:           "importer",
+			GrantTypes:     []string{"client_credentials"},
+			Scopes:         []string{"posts:write"},
+			ServiceAccount: true,
+		}
+		require.NoError(t, clientRepo.Create(ctx, account))
+
+		found, err := clientRepo.Get(ctx, account.ID)
+		require.NoError(t, err)
+		assert.True(t, found.ServiceAccount)
+	})
+
+	t.Run("authorization code can be consumed once", func(t *testing.T) {
+		code := &AuthorizationCode{
+			CodeHash:      "code-hash",
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			RedirectURI:   "https://wiki.example.com/callback",
+			Scopes:        []string{"openid"},
+			CodeChallenge: "challenge",
+			Nonce:         "nonce",
+			ExpiresAt:     time.Now().Add(time.Minute),
+		}
+		require.NoError(t, codeRepo.Create(ctx, code))
+
+		consumed, err := codeRepo.Consume(ctx, "code-hash")
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, consumed.UserID)
+		assert.Equal(t, "challenge", consumed.CodeChallenge)
+		assert.Equal(t, []string{"openid"}, consumed.Scopes)
+
+		_, err = codeRepo.Consume(ctx, "code-hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("expired authorization code is rejected", func(t *testing.T) {
+		require.NoError(t, codeRepo.Create(ctx, &AuthorizationCode{
+			CodeHash:    "expired-code-hash",
+			ClientID:    client.ID,
+			UserID:      user.ID,
+			RedirectURI: "https://wiki.example.com/callback",
+			Scopes:      []string{"openid"},
+			ExpiresAt:   time.Now().Add(-time.Minute),
+		}))
+
+		_, err := codeRepo.Consume(ctx, "expired-code-hash")
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("refresh tokens remember the client and are deleted with it", func(t *testing.T) {
+		token := &RefreshToken{
+			UserID:           user.ID,
+			Token:            "oauth-refresh-token",
+			FamilyID:         uuid.New().String(),
+			SessionStartedAt: time.Now(),
+			ExpiresAt:        time.Now().Add(time.Hour),
+			ClientID:         client.ID,
+			Scopes:           []string{"openid", "email"},
+		}
+		require.NoError(t, tokenRepo.Create(ctx, token))
+
+		found, err := tokenRepo.Get(ctx, "oauth-refresh-token")
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, found.ClientID)
+		assert.Equal(t, []string{"openid", "email"}, found.Scopes)
+
+		require.NoError(t, clientRepo.Delete(ctx, client.ID))
+		_, err = tokenRepo.Get(ctx, "oauth-refresh-token")
+		assert.Error(t, err)
+		assert.ErrorIs(t, clientRepo.Delete(ctx, client.ID), ErrNotFound)
+	})
+}
+
+func TestExternalIdentityRepository_Integration(t *testing.T) {
+	userRepo := NewUserRepository(testDB)
+	identityRepo := NewExternalIdentityRepository(testDB)
+	ctx := context.Background()
+
+	user := &User{
+		Username: "externaluser",
+		Email:    "external@example.com",
+	}
+	require.NoError(t, userRepo.Create(ctx, user))
+
+	identity := &ExternalIdentity{
+		UserID:  user.ID,
+		Issuer:  "https://idp.example.com",
+		Subject: "248289761001",
+		Email:   "external@example.com",
+	}
+	require.NoError(t, identityRepo.Create(ctx, identity))
+	assert.NotEmpty(t, identity.ID)
+
+	t.Run("identity is found by issuer and subject", func(t *testing.T) {
+		found, err := identityRepo.GetBySubject(ctx, identity.Issuer, identity.Subject)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, found.UserID)
+		assert.Nil(t, found.LastLoginAt)
+
+		_, err = identityRepo.GetBySubject(ctx, "https://other.example.com", identity.Subject)
+		assert.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("identity can only be linked once", func(t *testing.T) {
+		err := identityRepo.Create(ctx, &ExternalIdentity{UserID: user.ID, Issuer: identity.Issuer, Subject: identity.Subject})
+		assert.ErrorIs(t, err, ErrConflict)
+	})
+
+	t.Run("last login is recorded", func(t *testing.T) {
+		require.NoError(t, identityRepo.MarkUsed(ctx, identity.ID))
+
+		identities, err := identityRepo.ListForUser(ctx, user.ID)
+		require.NoError(t, err)
+		require.Len(t, identities, 1)
+		assert.NotNil(t, identities[0].LastLoginAt)
+	})
+
+	t.Run("identity is unlinked", func(t *testing.T) {
+		assert.ErrorIs(t, identityRepo.Delete(ctx, uuid.New().String(), identity.ID), ErrNotFound)
+		require.NoError(t, identityRepo.Delete(ctx, user.ID, identity.ID))
+		assert.ErrorIs(t, identityRepo.Delete(ctx, user.ID, identity.ID), ErrNotFound)
+	})
+}
+
+func TestRevokedTokenRepository_Integration(t *testing.T) {
+	repo := NewRevokedTokenRepository(testDB)
+	ctx := context.Background()
+
+	jti := uuid.New().String()
+	revoked, err := repo.IsRevoked(ctx, jti)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+
+	require.NoError(t, repo.Revoke(ctx, jti, time.Now().Add(time.Minute)))
+	require.NoError(t, repo.Revoke(ctx, jti, time.Now().Add(time.Minute)), "revoking twice is not an error")
+	revoked, err = repo.IsRevoked(ctx, jti)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+
+	expired := uuid.New().String()
+	require.NoError(t, repo.Revoke(ctx, expired, time.Now().Add(-time.Minute)))
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, deleted, int64(1))
+
+	revoked, err = repo.IsRevoked(ctx, expired)
+	require.NoError(t, err)
+	assert.False(t, revoked)
+	revoked, err = repo.IsRevoked(ctx, jti)
+	require.NoError(t, err)
+	assert.True(t, revoked)
+}
+
+func TestAdvisoryJobLock_Integration(t *testing.T) {
+	lock := NewAdvisoryJobLock(testDB)
+	ctx := context.Background()
+
+	release, ok, err := lock.TryLock(ctx, "test-job")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// Another session cannot take the lock while it is held
+	_, ok, err = lock.TryLock(ctx, "test-job")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	otherRelease, ok, err := lock.TryLock(ctx, "other-job")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	otherRelease()
+
+	release()
+	release, ok, err = lock.TryLock(ctx, "test-job")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	release()
 }
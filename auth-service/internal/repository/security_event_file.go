@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// fileSecurityEventRepository stores events in another repository and also
+// appends each one to a file as a line of JSON, for log shippers feeding a
+// SIEM.
+type fileSecurityEventRepository struct {
+	SecurityEventRepository
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// securityEventLine is the JSON form of an event in the file.
+type securityEventLine struct {
+	ID        string            `json:"id,omitempty"`
+	UserID    string            `json:"user_id,omitempty"`
+	Type      string            `json:"type"`
+	Details   map[string]string `json:"details,omitempty"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// NewFileSecurityEventRepository wraps next so that every event it stores is
+// also written to w. Events are written even when next fails to store them.
+func NewFileSecurityEventRepository(next SecurityEventRepository, w io.Writer) SecurityEventRepository {
+	return &fileSecurityEventRepository{SecurityEventRepository: next, w: w}
+}
+
+func (r *fileSecurityEventRepository) Create(ctx context.Context, event *SecurityEvent) error {
+	err := r.SecurityEventRepository.Create(ctx, event)
+
+	createdAt := event.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+	line, marshalErr := json.Marshal(securityEventLine{
+		ID:        event.ID,
+		UserID:    event.UserID,
+		Type:      event.Type,
+		Details:   event.Details,
+		IPAddress: event.IPAddress,
+		UserAgent: event.UserAgent,
+		CreatedAt: createdAt.UTC(),
+	})
+	if marshalErr != nil {
+		return marshalErr
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, writeErr := r.w.Write(append(line, '\n')); writeErr != nil && err == nil {
+		err = writeErr
+	}
+	return err
+}
@@ -0,0 +1,120 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+type securityEventRepository struct {
+	db *sql.DB
+}
+
+func NewSecurityEventRepository(db *sql.DB) SecurityEventRepository {
+	return &securityEventRepository{db: db}
+}
+
+const securityEventColumns = `id, user_id, event_type, details, ip_address, user_agent, created_at`
+
+func (r *securityEventRepository) Create(ctx context.Context, event *SecurityEvent) error {
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	details, err := json.Marshal(event.Details)
+	if err != nil {
+		return err
+	}
+
+	var userID sql.NullString
+	if event.UserID != "" {
+		userID = sql.NullString{String: event.UserID, Valid: true}
+	}
+
+	query := `
+		INSERT INTO security_events (user_id, event_type, details, ip_address, user_agent)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`
+
+	return r.db.QueryRowContext(ctx, query,
+		userID,
+		event.Type,
+		details,
+		event.IPAddress,
+		event.UserAgent,
+	).Scan(&event.ID, &event.CreatedAt)
+}
+
+func (r *securityEventRepository) ListForUser(ctx context.Context, userID string) ([]SecurityEvent, error) {
+	query := `
+		SELECT ` + securityEventColumns + `
+		FROM security_events
+		WHERE user_id = $1
+		ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []SecurityEvent
+	for rows.Next() {
+		event, err := scanSecurityEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, *event)
+	}
+	return events, rows.Err()
+}
+
+func (r *securityEventRepository) List(ctx context.Context, filter SecurityEventFilter) ([]SecurityEvent, int, error) {
+	where := `
+		WHERE ($1 = '' OR user_id::text = $1)
+		  AND ($2 = '' OR event_type = $2)
+		  AND ($3::timestamptz IS NULL OR created_at >= $3)
+		  AND ($4::timestamptz IS NULL OR created_at < $4)`
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM security_events` + where
+	if err := r.db.QueryRowContext(ctx, countQuery, filter.UserID, filter.Type, filter.Since, filter.Until).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT ` + securityEventColumns + `
+		FROM security_events` + where + `
+		ORDER BY created_at DESC, id
+		LIMIT $5 OFFSET $6`
+
+	rows, err := r.db.QueryContext(ctx, query, filter.UserID, filter.Type, filter.Since, filter.Until, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var events []SecurityEvent
+	for rows.Next() {
+		event, err := scanSecurityEvent(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		events = append(events, *event)
+	}
+	return events, total, rows.Err()
+}
+
+func scanSecurityEvent(row rowScanner) (*SecurityEvent, error) {
+	var event SecurityEvent
+	var userID sql.NullString
+	var details []byte
+	if err := row.Scan(&event.ID, &userID, &event.Type, &details, &event.IPAddress, &event.UserAgent, &event.CreatedAt); err != nil {
+		return nil, err
+	}
+	event.UserID = userID.String
+	if err := json.Unmarshal(details, &event.Details); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
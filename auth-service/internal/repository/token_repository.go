@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+
+	"github.com/lib/pq"
 )
 
 type tokenRepository struct {
@@ -16,21 +18,34 @@ func NewTokenRepository(db *sql.DB) TokenRepository {
 
 func (r *tokenRepository) Create(ctx context.Context, token *RefreshToken) error {
 	query := `
-		INSERT INTO tokens (user_id, refresh_token, expires_at)
-		VALUES ($1, $2, $3)
+		INSERT INTO tokens (user_id, refresh_token, family_id, user_agent, ip_address, session_started_at, expires_at, client_id, scopes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id, created_at`
 
+	var clientID sql.NullString
+	if token.ClientID != "" {
+		clientID = sql.NullString{String: token.ClientID, Valid: true}
+	}
+
 	return r.db.QueryRowContext(ctx, query,
 		token.UserID,
 		token.Token,
+		token.FamilyID,
+		token.UserAgent,
+		token.IPAddress,
+		token.SessionStartedAt,
 		token.ExpiresAt,
+		clientID,
+		pq.Array(token.Scopes),
 	).Scan(&token.ID, &token.CreatedAt)
 }
 
 func (r *tokenRepository) Get(ctx context.Context, token string) (*RefreshToken, error) {
 	refreshToken := &RefreshToken{}
+	var rotatedAt sql.NullTime
+	var clientID sql.NullString
 	query := `
-		SELECT id, user_id, refresh_token, expires_at, created_at
+		SELECT id, user_id, refresh_token, family_id, user_agent, ip_address, session_started_at, rotated_at, expires_at, created_at, client_id, scopes
 		FROM tokens
 		WHERE refresh_token = $1`
 
@@ -38,12 +53,23 @@ func (r *tokenRepository) Get(ctx context.Context, token string) (*RefreshToken,
 		&refreshToken.ID,
 		&refreshToken.UserID,
 		&refreshToken.Token,
+		&refreshToken.FamilyID,
+		&refreshToken.UserAgent,
+		&refreshToken.IPAddress,
+		&refreshToken.SessionStartedAt,
+		&rotatedAt,
 		&refreshToken.ExpiresAt,
 		&refreshToken.CreatedAt,
+		&clientID,
+		pq.Array(&refreshToken.Scopes),
 	)
 	if err == sql.ErrNoRows {
 		return nil, errors.New("token not found")
 	}
+	if rotatedAt.Valid {
+		refreshToken.RotatedAt = &rotatedAt.Time
+	}
+	refreshToken.ClientID = clientID.String
 	return refreshToken, err
 }
 
@@ -71,3 +97,95 @@ func (r *tokenRepository) DeleteAllForUser(ctx context.Context, userID string) e
 	_, err := r.db.ExecContext(ctx, query, userID)
 	return err
 }
+
+func (r *tokenRepository) MarkRotated(ctx context.Context, id string) error {
+	query := `UPDATE tokens SET rotated_at = CURRENT_TIMESTAMP WHERE id = $1 AND rotated_at IS NULL`
+	result, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) DeleteFamily(ctx context.Context, familyID string) error {
+	query := `DELETE FROM tokens WHERE family_id = $1`
+	_, err := r.db.ExecContext(ctx, query, familyID)
+	return err
+}
+
+func (r *tokenRepository) ListSessions(ctx context.Context, userID string) ([]Session, error) {
+	query := `
+		SELECT family_id, user_id, user_agent, ip_address, session_started_at, created_at, expires_at
+		FROM tokens
+		WHERE user_id = $1 AND rotated_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		ORDER BY created_at DESC`
+
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var session Session
+		if err := rows.Scan(
+			&session.ID,
+			&session.UserID,
+			&session.UserAgent,
+			&session.IPAddress,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+		); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (r *tokenRepository) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND family_id = $2`
+	result, err := r.db.ExecContext(ctx, query, userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) DeleteOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	query := `DELETE FROM tokens WHERE user_id = $1 AND family_id <> $2`
+	_, err := r.db.ExecContext(ctx, query, userID, keepSessionID)
+	return err
+}
+
+func (r *tokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM tokens WHERE expires_at < CURRENT_TIMESTAMP`
+
+	result, err := r.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
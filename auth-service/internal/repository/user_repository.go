@@ -4,8 +4,13 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"time"
+
+	"github.com/lib/pq"
 )
 
+const userColumns = `id, username, email, password_hash, email_verified_at, suspended_at, suspended_until, suspension_reason, display_name, bio, avatar_url, pending_email, COALESCE(invite_code_id::text, ''), pending_approval, tokens_valid_after, created_at, updated_at`
+
 type userRepository struct {
 	db *sql.DB
 }
@@ -15,77 +20,433 @@ func NewUserRepository(db *sql.DB) UserRepository {
 }
 
 func (r *userRepository) Create(ctx context.Context, user *User) error {
+	return insertUser(ctx, r.db, user)
+}
+
+// CreateWithRole inserts the user and grants them role in one transaction,
+// so that no account is left behind without its first role.
+func (r *userRepository) CreateWithRole(ctx context.Context, user *User, role, grantedBy string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := insertUser(ctx, tx, user); err != nil {
+		return err
+	}
+
+	var granter sql.NullString
+	if grantedBy != "" {
+		granter = sql.NullString{String: grantedBy, Valid: true}
+	}
 	query := `
-		INSERT INTO users (username, email, password_hash)
-		VALUES ($1, $2, $3)
+		INSERT INTO user_roles (user_id, role, granted_by)
+		VALUES ($1, $2, $3)`
+	if _, err := tx.ExecContext(ctx, query, user.ID, role, granter); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == foreignKeyViolation {
+			return ErrNotFound
+		}
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rowQuerier is implemented by both *sql.DB and *sql.Tx.
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// insertUser inserts the user as given, including a verified email, a
+// suspension or a display name it already has.
+func insertUser(ctx context.Context, q rowQuerier, user *User) error {
+	query := `
+		INSERT INTO users (username, email, password_hash, invite_code_id, pending_approval,
+			email_verified_at, suspended_at, suspended_until, suspension_reason, display_name)
+		VALUES ($1, $2, $3, NULLIF($4, '')::uuid, $5, $6, $7, $8, $9, $10)
 		RETURNING id, created_at, updated_at`
 
-	return r.db.QueryRowContext(ctx, query,
+	return q.QueryRowContext(ctx, query,
 		user.Username,
 		user.Email,
 		user.PasswordHash,
+		user.InviteCodeID,
+		user.PendingApproval,
+		user.EmailVerifiedAt,
+		user.SuspendedAt,
+		user.SuspendedUntil,
+		user.SuspensionReason,
+		user.DisplayName,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 }
 
 func (r *userRepository) GetByUsername(ctx context.Context, username string) (*User, error) {
-	user := &User{}
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE username = $1`
 
-	err := r.db.QueryRowContext(ctx, query, username).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, username))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
 	}
 	return user, err
 }
 
 func (r *userRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
-	user := &User{}
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE email = $1`
 
-	err := r.db.QueryRowContext(ctx, query, email).Scan(
-		&user.ID,
-		&user.Username,
-		&user.Email,
-		&user.PasswordHash,
-		&user.CreatedAt,
-		&user.UpdatedAt,
-	)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, email))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
 	}
 	return user, err
 }
 
 func (r *userRepository) GetByID(ctx context.Context, id string) (*User, error) {
-	user := &User{}
 	query := `
-		SELECT id, username, email, password_hash, created_at, updated_at
+		SELECT ` + userColumns + `
 		FROM users
 		WHERE id = $1`
 
-	err := r.db.QueryRowContext(ctx, query, id).Scan(
+	user, err := scanUser(r.db.QueryRowContext(ctx, query, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return user, err
+}
+
+func (r *userRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	query := `
+		UPDATE users
+		SET password_hash = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	result, err := r.db.ExecContext(ctx, query, passwordHash, id)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id string) error {
+	query := `
+		UPDATE users
+		SET email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email_verified_at IS NULL`
+
+	_, err := r.db.ExecContext(ctx, query, id)
+	return err
+}
+
+// List returns a page of users matching filter, newest first, and the total
+// number of matches.
+func (r *userRepository) List(ctx context.Context, filter UserFilter) ([]User, int, error) {
+	where := `
+		WHERE ($1 = '' OR username ILIKE '%' || $1 || '%' OR email ILIKE '%' || $1 || '%')
+		  AND (NOT $2 OR (suspended_at IS NOT NULL AND (suspended_until IS NULL OR suspended_until > CURRENT_TIMESTAMP)))
+		  AND (NOT $3 OR pending_approval)`
+
+	var total int
+	countQuery := `SELECT COUNT(*) FROM users` + where
+	if err := r.db.QueryRowContext(ctx, countQuery, filter.Query, filter.SuspendedOnly, filter.PendingOnly).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query := `
+		SELECT ` + userColumns + `
+		FROM users` + where + `
+		ORDER BY created_at DESC, id
+		LIMIT $4 OFFSET $5`
+
+	rows, err := r.db.QueryContext(ctx, query, filter.Query, filter.SuspendedOnly, filter.PendingOnly, filter.Limit, filter.Offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+	return users, total, rows.Err()
+}
+
+func (r *userRepository) Suspend(ctx context.Context, id, reason string, until *time.Time) error {
+	query := `
+		UPDATE users
+		SET suspended_at = CURRENT_TIMESTAMP, suspended_until = $1, suspension_reason = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $3`
+
+	return r.execForUser(ctx, query, until, reason, id)
+}
+
+func (r *userRepository) Unsuspend(ctx context.Context, id string) error {
+	query := `
+		UPDATE users
+		SET suspended_at = NULL, suspended_until = NULL, suspension_reason = '', updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1`
+
+	return r.execForUser(ctx, query, id)
+}
+
+func (r *userRepository) SetTokensValidAfter(ctx context.Context, id string, at time.Time) error {
+	query := `
+		UPDATE users
+		SET tokens_valid_after = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	return r.execForUser(ctx, query, at, id)
+}
+
+func (r *userRepository) Approve(ctx context.Context, id string) error {
+	query := `
+		UPDATE users
+		SET pending_approval = FALSE, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND pending_approval`
+
+	return r.execForUser(ctx, query, id)
+}
+
+func (r *userRepository) Delete(ctx context.Context, id string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := tx.ExecContext(ctx, `INSERT INTO user_deletions (user_id) VALUES ($1)`, id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *userRepository) ListDeletions(ctx context.Context, afterID int64, limit int) ([]UserDeletion, error) {
+	query := `
+		SELECT id, user_id, deleted_at
+		FROM user_deletions
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	rows, err := r.db.QueryContext(ctx, query, afterID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deletions []UserDeletion
+	for rows.Next() {
+		var deletion UserDeletion
+		if err := rows.Scan(&deletion.ID, &deletion.UserID, &deletion.DeletedAt); err != nil {
+			return nil, err
+		}
+		deletions = append(deletions, deletion)
+	}
+	return deletions, rows.Err()
+}
+
+func (r *userRepository) UpdateProfile(ctx context.Context, id, displayName, bio, avatarURL string) error {
+	query := `
+		UPDATE users
+		SET display_name = $1, bio = $2, avatar_url = $3, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $4`
+
+	return r.execForUser(ctx, query, displayName, bio, avatarURL, id)
+}
+
+func (r *userRepository) Rename(ctx context.Context, id, username string) (*UsernameChange, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	change := &UsernameChange{UserID: id, NewUsername: username}
+	err = tx.QueryRowContext(ctx, `SELECT username FROM users WHERE id = $1 FOR UPDATE`, id).Scan(&change.OldUsername)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE users
+		SET username = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+	if _, err := tx.ExecContext(ctx, query, username, id); err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+			return nil, ErrConflict
+		}
+		return nil, err
+	}
+
+	query = `
+		INSERT INTO username_history (user_id, old_username, new_username)
+		VALUES ($1, $2, $3)
+		RETURNING id, changed_at`
+	if err := tx.QueryRowContext(ctx, query, id, change.OldUsername, username).Scan(&change.ID, &change.ChangedAt); err != nil {
+		return nil, err
+	}
+
+	return change, tx.Commit()
+}
+
+func (r *userRepository) UsernameHistory(ctx context.Context, id string) ([]UsernameChange, error) {
+	query := `
+		SELECT id, user_id, old_username, new_username, changed_at
+		FROM username_history
+		WHERE user_id = $1
+		ORDER BY id DESC`
+
+	return r.queryUsernameChanges(ctx, query, id)
+}
+
+func (r *userRepository) ListUsernameChanges(ctx context.Context, afterID int64, limit int) ([]UsernameChange, error) {
+	query := `
+		SELECT id, user_id, old_username, new_username, changed_at
+		FROM username_history
+		WHERE id > $1
+		ORDER BY id
+		LIMIT $2`
+
+	return r.queryUsernameChanges(ctx, query, afterID, limit)
+}
+
+func (r *userRepository) PreviousOwner(ctx context.Context, username string) (string, error) {
+	query := `
+		SELECT user_id
+		FROM username_history
+		WHERE old_username = $1
+		ORDER BY id DESC
+		LIMIT 1`
+
+	var userID string
+	err := r.db.QueryRowContext(ctx, query, username).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotFound
+	}
+	return userID, err
+}
+
+func (r *userRepository) SetPendingEmail(ctx context.Context, id, email string) error {
+	query := `
+		UPDATE users
+		SET pending_email = $1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $2`
+
+	return r.execForUser(ctx, query, email, id)
+}
+
+func (r *userRepository) ConfirmPendingEmail(ctx context.Context, id string) error {
+	query := `
+		UPDATE users
+		SET email = pending_email, pending_email = '', email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND pending_email <> ''`
+
+	err := r.execForUser(ctx, query, id)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		return ErrConflict
+	}
+	return err
+}
+
+func (r *userRepository) queryUsernameChanges(ctx context.Context, query string, args ...interface{}) ([]UsernameChange, error) {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var changes []UsernameChange
+	for rows.Next() {
+		var change UsernameChange
+		if err := rows.Scan(&change.ID, &change.UserID, &change.OldUsername, &change.NewUsername, &change.ChangedAt); err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// execForUser runs a statement that affects one user, returning ErrNotFound
+// if there is no such user.
+func (r *userRepository) execForUser(ctx context.Context, query string, args ...interface{}) error {
+	result, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func scanUser(row rowScanner) (*User, error) {
+	user := &User{}
+	err := row.Scan(
 		&user.ID,
 		&user.Username,
 		&user.Email,
 		&user.PasswordHash,
+		&user.EmailVerifiedAt,
+		&user.SuspendedAt,
+		&user.SuspendedUntil,
+		&user.SuspensionReason,
+		&user.DisplayName,
+		&user.Bio,
+		&user.AvatarURL,
+		&user.PendingEmail,
+		&user.InviteCodeID,
+		&user.PendingApproval,
+		&user.TokensValidAfter,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
-	if err == sql.ErrNoRows {
-		return nil, errors.New("user not found")
+	if err != nil {
+		return nil, err
 	}
-	return user, err
+	return user, nil
 }
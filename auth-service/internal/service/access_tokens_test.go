@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+type MockPersonalAccessTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockPersonalAccessTokenRepository) Create(ctx context.Context, token *repository.PersonalAccessToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockPersonalAccessTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*repository.PersonalAccessToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenRepository) ListForUser(ctx context.Context, userID string) ([]repository.PersonalAccessToken, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]repository.PersonalAccessToken), args.Error(1)
+}
+
+func (m *MockPersonalAccessTokenRepository) Delete(ctx context.Context, userID, id string) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockPersonalAccessTokenRepository) MarkUsed(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestAuthService_PersonalAccessTokens(t *testing.T) {
+	user := &repository.User{ID: uuid.New().String(), Username: "bot-owner"}
+
+	t.Run("created token authenticates with its scopes", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		patRepo := new(MockPersonalAccessTokenRepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAuthService(userRepo, new(MockTokenRepository), roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), patRepo, newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		var stored *repository.PersonalAccessToken
+		patRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.PersonalAccessToken")).
+			Run(func(args mock.Arguments) {
+				stored = args.Get(1).(*repository.PersonalAccessToken)
+				stored.ID = uuid.New().String()
+			}).
+			Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventAccessTokenCreated
+		})).Return(nil)
+
+		token, pat, err := service.CreateAccessToken(context.Background(), user.ID, " chat bot ", []string{ScopeChatWrite, ScopeChatRead, ScopeChatWrite}, 30*24*time.Hour)
+		assert.NoError(t, err)
+		assert.True(t, strings.HasPrefix(token, PersonalAccessTokenPrefix))
+		assert.True(t, IsPersonalAccessToken(token))
+		assert.Equal(t, "chat bot", pat.Name)
+		assert.Equal(t, []string{ScopeChatWrite, ScopeChatRead}, pat.Scopes)
+		assert.Equal(t, hashToken(token), stored.TokenHash)
+		assert.NotContains(t, stored.TokenHash, token)
+		assert.WithinDuration(t, time.Now().Add(30*24*time.Hour), *pat.ExpiresAt, time.Minute)
+
+		patRepo.On("GetByHash", mock.Anything, hashToken(token)).Return(stored, nil)
+		patRepo.On("MarkUsed", mock.Anything, stored.ID).Return(nil)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		claims, err := service.ParseToken(context.Background(), token)
+		assert.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, "bot-owner", claims.Username)
+		assert.True(t, claims.HasScope(ScopeChatWrite))
+		assert.False(t, claims.HasScope(ScopePostsRead))
+
+		patRepo.AssertExpectations(t)
+	})
+
+	t.Run("rejects unknown scopes", func(t *testing.T) {
+		patRepo := new(MockPersonalAccessTokenRepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), patRepo, newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		_, _, err := service.CreateAccessToken(context.Background(), user.ID, "bot", []string{"admin"}, 0)
+		assert.ErrorIs(t, err, ErrInvalidScope)
+		_, _, err = service.CreateAccessToken(context.Background(), user.ID, "bot", nil, 0)
+		assert.ErrorIs(t, err, ErrInvalidScope)
+		_, _, err = service.CreateAccessToken(context.Background(), user.ID, " ", []string{ScopeChatRead}, 0)
+		assert.ErrorIs(t, err, ErrInvalidTokenName)
+
+		patRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("expired and unknown tokens are rejected", func(t *testing.T) {
+		patRepo := new(MockPersonalAccessTokenRepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), patRepo, newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		expiredAt := time.Now().Add(-time.Minute)
+		patRepo.On("GetByHash", mock.Anything, hashToken("gfp_expired")).
+			Return(&repository.PersonalAccessToken{ID: uuid.New().String(), UserID: user.ID, Scopes: []string{ScopeChatRead}, ExpiresAt: &expiredAt}, nil)
+		patRepo.On("GetByHash", mock.Anything, hashToken("gfp_unknown")).Return(nil, repository.ErrNotFound)
+
+		_, err := service.ParseToken(context.Background(), "gfp_expired")
+		assert.ErrorIs(t, err, ErrAccessTokenExpired)
+		_, err = service.ParseToken(context.Background(), "gfp_unknown")
+		assert.Error(t, err)
+	})
+
+	t.Run("interactive tokens have every scope", func(t *testing.T) {
+		claims := &Claims{UserID: user.ID}
+		assert.True(t, claims.HasScope(ScopePostsWrite))
+	})
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"auth-service/internal/repository"
+)
+
+// AccountExport is everything the auth service stores about a user, in the
+// form handed to the user when they download their data. Secrets such as
+// password and token hashes are left out.
+type AccountExport struct {
+	ExportedAt      time.Time                `json:"exported_at"`
+	Profile         ExportedProfile          `json:"profile"`
+	Roles           []string                 `json:"roles"`
+	Sessions        []ExportedSession        `json:"sessions"`
+	AccessTokens    []ExportedAccessToken    `json:"access_tokens"`
+	Identities      []ExportedIdentity       `json:"external_identities"`
+	UsernameHistory []ExportedUsernameChange `json:"username_history"`
+	SecurityEvents  []ExportedSecurityEvent  `json:"security_events"`
+}
+
+type ExportedProfile struct {
+	ID              string     `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	PendingEmail    string     `json:"pending_email,omitempty"`
+	DisplayName     string     `json:"display_name"`
+	Bio             string     `json:"bio"`
+	AvatarURL       string     `json:"avatar_url"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
+}
+
+type ExportedSession struct {
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type ExportedAccessToken struct {
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type ExportedIdentity struct {
+	Issuer      string     `json:"issuer"`
+	Subject     string     `json:"subject"`
+	Email       string     `json:"email"`
+	LastLoginAt *time.Time `json:"last_login_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+type ExportedUsernameChange struct {
+	OldUsername string    `json:"old_username"`
+	NewUsername string    `json:"new_username"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
+
+type ExportedSecurityEvent struct {
+	Type      string            `json:"type"`
+	Details   map[string]string `json:"details"`
+	CreatedAt time.Time         `json:"created_at"`
+}
+
+// ExportData collects the user's account data for download. Forum content
+// is exported by the forum service, which includes this export in its
+// archive.
+func (s *ProfileService) ExportData(ctx context.Context, userID string) (*AccountExport, error) {
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.auth.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	sessions, err := s.auth.tokenRepo.ListSessions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	tokens, err := s.auth.patRepo.ListForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := s.identityRepo.ListForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	renames, err := s.auth.userRepo.UsernameHistory(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.auth.eventRepo.ListForUser(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &AccountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: ExportedProfile{
+			ID:              user.ID,
+			Username:        user.Username,
+			Email:           user.Email,
+			EmailVerifiedAt: user.EmailVerifiedAt,
+			PendingEmail:    user.PendingEmail,
+			DisplayName:     user.DisplayName,
+			Bio:             user.Bio,
+			AvatarURL:       user.AvatarURL,
+			CreatedAt:       user.CreatedAt,
+			UpdatedAt:       user.UpdatedAt,
+		},
+		Roles:           roles,
+		Sessions:        make([]ExportedSession, len(sessions)),
+		AccessTokens:    make([]ExportedAccessToken, len(tokens)),
+		Identities:      make([]ExportedIdentity, len(identities)),
+		UsernameHistory: make([]ExportedUsernameChange, len(renames)),
+		SecurityEvents:  make([]ExportedSecurityEvent, len(events)),
+	}
+	for i, session := range sessions {
+		export.Sessions[i] = ExportedSession{
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastUsedAt: session.LastUsedAt,
+			ExpiresAt:  session.ExpiresAt,
+		}
+	}
+	for i, token := range tokens {
+		export.AccessTokens[i] = ExportedAccessToken{
+			Name:       token.Name,
+			Scopes:     token.Scopes,
+			ExpiresAt:  token.ExpiresAt,
+			LastUsedAt: token.LastUsedAt,
+			CreatedAt:  token.CreatedAt,
+		}
+	}
+	for i, identity := range identities {
+		export.Identities[i] = ExportedIdentity{
+			Issuer:      identity.Issuer,
+			Subject:     identity.Subject,
+			Email:       identity.Email,
+			LastLoginAt: identity.LastLoginAt,
+			CreatedAt:   identity.CreatedAt,
+		}
+	}
+	for i, rename := range renames {
+		export.UsernameHistory[i] = ExportedUsernameChange{
+			OldUsername: rename.OldUsername,
+			NewUsername: rename.NewUsername,
+			ChangedAt:   rename.ChangedAt,
+		}
+	}
+	for i, event := range events {
+		export.SecurityEvents[i] = ExportedSecurityEvent{
+			Type:      event.Type,
+			Details:   event.Details,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+	return export, nil
+}
+
+// DeleteAccount deletes the user's own account after checking their
+// password. Accounts without a password, such as those created through an
+// external login, only need a valid session. The forum deletes or
+// anonymizes the user's content once it sees the deletion.
+func (s *ProfileService) DeleteAccount(ctx context.Context, userID, password string) error {
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if user.PasswordHash != "" {
+		if ok, _ := s.auth.passwords.Verify(user.PasswordHash, password); !ok {
+			return ErrWrongPassword
+		}
+	}
+
+	return s.auth.userRepo.Delete(ctx, user.ID)
+}
+
+// ListDeletions returns deleted users after the deletion with ID afterID,
+// oldest first.
+func (s *ProfileService) ListDeletions(ctx context.Context, afterID int64, limit int) ([]repository.UserDeletion, error) {
+	if limit <= 0 {
+		limit = defaultFeedPageSize
+	}
+	if limit > maxFeedPageSize {
+		limit = maxFeedPageSize
+	}
+	return s.auth.userRepo.ListDeletions(ctx, afterID, limit)
+}
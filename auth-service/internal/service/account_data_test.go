@@ -0,0 +1,87 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestProfileService_ExportData(t *testing.T) {
+	service, deps := newProfileTestService()
+	roleRepo := new(MockRoleRepository)
+	patRepo := new(MockPersonalAccessTokenRepository)
+	eventRepo := newMockSecurityEventRepository()
+	service.auth.roleRepo = roleRepo
+	service.auth.patRepo = patRepo
+	service.auth.eventRepo = eventRepo
+
+	user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com", PasswordHash: "secret-hash"}
+	deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+	deps.userRepo.On("UsernameHistory", mock.Anything, user.ID).Return([]repository.UsernameChange{{OldUsername: "alice0", NewUsername: "alice"}}, nil)
+	roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+	deps.tokenRepo.On("ListSessions", mock.Anything, user.ID).Return([]repository.Session{{ID: "session", IPAddress: "203.0.113.1"}}, nil)
+	patRepo.On("ListForUser", mock.Anything, user.ID).Return([]repository.PersonalAccessToken{{Name: "bot", TokenHash: "token-hash"}}, nil)
+	deps.identityRepo.On("ListForUser", mock.Anything, user.ID).Return([]repository.ExternalIdentity{}, nil)
+	eventRepo.On("ListForUser", mock.Anything, user.ID).Return([]repository.SecurityEvent{{Type: EventPasswordChanged, CreatedAt: time.Now()}}, nil)
+
+	export, err := service.ExportData(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "alice@example.com", export.Profile.Email)
+	assert.Equal(t, []string{RoleUser}, export.Roles)
+	require.Len(t, export.Sessions, 1)
+	assert.Equal(t, "203.0.113.1", export.Sessions[0].IPAddress)
+	require.Len(t, export.AccessTokens, 1)
+	assert.Len(t, export.UsernameHistory, 1)
+	assert.Len(t, export.SecurityEvents, 1)
+
+	// Hashes of passwords and tokens are not personal data worth handing out
+	data, err := json.Marshal(export)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret-hash")
+	assert.NotContains(t, string(data), "token-hash")
+}
+
+func TestProfileService_DeleteAccount(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+
+	t.Run("password is required", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), PasswordHash: string(hashedPassword)}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		assert.ErrorIs(t, service.DeleteAccount(context.Background(), user.ID, "wrong"), ErrWrongPassword)
+		deps.userRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("account is deleted", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), PasswordHash: string(hashedPassword)}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("Delete", mock.Anything, user.ID).Return(nil)
+
+		require.NoError(t, service.DeleteAccount(context.Background(), user.ID, "password123"))
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("accounts without a password", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String()}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("Delete", mock.Anything, user.ID).Return(nil)
+
+		require.NoError(t, service.DeleteAccount(context.Background(), user.ID, ""))
+		deps.userRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/mailer"
+	"auth-service/internal/password"
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// EventPasswordResetForced is recorded when an administrator clears a user's
+// password. Passwords set with a reset link are recorded as
+// EventPasswordChanged.
+const EventPasswordResetForced = "password_reset_forced"
+
+// AccountService handles the emailed account flows: password reset and email
+// verification.
+type AccountService struct {
+	userRepo   repository.UserRepository
+	tokenRepo  repository.TokenRepository
+	resetRepo  repository.OneTimeTokenRepository
+	verifyRepo repository.OneTimeTokenRepository
+	eventRepo  repository.SecurityEventRepository
+	mailer     mailer.Mailer
+	passwords  *password.Policy
+	config     *config.Config
+}
+
+func NewAccountService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, resetRepo, verifyRepo repository.OneTimeTokenRepository, eventRepo repository.SecurityEventRepository, mailer mailer.Mailer, passwords *password.Policy, config *config.Config) *AccountService {
+	return &AccountService{
+		userRepo:   userRepo,
+		tokenRepo:  tokenRepo,
+		resetRepo:  resetRepo,
+		verifyRepo: verifyRepo,
+		eventRepo:  eventRepo,
+		mailer:     mailer,
+		passwords:  passwords,
+		config:     config,
+	}
+}
+
+// RequestPasswordReset mails a reset link to the account registered with
+// email. Unknown addresses are silently ignored so that the endpoint cannot be
+// used to find out who has an account.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+
+	link, err := s.createResetLink(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+			"Use the link below to choose a new one. It expires in %s.\n\n%s\n\n"+
+			"If this wasn't you, you can ignore this email.\n",
+			user.Username, s.config.PasswordResetTTL, link),
+	})
+}
+
+// ForcePasswordReset is used by administrators: it clears the user's
+// password, logs them out of every session, revokes their access tokens and
+// mails them a reset link. The account cannot be logged in to with a password
+// until the link is used.
+func (s *AccountService) ForcePasswordReset(ctx context.Context, actorID, userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return repository.ErrNotFound
+	}
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, ""); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.SetTokensValidAfter(ctx, user.ID, time.Now()); err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.DeleteAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, user.ID, EventPasswordResetForced, map[string]string{"actor_id": actorID})
+
+	link, err := s.createResetLink(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your password has been reset",
+		Body: fmt.Sprintf("Hi %s,\n\nAn administrator has reset the password for your account "+
+			"and signed you out everywhere. Use the link below to choose a new one. "+
+			"It expires in %s.\n\n%s\n",
+			user.Username, s.config.PasswordResetTTL, link),
+	})
+}
+
+// createResetLink stores a new reset token for userID and returns the link
+// that redeems it.
+func (s *AccountService) createResetLink(ctx context.Context, userID string) (string, error) {
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	resetToken := &repository.OneTimeToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.PasswordResetTTL),
+	}
+	if err := s.resetRepo.Create(ctx, resetToken); err != nil {
+		return "", err
+	}
+
+	return s.config.AppURL + "/reset-password?token=" + url.QueryEscape(token), nil
+}
+
+// ResetPassword sets a new password using a token from RequestPasswordReset
+// and logs the user out of every session. A password the policy rejects
+// leaves the token usable.
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	if err := s.passwords.Check(newPassword); err != nil {
+		return err
+	}
+
+	resetToken, err := s.resetRepo.Consume(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidResetToken
+	}
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.UpdatePassword(ctx, resetToken.UserID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Any other outstanding links are now stale
+	if err := s.resetRepo.DeleteAllForUser(ctx, resetToken.UserID); err != nil {
+		return err
+	}
+
+	if err := s.tokenRepo.DeleteAllForUser(ctx, resetToken.UserID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, resetToken.UserID, EventPasswordChanged, map[string]string{"method": "reset_link"})
+	return nil
+}
+
+// recordEvent stores a security event. Failures are not fatal to the action
+// being recorded.
+func (s *AccountService) recordEvent(ctx context.Context, userID, eventType string, details map[string]string) {
+	_ = s.eventRepo.Create(ctx, newSecurityEvent(ctx, userID, eventType, details))
+}
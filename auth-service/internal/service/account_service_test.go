@@ -0,0 +1,284 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/mailer"
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockOneTimeTokenRepository struct {
+	mock.Mock
+}
+
+func (m *MockOneTimeTokenRepository) Create(ctx context.Context, token *repository.OneTimeToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockOneTimeTokenRepository) Consume(ctx context.Context, tokenHash string) (*repository.OneTimeToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.OneTimeToken), args.Error(1)
+}
+
+func (m *MockOneTimeTokenRepository) DeleteAllForUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockOneTimeTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// fakeMailer records sent messages instead of delivering them.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func newTestAccountConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.AppURL = "https://forum.example.com"
+	cfg.PasswordResetTTL = time.Hour
+	cfg.EmailVerificationTTL = 48 * time.Hour
+	return cfg
+}
+
+func TestAccountService_RequestPasswordReset(t *testing.T) {
+	t.Run("sends reset link", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		resetRepo := new(MockOneTimeTokenRepository)
+		mail := &fakeMailer{}
+		service := NewAccountService(userRepo, new(MockTokenRepository), resetRepo, new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), mail, testPasswords, newTestAccountConfig())
+
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", Email: "test@example.com"}
+		userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(user, nil)
+
+		var stored *repository.OneTimeToken
+		resetRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OneTimeToken")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*repository.OneTimeToken) }).
+			Return(nil)
+
+		err := service.RequestPasswordReset(context.Background(), "test@example.com")
+		assert.NoError(t, err)
+
+		if assert.Len(t, mail.sent, 1) {
+			msg := mail.sent[0]
+			assert.Equal(t, "test@example.com", msg.To)
+
+			prefix := "https://forum.example.com/reset-password?token="
+			start := strings.Index(msg.Body, prefix)
+			if assert.GreaterOrEqual(t, start, 0) {
+				token, err := url.QueryUnescape(strings.Fields(msg.Body[start+len(prefix):])[0])
+				assert.NoError(t, err)
+				// Only the hash is persisted
+				assert.Equal(t, hashToken(token), stored.TokenHash)
+				assert.NotContains(t, stored.TokenHash, token)
+			}
+		}
+		assert.Equal(t, user.ID, stored.UserID)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), stored.ExpiresAt, time.Minute)
+	})
+
+	t.Run("unknown email is ignored", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		resetRepo := new(MockOneTimeTokenRepository)
+		mail := &fakeMailer{}
+		service := NewAccountService(userRepo, new(MockTokenRepository), resetRepo, new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), mail, testPasswords, newTestAccountConfig())
+
+		userRepo.On("GetByEmail", mock.Anything, "nobody@example.com").Return(nil, repository.ErrNotFound)
+
+		err := service.RequestPasswordReset(context.Background(), "nobody@example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, mail.sent)
+		resetRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAccountService_ResetPassword(t *testing.T) {
+	t.Run("successful reset", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		resetRepo := new(MockOneTimeTokenRepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAccountService(userRepo, tokenRepo, resetRepo, new(MockOneTimeTokenRepository), eventRepo, &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		userID := uuid.New().String()
+		resetRepo.On("Consume", mock.Anything, hashToken("reset-token")).
+			Return(&repository.OneTimeToken{UserID: userID}, nil)
+		userRepo.On("UpdatePassword", mock.Anything, userID, mock.AnythingOfType("string")).
+			Run(func(args mock.Arguments) {
+				hash := args.String(2)
+				assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(hash), []byte("N3w-password")))
+			}).
+			Return(nil)
+		resetRepo.On("DeleteAllForUser", mock.Anything, userID).Return(nil)
+		tokenRepo.On("DeleteAllForUser", mock.Anything, userID).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.UserID == userID && event.Type == EventPasswordChanged
+		})).Return(nil)
+
+		err := service.ResetPassword(context.Background(), "reset-token", "N3w-password")
+		assert.NoError(t, err)
+
+		userRepo.AssertExpectations(t)
+		resetRepo.AssertExpectations(t)
+		tokenRepo.AssertExpectations(t)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid or used token", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		resetRepo := new(MockOneTimeTokenRepository)
+		service := NewAccountService(userRepo, new(MockTokenRepository), resetRepo, new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		resetRepo.On("Consume", mock.Anything, hashToken("used-token")).Return(nil, repository.ErrNotFound)
+
+		err := service.ResetPassword(context.Background(), "used-token", "N3w-password")
+		assert.ErrorIs(t, err, ErrInvalidResetToken)
+		userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("weak password keeps the token", func(t *testing.T) {
+		resetRepo := new(MockOneTimeTokenRepository)
+		service := NewAccountService(new(MockUserRepository), new(MockTokenRepository), resetRepo, new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		err := service.ResetPassword(context.Background(), "reset-token", "new-password")
+		assert.ErrorIs(t, err, ErrWeakPassword)
+		resetRepo.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAccountService_ForcePasswordReset(t *testing.T) {
+	t.Run("clears the password and revokes tokens", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		resetRepo := new(MockOneTimeTokenRepository)
+		eventRepo := newMockSecurityEventRepository()
+		mail := &fakeMailer{}
+		service := NewAccountService(userRepo, tokenRepo, resetRepo, new(MockOneTimeTokenRepository), eventRepo, mail, testPasswords, newTestAccountConfig())
+
+		adminID := uuid.New().String()
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", Email: "test@example.com", PasswordHash: "hash"}
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		userRepo.On("UpdatePassword", mock.Anything, user.ID, "").Return(nil)
+		userRepo.On("SetTokensValidAfter", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil)
+		tokenRepo.On("DeleteAllForUser", mock.Anything, user.ID).Return(nil)
+		resetRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OneTimeToken")).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.UserID == user.ID && event.Type == EventPasswordResetForced && event.Details["actor_id"] == adminID
+		})).Return(nil)
+
+		err := service.ForcePasswordReset(context.Background(), adminID, user.ID)
+		assert.NoError(t, err)
+		if assert.Len(t, mail.sent, 1) {
+			assert.Equal(t, "test@example.com", mail.sent[0].To)
+			assert.Contains(t, mail.sent[0].Body, "https://forum.example.com/reset-password?token=")
+		}
+		userRepo.AssertExpectations(t)
+		tokenRepo.AssertExpectations(t)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("database errors are not reported as unknown users", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := NewAccountService(userRepo, new(MockTokenRepository), new(MockOneTimeTokenRepository), new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		userID := uuid.New().String()
+		dbErr := errors.New("connection refused")
+		userRepo.On("GetByID", mock.Anything, userID).Return(nil, dbErr)
+
+		err := service.ForcePasswordReset(context.Background(), uuid.New().String(), userID)
+		assert.ErrorIs(t, err, dbErr)
+		assert.NotErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestAccountService_EmailVerification(t *testing.T) {
+	t.Run("sends verification link", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		verifyRepo := new(MockOneTimeTokenRepository)
+		mail := &fakeMailer{}
+		service := NewAccountService(userRepo, new(MockTokenRepository), new(MockOneTimeTokenRepository), verifyRepo, newMockSecurityEventRepository(), mail, testPasswords, newTestAccountConfig())
+
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", Email: "test@example.com"}
+		userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(user, nil)
+		verifyRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OneTimeToken")).Return(nil)
+
+		err := service.RequestEmailVerification(context.Background(), "test@example.com")
+		assert.NoError(t, err)
+
+		if assert.Len(t, mail.sent, 1) {
+			assert.Equal(t, "test@example.com", mail.sent[0].To)
+			assert.Contains(t, mail.sent[0].Body, "https://forum.example.com/verify-email?token=")
+		}
+		verifyRepo.AssertExpectations(t)
+	})
+
+	t.Run("already verified address is ignored", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		verifyRepo := new(MockOneTimeTokenRepository)
+		mail := &fakeMailer{}
+		service := NewAccountService(userRepo, new(MockTokenRepository), new(MockOneTimeTokenRepository), verifyRepo, newMockSecurityEventRepository(), mail, testPasswords, newTestAccountConfig())
+
+		verifiedAt := time.Now()
+		user := &repository.User{ID: uuid.New().String(), Email: "test@example.com", EmailVerifiedAt: &verifiedAt}
+		userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(user, nil)
+
+		err := service.RequestEmailVerification(context.Background(), "test@example.com")
+		assert.NoError(t, err)
+		assert.Empty(t, mail.sent)
+		verifyRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("verify email", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		verifyRepo := new(MockOneTimeTokenRepository)
+		service := NewAccountService(userRepo, new(MockTokenRepository), new(MockOneTimeTokenRepository), verifyRepo, newMockSecurityEventRepository(), &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		userID := uuid.New().String()
+		verifyRepo.On("Consume", mock.Anything, hashToken("verify-token")).
+			Return(&repository.OneTimeToken{UserID: userID}, nil)
+		userRepo.On("MarkEmailVerified", mock.Anything, userID).Return(nil)
+		verifyRepo.On("DeleteAllForUser", mock.Anything, userID).Return(nil)
+
+		err := service.VerifyEmail(context.Background(), "verify-token")
+		assert.NoError(t, err)
+
+		userRepo.AssertExpectations(t)
+		verifyRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		verifyRepo := new(MockOneTimeTokenRepository)
+		service := NewAccountService(new(MockUserRepository), new(MockTokenRepository), new(MockOneTimeTokenRepository), verifyRepo, newMockSecurityEventRepository(), &fakeMailer{}, testPasswords, newTestAccountConfig())
+
+		verifyRepo.On("Consume", mock.Anything, hashToken("bad-token")).Return(nil, repository.ErrNotFound)
+
+		err := service.VerifyEmail(context.Background(), "bad-token")
+		assert.ErrorIs(t, err, ErrInvalidVerificationToken)
+	})
+}
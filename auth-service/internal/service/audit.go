@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+
+	"auth-service/internal/repository"
+)
+
+// Authentication events. Together with the other security events they form
+// the audit log.
+const (
+	EventUserRegistered     = "user_registered"
+	EventLoginSucceeded     = "login_succeeded"
+	EventLoginFailed        = "login_failed"
+	EventTokenRefreshed     = "token_refreshed"
+	EventTokenRefreshFailed = "token_refresh_failed"
+	EventLoggedOut          = "logged_out"
+	EventRoleGranted        = "role_granted"
+	EventRoleRevoked        = "role_revoked"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 1000
+)
+
+// ListSecurityEvents returns a page of the audit log and the total number of
+// events matching filter.
+func (s *AuthService) ListSecurityEvents(ctx context.Context, filter repository.SecurityEventFilter) ([]repository.SecurityEvent, int, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditPageSize
+	}
+	if filter.Limit > maxAuditPageSize {
+		filter.Limit = maxAuditPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.eventRepo.List(ctx, filter)
+}
+
+// newSecurityEvent creates an event labelled with the client the request
+// came from.
+func newSecurityEvent(ctx context.Context, userID, eventType string, details map[string]string) *repository.SecurityEvent {
+	client := ClientInfoFromContext(ctx)
+	return &repository.SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Details:   details,
+		IPAddress: client.IPAddress,
+		UserAgent: client.UserAgent,
+	}
+}
+
+// recordLoginFailure records a failed login. userID is empty when the
+// username is unknown.
+func (s *AuthService) recordLoginFailure(ctx context.Context, userID, username, reason string) {
+	s.recordEvent(ctx, userID, EventLoginFailed, map[string]string{
+		"username": username,
+		"reason":   reason,
+	})
+}
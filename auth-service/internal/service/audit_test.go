@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_AuditLog(t *testing.T) {
+	ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.7", UserAgent: "curl/8.5"})
+
+	newService := func(userRepo *MockUserRepository, tokenRepo *MockTokenRepository, roleRepo *MockRoleRepository, eventRepo *MockSecurityEventRepository) *AuthService {
+		return NewAuthService(userRepo, tokenRepo, roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+	}
+
+	t.Run("login records success with the client", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(userRepo, tokenRepo, roleRepo, eventRepo)
+
+		hash, _ := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", PasswordHash: string(hash)}
+		userRepo.On("GetByUsername", mock.Anything, "alice").Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventLoginSucceeded && e.UserID == user.ID &&
+				e.Details["method"] == "password" &&
+				e.IPAddress == "203.0.113.7" && e.UserAgent == "curl/8.5"
+		})).Return(nil).Once()
+
+		_, err := service.Login(ctx, "alice", "Passw0rd!")
+		assert.NoError(t, err)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("login records the failure reason", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(userRepo, new(MockTokenRepository), new(MockRoleRepository), eventRepo)
+
+		hash, _ := bcrypt.GenerateFromPassword([]byte("Passw0rd!"), bcrypt.MinCost)
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", PasswordHash: string(hash)}
+		userRepo.On("GetByUsername", mock.Anything, "alice").Return(user, nil)
+		userRepo.On("GetByUsername", mock.Anything, "nobody").Return(nil, repository.ErrNotFound)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventLoginFailed && e.UserID == user.ID && e.Details["reason"] == "wrong_password"
+		})).Return(nil).Once()
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventLoginFailed && e.UserID == "" &&
+				e.Details["username"] == "nobody" && e.Details["reason"] == "unknown_user"
+		})).Return(nil).Once()
+
+		_, err := service.Login(ctx, "alice", "wrong")
+		assert.Error(t, err)
+		_, err = service.Login(ctx, "nobody", "Passw0rd!")
+		assert.Error(t, err)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("role changes record the actor", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(userRepo, new(MockTokenRepository), roleRepo, eventRepo)
+
+		adminID := uuid.New().String()
+		userID := uuid.New().String()
+		userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID}, nil)
+		roleRepo.On("Assign", mock.Anything, userID, RoleModerator, adminID).Return(nil)
+		roleRepo.On("Revoke", mock.Anything, userID, RoleModerator).Return(nil)
+		for _, eventType := range []string{EventRoleGranted, EventRoleRevoked} {
+			eventType := eventType
+			eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+				return e.Type == eventType && e.UserID == userID &&
+					e.Details["role"] == RoleModerator && e.Details["actor_id"] == adminID
+			})).Return(nil).Once()
+		}
+
+		assert.NoError(t, service.AssignRole(ctx, adminID, userID, RoleModerator))
+		assert.NoError(t, service.RevokeRole(ctx, adminID, userID, RoleModerator))
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("list clamps the page size", func(t *testing.T) {
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), eventRepo)
+
+		eventRepo.On("List", mock.Anything, repository.SecurityEventFilter{Type: EventLoginFailed, Limit: defaultAuditPageSize}).
+			Return([]repository.SecurityEvent{{Type: EventLoginFailed}}, 1, nil)
+		eventRepo.On("List", mock.Anything, repository.SecurityEventFilter{Limit: maxAuditPageSize}).
+			Return([]repository.SecurityEvent{}, 0, nil)
+
+		events, total, err := service.ListSecurityEvents(ctx, repository.SecurityEventFilter{Type: EventLoginFailed, Offset: -5})
+		assert.NoError(t, err)
+		assert.Len(t, events, 1)
+		assert.Equal(t, 1, total)
+
+		_, _, err = service.ListSecurityEvents(ctx, repository.SecurityEventFilter{Limit: 1 << 20})
+		assert.NoError(t, err)
+		eventRepo.AssertExpectations(t)
+	})
+}
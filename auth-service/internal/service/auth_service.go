@@ -2,38 +2,132 @@ package service
 
 import (
 	"context"
-	"crypto/rand"
-	"encoding/base64"
 	"errors"
 	"time"
 
 	"auth-service/internal/config"
+	"auth-service/internal/password"
 	"auth-service/internal/repository"
+	"auth-service/internal/signing"
 
 	"github.com/golang-jwt/jwt/v5"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/google/uuid"
 )
 
+// ErrRefreshTokenReuse is returned when a refresh token that was already
+// exchanged is presented again. The whole token family is revoked when this
+// happens, since either the legitimate client or an attacker holds a copy.
+var ErrRefreshTokenReuse = errors.New("refresh token reuse detected")
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenExpired = errors.New("refresh token expired")
+)
+
+// New passwords are checked against the password policy.
+var (
+	ErrWeakPassword     = password.ErrTooWeak
+	ErrBreachedPassword = password.ErrBreached
+)
+
+const EventRefreshTokenReuse = "refresh_token_reuse"
+
 type AuthService struct {
-	userRepo  repository.UserRepository
-	tokenRepo repository.TokenRepository
-	config    *config.Config
+	userRepo    repository.UserRepository
+	tokenRepo   repository.TokenRepository
+	roleRepo    repository.RoleRepository
+	eventRepo   repository.SecurityEventRepository
+	mfaRepo     repository.MFARepository
+	attemptRepo repository.LoginAttemptRepository
+	patRepo     repository.PersonalAccessTokenRepository
+	revokedRepo repository.RevokedTokenRepository
+	inviteRepo  repository.InviteCodeRepository
+	clientRepo  repository.OAuthClientRepository
+	keys        *signing.KeySet
+	passwords   *password.Policy
+	config      *config.Config
 }
 
 type TokenPair struct {
 	AccessToken  string
 	RefreshToken string
+	// Scopes are the scopes granted to an OAuth client, nil for first-party
+	// logins.
+	Scopes []string
+}
+
+// Claims is the payload of an access token. Services that verify tokens
+// locally against the JWKS rely on Username and CanWrite instead of asking
+// this service about the user.
+type Claims struct {
+	UserID   string   `json:"user_id"`
+	Username string   `json:"username,omitempty"`
+	Roles    []string `json:"roles,omitempty"`
+	CanWrite bool     `json:"can_write"`
+	// SessionID is the token family of the refresh token issued alongside.
+	SessionID string `json:"sid,omitempty"`
+	// Scopes limit what a personal access token or OAuth client token may be
+	// used for. They are nil for tokens from an interactive login.
+	Scopes []string `json:"scopes,omitempty"`
+	// ClientID is set for tokens issued to an OAuth client.
+	ClientID string `json:"client_id,omitempty"`
+	// PendingApproval marks the restricted token of an account waiting for
+	// admin approval. It carries no roles and cannot write.
+	PendingApproval bool `json:"pending_approval,omitempty"`
+	// ServiceAccount marks a client credentials token of a service account.
+	// Its subject is the client ID and UserID is empty.
+	ServiceAccount bool `json:"service_account,omitempty"`
+	// Actor is the admin acting as the user, for impersonation tokens.
+	Actor *Actor `json:"act,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Actor is the act claim of RFC 8693 section 4.1, naming who is acting on
+// behalf of the token's user.
+type Actor struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username,omitempty"`
 }
 
-func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, config *config.Config) *AuthService {
+// session identifies the login a token pair belongs to. Sessions started
+// through OAuth also remember the client and the scopes it was granted.
+type session struct {
+	familyID  string
+	startedAt time.Time
+	clientID  string
+	scopes    []string
+}
+
+func newSession() session {
+	return session{
+		familyID:  uuid.New().String(),
+		startedAt: time.Now(),
+	}
+}
+
+func NewAuthService(userRepo repository.UserRepository, tokenRepo repository.TokenRepository, roleRepo repository.RoleRepository, eventRepo repository.SecurityEventRepository, mfaRepo repository.MFARepository, attemptRepo repository.LoginAttemptRepository, patRepo repository.PersonalAccessTokenRepository, revokedRepo repository.RevokedTokenRepository, inviteRepo repository.InviteCodeRepository, clientRepo repository.OAuthClientRepository, keys *signing.KeySet, passwords *password.Policy, config *config.Config) *AuthService {
 	return &AuthService{
-		userRepo:  userRepo,
-		tokenRepo: tokenRepo,
-		config:    config,
+		userRepo:    userRepo,
+		tokenRepo:   tokenRepo,
+		roleRepo:    roleRepo,
+		eventRepo:   eventRepo,
+		mfaRepo:     mfaRepo,
+		attemptRepo: attemptRepo,
+		patRepo:     patRepo,
+		revokedRepo: revokedRepo,
+		inviteRepo:  inviteRepo,
+		clientRepo:  clientRepo,
+		keys:        keys,
+		passwords:   passwords,
+		config:      config,
 	}
 }
 
-func (s *AuthService) Register(ctx context.Context, username, email, password string) error {
+func (s *AuthService) Register(ctx context.Context, username, email, password, inviteCode string) error {
+	if err := s.passwords.Check(password); err != nil {
+		return err
+	}
+
 	// Check if user already exists
 	if _, err := s.userRepo.GetByUsername(ctx, username); err == nil {
 		return errors.New("username already taken")
@@ -43,79 +137,253 @@ func (s *AuthService) Register(ctx context.Context, username, email, password st
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	// Redeeming an invite is the last check so that a use is only taken
+	// for an account that is about to be created
+	invite, pending, err := s.admit(ctx, email, inviteCode)
 	if err != nil {
 		return err
 	}
 
 	user := &repository.User{
-		Username:     username,
-		Email:        email,
-		PasswordHash: string(hashedPassword),
+		Username:        username,
+		Email:           email,
+		PasswordHash:    hashedPassword,
+		PendingApproval: pending,
+	}
+	if invite != nil {
+		user.InviteCodeID = invite.ID
+	}
+
+	if err := s.userRepo.CreateWithRole(ctx, user, RoleUser, ""); err != nil {
+		s.releaseInvite(ctx, invite)
+		return err
 	}
 
-	return s.userRepo.Create(ctx, user)
+	details := map[string]string{"username": username}
+	if invite != nil {
+		details["invite_id"] = invite.ID
+	}
+	if pending {
+		details["pending_approval"] = "true"
+	}
+	s.recordEvent(ctx, user.ID, EventUserRegistered, details)
+	return nil
 }
 
+// Login checks the user's password. Repeated failures for the same account or
+// client address are throttled with a RateLimitError. Passwords hashed with
+// an outdated algorithm or parameters are rehashed once they have been
+// checked.
 func (s *AuthService) Login(ctx context.Context, username, password string) (*TokenPair, error) {
+	keys := s.loginThrottleKeys(ctx, username)
+	if err := s.checkThrottle(ctx, keys); err != nil {
+		s.recordLoginFailure(ctx, "", username, "throttled")
+		return nil, err
+	}
+
 	user, err := s.userRepo.GetByUsername(ctx, username)
 	if err != nil {
+		if err := s.recordFailure(ctx, keys, ""); err != nil {
+			return nil, err
+		}
+		s.recordLoginFailure(ctx, "", username, "unknown_user")
 		return nil, errors.New("invalid credentials")
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	ok, rehash := s.passwords.Verify(user.PasswordHash, password)
+	if !ok {
+		if err := s.recordFailure(ctx, keys, user.ID); err != nil {
+			return nil, err
+		}
+		s.recordLoginFailure(ctx, user.ID, username, "wrong_password")
 		return nil, errors.New("invalid credentials")
 	}
 
-	// Generate token pair
-	return s.generateTokenPair(ctx, user.ID)
+	if err := s.resetThrottle(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	if rehash {
+		s.rehashPassword(ctx, user, password)
+	}
+
+	if err := checkSuspended(user); err != nil {
+		s.recordLoginFailure(ctx, user.ID, username, "suspended")
+		return nil, err
+	}
+
+	if s.config.EmailVerification == EmailVerificationLogin && user.EmailVerifiedAt == nil {
+		s.recordLoginFailure(ctx, user.ID, username, "email_not_verified")
+		return nil, ErrEmailNotVerified
+	}
+
+	if err := s.mfaRequired(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	// Generate token pair, starting a new token family for this login
+	tokens, err := s.generateTokenPair(ctx, user, newSession())
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, user.ID, EventLoginSucceeded, map[string]string{"method": "password"})
+	return tokens, nil
+}
+
+// rehashPassword replaces the user's password hash with one from the current
+// hasher. Failing to do so does not fail the login; it is retried next time.
+func (s *AuthService) rehashPassword(ctx context.Context, user *repository.User, password string) {
+	hashedPassword, err := s.passwords.Hash(password)
+	if err != nil {
+		return
+	}
+	_ = s.userRepo.UpdatePassword(ctx, user.ID, hashedPassword)
 }
 
 func (s *AuthService) RefreshTokens(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	return s.refreshTokens(ctx, refreshToken, "")
+}
+
+// refreshTokens rotates a refresh token issued to the OAuth client clientID,
+// or to a first-party login when clientID is empty.
+func (s *AuthService) refreshTokens(ctx context.Context, refreshToken, clientID string) (*TokenPair, error) {
 	// Validate refresh token
 	token, err := s.tokenRepo.Get(ctx, refreshToken)
-	if err != nil {
-		return nil, errors.New("invalid refresh token")
+	if err != nil || token.ClientID != clientID {
+		s.recordRefreshFailure(ctx, "", clientID, "invalid_token")
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if token.RotatedAt != nil {
+		return nil, s.revokeReusedFamily(ctx, token)
 	}
 
 	if time.Now().After(token.ExpiresAt) {
-		s.tokenRepo.Delete(ctx, refreshToken)
-		return nil, errors.New("refresh token expired")
+		s.tokenRepo.DeleteFamily(ctx, token.FamilyID)
+		s.recordRefreshFailure(ctx, token.UserID, clientID, "expired")
+		return nil, ErrRefreshTokenExpired
+	}
+
+	// Mark old refresh token as rotated. Losing this race means a concurrent
+	// request already used the token, which is treated as a replay.
+	if err := s.tokenRepo.MarkRotated(ctx, token.ID); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return nil, s.revokeReusedFamily(ctx, token)
+		}
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, token.UserID)
+	if err != nil {
+		return nil, err
 	}
 
-	// Delete old refresh token
-	if err := s.tokenRepo.Delete(ctx, refreshToken); err != nil {
+	// Generate new token pair in the same family
+	tokens, err := s.generateTokenPair(ctx, user, session{
+		familyID:  token.FamilyID,
+		startedAt: token.SessionStartedAt,
+		clientID:  token.ClientID,
+		scopes:    token.Scopes,
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// Generate new token pair
-	return s.generateTokenPair(ctx, token.UserID)
+	details := map[string]string{"session_id": token.FamilyID}
+	if clientID != "" {
+		details["client_id"] = clientID
+	}
+	s.recordEvent(ctx, user.ID, EventTokenRefreshed, details)
+	return tokens, nil
 }
 
-func (s *AuthService) generateTokenPair(ctx context.Context, userID string) (*TokenPair, error) {
-	// Generate access token
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id": userID,
-		"exp":     time.Now().Add(s.config.AccessTokenTTL).Unix(),
+// recordRefreshFailure records why a refresh token was not accepted. userID
+// is empty when the token is unknown.
+func (s *AuthService) recordRefreshFailure(ctx context.Context, userID, clientID, reason string) {
+	details := map[string]string{"reason": reason}
+	if clientID != "" {
+		details["client_id"] = clientID
+	}
+	s.recordEvent(ctx, userID, EventTokenRefreshFailed, details)
+}
+
+// revokeReusedFamily deletes every token descended from the same login as the
+// replayed token and records the incident.
+func (s *AuthService) revokeReusedFamily(ctx context.Context, token *repository.RefreshToken) error {
+	if err := s.tokenRepo.DeleteFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+
+	event := newSecurityEvent(ctx, token.UserID, EventRefreshTokenReuse, map[string]string{
+		"family_id": token.FamilyID,
+		"token_id":  token.ID,
 	})
+	if err := s.eventRepo.Create(ctx, event); err != nil {
+		return err
+	}
+
+	return ErrRefreshTokenReuse
+}
 
-	accessTokenString, err := accessToken.SignedString([]byte(s.config.JWTSecretKey))
+func (s *AuthService) generateTokenPair(ctx context.Context, user *repository.User, sess session) (*TokenPair, error) {
+	// Every way of obtaining tokens ends here, so this also covers refresh,
+	// two-factor, external and OAuth logins
+	if err := checkSuspended(user); err != nil {
+		return nil, err
+	}
+
+	userID := user.ID
+	roles, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.PendingApproval {
+		roles = nil
+	}
+
+	// Generate access token
+	accessTokenString, err := s.keys.Sign(Claims{
+		UserID:          userID,
+		Username:        user.Username,
+		Roles:           roles,
+		CanWrite:        s.CanWrite(user),
+		SessionID:       sess.familyID,
+		Scopes:          sess.scopes,
+		ClientID:        sess.clientID,
+		PendingApproval: user.PendingApproval,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.AccessTokenTTL)),
+		},
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	// Generate refresh token
-	refreshTokenBytes := make([]byte, 32)
-	if _, err := rand.Read(refreshTokenBytes); err != nil {
+	refreshTokenString, err := generateOpaqueToken()
+	if err != nil {
 		return nil, err
 	}
-	refreshTokenString := base64.URLEncoding.EncodeToString(refreshTokenBytes)
 
 	// Store refresh token
+	client := ClientInfoFromContext(ctx)
 	refreshTokenEntity := &repository.RefreshToken{
-		UserID:    userID,
-		Token:     refreshTokenString,
-		ExpiresAt: time.Now().Add(s.config.RefreshTokenTTL),
+		UserID:           userID,
+		Token:            refreshTokenString,
+		FamilyID:         sess.familyID,
+		UserAgent:        client.UserAgent,
+		IPAddress:        client.IPAddress,
+		SessionStartedAt: sess.startedAt,
+		ExpiresAt:        time.Now().Add(s.config.RefreshTokenTTL),
+		ClientID:         sess.clientID,
+		Scopes:           sess.scopes,
 	}
 
 	if err := s.tokenRepo.Create(ctx, refreshTokenEntity); err != nil {
@@ -125,30 +393,140 @@ func (s *AuthService) generateTokenPair(ctx context.Context, userID string) (*To
 	return &TokenPair{
 		AccessToken:  accessTokenString,
 		RefreshToken: refreshTokenString,
+		Scopes:       sess.scopes,
 	}, nil
 }
 
-func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (string, error) {
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+// ValidateToken verifies a token and loads its user, rejecting users who
+// have been suspended since the token was issued. Client credentials tokens
+// of service accounts are accepted while their client exists and return no
+// user.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*Claims, *repository.User, error) {
+	if IsPersonalAccessToken(tokenString) {
+		return s.parsePersonalAccessToken(ctx, tokenString)
+	}
+
+	claims, err := s.verifyAccessToken(ctx, tokenString)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Service accounts act as themselves and have no user to return
+	if claims.UserID == "" && claims.ServiceAccount {
+		if err := s.checkClient(ctx, claims); err != nil {
+			return nil, nil, err
 		}
-		return []byte(s.config.JWTSecretKey), nil
-	})
+		return claims, nil, nil
+	}
+
+	return s.checkUserToken(ctx, claims)
+}
+
+// ParseToken verifies an access token or a personal access token and
+// returns its claims. Tokens of suspended users, and access tokens issued
+// before the user's tokens were revoked, are rejected.
+func (s *AuthService) ParseToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, _, err := s.parseToken(ctx, tokenString)
+	return claims, err
+}
+
+func (s *AuthService) parseToken(ctx context.Context, tokenString string) (*Claims, *repository.User, error) {
+	if IsPersonalAccessToken(tokenString) {
+		return s.parsePersonalAccessToken(ctx, tokenString)
+	}
 
+	claims, err := s.verifyAccessToken(ctx, tokenString)
 	if err != nil {
-		return "", err
+		return nil, nil, err
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		userID, ok := claims["user_id"].(string)
-		if !ok {
-			return "", errors.New("invalid user id in token")
+	return s.checkUserToken(ctx, claims)
+}
+
+// checkUserToken checks a verified access token issued to a user and returns
+// the user.
+func (s *AuthService) checkUserToken(ctx context.Context, claims *Claims) (*Claims, *repository.User, error) {
+	if claims.UserID == "" {
+		return nil, nil, errors.New("invalid user id in token")
+	}
+
+	user, err := s.checkAccessTokenHolders(ctx, claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return claims, user, nil
+}
+
+// checkAccessTokenHolders loads the user an access token was issued to and
+// checks that neither they nor an impersonating admin are suspended or have
+// had their tokens revoked since the token was issued.
+func (s *AuthService) checkAccessTokenHolders(ctx context.Context, claims *Claims) (*repository.User, error) {
+	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTokenHolder(user, claims); err != nil {
+		return nil, err
+	}
+
+	if claims.Actor != nil {
+		actor, err := s.userRepo.GetByID(ctx, claims.Actor.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkTokenHolder(actor, claims); err != nil {
+			return nil, err
 		}
-		return userID, nil
 	}
 
-	return "", errors.New("invalid token")
+	return user, nil
+}
+
+func checkTokenHolder(user *repository.User, claims *Claims) error {
+	if err := checkSuspended(user); err != nil {
+		return err
+	}
+	// iat has whole seconds only, so a token issued in the same second as
+	// the revocation is treated as revoked
+	if user.TokensValidAfter != nil && (claims.IssuedAt == nil || !claims.IssuedAt.After(*user.TokensValidAfter)) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// ParseClientToken verifies a client credentials token, which belongs to a
+// confidential OAuth client or a service account rather than to a user, and
+// returns its claims.
+func (s *AuthService) ParseClientToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims, err := s.verifyAccessToken(ctx, tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.UserID != "" || claims.ClientID == "" {
+		return nil, errors.New("not a client credentials token")
+	}
+	if err := s.checkClient(ctx, claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// checkClient checks that the client a client credentials token was issued
+// to has not been deleted since, which revokes its tokens.
+func (s *AuthService) checkClient(ctx context.Context, claims *Claims) error {
+	_, err := s.clientRepo.Get(ctx, claims.ClientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrTokenRevoked
+	}
+	return err
+}
+
+// JWKS returns the public keys access tokens can be verified with.
+func (s *AuthService) JWKS() signing.JWKS {
+	return s.keys.JWKS()
 }
 
 func (s *AuthService) GetUserByUsername(ctx context.Context, username string) (*repository.User, error) {
@@ -159,10 +537,25 @@ func (s *AuthService) GetUserByID(ctx context.Context, userID string) (*reposito
 	return s.userRepo.GetByID(ctx, userID)
 }
 
+// Logout revokes the refresh token together with the rest of its family.
 func (s *AuthService) Logout(ctx context.Context, refreshToken string) error {
-	return s.tokenRepo.Delete(ctx, refreshToken)
+	token, err := s.tokenRepo.Get(ctx, refreshToken)
+	if err != nil {
+		return err
+	}
+	if err := s.tokenRepo.DeleteFamily(ctx, token.FamilyID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, token.UserID, EventLoggedOut, map[string]string{"session_id": token.FamilyID})
+	return nil
 }
 
 func (s *AuthService) LogoutAll(ctx context.Context, userID string) error {
-	return s.tokenRepo.DeleteAllForUser(ctx, userID)
+	if err := s.tokenRepo.DeleteAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventLoggedOut, map[string]string{"all_sessions": "true"})
+	return nil
 }
@@ -6,8 +6,11 @@ import (
 	"time"
 
 	"auth-service/internal/config"
+	"auth-service/internal/password"
 	"auth-service/internal/repository"
+	"auth-service/internal/signing"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -23,6 +26,11 @@ func (m *MockUserRepository) Create(ctx context.Context, user *repository.User)
 	return args.Error(0)
 }
 
+func (m *MockUserRepository) CreateWithRole(ctx context.Context, user *repository.User, role, grantedBy string) error {
+	args := m.Called(ctx, user, role, grantedBy)
+	return args.Error(0)
+}
+
 func (m *MockUserRepository) GetByUsername(ctx context.Context, username string) (*repository.User, error) {
 	args := m.Called(ctx, username)
 	if args.Get(0) == nil {
@@ -47,6 +55,89 @@ func (m *MockUserRepository) GetByID(ctx context.Context, id string) (*repositor
 	return args.Get(0).(*repository.User), args.Error(1)
 }
 
+func (m *MockUserRepository) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	args := m.Called(ctx, id, passwordHash)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) MarkEmailVerified(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) List(ctx context.Context, filter repository.UserFilter) ([]repository.User, int, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]repository.User), args.Int(1), args.Error(2)
+}
+
+func (m *MockUserRepository) Suspend(ctx context.Context, id, reason string, until *time.Time) error {
+	args := m.Called(ctx, id, reason, until)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Unsuspend(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) SetTokensValidAfter(ctx context.Context, id string, at time.Time) error {
+	args := m.Called(ctx, id, at)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) ListDeletions(ctx context.Context, afterID int64, limit int) ([]repository.UserDeletion, error) {
+	args := m.Called(ctx, afterID, limit)
+	return args.Get(0).([]repository.UserDeletion), args.Error(1)
+}
+
+func (m *MockUserRepository) UpdateProfile(ctx context.Context, id, displayName, bio, avatarURL string) error {
+	args := m.Called(ctx, id, displayName, bio, avatarURL)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Rename(ctx context.Context, id, username string) (*repository.UsernameChange, error) {
+	args := m.Called(ctx, id, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.UsernameChange), args.Error(1)
+}
+
+func (m *MockUserRepository) UsernameHistory(ctx context.Context, id string) ([]repository.UsernameChange, error) {
+	args := m.Called(ctx, id)
+	return args.Get(0).([]repository.UsernameChange), args.Error(1)
+}
+
+func (m *MockUserRepository) ListUsernameChanges(ctx context.Context, afterID int64, limit int) ([]repository.UsernameChange, error) {
+	args := m.Called(ctx, afterID, limit)
+	return args.Get(0).([]repository.UsernameChange), args.Error(1)
+}
+
+func (m *MockUserRepository) PreviousOwner(ctx context.Context, username string) (string, error) {
+	args := m.Called(ctx, username)
+	return args.String(0), args.Error(1)
+}
+
+func (m *MockUserRepository) SetPendingEmail(ctx context.Context, id, email string) error {
+	args := m.Called(ctx, id, email)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) ConfirmPendingEmail(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockUserRepository) Approve(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
 type MockTokenRepository struct {
 	mock.Mock
 }
@@ -74,54 +165,222 @@ func (m *MockTokenRepository) DeleteAllForUser(ctx context.Context, userID strin
 	return args.Error(0)
 }
 
-func TestAuthService_Register(t *testing.T) {
-	userRepo := new(MockUserRepository)
-	tokenRepo := new(MockTokenRepository)
-	cfg := &config.Config{
+func (m *MockTokenRepository) MarkRotated(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) DeleteFamily(ctx context.Context, familyID string) error {
+	args := m.Called(ctx, familyID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) ListSessions(ctx context.Context, userID string) ([]repository.Session, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.Session), args.Error(1)
+}
+
+func (m *MockTokenRepository) DeleteSession(ctx context.Context, userID, sessionID string) error {
+	args := m.Called(ctx, userID, sessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) DeleteOtherSessions(ctx context.Context, userID, keepSessionID string) error {
+	args := m.Called(ctx, userID, keepSessionID)
+	return args.Error(0)
+}
+
+func (m *MockTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+type MockRoleRepository struct {
+	mock.Mock
+}
+
+func (m *MockRoleRepository) List(ctx context.Context) ([]repository.Role, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.Role), args.Error(1)
+}
+
+func (m *MockRoleRepository) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRoleRepository) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]string), args.Error(1)
+}
+
+func (m *MockRoleRepository) Assign(ctx context.Context, userID, role, grantedBy string) error {
+	args := m.Called(ctx, userID, role, grantedBy)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) Revoke(ctx context.Context, userID, role string) error {
+	args := m.Called(ctx, userID, role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) Create(ctx context.Context, role *repository.Role) error {
+	args := m.Called(ctx, role)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) Delete(ctx context.Context, name string) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+
+func (m *MockRoleRepository) ListMembers(ctx context.Context, role string) ([]repository.RoleMember, error) {
+	args := m.Called(ctx, role)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]repository.RoleMember), args.Error(1)
+}
+
+type MockSecurityEventRepository struct {
+	mock.Mock
+}
+
+// newMockSecurityEventRepository accepts the authentication events most
+// flows record, so tests only need expectations for the events they check.
+func newMockSecurityEventRepository() *MockSecurityEventRepository {
+	m := new(MockSecurityEventRepository)
+	m.On("Create", mock.Anything, mock.MatchedBy(isAuthenticationEvent)).Return(nil).Maybe()
+	return m
+}
+
+func isAuthenticationEvent(event *repository.SecurityEvent) bool {
+	switch event.Type {
+	case EventUserRegistered, EventLoginSucceeded, EventLoginFailed,
+		EventTokenRefreshed, EventTokenRefreshFailed, EventLoggedOut,
+		EventRoleGranted, EventRoleRevoked:
+		return true
+	}
+	return false
+}
+
+func (m *MockSecurityEventRepository) Create(ctx context.Context, event *repository.SecurityEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockSecurityEventRepository) ListForUser(ctx context.Context, userID string) ([]repository.SecurityEvent, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]repository.SecurityEvent), args.Error(1)
+}
+
+func (m *MockSecurityEventRepository) List(ctx context.Context, filter repository.SecurityEventFilter) ([]repository.SecurityEvent, int, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]repository.SecurityEvent), args.Int(1), args.Error(2)
+}
+
+// testKeys signs access tokens in tests. One key is shared by the whole
+// package to keep key generation out of every test.
+var testKeys = func() *signing.KeySet {
+	key, err := signing.GenerateKey()
+	if err != nil {
+		panic(err)
+	}
+	keys, err := signing.NewKeySet([]*signing.Key{key}, nil)
+	if err != nil {
+		panic(err)
+	}
+	return keys
+}()
+
+// testPasswords hashes with the cheapest bcrypt cost. Test users are created
+// with bcrypt.MinCost hashes, so logging in does not rehash them.
+var testPasswords = password.NewPolicy(password.NewBcrypt(bcrypt.MinCost))
+
+func newTestConfig() *config.Config {
+	return &config.Config{
 		AccessTokenTTL:  time.Minute * 15,
 		RefreshTokenTTL: time.Hour * 24 * 7,
 		JWTSecretKey:    "test-secret",
-	}
+		MFAIssuer:       "Test",
+		MFAChallengeTTL: time.Minute * 5,
 
-	service := NewAuthService(userRepo, tokenRepo, cfg)
+		LoginFailureWindow:      time.Hour,
+		LoginFreeAttempts:       3,
+		LoginBackoffBase:        time.Second,
+		LoginBackoffMax:         time.Minute,
+		LoginLockoutThreshold:   10,
+		LoginLockoutDuration:    time.Minute * 15,
+		LoginIPFreeAttempts:     20,
+		LoginIPLockoutThreshold: 100,
+	}
+}
 
+func TestAuthService_Register(t *testing.T) {
 	t.Run("successful registration", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
 		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(nil, repository.ErrNotFound)
 		userRepo.On("GetByEmail", mock.Anything, "test@example.com").Return(nil, repository.ErrNotFound)
-		userRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.User")).Return(nil)
+		userRepo.On("CreateWithRole", mock.Anything, mock.AnythingOfType("*repository.User"), RoleUser, "").Return(nil)
 
-		err := service.Register(context.Background(), "testuser", "test@example.com", "password123")
+		err := service.Register(context.Background(), "testuser", "test@example.com", "Passw0rd!", "")
 		assert.NoError(t, err)
 
 		userRepo.AssertExpectations(t)
+		roleRepo.AssertExpectations(t)
 	})
 
 	t.Run("username already exists", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
 		userID := uuid.New().String()
 		existingUser := &repository.User{ID: userID, Username: "testuser"}
 		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(existingUser, nil)
 
-		err := service.Register(context.Background(), "testuser", "test@example.com", "password123")
+		err := service.Register(context.Background(), "testuser", "test@example.com", "Passw0rd!", "")
 		assert.Error(t, err)
 		assert.Equal(t, "username already taken", err.Error())
 
 		userRepo.AssertExpectations(t)
 	})
-}
 
-func TestAuthService_Login(t *testing.T) {
-	userRepo := new(MockUserRepository)
-	tokenRepo := new(MockTokenRepository)
-	cfg := &config.Config{
-		AccessTokenTTL:  time.Minute * 15,
-		RefreshTokenTTL: time.Hour * 24 * 7,
-		JWTSecretKey:    "test-secret",
-	}
+	t.Run("weak password", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
 
-	service := NewAuthService(userRepo, tokenRepo, cfg)
+		err := service.Register(context.Background(), "testuser", "test@example.com", "password123", "")
+		assert.ErrorIs(t, err, ErrWeakPassword)
+		userRepo.AssertNotCalled(t, "CreateWithRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
 
+func TestAuthService_Login(t *testing.T) {
 	t.Run("successful login", func(t *testing.T) {
-		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.DefaultCost)
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
 		userID := uuid.New().String()
 		user := &repository.User{
 			ID:           userID,
@@ -130,6 +389,8 @@ func TestAuthService_Login(t *testing.T) {
 		}
 
 		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		userRepo.On("GetByID", mock.Anything, userID).Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, userID).Return([]string{RoleUser, RoleModerator}, nil)
 		tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
 
 		tokens, err := service.Login(context.Background(), "testuser", "password123")
@@ -137,11 +398,22 @@ func TestAuthService_Login(t *testing.T) {
 		assert.NotEmpty(t, tokens.AccessToken)
 		assert.NotEmpty(t, tokens.RefreshToken)
 
+		claims, err := service.ParseToken(context.Background(), tokens.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, claims.UserID)
+		assert.Equal(t, []string{RoleUser, RoleModerator}, claims.Roles)
+
 		userRepo.AssertExpectations(t)
 		tokenRepo.AssertExpectations(t)
+		roleRepo.AssertExpectations(t)
 	})
 
 	t.Run("invalid credentials", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
 		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(nil, repository.ErrNotFound)
 
 		tokens, err := service.Login(context.Background(), "testuser", "password123")
@@ -151,4 +423,392 @@ func TestAuthService_Login(t *testing.T) {
 
 		userRepo.AssertExpectations(t)
 	})
+
+	t.Run("unverified email blocked in login mode", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		cfg := newTestConfig()
+		cfg.EmailVerification = EmailVerificationLogin
+		service := NewAuthService(userRepo, tokenRepo, new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &repository.User{
+			ID:           uuid.New().String(),
+			Username:     "testuser",
+			PasswordHash: string(hashedPassword),
+		}
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+
+		tokens, err := service.Login(context.Background(), "testuser", "password123")
+		assert.ErrorIs(t, err, ErrEmailNotVerified)
+		assert.Nil(t, tokens)
+		tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_CanWrite(t *testing.T) {
+	verifiedAt := time.Now()
+	verified := &repository.User{EmailVerifiedAt: &verifiedAt}
+	unverified := &repository.User{}
+
+	cfg := newTestConfig()
+	service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+	assert.True(t, service.CanWrite(unverified))
+
+	cfg.EmailVerification = EmailVerificationWrite
+	assert.True(t, service.CanWrite(verified))
+	assert.False(t, service.CanWrite(unverified))
+}
+
+func TestAuthService_RefreshTokens(t *testing.T) {
+	t.Run("rotates token within the same family", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		stored := &repository.RefreshToken{
+			ID:        uuid.New().String(),
+			UserID:    uuid.New().String(),
+			Token:     "old-token",
+			FamilyID:  uuid.New().String(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		tokenRepo.On("Get", mock.Anything, "old-token").Return(stored, nil)
+		tokenRepo.On("MarkRotated", mock.Anything, stored.ID).Return(nil)
+		tokenRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *repository.RefreshToken) bool {
+			return token.FamilyID == stored.FamilyID && token.UserID == stored.UserID
+		})).Return(nil)
+		roleRepo.On("GetUserRoles", mock.Anything, stored.UserID).Return([]string{RoleUser}, nil)
+		userRepo.On("GetByID", mock.Anything, stored.UserID).Return(&repository.User{ID: stored.UserID, Username: "testuser"}, nil)
+
+		tokens, err := service.RefreshTokens(context.Background(), "old-token")
+		assert.NoError(t, err)
+		assert.NotEqual(t, "old-token", tokens.RefreshToken)
+
+		tokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("replayed token revokes the family", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := NewAuthService(new(MockUserRepository), tokenRepo, new(MockRoleRepository), eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		rotatedAt := time.Now().Add(-time.Minute)
+		stored := &repository.RefreshToken{
+			ID:        uuid.New().String(),
+			UserID:    uuid.New().String(),
+			Token:     "stolen-token",
+			FamilyID:  uuid.New().String(),
+			RotatedAt: &rotatedAt,
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		tokenRepo.On("Get", mock.Anything, "stolen-token").Return(stored, nil)
+		tokenRepo.On("DeleteFamily", mock.Anything, stored.FamilyID).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.Type == EventRefreshTokenReuse && event.UserID == stored.UserID
+		})).Return(nil)
+
+		tokens, err := service.RefreshTokens(context.Background(), "stolen-token")
+		assert.ErrorIs(t, err, ErrRefreshTokenReuse)
+		assert.Nil(t, tokens)
+
+		tokenRepo.AssertExpectations(t)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("concurrent rotation is treated as reuse", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAuthService(new(MockUserRepository), tokenRepo, new(MockRoleRepository), eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		stored := &repository.RefreshToken{
+			ID:        uuid.New().String(),
+			UserID:    uuid.New().String(),
+			Token:     "raced-token",
+			FamilyID:  uuid.New().String(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		tokenRepo.On("Get", mock.Anything, "raced-token").Return(stored, nil)
+		tokenRepo.On("MarkRotated", mock.Anything, stored.ID).Return(repository.ErrConflict)
+		tokenRepo.On("DeleteFamily", mock.Anything, stored.FamilyID).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.SecurityEvent")).Return(nil)
+
+		_, err := service.RefreshTokens(context.Background(), "raced-token")
+		assert.ErrorIs(t, err, ErrRefreshTokenReuse)
+
+		tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+		eventRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_Sessions(t *testing.T) {
+	t.Run("login records device and session", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", PasswordHash: string(hashedPassword)}
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		var stored *repository.RefreshToken
+		tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*repository.RefreshToken) }).
+			Return(nil)
+
+		ctx := WithClientInfo(context.Background(), ClientInfo{UserAgent: "laptop", IPAddress: "10.0.0.1"})
+		tokens, err := service.Login(ctx, "testuser", "password123")
+		assert.NoError(t, err)
+
+		assert.Equal(t, "laptop", stored.UserAgent)
+		assert.Equal(t, "10.0.0.1", stored.IPAddress)
+		assert.False(t, stored.SessionStartedAt.IsZero())
+
+		claims, err := service.ParseToken(context.Background(), tokens.AccessToken)
+		assert.NoError(t, err)
+		assert.Equal(t, stored.FamilyID, claims.SessionID)
+		assert.Equal(t, "testuser", claims.Username)
+		assert.True(t, claims.CanWrite)
+	})
+
+	t.Run("revoke session with malformed id", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		service := NewAuthService(new(MockUserRepository), tokenRepo, new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		err := service.RevokeSession(context.Background(), uuid.New().String(), "not-a-uuid")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		tokenRepo.AssertNotCalled(t, "DeleteSession", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("revoke other sessions keeps the current one", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := NewAuthService(new(MockUserRepository), tokenRepo, new(MockRoleRepository), eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		userID := uuid.New().String()
+		sessionID := uuid.New().String()
+		tokenRepo.On("DeleteOtherSessions", mock.Anything, userID, sessionID).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.UserID == userID && e.Type == EventLoggedOut && e.Details["other_sessions"] == "true"
+		})).Return(nil).Once()
+
+		assert.NoError(t, service.RevokeOtherSessions(context.Background(), userID, sessionID))
+		assert.ErrorIs(t, service.RevokeOtherSessions(context.Background(), userID, ""), ErrUnknownSession)
+
+		tokenRepo.AssertExpectations(t)
+		eventRepo.AssertExpectations(t)
+	})
+}
+
+func TestAuthService_ParseToken(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+	validClaims := Claims{
+		UserID: uuid.New().String(),
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+	userRepo.On("GetByID", mock.Anything, validClaims.UserID).Return(&repository.User{ID: validClaims.UserID}, nil)
+
+	t.Run("accepts token signed with the current key", func(t *testing.T) {
+		signed, err := testKeys.Sign(validClaims)
+		assert.NoError(t, err)
+
+		claims, err := service.ParseToken(context.Background(), signed)
+		assert.NoError(t, err)
+		assert.Equal(t, validClaims.UserID, claims.UserID)
+	})
+
+	t.Run("rejects token signed with another key", func(t *testing.T) {
+		other, _ := signing.GenerateKey()
+		otherKeys, _ := signing.NewKeySet([]*signing.Key{other}, nil)
+		signed, err := otherKeys.Sign(validClaims)
+		assert.NoError(t, err)
+
+		_, err = service.ParseToken(context.Background(), signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects HMAC token signed with the shared secret", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims)
+		token.Header["kid"] = testKeys.SigningKeyID()
+		signed, err := token.SignedString([]byte("test-secret"))
+		assert.NoError(t, err)
+
+		_, err = service.ParseToken(context.Background(), signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects expired token", func(t *testing.T) {
+		expired := validClaims
+		expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		signed, err := testKeys.Sign(expired)
+		assert.NoError(t, err)
+
+		_, err = service.ParseToken(context.Background(), signed)
+		assert.Error(t, err)
+	})
+
+	t.Run("rejects tokens of suspended users", func(t *testing.T) {
+		suspendedAt := time.Now()
+		suspended := &repository.User{ID: uuid.New().String(), SuspendedAt: &suspendedAt}
+		userRepo.On("GetByID", mock.Anything, suspended.ID).Return(suspended, nil)
+
+		claims := validClaims
+		claims.UserID = suspended.ID
+		signed, err := testKeys.Sign(claims)
+		assert.NoError(t, err)
+
+		_, err = service.ParseToken(context.Background(), signed)
+		var suspendedErr *AccountSuspendedError
+		assert.ErrorAs(t, err, &suspendedErr)
+	})
+
+	t.Run("rejects tokens issued before the user's tokens were revoked", func(t *testing.T) {
+		revokedAt := time.Now().Add(-time.Minute)
+		user := &repository.User{ID: uuid.New().String(), TokensValidAfter: &revokedAt}
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		before := validClaims
+		before.UserID = user.ID
+		before.IssuedAt = jwt.NewNumericDate(revokedAt.Add(-time.Minute))
+		signed, err := testKeys.Sign(before)
+		assert.NoError(t, err)
+		_, err = service.ParseToken(context.Background(), signed)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+
+		after := before
+		after.IssuedAt = jwt.NewNumericDate(time.Now())
+		signed, err = testKeys.Sign(after)
+		assert.NoError(t, err)
+		_, err = service.ParseToken(context.Background(), signed)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rejects impersonation by a suspended admin", func(t *testing.T) {
+		suspendedAt := time.Now()
+		admin := &repository.User{ID: uuid.New().String(), Username: "admin", SuspendedAt: &suspendedAt}
+		userRepo.On("GetByID", mock.Anything, admin.ID).Return(admin, nil)
+
+		claims := validClaims
+		claims.Actor = &Actor{Subject: admin.ID, Username: admin.Username}
+		signed, err := testKeys.Sign(claims)
+		assert.NoError(t, err)
+
+		_, err = service.ParseToken(context.Background(), signed)
+		var suspendedErr *AccountSuspendedError
+		assert.ErrorAs(t, err, &suspendedErr)
+	})
+}
+
+func TestAuthService_Roles(t *testing.T) {
+	t.Run("is admin", func(t *testing.T) {
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		adminID := uuid.New().String()
+		userID := uuid.New().String()
+		roleRepo.On("GetUserRoles", mock.Anything, adminID).Return([]string{RoleAdmin, RoleUser}, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, userID).Return([]string{RoleUser}, nil)
+
+		isAdmin, err := service.IsAdmin(context.Background(), adminID)
+		assert.NoError(t, err)
+		assert.True(t, isAdmin)
+
+		isAdmin, err = service.IsAdmin(context.Background(), userID)
+		assert.NoError(t, err)
+		assert.False(t, isAdmin)
+	})
+
+	t.Run("has permission", func(t *testing.T) {
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		userID := uuid.New().String()
+		roleRepo.On("GetUserPermissions", mock.Anything, userID).Return([]string{PermissionChatModerate, PermissionPostsModerate}, nil)
+
+		allowed, err := service.HasPermission(context.Background(), userID, PermissionPostsModerate)
+		assert.NoError(t, err)
+		assert.True(t, allowed)
+
+		allowed, err = service.HasPermission(context.Background(), userID, PermissionRolesManage)
+		assert.NoError(t, err)
+		assert.False(t, allowed)
+	})
+
+	t.Run("assign role to missing user", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, new(MockTokenRepository), roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		userRepo.On("GetByID", mock.Anything, "missing").Return(nil, repository.ErrNotFound)
+
+		err := service.AssignRole(context.Background(), uuid.New().String(), "missing", RoleModerator)
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+		roleRepo.AssertNotCalled(t, "Assign", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("cannot revoke own admin role", func(t *testing.T) {
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		adminID := uuid.New().String()
+		err := service.RevokeRole(context.Background(), adminID, adminID, RoleAdmin)
+		assert.ErrorIs(t, err, ErrRevokeOwnAdmin)
+		roleRepo.AssertNotCalled(t, "Revoke", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestAuthService_Login_Rehash(t *testing.T) {
+	passwords := password.NewPolicy(password.NewArgon2id(password.Argon2Params{
+		Memory:      1024,
+		Iterations:  1,
+		Parallelism: 1,
+		SaltLength:  16,
+		KeyLength:   32,
+	}), password.NewBcrypt(bcrypt.MinCost))
+
+	newService := func(userRepo *MockUserRepository) *AuthService {
+		roleRepo := new(MockRoleRepository)
+		roleRepo.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{RoleUser}, nil)
+		tokenRepo := new(MockTokenRepository)
+		tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+		return NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, passwords, newTestConfig())
+	}
+
+	t.Run("bcrypt hashes are upgraded", func(t *testing.T) {
+		hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", PasswordHash: string(hashedPassword)}
+
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		userRepo.On("UpdatePassword", mock.Anything, user.ID, mock.MatchedBy(func(hash string) bool {
+			ok, rehash := passwords.Verify(hash, "password123")
+			return ok && !rehash
+		})).Return(nil)
+
+		_, err := newService(userRepo).Login(context.Background(), "testuser", "password123")
+		assert.NoError(t, err)
+		userRepo.AssertExpectations(t)
+	})
+
+	t.Run("current hashes are kept", func(t *testing.T) {
+		hashedPassword, err := passwords.Hash("password123")
+		assert.NoError(t, err)
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser", PasswordHash: hashedPassword}
+
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+
+		_, err = newService(userRepo).Login(context.Background(), "testuser", "password123")
+		assert.NoError(t, err)
+		userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
 }
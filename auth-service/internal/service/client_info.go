@@ -0,0 +1,22 @@
+package service
+
+import "context"
+
+// ClientInfo describes the device a request came from. Transports attach it
+// to the request context so that sessions can be labelled without threading
+// it through every method signature.
+type ClientInfo struct {
+	UserAgent string
+	IPAddress string
+}
+
+type clientInfoKey struct{}
+
+func WithClientInfo(ctx context.Context, info ClientInfo) context.Context {
+	return context.WithValue(ctx, clientInfoKey{}, info)
+}
+
+func ClientInfoFromContext(ctx context.Context) ClientInfo {
+	info, _ := ctx.Value(clientInfoKey{}).(ClientInfo)
+	return info
+}
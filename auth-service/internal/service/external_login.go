@@ -0,0 +1,341 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"auth-service/internal/config"
+	"auth-service/internal/oidc"
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	EventExternalIdentityLinked   = "external_identity_linked"
+	EventExternalIdentityUnlinked = "external_identity_unlinked"
+)
+
+// externalLoginAudience marks flow tokens so they cannot be confused with
+// access tokens or two-factor challenges.
+const externalLoginAudience = "oidc"
+
+// externalLoginTTL is how long the user has to log in at the provider.
+const externalLoginTTL = 10 * time.Minute
+
+const maxGeneratedUsernameLength = 25
+
+var (
+	ErrInvalidExternalLogin = errors.New("invalid or expired external login")
+	ErrExternalEmailMissing = errors.New("the identity provider did not return an email address")
+	// ErrExternalAccountExists is returned when an unknown external identity
+	// has the email address of an existing account. The user must log in
+	// with their password and link the identity instead, so that control of
+	// an email address at the provider is not enough to take over an account.
+	ErrExternalAccountExists = errors.New("an account with this email address already exists; log in and link the identity from your account")
+	ErrIdentityAlreadyLinked = errors.New("this identity is already linked to another account")
+	ErrLastLoginMethod       = errors.New("cannot unlink the only way to log in to this account")
+)
+
+// ExternalLoginService logs users in with an external OpenID provider. The
+// first login with an unknown identity registers a new account; identities
+// can also be linked to an existing account, and an account can have several.
+type ExternalLoginService struct {
+	auth         *AuthService
+	identityRepo repository.ExternalIdentityRepository
+	provider     *oidc.Provider
+	config       *config.Config
+}
+
+func NewExternalLoginService(auth *AuthService, identityRepo repository.ExternalIdentityRepository, provider *oidc.Provider, config *config.Config) *ExternalLoginService {
+	return &ExternalLoginService{
+		auth:         auth,
+		identityRepo: identityRepo,
+		provider:     provider,
+		config:       config,
+	}
+}
+
+// ExternalLoginResult is the outcome of a completed external login. Tokens
+// is set for logins and Identity when an identity was linked.
+type ExternalLoginResult struct {
+	Tokens   *TokenPair
+	Identity *repository.ExternalIdentity
+}
+
+// externalLoginClaims is the state of a login in progress. It is kept in a
+// signed cookie in the user's browser until the provider redirects back.
+type externalLoginClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	// LinkUserID is set when a logged-in user is linking an identity.
+	LinkUserID string `json:"link_user_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// Start begins a login, or links an identity to linkUserID if it is set. It
+// returns the provider URL to send the user to and the flow token that must
+// be passed back to Complete.
+func (s *ExternalLoginService) Start(ctx context.Context, linkUserID string) (string, string, error) {
+	state, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier, err := generateOpaqueToken()
+	if err != nil {
+		return "", "", err
+	}
+	verifier = strings.TrimRight(verifier, "=")
+
+	sum := sha256.Sum256([]byte(verifier))
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		return "", "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, externalLoginClaims{
+		State:        state,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		LinkUserID:   linkUserID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Audience:  jwt.ClaimStrings{externalLoginAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(externalLoginTTL)),
+		},
+	})
+	flowToken, err := token.SignedString([]byte(s.config.JWTSecretKey))
+	if err != nil {
+		return "", "", err
+	}
+
+	return authURL, flowToken, nil
+}
+
+// Complete finishes the flow started by Start once the provider redirects
+// back with state and code.
+func (s *ExternalLoginService) Complete(ctx context.Context, flowToken, state, code string) (*ExternalLoginResult, error) {
+	flow := &externalLoginClaims{}
+	_, err := jwt.ParseWithClaims(flowToken, flow, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(externalLoginAudience))
+	if err != nil || flow.State == "" || flow.State != state {
+		return nil, ErrInvalidExternalLogin
+	}
+
+	claims, err := s.provider.Exchange(ctx, code, flow.CodeVerifier, flow.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	if flow.LinkUserID != "" {
+		identity, err := s.link(ctx, flow.LinkUserID, claims)
+		if err != nil {
+			return nil, err
+		}
+		return &ExternalLoginResult{Identity: identity}, nil
+	}
+
+	tokens, err := s.login(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	return &ExternalLoginResult{Tokens: tokens}, nil
+}
+
+func (s *ExternalLoginService) login(ctx context.Context, claims *oidc.Claims) (*TokenPair, error) {
+	var user *repository.User
+	identity, err := s.identityRepo.GetBySubject(ctx, s.provider.Issuer(), claims.Subject)
+	switch {
+	case err == nil:
+		if user, err = s.auth.userRepo.GetByID(ctx, identity.UserID); err != nil {
+			return nil, err
+		}
+		// Last login is informational, so failing to record it is not fatal
+		_ = s.identityRepo.MarkUsed(ctx, identity.ID)
+	case errors.Is(err, repository.ErrNotFound):
+		if user, err = s.register(ctx, claims); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if s.config.EmailVerification == EmailVerificationLogin && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	if err := s.auth.mfaRequired(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return s.auth.generateTokenPair(ctx, user, newSession())
+}
+
+// register creates an account for an identity seen for the first time.
+func (s *ExternalLoginService) register(ctx context.Context, claims *oidc.Claims) (*repository.User, error) {
+	if claims.Email == "" {
+		return nil, ErrExternalEmailMissing
+	}
+	if _, err := s.auth.userRepo.GetByEmail(ctx, claims.Email); err == nil {
+		return nil, ErrExternalAccountExists
+	}
+
+	username, err := s.availableUsername(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+
+	// External sign-ups follow the registration mode too. They cannot bring
+	// an invite code, so invite-only registration turns them away.
+	_, pending, err := s.auth.admit(ctx, claims.Email, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// The account has no password until the user sets one with a reset link
+	user := &repository.User{
+		Username:        username,
+		Email:           claims.Email,
+		PendingApproval: pending,
+	}
+	if claims.EmailVerified {
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+	if err := s.auth.userRepo.CreateWithRole(ctx, user, RoleUser, ""); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.createIdentity(ctx, user.ID, claims); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *ExternalLoginService) link(ctx context.Context, userID string, claims *oidc.Claims) (*repository.ExternalIdentity, error) {
+	existing, err := s.identityRepo.GetBySubject(ctx, s.provider.Issuer(), claims.Subject)
+	if err == nil {
+		if existing.UserID != userID {
+			return nil, ErrIdentityAlreadyLinked
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	identity, err := s.createIdentity(ctx, userID, claims)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrIdentityAlreadyLinked
+	}
+	return identity, err
+}
+
+func (s *ExternalLoginService) createIdentity(ctx context.Context, userID string, claims *oidc.Claims) (*repository.ExternalIdentity, error) {
+	identity := &repository.ExternalIdentity{
+		UserID:  userID,
+		Issuer:  s.provider.Issuer(),
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}
+	if err := s.identityRepo.Create(ctx, identity); err != nil {
+		return nil, err
+	}
+
+	s.auth.recordEvent(ctx, userID, EventExternalIdentityLinked, map[string]string{
+		"identity_id": identity.ID,
+		"issuer":      identity.Issuer,
+	})
+	return identity, nil
+}
+
+func (s *ExternalLoginService) ListIdentities(ctx context.Context, userID string) ([]repository.ExternalIdentity, error) {
+	return s.identityRepo.ListForUser(ctx, userID)
+}
+
+// UnlinkIdentity removes one of userID's external identities. The last one
+// cannot be removed from an account without a password.
+func (s *ExternalLoginService) UnlinkIdentity(ctx context.Context, userID, identityID string) error {
+	if _, err := uuid.Parse(identityID); err != nil {
+		return repository.ErrNotFound
+	}
+
+	user, err := s.auth.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.PasswordHash == "" {
+		identities, err := s.identityRepo.ListForUser(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if len(identities) <= 1 {
+			return ErrLastLoginMethod
+		}
+	}
+
+	if err := s.identityRepo.Delete(ctx, userID, identityID); err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, userID, EventExternalIdentityUnlinked, map[string]string{"identity_id": identityID})
+	return nil
+}
+
+// availableUsername derives a username from the provider's claims, adding a
+// random suffix if it is taken.
+func (s *ExternalLoginService) availableUsername(ctx context.Context, claims *oidc.Claims) (string, error) {
+	base := claims.PreferredUsername
+	if base == "" || strings.Contains(base, "@") {
+		base = strings.SplitN(claims.Email, "@", 2)[0]
+	}
+	base = sanitizeUsername(base)
+
+	candidate := base
+	for i := 0; i < 5; i++ {
+		if _, err := s.auth.userRepo.GetByUsername(ctx, candidate); err != nil {
+			return candidate, nil
+		}
+		suffix := make([]byte, 2)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		candidate = base + "-" + hex.EncodeToString(suffix)
+	}
+	return "", errors.New("could not find a free username")
+}
+
+// sanitizeUsername keeps the characters allowed in usernames.
+func sanitizeUsername(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r) || r == '_' || r == '-':
+			b.WriteRune(r)
+		case r == '.':
+			b.WriteRune('_')
+		}
+	}
+
+	username := b.String()
+	if len(username) > maxGeneratedUsernameLength {
+		username = username[:maxGeneratedUsernameLength]
+	}
+	if len(username) < 3 {
+		username = "user"
+	}
+	return username
+}
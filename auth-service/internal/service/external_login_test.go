@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-service/internal/oidc"
+	"auth-service/internal/oidc/oidctest"
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockExternalIdentityRepository struct {
+	mock.Mock
+}
+
+func (m *MockExternalIdentityRepository) Create(ctx context.Context, identity *repository.ExternalIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *MockExternalIdentityRepository) GetBySubject(ctx context.Context, issuer, subject string) (*repository.ExternalIdentity, error) {
+	args := m.Called(ctx, issuer, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.ExternalIdentity), args.Error(1)
+}
+
+func (m *MockExternalIdentityRepository) ListForUser(ctx context.Context, userID string) ([]repository.ExternalIdentity, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]repository.ExternalIdentity), args.Error(1)
+}
+
+func (m *MockExternalIdentityRepository) Delete(ctx context.Context, userID, id string) error {
+	args := m.Called(ctx, userID, id)
+	return args.Error(0)
+}
+
+func (m *MockExternalIdentityRepository) MarkUsed(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// externalLoginTest wires an ExternalLoginService to fresh mocks and a mock
+// OpenID provider.
+type externalLoginTest struct {
+	service      *ExternalLoginService
+	auth         *AuthService
+	idp          *oidctest.Server
+	userRepo     *MockUserRepository
+	tokenRepo    *MockTokenRepository
+	roleRepo     *MockRoleRepository
+	identityRepo *MockExternalIdentityRepository
+}
+
+func newExternalLoginTest(t *testing.T) *externalLoginTest {
+	idp := oidctest.NewServer()
+	t.Cleanup(idp.Close)
+
+	cfg := newTestConfig()
+	e := &externalLoginTest{
+		idp:          idp,
+		userRepo:     new(MockUserRepository),
+		tokenRepo:    new(MockTokenRepository),
+		roleRepo:     new(MockRoleRepository),
+		identityRepo: new(MockExternalIdentityRepository),
+	}
+	eventRepo := newMockSecurityEventRepository()
+	eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	e.auth = NewAuthService(e.userRepo, e.tokenRepo, e.roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+	provider := oidc.NewProvider(idp.Config("https://auth.example.com/api/v1/auth/oidc/callback"))
+	e.service = NewExternalLoginService(e.auth, e.identityRepo, provider, cfg)
+	return e
+}
+
+// login runs the whole flow for identity, optionally linking it to linkUserID.
+func (e *externalLoginTest) login(t *testing.T, identity oidctest.Identity, linkUserID string) (*ExternalLoginResult, error) {
+	authURL, flowToken, err := e.service.Start(context.Background(), linkUserID)
+	require.NoError(t, err)
+	code, state := e.idp.Authorize(authURL, identity)
+	return e.service.Complete(context.Background(), flowToken, state, code)
+}
+
+func TestExternalLoginService_Login(t *testing.T) {
+	identity := oidctest.Identity{
+		Subject:           "248289761001",
+		Email:             "jane.doe@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "jane.doe",
+	}
+
+	t.Run("first login registers a user", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		userID := uuid.New().String()
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).Return(nil, repository.ErrNotFound)
+		e.userRepo.On("GetByEmail", mock.Anything, identity.Email).Return(nil, repository.ErrNotFound)
+		e.userRepo.On("GetByUsername", mock.Anything, "jane_doe").Return(&repository.User{}, nil)
+		e.userRepo.On("GetByUsername", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+		e.userRepo.On("CreateWithRole", mock.Anything, mock.MatchedBy(func(user *repository.User) bool {
+			return user.PasswordHash == "" && user.Email == identity.Email && user.EmailVerifiedAt != nil && len(user.Username) == len("jane_doe-0000")
+		}), RoleUser, "").Run(func(args mock.Arguments) {
+			args.Get(1).(*repository.User).ID = userID
+		}).Return(nil)
+		e.identityRepo.On("Create", mock.Anything, mock.MatchedBy(func(linked *repository.ExternalIdentity) bool {
+			return linked.UserID == userID && linked.Issuer == e.idp.URL && linked.Subject == identity.Subject
+		})).Return(nil)
+		e.roleRepo.On("GetUserRoles", mock.Anything, userID).Return([]string{RoleUser}, nil)
+		e.tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+		e.userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID}, nil)
+
+		result, err := e.login(t, identity, "")
+		require.NoError(t, err)
+		require.NotNil(t, result.Tokens)
+
+		claims, err := e.auth.ParseToken(context.Background(), result.Tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, userID, claims.UserID)
+		e.userRepo.AssertExpectations(t)
+		e.identityRepo.AssertExpectations(t)
+	})
+
+	t.Run("known identity logs in", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		user := &repository.User{ID: uuid.New().String(), Username: "jane", Email: identity.Email}
+		linked := &repository.ExternalIdentity{ID: uuid.New().String(), UserID: user.ID, Issuer: e.idp.URL, Subject: identity.Subject}
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).Return(linked, nil)
+		e.identityRepo.On("MarkUsed", mock.Anything, linked.ID).Return(nil)
+		e.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		e.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		e.tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		result, err := e.login(t, identity, "")
+		require.NoError(t, err)
+		assert.NotEmpty(t, result.Tokens.RefreshToken)
+		e.identityRepo.AssertExpectations(t)
+	})
+
+	t.Run("email of an existing account is not taken over", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).Return(nil, repository.ErrNotFound)
+		e.userRepo.On("GetByEmail", mock.Anything, identity.Email).Return(&repository.User{ID: uuid.New().String()}, nil)
+
+		_, err := e.login(t, identity, "")
+		assert.ErrorIs(t, err, ErrExternalAccountExists)
+		e.userRepo.AssertNotCalled(t, "CreateWithRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("mismatched state is rejected", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		authURL, flowToken, err := e.service.Start(context.Background(), "")
+		require.NoError(t, err)
+		code, _ := e.idp.Authorize(authURL, identity)
+
+		_, err = e.service.Complete(context.Background(), flowToken, "forged", code)
+		assert.ErrorIs(t, err, ErrInvalidExternalLogin)
+	})
+
+	t.Run("two-factor users get a challenge", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		enabledAt := time.Now()
+		mfaRepo := new(MockMFARepository)
+		mfaRepo.On("Get", mock.Anything, mock.Anything).Return(&repository.MFASecret{EnabledAt: &enabledAt}, nil)
+		e.auth.mfaRepo = mfaRepo
+
+		user := &repository.User{ID: uuid.New().String(), Username: "jane", Email: identity.Email}
+		linked := &repository.ExternalIdentity{ID: uuid.New().String(), UserID: user.ID}
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).Return(linked, nil)
+		e.identityRepo.On("MarkUsed", mock.Anything, linked.ID).Return(nil)
+		e.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := e.login(t, identity, "")
+		var mfaErr *MFARequiredError
+		assert.ErrorAs(t, err, &mfaErr)
+	})
+}
+
+func TestExternalLoginService_Link(t *testing.T) {
+	identity := oidctest.Identity{Subject: "sub-1", Email: "jane@example.com"}
+	userID := uuid.New().String()
+
+	t.Run("identity is linked to the current user", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).Return(nil, repository.ErrNotFound)
+		e.identityRepo.On("Create", mock.Anything, mock.MatchedBy(func(linked *repository.ExternalIdentity) bool {
+			return linked.UserID == userID
+		})).Return(nil)
+
+		result, err := e.login(t, identity, userID)
+		require.NoError(t, err)
+		assert.Nil(t, result.Tokens)
+		assert.Equal(t, identity.Subject, result.Identity.Subject)
+	})
+
+	t.Run("identity of another user cannot be linked", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		e.identityRepo.On("GetBySubject", mock.Anything, e.idp.URL, identity.Subject).
+			Return(&repository.ExternalIdentity{UserID: uuid.New().String()}, nil)
+
+		_, err := e.login(t, identity, userID)
+		assert.ErrorIs(t, err, ErrIdentityAlreadyLinked)
+	})
+}
+
+func TestExternalLoginService_UnlinkIdentity(t *testing.T) {
+	userID := uuid.New().String()
+	identityID := uuid.New().String()
+
+	t.Run("last login method is kept", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		e.userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID}, nil)
+		e.identityRepo.On("ListForUser", mock.Anything, userID).Return([]repository.ExternalIdentity{{ID: identityID}}, nil)
+
+		err := e.service.UnlinkIdentity(context.Background(), userID, identityID)
+		assert.ErrorIs(t, err, ErrLastLoginMethod)
+		e.identityRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("users with a password can unlink", func(t *testing.T) {
+		e := newExternalLoginTest(t)
+		e.userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID, PasswordHash: "hash"}, nil)
+		e.identityRepo.On("Delete", mock.Anything, userID, identityID).Return(nil)
+
+		require.NoError(t, e.service.UnlinkIdentity(context.Background(), userID, identityID))
+	})
+}
+
+func TestSanitizeUsername(t *testing.T) {
+	assert.Equal(t, "jane_doe", sanitizeUsername("jane.doe"))
+	assert.Equal(t, "user", sanitizeUsername("j+"))
+	assert.Len(t, sanitizeUsername("a-very-long-username-from-the-provider"), maxGeneratedUsernameLength)
+}
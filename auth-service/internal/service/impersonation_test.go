@@ -0,0 +1,88 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newImpersonationTestService(userRepo *MockUserRepository, roleRepo *MockRoleRepository, eventRepo *MockSecurityEventRepository) *AuthService {
+	cfg := newTestConfig()
+	cfg.ImpersonationTTL = 10 * time.Minute
+	return NewAuthService(userRepo, new(MockTokenRepository), roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+}
+
+func TestAuthService_Impersonate(t *testing.T) {
+	ctx := context.Background()
+	admin := &repository.User{ID: uuid.New().String(), Username: "root"}
+	user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+
+	t.Run("token acts as the user on behalf of the admin", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := newImpersonationTestService(userRepo, roleRepo, eventRepo)
+
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		userRepo.On("GetByID", mock.Anything, admin.ID).Return(admin, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.Type == EventUserImpersonated && event.UserID == user.ID &&
+				event.Details["actor_id"] == admin.ID && event.Details["token_id"] != ""
+		})).Return(nil).Once()
+
+		impersonation, err := service.Impersonate(ctx, admin.ID, user.ID)
+		require.NoError(t, err)
+		assert.WithinDuration(t, time.Now().Add(10*time.Minute), impersonation.ExpiresAt, time.Minute)
+
+		claims, err := service.ParseToken(ctx, impersonation.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, claims.UserID)
+		assert.Equal(t, []string{RoleUser}, claims.Roles)
+		assert.Equal(t, &Actor{Subject: admin.ID, Username: "root"}, claims.Actor)
+		// There is no session and so nothing to refresh
+		assert.Empty(t, claims.SessionID)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("admins cannot be impersonated", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		service := newImpersonationTestService(userRepo, roleRepo, newMockSecurityEventRepository())
+		other := &repository.User{ID: uuid.New().String(), Username: "other-admin"}
+
+		userRepo.On("GetByID", mock.Anything, other.ID).Return(other, nil)
+		userRepo.On("GetByID", mock.Anything, admin.ID).Return(admin, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, other.ID).Return([]string{RoleUser, RoleAdmin}, nil)
+
+		_, err := service.Impersonate(ctx, admin.ID, other.ID)
+		assert.ErrorIs(t, err, ErrImpersonateAdmin)
+	})
+
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		service := newImpersonationTestService(userRepo, roleRepo, newMockSecurityEventRepository())
+		suspended := suspendedUser(nil)
+
+		userRepo.On("GetByID", mock.Anything, suspended.ID).Return(suspended, nil)
+		userRepo.On("GetByID", mock.Anything, admin.ID).Return(admin, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, suspended.ID).Return([]string{RoleUser}, nil)
+
+		_, err := service.Impersonate(ctx, admin.ID, admin.ID)
+		assert.ErrorIs(t, err, ErrImpersonateSelf)
+		_, err = service.Impersonate(ctx, admin.ID, "not-a-uuid")
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+
+		_, err = service.Impersonate(ctx, admin.ID, suspended.ID)
+		var suspendedErr *AccountSuspendedError
+		assert.ErrorAs(t, err, &suspendedErr)
+	})
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/mailer"
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// magicLinkAudience marks login links so they cannot be confused with access
+// tokens or other internal tokens.
+const magicLinkAudience = "magic-link"
+
+var (
+	ErrMagicLinkDisabled = errors.New("login links are disabled")
+	ErrInvalidMagicLink  = errors.New("invalid or expired login link")
+)
+
+// MagicLinkService logs users in with a link emailed to them. A link is a
+// signed token whose ID is also stored, so that it can be used only once.
+type MagicLinkService struct {
+	auth     *AuthService
+	linkRepo repository.OneTimeTokenRepository
+	mailer   mailer.Mailer
+	config   *config.Config
+}
+
+func NewMagicLinkService(auth *AuthService, linkRepo repository.OneTimeTokenRepository, mailer mailer.Mailer, config *config.Config) *MagicLinkService {
+	return &MagicLinkService{
+		auth:     auth,
+		linkRepo: linkRepo,
+		mailer:   mailer,
+		config:   config,
+	}
+}
+
+// RequestLink mails a login link to the account registered with email.
+// Unknown addresses, and accounts that may not use links, are silently
+// ignored so that the endpoint cannot be used to find out who has an
+// account. Requests are limited per address whether or not it is known.
+func (s *MagicLinkService) RequestLink(ctx context.Context, email string) error {
+	if !s.config.MagicLinkEnabled {
+		return ErrMagicLinkDisabled
+	}
+
+	if err := s.throttle(ctx, email); err != nil {
+		return err
+	}
+
+	user, err := s.auth.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil
+	}
+	if checkSuspended(user) != nil {
+		return nil
+	}
+	allowed, err := s.allowed(ctx, user.ID)
+	if err != nil || !allowed {
+		return err
+	}
+
+	link, err := s.createLink(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to log in. It works once and expires in %s.\n\n%s\n\n"+
+			"If you didn't ask for it, you can ignore this email.\n",
+			user.Username, s.config.MagicLinkTTL, link),
+	})
+}
+
+// throttle counts a request for a link to email and returns a RateLimitError
+// once MagicLinkMaxRequests have been made in MagicLinkWindow.
+func (s *MagicLinkService) throttle(ctx context.Context, email string) error {
+	key := "magic-link:" + strings.ToLower(email)
+	attempt, err := s.auth.attemptRepo.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if wait := time.Until(attempt.LockedUntil); wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+
+	requests, err := s.auth.attemptRepo.RecordFailure(ctx, key, s.config.MagicLinkWindow)
+	if err != nil {
+		return err
+	}
+	if requests >= s.config.MagicLinkMaxRequests {
+		return s.auth.attemptRepo.Lock(ctx, key, time.Now().Add(s.config.MagicLinkWindow))
+	}
+	return nil
+}
+
+// allowed reports whether userID may log in with a link.
+func (s *MagicLinkService) allowed(ctx context.Context, userID string) (bool, error) {
+	if s.config.MagicLinkAdmins {
+		return true, nil
+	}
+	isAdmin, err := s.auth.IsAdmin(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return !isAdmin, nil
+}
+
+// createLink stores the ID of a new login token for userID and returns the
+// link that redeems it.
+func (s *MagicLinkService) createLink(ctx context.Context, userID string) (string, error) {
+	expiresAt := time.Now().Add(s.config.MagicLinkTTL)
+	id := uuid.New().String()
+
+	linkToken := &repository.OneTimeToken{
+		UserID:    userID,
+		TokenHash: hashToken(id),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.linkRepo.Create(ctx, linkToken); err != nil {
+		return "", err
+	}
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{magicLinkAudience},
+		ID:        id,
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	}).SignedString([]byte(s.config.JWTSecretKey))
+	if err != nil {
+		return "", err
+	}
+
+	return s.config.AppURL + "/magic-login?token=" + url.QueryEscape(token), nil
+}
+
+// Login redeems a login link. Following the link proves that the user owns
+// the email address, so it is marked as verified. Users with two-factor
+// authentication still get an MFARequiredError.
+func (s *MagicLinkService) Login(ctx context.Context, token string) (*TokenPair, error) {
+	if !s.config.MagicLinkEnabled {
+		return nil, ErrMagicLinkDisabled
+	}
+
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(magicLinkAudience))
+	if err != nil || claims.ID == "" {
+		return nil, ErrInvalidMagicLink
+	}
+
+	linkToken, err := s.linkRepo.Consume(ctx, hashToken(claims.ID))
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && linkToken.UserID != claims.Subject) {
+		return nil, ErrInvalidMagicLink
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.auth.userRepo.GetByID(ctx, linkToken.UserID)
+	if err != nil {
+		return nil, ErrInvalidMagicLink
+	}
+
+	// The user may have been made an admin since the link was sent
+	allowed, err := s.allowed(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrInvalidMagicLink
+	}
+
+	if err := checkSuspended(user); err != nil {
+		s.auth.recordLoginFailure(ctx, user.ID, user.Username, "suspended")
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		if err := s.auth.userRepo.MarkEmailVerified(ctx, user.ID); err != nil {
+			return nil, err
+		}
+		now := time.Now()
+		user.EmailVerifiedAt = &now
+	}
+
+	// Any other outstanding links are now stale
+	if err := s.linkRepo.DeleteAllForUser(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.mfaRequired(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.auth.generateTokenPair(ctx, user, newSession())
+	if err != nil {
+		return nil, err
+	}
+	s.auth.recordEvent(ctx, user.ID, EventLoginSucceeded, map[string]string{"method": "magic_link"})
+	return tokens, nil
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type magicLinkTestDeps struct {
+	userRepo  *MockUserRepository
+	tokenRepo *MockTokenRepository
+	roleRepo  *MockRoleRepository
+	linkRepo  *MockOneTimeTokenRepository
+	mail      *fakeMailer
+}
+
+func newMagicLinkTestService() (*MagicLinkService, magicLinkTestDeps) {
+	deps := magicLinkTestDeps{
+		userRepo:  new(MockUserRepository),
+		tokenRepo: new(MockTokenRepository),
+		roleRepo:  new(MockRoleRepository),
+		linkRepo:  new(MockOneTimeTokenRepository),
+		mail:      &fakeMailer{},
+	}
+	cfg := newTestAccountConfig()
+	cfg.MagicLinkEnabled = true
+	cfg.MagicLinkTTL = 15 * time.Minute
+	cfg.MagicLinkMaxRequests = 2
+	cfg.MagicLinkWindow = time.Hour
+
+	eventRepo := newMockSecurityEventRepository()
+	eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	authService := NewAuthService(deps.userRepo, deps.tokenRepo, deps.roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+	return NewMagicLinkService(authService, deps.linkRepo, deps.mail, cfg), deps
+}
+
+// linkToken returns the token from the login link in body.
+func linkToken(t *testing.T, body string) string {
+	prefix := "https://forum.example.com/magic-login?token="
+	start := strings.Index(body, prefix)
+	require.GreaterOrEqual(t, start, 0)
+	token, err := url.QueryUnescape(strings.Fields(body[start+len(prefix):])[0])
+	require.NoError(t, err)
+	return token
+}
+
+func TestMagicLinkService_RequestLink(t *testing.T) {
+	ctx := context.Background()
+	user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com"}
+
+	t.Run("sends a link that logs in once", func(t *testing.T) {
+		service, deps := newMagicLinkTestService()
+
+		deps.userRepo.On("GetByEmail", mock.Anything, "alice@example.com").Return(user, nil)
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("MarkEmailVerified", mock.Anything, user.ID).Return(nil).Once()
+		deps.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		deps.tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+		deps.linkRepo.On("DeleteAllForUser", mock.Anything, user.ID).Return(nil)
+
+		var stored *repository.OneTimeToken
+		deps.linkRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OneTimeToken")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*repository.OneTimeToken) }).
+			Return(nil)
+
+		require.NoError(t, service.RequestLink(ctx, "alice@example.com"))
+		require.Len(t, deps.mail.sent, 1)
+		assert.Equal(t, "alice@example.com", deps.mail.sent[0].To)
+		assert.WithinDuration(t, time.Now().Add(15*time.Minute), stored.ExpiresAt, time.Minute)
+
+		token := linkToken(t, deps.mail.sent[0].Body)
+		// Only the hash of the link ID is persisted
+		assert.NotContains(t, token, stored.TokenHash)
+		deps.linkRepo.On("Consume", mock.Anything, stored.TokenHash).
+			Return(&repository.OneTimeToken{UserID: user.ID}, nil).Once()
+		deps.linkRepo.On("Consume", mock.Anything, stored.TokenHash).
+			Return(nil, repository.ErrNotFound)
+
+		tokens, err := service.Login(ctx, token)
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+		assert.NotEmpty(t, tokens.RefreshToken)
+
+		_, err = service.Login(ctx, token)
+		assert.ErrorIs(t, err, ErrInvalidMagicLink)
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("unknown email is ignored", func(t *testing.T) {
+		service, deps := newMagicLinkTestService()
+		deps.userRepo.On("GetByEmail", mock.Anything, "nobody@example.com").Return(nil, repository.ErrNotFound)
+
+		assert.NoError(t, service.RequestLink(ctx, "nobody@example.com"))
+		assert.Empty(t, deps.mail.sent)
+		deps.linkRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("requests are limited per address", func(t *testing.T) {
+		service, deps := newMagicLinkTestService()
+		deps.userRepo.On("GetByEmail", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+		assert.NoError(t, service.RequestLink(ctx, "nobody@example.com"))
+		assert.NoError(t, service.RequestLink(ctx, "Nobody@example.com"))
+		err := service.RequestLink(ctx, "nobody@example.com")
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+
+		assert.NoError(t, service.RequestLink(ctx, "other@example.com"))
+	})
+
+	t.Run("admins cannot use links unless allowed", func(t *testing.T) {
+		service, deps := newMagicLinkTestService()
+		admin := &repository.User{ID: uuid.New().String(), Username: "root", Email: "root@example.com"}
+		deps.userRepo.On("GetByEmail", mock.Anything, "root@example.com").Return(admin, nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, admin.ID).Return([]string{RoleUser, RoleAdmin}, nil)
+		deps.linkRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		assert.NoError(t, service.RequestLink(ctx, "root@example.com"))
+		assert.Empty(t, deps.mail.sent)
+
+		service.config.MagicLinkAdmins = true
+		assert.NoError(t, service.RequestLink(ctx, "root@example.com"))
+		assert.Len(t, deps.mail.sent, 1)
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		service, _ := newMagicLinkTestService()
+		service.config.MagicLinkEnabled = false
+
+		assert.ErrorIs(t, service.RequestLink(ctx, "alice@example.com"), ErrMagicLinkDisabled)
+		_, err := service.Login(ctx, "token")
+		assert.ErrorIs(t, err, ErrMagicLinkDisabled)
+	})
+}
+
+func TestMagicLinkService_Login(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("other tokens are rejected", func(t *testing.T) {
+		service, deps := newMagicLinkTestService()
+
+		// A two-factor challenge is signed with the same key
+		challenge, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+			Subject:   uuid.New().String(),
+			Audience:  jwt.ClaimStrings{mfaAudience},
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}).SignedString([]byte(service.config.JWTSecretKey))
+		require.NoError(t, err)
+
+		for _, token := range []string{"", "not-a-token", challenge} {
+			_, err := service.Login(ctx, token)
+			assert.ErrorIs(t, err, ErrInvalidMagicLink)
+		}
+		deps.linkRepo.AssertNotCalled(t, "Consume", mock.Anything, mock.Anything)
+	})
+}
@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	EventMFAEnabled                  = "mfa_enabled"
+	EventMFADisabled                 = "mfa_disabled"
+	EventMFARecoveryCodeUsed         = "mfa_recovery_code_used"
+	EventMFARecoveryCodesRegenerated = "mfa_recovery_codes_regenerated"
+)
+
+// mfaAudience marks challenge tokens so they cannot be confused with access
+// tokens, which carry no audience.
+const mfaAudience = "mfa"
+
+const recoveryCodeCount = 10
+
+var (
+	ErrMFAAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled    = errors.New("no pending two-factor enrollment")
+	ErrInvalidMFACode    = errors.New("invalid two-factor code")
+	ErrInvalidMFAToken   = errors.New("invalid or expired mfa token")
+)
+
+// MFARequiredError is returned by Login when the password was correct but the
+// account has two-factor authentication enabled. The login is completed by
+// passing ChallengeToken and a code to VerifyMFA.
+type MFARequiredError struct {
+	ChallengeToken string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "mfa_required"
+}
+
+// MFAEnrollment is a pending TOTP setup for the user to add to their
+// authenticator app.
+type MFAEnrollment struct {
+	Secret string
+	// URI is the otpauth:// URI to render as a QR code.
+	URI string
+}
+
+// EnrollMFA starts TOTP enrollment. The secret is not used for logins until
+// ConfirmMFA succeeds; enrolling again replaces a pending secret.
+func (s *AuthService) EnrollMFA(ctx context.Context, userID string) (*MFAEnrollment, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.mfaRepo.Get(ctx, userID)
+	if err == nil && existing.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.Save(ctx, &repository.MFASecret{UserID: userID, Secret: secret}); err != nil {
+		return nil, err
+	}
+
+	return &MFAEnrollment{
+		Secret: secret,
+		URI:    totpURI(s.config.MFAIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication once the user proves their app
+// produces valid codes. It returns the recovery codes, which are only shown
+// this once.
+func (s *AuthService) ConfirmMFA(ctx context.Context, userID, code string) ([]string, error) {
+	mfa, err := s.mfaRepo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrMFANotEnrolled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt != nil {
+		return nil, ErrMFAAlreadyEnabled
+	}
+
+	if err := s.checkTOTP(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	if err := s.mfaRepo.Enable(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(ctx, userID, EventMFAEnabled, nil)
+	return codes, nil
+}
+
+// DisableMFA turns two-factor authentication off. It requires a current code
+// or an unused recovery code.
+func (s *AuthService) DisableMFA(ctx context.Context, userID, code string) error {
+	mfa, err := s.enabledMFA(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkMFACode(ctx, mfa, code); err != nil {
+		return err
+	}
+
+	if err := s.mfaRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventMFADisabled, nil)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes with a fresh set.
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	mfa, err := s.enabledMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMFACode(ctx, mfa, code); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	s.recordEvent(ctx, userID, EventMFARecoveryCodesRegenerated, nil)
+	return codes, nil
+}
+
+// VerifyMFA completes a login started by Login using the challenge token from
+// MFARequiredError and a TOTP or recovery code.
+func (s *AuthService) VerifyMFA(ctx context.Context, challengeToken, code string) (*TokenPair, error) {
+	userID, err := s.parseMFAChallenge(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	// Six digit codes are guessable, so failures are throttled like passwords
+	keys := []throttleKey{s.accountThrottleKey("mfa", userID)}
+	if err := s.checkThrottle(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.enabledMFA(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkMFACode(ctx, mfa, code); err != nil {
+		if errors.Is(err, ErrInvalidMFACode) {
+			if err := s.recordFailure(ctx, keys, userID); err != nil {
+				return nil, err
+			}
+			s.recordLoginFailure(ctx, userID, "", "invalid_mfa_code")
+		}
+		return nil, err
+	}
+
+	if err := s.resetThrottle(ctx, keys); err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.generateTokenPair(ctx, user, newSession())
+	if err != nil {
+		return nil, err
+	}
+	s.recordEvent(ctx, user.ID, EventLoginSucceeded, map[string]string{"method": "mfa"})
+	return tokens, nil
+}
+
+// mfaRequired returns an MFARequiredError if userID has two-factor
+// authentication enabled, and nil otherwise.
+func (s *AuthService) mfaRequired(ctx context.Context, userID string) error {
+	mfa, err := s.mfaRepo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if mfa.EnabledAt == nil {
+		return nil
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Subject:   userID,
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		ID:        uuid.New().String(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.MFAChallengeTTL)),
+	})
+
+	challenge, err := token.SignedString([]byte(s.config.JWTSecretKey))
+	if err != nil {
+		return err
+	}
+
+	return &MFARequiredError{ChallengeToken: challenge}
+}
+
+func (s *AuthService) parseMFAChallenge(challengeToken string) (string, error) {
+	claims := &jwt.RegisteredClaims{}
+	_, err := jwt.ParseWithClaims(challengeToken, claims, func(token *jwt.Token) (interface{}, error) {
+		return []byte(s.config.JWTSecretKey), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithAudience(mfaAudience))
+	if err != nil || claims.Subject == "" {
+		return "", ErrInvalidMFAToken
+	}
+	return claims.Subject, nil
+}
+
+func (s *AuthService) enabledMFA(ctx context.Context, userID string) (*repository.MFASecret, error) {
+	mfa, err := s.mfaRepo.Get(ctx, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrMFANotEnabled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if mfa.EnabledAt == nil {
+		return nil, ErrMFANotEnabled
+	}
+	return mfa, nil
+}
+
+// checkMFACode accepts either a TOTP code or a recovery code.
+func (s *AuthService) checkMFACode(ctx context.Context, mfa *repository.MFASecret, code string) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totpDigits {
+		return s.checkTOTP(ctx, mfa, code)
+	}
+
+	err := s.mfaRepo.UseRecoveryCode(ctx, mfa.UserID, hashToken(normalizeRecoveryCode(code)))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidMFACode
+	}
+	if err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, mfa.UserID, EventMFARecoveryCodeUsed, nil)
+	return nil
+}
+
+// checkTOTP validates a TOTP code and burns its time step so that the same
+// code cannot be replayed.
+func (s *AuthService) checkTOTP(ctx context.Context, mfa *repository.MFASecret, code string) error {
+	step, ok := validateTOTP(mfa.Secret, strings.TrimSpace(code), time.Now())
+	if !ok || step <= mfa.LastUsedStep {
+		return ErrInvalidMFACode
+	}
+
+	err := s.mfaRepo.UseStep(ctx, mfa.UserID, step)
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrInvalidMFACode
+	}
+	return err
+}
+
+func (s *AuthService) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := generateRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		hashes[i] = hashToken(normalizeRecoveryCode(code))
+	}
+
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// generateRecoveryCode returns a code such as "k3v9q-x2mfa".
+func generateRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode lets users type codes without the dash or in any case.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// recordEvent stores a security event. Failures are not fatal to the action
+// being recorded.
+func (s *AuthService) recordEvent(ctx context.Context, userID, eventType string, details map[string]string) {
+	_ = s.eventRepo.Create(ctx, newSecurityEvent(ctx, userID, eventType, details))
+}
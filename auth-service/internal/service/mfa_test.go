@@ -0,0 +1,253 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type MockMFARepository struct {
+	mock.Mock
+}
+
+// newMockMFARepository returns a mock for users without two-factor
+// authentication unless the test sets up Get itself.
+func newMockMFARepository() *MockMFARepository {
+	m := new(MockMFARepository)
+	m.On("Get", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound).Maybe()
+	return m
+}
+
+func (m *MockMFARepository) Get(ctx context.Context, userID string) (*repository.MFASecret, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.MFASecret), args.Error(1)
+}
+
+func (m *MockMFARepository) Save(ctx context.Context, secret *repository.MFASecret) error {
+	args := m.Called(ctx, secret)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) Enable(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) Delete(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseStep(ctx context.Context, userID string, step int64) error {
+	args := m.Called(ctx, userID, step)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	args := m.Called(ctx, userID, codeHashes)
+	return args.Error(0)
+}
+
+func (m *MockMFARepository) UseRecoveryCode(ctx context.Context, userID, codeHash string) error {
+	args := m.Called(ctx, userID, codeHash)
+	return args.Error(0)
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B test vector for SHA1, truncated to six digits
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	code, err := totpCode(secret, totpStep(time.Unix(59, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "287082", code)
+
+	code, err = totpCode(secret, totpStep(time.Unix(1111111109, 0)))
+	assert.NoError(t, err)
+	assert.Equal(t, "081804", code)
+
+	now := time.Unix(1111111109, 0)
+	step, ok := validateTOTP(secret, "081804", now.Add(totpPeriod*time.Second))
+	assert.True(t, ok, "previous step is accepted for clock drift")
+	assert.Equal(t, totpStep(now), step)
+
+	_, ok = validateTOTP(secret, "081804", now.Add(3*totpPeriod*time.Second))
+	assert.False(t, ok)
+
+	uri := totpURI("Go Forum", "alice", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Go%20Forum:alice?"))
+	assert.Contains(t, uri, "secret="+secret)
+	assert.Contains(t, uri, "issuer=Go+Forum")
+}
+
+func newMFATestUser(t *testing.T) *repository.User {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	return &repository.User{
+		ID:           uuid.New().String(),
+		Username:     "testuser",
+		PasswordHash: string(hashedPassword),
+	}
+}
+
+func TestAuthService_MFA(t *testing.T) {
+	t.Run("enroll and confirm", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		mfaRepo := new(MockMFARepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), eventRepo, mfaRepo, repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		user := newMFATestUser(t)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		mfaRepo.On("Get", mock.Anything, user.ID).Return(nil, repository.ErrNotFound).Once()
+
+		var saved *repository.MFASecret
+		mfaRepo.On("Save", mock.Anything, mock.AnythingOfType("*repository.MFASecret")).
+			Run(func(args mock.Arguments) { saved = args.Get(1).(*repository.MFASecret) }).
+			Return(nil)
+
+		enrollment, err := service.EnrollMFA(context.Background(), user.ID)
+		assert.NoError(t, err)
+		assert.Equal(t, saved.Secret, enrollment.Secret)
+		assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+		code, _ := totpCode(enrollment.Secret, totpStep(time.Now()))
+		mfaRepo.On("Get", mock.Anything, user.ID).Return(saved, nil)
+		mfaRepo.On("UseStep", mock.Anything, user.ID, mock.AnythingOfType("int64")).Return(nil)
+		mfaRepo.On("Enable", mock.Anything, user.ID).Return(nil)
+		mfaRepo.On("ReplaceRecoveryCodes", mock.Anything, user.ID, mock.AnythingOfType("[]string")).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventMFAEnabled
+		})).Return(nil)
+
+		recoveryCodes, err := service.ConfirmMFA(context.Background(), user.ID, code)
+		assert.NoError(t, err)
+		assert.Len(t, recoveryCodes, recoveryCodeCount)
+
+		mfaRepo.AssertExpectations(t)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("confirm with wrong code", func(t *testing.T) {
+		mfaRepo := new(MockMFARepository)
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), mfaRepo, repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		secret, _ := generateTOTPSecret()
+		userID := uuid.New().String()
+		mfaRepo.On("Get", mock.Anything, userID).Return(&repository.MFASecret{UserID: userID, Secret: secret}, nil)
+
+		_, err := service.ConfirmMFA(context.Background(), userID, "000000")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+		mfaRepo.AssertNotCalled(t, "Enable", mock.Anything, mock.Anything)
+	})
+
+	t.Run("regenerate recovery codes", func(t *testing.T) {
+		mfaRepo := new(MockMFARepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), eventRepo, mfaRepo, repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		secret, _ := generateTOTPSecret()
+		enabledAt := time.Now()
+		userID := uuid.New().String()
+		mfaRepo.On("Get", mock.Anything, userID).Return(&repository.MFASecret{UserID: userID, Secret: secret, EnabledAt: &enabledAt}, nil)
+		mfaRepo.On("UseStep", mock.Anything, userID, mock.AnythingOfType("int64")).Return(nil)
+		mfaRepo.On("ReplaceRecoveryCodes", mock.Anything, userID, mock.AnythingOfType("[]string")).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.UserID == userID && e.Type == EventMFARecoveryCodesRegenerated
+		})).Return(nil)
+
+		code, _ := totpCode(secret, totpStep(time.Now()))
+		recoveryCodes, err := service.RegenerateRecoveryCodes(context.Background(), userID, code)
+		assert.NoError(t, err)
+		assert.Len(t, recoveryCodes, recoveryCodeCount)
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("login requires second factor", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		mfaRepo := new(MockMFARepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), mfaRepo, repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		user := newMFATestUser(t)
+		secret, _ := generateTOTPSecret()
+		enabledAt := time.Now()
+		mfa := &repository.MFASecret{UserID: user.ID, Secret: secret, EnabledAt: &enabledAt}
+
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		mfaRepo.On("Get", mock.Anything, user.ID).Return(mfa, nil)
+
+		tokens, err := service.Login(context.Background(), "testuser", "password123")
+		assert.Nil(t, tokens)
+		var mfaErr *MFARequiredError
+		if !assert.True(t, errors.As(err, &mfaErr)) {
+			return
+		}
+		tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+
+		// The challenge token is not an access token
+		_, err = service.ParseToken(context.Background(), mfaErr.ChallengeToken)
+		assert.Error(t, err)
+
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleModerator}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+		mfaRepo.On("UseStep", mock.Anything, user.ID, mock.AnythingOfType("int64")).Return(nil).Once()
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		code, _ := totpCode(secret, totpStep(time.Now()))
+		tokens, err = service.VerifyMFA(context.Background(), mfaErr.ChallengeToken, code)
+		assert.NoError(t, err)
+		assert.NotEmpty(t, tokens.AccessToken)
+
+		// The same code cannot be used twice
+		mfaRepo.On("UseStep", mock.Anything, user.ID, mock.AnythingOfType("int64")).Return(repository.ErrConflict)
+		_, err = service.VerifyMFA(context.Background(), mfaErr.ChallengeToken, code)
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	})
+
+	t.Run("recovery code", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		mfaRepo := new(MockMFARepository)
+		eventRepo := newMockSecurityEventRepository()
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, eventRepo, mfaRepo, repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		userID := uuid.New().String()
+		enabledAt := time.Now()
+		mfaRepo.On("Get", mock.Anything, userID).Return(&repository.MFASecret{UserID: userID, EnabledAt: &enabledAt}, nil)
+		mfaRepo.On("UseRecoveryCode", mock.Anything, userID, hashToken("abcdefghij")).Return(nil).Once()
+		mfaRepo.On("UseRecoveryCode", mock.Anything, userID, hashToken("abcdefghij")).Return(repository.ErrNotFound)
+		eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+		roleRepo.On("GetUserRoles", mock.Anything, userID).Return([]string{RoleUser}, nil)
+		userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID, Username: "testuser"}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		challenge := service.mfaRequired(context.Background(), userID).(*MFARequiredError).ChallengeToken
+
+		_, err := service.VerifyMFA(context.Background(), challenge, "ABCDE-FGHIJ")
+		assert.NoError(t, err)
+
+		_, err = service.VerifyMFA(context.Background(), challenge, "abcde-fghij")
+		assert.ErrorIs(t, err, ErrInvalidMFACode)
+	})
+
+	t.Run("invalid challenge token", func(t *testing.T) {
+		service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		_, err := service.VerifyMFA(context.Background(), "not-a-token", "123456")
+		assert.ErrorIs(t, err, ErrInvalidMFAToken)
+	})
+}
@@ -0,0 +1,686 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// OAuth2 grant types a client can be registered for.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+	GrantRefreshToken      = "refresh_token"
+)
+
+// OpenID Connect scopes. Clients may also be granted the personal access
+// token scopes, which limit what their access tokens can do in the forum.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+const (
+	EventOAuthClientCreated = "oauth_client_created"
+	EventOAuthClientDeleted = "oauth_client_deleted"
+)
+
+// Error codes from RFC 6749 section 4.1.2.1 and 5.2.
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnauthorizedClient      = "unauthorized_client"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthInvalidToken            = "invalid_token"
+	OAuthInsufficientScope       = "insufficient_scope"
+)
+
+// OAuthError is an error reported to OAuth clients in the format of RFC 6749.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+var (
+	// ErrInvalidRedirectURI is returned when an authorization request names
+	// an unknown client or a redirect URI that is not registered for it. The
+	// user must not be redirected in that case.
+	ErrInvalidRedirectURI = errors.New("unknown client or redirect_uri")
+	ErrInvalidClientName  = errors.New("client name is required and must be at most 100 characters")
+	ErrInvalidGrantTypes  = errors.New("invalid grant types")
+	ErrInvalidClientURIs  = errors.New("redirect URIs must be absolute URLs without a fragment")
+)
+
+// Length limits of a PKCE code_verifier from RFC 7636 section 4.1.
+const (
+	minPKCEVerifierLength = 43
+	maxPKCEVerifierLength = 128
+)
+
+// OAuthService lets other applications sign users in through the auth
+// service with OAuth2 and OpenID Connect. Tokens are issued through the same
+// token families as first-party logins, so OAuth sessions show up in and can
+// be revoked from the user's session list.
+type OAuthService struct {
+	auth       *AuthService
+	clientRepo repository.OAuthClientRepository
+	codeRepo   repository.AuthorizationCodeRepository
+	config     *config.Config
+}
+
+func NewOAuthService(auth *AuthService, clientRepo repository.OAuthClientRepository, codeRepo repository.AuthorizationCodeRepository, config *config.Config) *OAuthService {
+	return &OAuthService{
+		auth:       auth,
+		clientRepo: clientRepo,
+		codeRepo:   codeRepo,
+		config:     config,
+	}
+}
+
+// NewOAuthClient describes a client to register.
+type NewOAuthClient struct {
+	Name         string
+	RedirectURIs []string
+	GrantTypes   []string
+	Scopes       []string
+	// Public clients, such as single-page apps, get no secret and must use
+	// PKCE instead.
+	Public bool
+	// ServiceAccount registers a machine identity for another service. It
+	// must be confidential and use only the client credentials grant.
+	ServiceAccount bool
+}
+
+// AuthorizeRequest holds the parameters of an authorization request.
+type AuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// TokenRequest holds the parameters of a token request. ClientSecret is
+// empty for public clients.
+type TokenRequest struct {
+	GrantType    string
+	ClientID     string
+	ClientSecret string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	RefreshToken string
+	Scope        string
+}
+
+// OAuthTokens is a successful token response. RefreshToken and IDToken are
+// empty when they were not issued.
+type OAuthTokens struct {
+	AccessToken  string
+	RefreshToken string
+	IDToken      string
+	ExpiresIn    int
+	Scopes       []string
+}
+
+// IDTokenClaims is the payload of an OpenID Connect ID token.
+type IDTokenClaims struct {
+	Nonce             string           `json:"nonce,omitempty"`
+	AuthTime          *jwt.NumericDate `json:"auth_time,omitempty"`
+	PreferredUsername string           `json:"preferred_username,omitempty"`
+	Email             string           `json:"email,omitempty"`
+	EmailVerified     *bool            `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// UserInfo holds the standard claims released for the granted scopes.
+type UserInfo struct {
+	Subject           string `json:"sub"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+}
+
+// Discovery is the OpenID Provider metadata served at
+// /.well-known/openid-configuration.
+type Discovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserInfoEndpoint                  string   `json:"userinfo_endpoint"`
+	IntrospectionEndpoint             string   `json:"introspection_endpoint"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// OAuthScopes are the scopes a client can be registered for. Provisioning
+// is left to personal access tokens.
+var OAuthScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeChatRead, ScopeChatWrite, ScopePostsRead, ScopePostsWrite}
+
+var oauthGrantTypes = []string{GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken}
+
+func (s *OAuthService) Discovery() Discovery {
+	issuer := strings.TrimRight(s.config.OAuthIssuer, "/")
+	return Discovery{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserInfoEndpoint:                  issuer + "/oauth/userinfo",
+		IntrospectionEndpoint:             issuer + "/oauth/introspect",
+		RevocationEndpoint:                issuer + "/oauth/revoke",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   OAuthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               oauthGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  s.auth.keys.Methods(),
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "preferred_username", "email", "email_verified"},
+	}
+}
+
+// RegisterClient stores a new client. The secret of a confidential client is
+// returned only this once.
+func (s *OAuthService) RegisterClient(ctx context.Context, actorID string, req NewOAuthClient) (*repository.OAuthClient, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > 100 {
+		return nil, "", ErrInvalidClientName
+	}
+
+	grantTypes, err := normalizeList(req.GrantTypes, oauthGrantTypes, ErrInvalidGrantTypes)
+	if err != nil {
+		return nil, "", err
+	}
+	if req.Public && contains(grantTypes, GrantClientCredentials) {
+		return nil, "", ErrInvalidGrantTypes
+	}
+	if req.ServiceAccount && (req.Public || len(grantTypes) != 1 || grantTypes[0] != GrantClientCredentials) {
+		return nil, "", ErrInvalidGrantTypes
+	}
+
+	scopes, err := normalizeList(req.Scopes, OAuthScopes, ErrInvalidScope)
+	if err != nil {
+		return nil, "", err
+	}
+
+	for _, uri := range req.RedirectURIs {
+		u, err := url.Parse(uri)
+		if err != nil || !u.IsAbs() || u.Fragment != "" {
+			return nil, "", ErrInvalidClientURIs
+		}
+	}
+	if contains(grantTypes, GrantAuthorizationCode) && len(req.RedirectURIs) == 0 {
+		return nil, "", ErrInvalidClientURIs
+	}
+
+	client := &repository.OAuthClient{
+		ID:             uuid.New().String(),
+		Name:           name,
+		RedirectURIs:   req.RedirectURIs,
+		GrantTypes:     grantTypes,
+		Scopes:         scopes,
+		ServiceAccount: req.ServiceAccount,
+	}
+
+	var secret string
+	if !req.Public {
+		if secret, err = generateOpaqueToken(); err != nil {
+			return nil, "", err
+		}
+		secret = strings.TrimRight(secret, "=")
+		client.SecretHash = hashToken(secret)
+	}
+
+	if err := s.clientRepo.Create(ctx, client); err != nil {
+		return nil, "", err
+	}
+
+	s.auth.recordEvent(ctx, actorID, EventOAuthClientCreated, map[string]string{
+		"client_id":       client.ID,
+		"name":            client.Name,
+		"service_account": strconv.FormatBool(client.ServiceAccount),
+	})
+	return client, secret, nil
+}
+
+func (s *OAuthService) ListClients(ctx context.Context) ([]repository.OAuthClient, error) {
+	return s.clientRepo.List(ctx)
+}
+
+// DeleteClient removes a client together with its codes and refresh tokens.
+func (s *OAuthService) DeleteClient(ctx context.Context, actorID, clientID string) error {
+	if err := s.clientRepo.Delete(ctx, clientID); err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, actorID, EventOAuthClientDeleted, map[string]string{"client_id": clientID})
+	return nil
+}
+
+// CheckAuthorizeRequest validates an authorization request before the user
+// is asked to log in. ErrInvalidRedirectURI means the request must be
+// rejected without redirecting; an *OAuthError should be sent back to the
+// client's redirect URI.
+func (s *OAuthService) CheckAuthorizeRequest(ctx context.Context, req AuthorizeRequest) error {
+	_, _, err := s.checkAuthorizeRequest(ctx, req)
+	return err
+}
+
+// LoginURL returns the login page that completes the authorization request
+// with the given query.
+func (s *OAuthService) LoginURL(query url.Values) string {
+	return RedirectURI(s.config.OAuthLoginURL, "", query)
+}
+
+// Authorize issues an authorization code for userID, who has logged in and
+// approved req, and returns the URI to redirect the user to.
+func (s *OAuthService) Authorize(ctx context.Context, userID string, req AuthorizeRequest) (string, error) {
+	client, scopes, err := s.checkAuthorizeRequest(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	code = strings.TrimRight(code, "=")
+
+	err = s.codeRepo.Create(ctx, &repository.AuthorizationCode{
+		CodeHash:      hashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		ExpiresAt:     time.Now().Add(s.config.OAuthCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return RedirectURI(req.RedirectURI, req.State, url.Values{"code": {code}}), nil
+}
+
+// ErrorRedirectURI returns the URI that reports err to the client.
+func ErrorRedirectURI(req AuthorizeRequest, err *OAuthError) string {
+	return RedirectURI(req.RedirectURI, req.State, url.Values{
+		"error":             {err.Code},
+		"error_description": {err.Description},
+	})
+}
+
+// RedirectURI adds params and state to the query of a client's redirect URI.
+func RedirectURI(redirectURI, state string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if state != "" {
+		query.Set("state", state)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+func (s *OAuthService) checkAuthorizeRequest(ctx context.Context, req AuthorizeRequest) (*repository.OAuthClient, []string, error) {
+	client, err := s.clientRepo.Get(ctx, req.ClientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil, ErrInvalidRedirectURI
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !contains(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, ErrInvalidRedirectURI
+	}
+
+	if req.ResponseType != "code" {
+		return nil, nil, oauthError(OAuthUnsupportedResponseType, "only the code response type is supported")
+	}
+	if !contains(client.GrantTypes, GrantAuthorizationCode) {
+		return nil, nil, oauthError(OAuthUnauthorizedClient, "client may not use the authorization code grant")
+	}
+
+	scopes, err := grantScopes(client, req.Scope)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if req.CodeChallenge == "" {
+		if client.SecretHash == "" {
+			return nil, nil, oauthError(OAuthInvalidRequest, "public clients must use PKCE")
+		}
+	} else if req.CodeChallengeMethod != "S256" {
+		return nil, nil, oauthError(OAuthInvalidRequest, "code_challenge_method must be S256")
+	}
+
+	return client, scopes, nil
+}
+
+// Token handles a request to the token endpoint.
+func (s *OAuthService) Token(ctx context.Context, req TokenRequest) (*OAuthTokens, error) {
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode, GrantClientCredentials, GrantRefreshToken:
+	default:
+		return nil, oauthError(OAuthUnsupportedGrantType, "unsupported grant_type")
+	}
+	if !contains(client.GrantTypes, req.GrantType) {
+		return nil, oauthError(OAuthUnauthorizedClient, "client may not use the "+req.GrantType+" grant")
+	}
+
+	switch req.GrantType {
+	case GrantAuthorizationCode:
+		return s.exchangeCode(ctx, client, req)
+	case GrantClientCredentials:
+		return s.clientCredentials(client, req.Scope)
+	default:
+		return s.refresh(ctx, client, req.RefreshToken)
+	}
+}
+
+// authenticateClient checks the client's secret. Public clients have none
+// and authenticate with their ID alone.
+func (s *OAuthService) authenticateClient(ctx context.Context, clientID, secret string) (*repository.OAuthClient, error) {
+	client, err := s.clientRepo.Get(ctx, clientID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if client.SecretHash != "" && subtle.ConstantTimeCompare([]byte(hashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError(OAuthInvalidClient, "client authentication failed")
+	}
+	return client, nil
+}
+
+func (s *OAuthService) exchangeCode(ctx context.Context, client *repository.OAuthClient, req TokenRequest) (*OAuthTokens, error) {
+	code, err := s.codeRepo.Consume(ctx, hashToken(req.Code))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, oauthError(OAuthInvalidGrant, "invalid or expired authorization code")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if code.ClientID != client.ID || code.RedirectURI != req.RedirectURI {
+		return nil, oauthError(OAuthInvalidGrant, "authorization code was issued to another client or redirect_uri")
+	}
+	if code.CodeChallenge != "" && !verifyPKCE(code.CodeChallenge, req.CodeVerifier) {
+		return nil, oauthError(OAuthInvalidGrant, "code_verifier does not match the code_challenge")
+	}
+
+	user, err := s.auth.userRepo.GetByID(ctx, code.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	sess := newSession()
+	sess.clientID = client.ID
+	sess.scopes = code.Scopes
+	pair, err := s.auth.generateTokenPair(ctx, user, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := s.oauthTokens(client, pair)
+	if contains(code.Scopes, ScopeOpenID) {
+		info := userInfo(user, code.Scopes)
+		tokens.IDToken, err = s.auth.keys.Sign(IDTokenClaims{
+			Nonce:             code.Nonce,
+			AuthTime:          jwt.NewNumericDate(code.CreatedAt),
+			PreferredUsername: info.PreferredUsername,
+			Email:             info.Email,
+			EmailVerified:     info.EmailVerified,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    strings.TrimRight(s.config.OAuthIssuer, "/"),
+				Subject:   user.ID,
+				Audience:  jwt.ClaimStrings{client.ID},
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.AccessTokenTTL)),
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return tokens, nil
+}
+
+// clientCredentials issues an access token to the client itself. It has no
+// user, so the client is its subject, the OpenID Connect scopes are left out
+// and no refresh token is issued. Tokens of service accounts also carry the
+// client name and may write, within their scopes, so that the forum accepts
+// them as the acting identity of internal calls.
+func (s *OAuthService) clientCredentials(client *repository.OAuthClient, scope string) (*OAuthTokens, error) {
+	requested, err := grantScopes(client, scope)
+	if err != nil {
+		return nil, err
+	}
+	var scopes []string
+	for _, granted := range requested {
+		if granted != ScopeOpenID && granted != ScopeProfile && granted != ScopeEmail {
+			scopes = append(scopes, granted)
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, oauthError(OAuthInvalidScope, "no scope can be granted without a user")
+	}
+
+	claims := Claims{
+		Scopes:   scopes,
+		ClientID: client.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    strings.TrimRight(s.config.OAuthIssuer, "/"),
+			Subject:   client.ID,
+			ID:        uuid.New().String(),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(s.config.AccessTokenTTL)),
+		},
+	}
+	if client.ServiceAccount {
+		claims.ServiceAccount = true
+		claims.Username = client.Name
+		claims.CanWrite = true
+	}
+
+	accessToken, err := s.auth.keys.Sign(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		ExpiresIn:   int(s.config.AccessTokenTTL.Seconds()),
+		Scopes:      scopes,
+	}, nil
+}
+
+func (s *OAuthService) refresh(ctx context.Context, client *repository.OAuthClient, refreshToken string) (*OAuthTokens, error) {
+	pair, err := s.auth.refreshTokens(ctx, refreshToken, client.ID)
+	if errors.Is(err, ErrRefreshTokenReuse) || errors.Is(err, ErrInvalidRefreshToken) || errors.Is(err, ErrRefreshTokenExpired) {
+		return nil, oauthError(OAuthInvalidGrant, err.Error())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.oauthTokens(client, pair), nil
+}
+
+func (s *OAuthService) oauthTokens(client *repository.OAuthClient, pair *TokenPair) *OAuthTokens {
+	tokens := &OAuthTokens{
+		AccessToken: pair.AccessToken,
+		ExpiresIn:   int(s.config.AccessTokenTTL.Seconds()),
+		Scopes:      pair.Scopes,
+	}
+	if contains(client.GrantTypes, GrantRefreshToken) {
+		tokens.RefreshToken = pair.RefreshToken
+	}
+	return tokens
+}
+
+// Introspect describes token to a confidential client, such as a resource
+// server that cannot verify tokens itself (RFC 7662).
+func (s *OAuthService) Introspect(ctx context.Context, clientID, secret, token string) (*Introspection, error) {
+	client, err := s.authenticateClient(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+	if client.SecretHash == "" {
+		return nil, oauthError(OAuthInvalidClient, "public clients cannot introspect tokens")
+	}
+	return s.auth.Introspect(ctx, token), nil
+}
+
+// Revoke revokes a token issued to the client (RFC 7009). Without a client
+// ID only tokens from first-party logins can be revoked, by whoever holds
+// them.
+func (s *OAuthService) Revoke(ctx context.Context, clientID, secret, token string) error {
+	if clientID != "" {
+		client, err := s.authenticateClient(ctx, clientID, secret)
+		if err != nil {
+			return err
+		}
+		clientID = client.ID
+	}
+
+	err := s.auth.RevokeToken(ctx, token, clientID)
+	if errors.Is(err, ErrTokenNotOwned) {
+		return oauthError(OAuthUnauthorizedClient, err.Error())
+	}
+	return err
+}
+
+// UserInfo returns the claims about the user that the access token's scopes
+// release. The token must have been granted the openid scope.
+func (s *OAuthService) UserInfo(ctx context.Context, accessToken string) (*UserInfo, error) {
+	claims, err := s.auth.ParseToken(ctx, accessToken)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidToken, "invalid access token")
+	}
+	if claims.ClientID == "" || !claims.HasScope(ScopeOpenID) {
+		return nil, oauthError(OAuthInsufficientScope, "the openid scope is required")
+	}
+
+	user, err := s.auth.userRepo.GetByID(ctx, claims.UserID)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidToken, "user not found")
+	}
+
+	info := userInfo(user, claims.Scopes)
+	return &info, nil
+}
+
+func userInfo(user *repository.User, scopes []string) UserInfo {
+	info := UserInfo{Subject: user.ID}
+	if contains(scopes, ScopeProfile) {
+		info.PreferredUsername = user.Username
+	}
+	if contains(scopes, ScopeEmail) {
+		verified := user.EmailVerifiedAt != nil
+		info.Email = user.Email
+		info.EmailVerified = &verified
+	}
+	return info
+}
+
+// grantScopes parses a space-separated scope parameter. An empty parameter
+// requests every scope the client is registered for.
+func grantScopes(client *repository.OAuthClient, scope string) ([]string, error) {
+	requested := strings.Fields(scope)
+	if len(requested) == 0 {
+		return client.Scopes, nil
+	}
+
+	scopes, err := normalizeList(requested, client.Scopes, ErrInvalidScope)
+	if err != nil {
+		return nil, oauthError(OAuthInvalidScope, "scope is not allowed for this client")
+	}
+	return scopes, nil
+}
+
+// verifyPKCE checks a code_verifier against an S256 code_challenge.
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < minPKCEVerifierLength || len(verifier) > maxPKCEVerifierLength {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// normalizeList checks that every item is allowed and removes duplicates,
+// returning errInvalid for unknown items or an empty list.
+func normalizeList(items, allowed []string, errInvalid error) ([]string, error) {
+	if len(items) == 0 {
+		return nil, errInvalid
+	}
+
+	var normalized []string
+	for _, item := range items {
+		if !contains(allowed, item) {
+			return nil, errInvalid
+		}
+		if !contains(normalized, item) {
+			normalized = append(normalized, item)
+		}
+	}
+	return normalized, nil
+}
+
+func contains(list []string, item string) bool {
+	for _, s := range list {
+		if s == item {
+			return true
+		}
+	}
+	return false
+}
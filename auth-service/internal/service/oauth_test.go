@@ -0,0 +1,595 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/config"
+	"auth-service/internal/repository"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockOAuthClientRepository struct {
+	mock.Mock
+}
+
+func (m *MockOAuthClientRepository) Create(ctx context.Context, client *repository.OAuthClient) error {
+	args := m.Called(ctx, client)
+	return args.Error(0)
+}
+
+func (m *MockOAuthClientRepository) Get(ctx context.Context, id string) (*repository.OAuthClient, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthClientRepository) List(ctx context.Context) ([]repository.OAuthClient, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repository.OAuthClient), args.Error(1)
+}
+
+func (m *MockOAuthClientRepository) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+type MockAuthorizationCodeRepository struct {
+	mock.Mock
+}
+
+func (m *MockAuthorizationCodeRepository) Create(ctx context.Context, code *repository.AuthorizationCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockAuthorizationCodeRepository) Consume(ctx context.Context, codeHash string) (*repository.AuthorizationCode, error) {
+	args := m.Called(ctx, codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.AuthorizationCode), args.Error(1)
+}
+
+func newTestOAuthConfig() *config.Config {
+	cfg := newTestConfig()
+	cfg.OAuthIssuer = "https://auth.example.com/"
+	cfg.OAuthLoginURL = "https://forum.example.com/login"
+	cfg.OAuthCodeTTL = time.Minute
+	return cfg
+}
+
+// oauthTest wires an OAuthService to fresh mocks.
+type oauthTest struct {
+	service    *OAuthService
+	auth       *AuthService
+	userRepo   *MockUserRepository
+	tokenRepo  *MockTokenRepository
+	roleRepo   *MockRoleRepository
+	clientRepo *MockOAuthClientRepository
+	codeRepo   *MockAuthorizationCodeRepository
+}
+
+func newOAuthTest() *oauthTest {
+	cfg := newTestOAuthConfig()
+	t := &oauthTest{
+		userRepo:   new(MockUserRepository),
+		tokenRepo:  new(MockTokenRepository),
+		roleRepo:   new(MockRoleRepository),
+		clientRepo: new(MockOAuthClientRepository),
+		codeRepo:   new(MockAuthorizationCodeRepository),
+	}
+	eventRepo := newMockSecurityEventRepository()
+	eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	t.auth = NewAuthService(t.userRepo, t.tokenRepo, t.roleRepo, eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), t.clientRepo, testKeys, testPasswords, cfg)
+	t.service = NewOAuthService(t.auth, t.clientRepo, t.codeRepo, cfg)
+	return t
+}
+
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func TestOAuthService_AuthorizationCode(t *testing.T) {
+	verifiedAt := time.Now()
+	user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com", EmailVerifiedAt: &verifiedAt}
+	client := &repository.OAuthClient{
+		ID:           "wiki",
+		Name:         "Wiki",
+		RedirectURIs: []string{"https://wiki.example.com/callback"},
+		GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken},
+		Scopes:       []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopePostsRead},
+	}
+	verifier := strings.Repeat("v", 50)
+	authorize := AuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            client.ID,
+		RedirectURI:         "https://wiki.example.com/callback",
+		Scope:               "openid email",
+		State:               "xyz",
+		Nonce:               "n-0S6",
+		CodeChallenge:       pkceChallenge(verifier),
+		CodeChallengeMethod: "S256",
+	}
+
+	t.Run("code with PKCE is exchanged for tokens", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+
+		var stored *repository.AuthorizationCode
+		o.codeRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.AuthorizationCode")).
+			Run(func(args mock.Arguments) {
+				stored = args.Get(1).(*repository.AuthorizationCode)
+				stored.CreatedAt = time.Now()
+			}).
+			Return(nil)
+
+		redirect, err := o.service.Authorize(context.Background(), user.ID, authorize)
+		require.NoError(t, err)
+		u, err := url.Parse(redirect)
+		require.NoError(t, err)
+		assert.Equal(t, "wiki.example.com", u.Host)
+		assert.Equal(t, "xyz", u.Query().Get("state"))
+		code := u.Query().Get("code")
+		assert.Equal(t, hashToken(code), stored.CodeHash)
+		assert.Equal(t, []string{ScopeOpenID, ScopeEmail}, stored.Scopes)
+
+		o.codeRepo.On("Consume", mock.Anything, hashToken(code)).Return(stored, nil)
+		o.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		o.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		o.tokenRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *repository.RefreshToken) bool {
+			return token.ClientID == client.ID && len(token.Scopes) == 2
+		})).Return(nil)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantAuthorizationCode,
+			ClientID:     client.ID,
+			Code:         code,
+			RedirectURI:  authorize.RedirectURI,
+			CodeVerifier: verifier,
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, tokens.RefreshToken)
+		assert.Equal(t, []string{ScopeOpenID, ScopeEmail}, tokens.Scopes)
+
+		claims, err := o.auth.ParseToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, claims.ClientID)
+		assert.False(t, claims.HasScope(ScopePostsRead))
+
+		idClaims := &IDTokenClaims{}
+		_, err = jwt.ParseWithClaims(tokens.IDToken, idClaims, testKeys.Keyfunc, jwt.WithAudience(client.ID), jwt.WithIssuer("https://auth.example.com"))
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, idClaims.Subject)
+		assert.Equal(t, "n-0S6", idClaims.Nonce)
+		assert.Equal(t, "alice@example.com", idClaims.Email)
+		assert.True(t, *idClaims.EmailVerified)
+		assert.Empty(t, idClaims.PreferredUsername, "profile scope was not granted")
+
+		// ID tokens carry no user_id and cannot be used as access tokens
+		_, err = o.auth.ParseToken(context.Background(), tokens.IDToken)
+		assert.Error(t, err)
+
+		info, err := o.service.UserInfo(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, info.Subject)
+		assert.Equal(t, "alice@example.com", info.Email)
+	})
+
+	t.Run("wrong code verifier is rejected", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+		o.codeRepo.On("Consume", mock.Anything, hashToken("code")).Return(&repository.AuthorizationCode{
+			ClientID:      client.ID,
+			UserID:        user.ID,
+			RedirectURI:   authorize.RedirectURI,
+			Scopes:        []string{ScopeOpenID},
+			CodeChallenge: pkceChallenge(verifier),
+		}, nil)
+
+		_, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantAuthorizationCode,
+			ClientID:     client.ID,
+			Code:         "code",
+			RedirectURI:  authorize.RedirectURI,
+			CodeVerifier: strings.Repeat("w", 50),
+		})
+		var oauthErr *OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+		o.tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("used or unknown code is rejected", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+		o.codeRepo.On("Consume", mock.Anything, hashToken("used")).Return(nil, repository.ErrNotFound)
+
+		_, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:   GrantAuthorizationCode,
+			ClientID:    client.ID,
+			Code:        "used",
+			RedirectURI: authorize.RedirectURI,
+		})
+		var oauthErr *OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	})
+
+	t.Run("invalid authorization requests", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+		o.clientRepo.On("Get", mock.Anything, "unknown").Return(nil, repository.ErrNotFound)
+
+		req := authorize
+		req.RedirectURI = "https://evil.example.com/callback"
+		assert.ErrorIs(t, o.service.CheckAuthorizeRequest(context.Background(), req), ErrInvalidRedirectURI)
+
+		req = authorize
+		req.ClientID = "unknown"
+		assert.ErrorIs(t, o.service.CheckAuthorizeRequest(context.Background(), req), ErrInvalidRedirectURI)
+
+		cases := map[string]func(*AuthorizeRequest){
+			OAuthUnsupportedResponseType: func(r *AuthorizeRequest) { r.ResponseType = "token" },
+			OAuthInvalidScope:            func(r *AuthorizeRequest) { r.Scope = "openid chat:write" },
+			OAuthInvalidRequest:          func(r *AuthorizeRequest) { r.CodeChallenge = "" },
+		}
+		for code, change := range cases {
+			req := authorize
+			change(&req)
+			var oauthErr *OAuthError
+			if assert.ErrorAs(t, o.service.CheckAuthorizeRequest(context.Background(), req), &oauthErr) {
+				assert.Equal(t, code, oauthErr.Code)
+			}
+		}
+
+		req = authorize
+		req.CodeChallengeMethod = "plain"
+		var oauthErr *OAuthError
+		require.ErrorAs(t, o.service.CheckAuthorizeRequest(context.Background(), req), &oauthErr)
+		assert.Equal(t, OAuthInvalidRequest, oauthErr.Code)
+
+		redirect := ErrorRedirectURI(req, oauthErr)
+		u, err := url.Parse(redirect)
+		require.NoError(t, err)
+		assert.Equal(t, OAuthInvalidRequest, u.Query().Get("error"))
+		assert.Equal(t, "xyz", u.Query().Get("state"))
+
+		o.codeRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestOAuthService_ClientCredentials(t *testing.T) {
+	secret := "s3cret"
+	client := &repository.OAuthClient{
+		ID:         "ci-bot",
+		SecretHash: hashToken(secret),
+		GrantTypes: []string{GrantClientCredentials},
+		Scopes:     []string{ScopeOpenID, ScopePostsRead},
+	}
+
+	t.Run("issues a token for the client", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantClientCredentials,
+			ClientID:     client.ID,
+			ClientSecret: secret,
+		})
+		require.NoError(t, err)
+		assert.Empty(t, tokens.RefreshToken)
+		assert.Empty(t, tokens.IDToken)
+		assert.Equal(t, []string{ScopePostsRead}, tokens.Scopes)
+
+		claims := &Claims{}
+		_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, testKeys.Keyfunc)
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, claims.Subject)
+		assert.Equal(t, client.ID, claims.ClientID)
+		assert.Empty(t, claims.UserID)
+		assert.False(t, claims.ServiceAccount)
+		assert.False(t, claims.CanWrite)
+		o.tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("service account tokens name the account", func(t *testing.T) {
+		o := newOAuthTest()
+		account := &repository.OAuthClient{
+			ID:             uuid.New().String(),
+			SecretHash:     hashToken(secret),
+			Name:           "importer",
+			GrantTypes:     []string{GrantClientCredentials},
+			Scopes:         []string{ScopePostsRead, ScopePostsWrite},
+			ServiceAccount: true,
+		}
+		o.clientRepo.On("Get", mock.Anything, account.ID).Return(account, nil)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantClientCredentials,
+			ClientID:     account.ID,
+			ClientSecret: secret,
+			Scope:        ScopePostsWrite,
+		})
+		require.NoError(t, err)
+
+		claims := &Claims{}
+		_, err = jwt.ParseWithClaims(tokens.AccessToken, claims, testKeys.Keyfunc)
+		require.NoError(t, err)
+		assert.True(t, claims.ServiceAccount)
+		assert.Equal(t, account.ID, claims.Subject)
+		assert.Equal(t, "importer", claims.Username)
+		assert.True(t, claims.CanWrite)
+		assert.Empty(t, claims.UserID)
+		assert.Equal(t, []string{ScopePostsWrite}, claims.Scopes)
+	})
+
+	t.Run("client tokens identify the client and not a user", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantClientCredentials,
+			ClientID:     client.ID,
+			ClientSecret: secret,
+		})
+		require.NoError(t, err)
+
+		claims, err := o.auth.ParseClientToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, claims.ClientID)
+		_, err = o.auth.ParseToken(context.Background(), tokens.AccessToken)
+		assert.Error(t, err)
+
+		userToken, err := testKeys.Sign(Claims{
+			UserID:           uuid.New().String(),
+			RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))},
+		})
+		require.NoError(t, err)
+		_, err = o.auth.ParseClientToken(context.Background(), userToken)
+		assert.Error(t, err)
+	})
+
+	t.Run("tokens of deleted clients are rejected", func(t *testing.T) {
+		o := newOAuthTest()
+		account := &repository.OAuthClient{
+			ID:             uuid.New().String(),
+			SecretHash:     hashToken(secret),
+			Name:           "importer",
+			GrantTypes:     []string{GrantClientCredentials},
+			Scopes:         []string{ScopePostsWrite},
+			ServiceAccount: true,
+		}
+		o.clientRepo.On("Get", mock.Anything, account.ID).Return(account, nil).Times(4)
+		o.clientRepo.On("Get", mock.Anything, account.ID).Return(nil, repository.ErrNotFound)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantClientCredentials,
+			ClientID:     account.ID,
+			ClientSecret: secret,
+		})
+		require.NoError(t, err)
+
+		claims, user, err := o.auth.ValidateToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.Nil(t, user)
+		assert.True(t, claims.ServiceAccount)
+		_, err = o.auth.ParseClientToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, o.auth.Introspect(context.Background(), tokens.AccessToken).Active)
+
+		// The client is deleted
+		_, _, err = o.auth.ValidateToken(context.Background(), tokens.AccessToken)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+		_, err = o.auth.ParseClientToken(context.Background(), tokens.AccessToken)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+		assert.False(t, o.auth.Introspect(context.Background(), tokens.AccessToken).Active)
+	})
+
+	t.Run("wrong secret and disallowed grants are rejected", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+
+		var oauthErr *OAuthError
+		_, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantClientCredentials,
+			ClientID:     client.ID,
+			ClientSecret: "wrong",
+		})
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+
+		_, err = o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantRefreshToken,
+			ClientID:     client.ID,
+			ClientSecret: secret,
+			RefreshToken: "token",
+		})
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthUnauthorizedClient, oauthErr.Code)
+
+		_, err = o.service.Token(context.Background(), TokenRequest{
+			GrantType:    "password",
+			ClientID:     client.ID,
+			ClientSecret: secret,
+		})
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthUnsupportedGrantType, oauthErr.Code)
+	})
+}
+
+func TestOAuthService_RefreshToken(t *testing.T) {
+	client := &repository.OAuthClient{
+		ID:         "wiki",
+		GrantTypes: []string{GrantAuthorizationCode, GrantRefreshToken},
+		Scopes:     []string{ScopeOpenID},
+	}
+	user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+	stored := &repository.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Token:     "client-token",
+		FamilyID:  uuid.New().String(),
+		ExpiresAt: time.Now().Add(time.Hour),
+		ClientID:  client.ID,
+		Scopes:    []string{ScopeOpenID},
+	}
+
+	t.Run("client refreshes its own token", func(t *testing.T) {
+		o := newOAuthTest()
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+		o.tokenRepo.On("Get", mock.Anything, "client-token").Return(stored, nil)
+		o.tokenRepo.On("MarkRotated", mock.Anything, stored.ID).Return(nil)
+		o.tokenRepo.On("Create", mock.Anything, mock.MatchedBy(func(token *repository.RefreshToken) bool {
+			return token.FamilyID == stored.FamilyID && token.ClientID == client.ID
+		})).Return(nil)
+		o.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		o.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		tokens, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantRefreshToken,
+			ClientID:     client.ID,
+			RefreshToken: "client-token",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{ScopeOpenID}, tokens.Scopes)
+		o.tokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("client tokens cannot be refreshed as first-party sessions", func(t *testing.T) {
+		o := newOAuthTest()
+		o.tokenRepo.On("Get", mock.Anything, "client-token").Return(stored, nil)
+
+		_, err := o.auth.RefreshTokens(context.Background(), "client-token")
+		assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+		o.tokenRepo.AssertNotCalled(t, "MarkRotated", mock.Anything, mock.Anything)
+	})
+
+	t.Run("first-party tokens cannot be refreshed by a client", func(t *testing.T) {
+		o := newOAuthTest()
+		firstParty := *stored
+		firstParty.ClientID = ""
+		o.clientRepo.On("Get", mock.Anything, client.ID).Return(client, nil)
+		o.tokenRepo.On("Get", mock.Anything, "client-token").Return(&firstParty, nil)
+
+		_, err := o.service.Token(context.Background(), TokenRequest{
+			GrantType:    GrantRefreshToken,
+			ClientID:     client.ID,
+			RefreshToken: "client-token",
+		})
+		var oauthErr *OAuthError
+		require.ErrorAs(t, err, &oauthErr)
+		assert.Equal(t, OAuthInvalidGrant, oauthErr.Code)
+	})
+}
+
+func TestOAuthService_UserInfoRequiresOpenID(t *testing.T) {
+	o := newOAuthTest()
+	user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+	o.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+	o.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+	o.tokenRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.RefreshToken")).Return(nil)
+
+	sess := newSession()
+	sess.clientID = "wiki"
+	sess.scopes = []string{ScopePostsRead}
+	pair, err := o.auth.generateTokenPair(context.Background(), user, sess)
+	require.NoError(t, err)
+
+	_, err = o.service.UserInfo(context.Background(), pair.AccessToken)
+	var oauthErr *OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInsufficientScope, oauthErr.Code)
+
+	_, err = o.service.UserInfo(context.Background(), "not-a-token")
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidToken, oauthErr.Code)
+}
+
+func TestOAuthService_RegisterClient(t *testing.T) {
+	t.Run("confidential client gets a hashed secret", func(t *testing.T) {
+		o := newOAuthTest()
+		var stored *repository.OAuthClient
+		o.clientRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OAuthClient")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*repository.OAuthClient) }).
+			Return(nil)
+
+		client, secret, err := o.service.RegisterClient(context.Background(), "", NewOAuthClient{
+			Name:         " Wiki ",
+			RedirectURIs: []string{"https://wiki.example.com/callback"},
+			GrantTypes:   []string{GrantAuthorizationCode, GrantRefreshToken, GrantRefreshToken},
+			Scopes:       []string{ScopeOpenID, ScopeProfile},
+		})
+		require.NoError(t, err)
+		assert.NotEmpty(t, secret)
+		assert.Equal(t, "Wiki", client.Name)
+		assert.Equal(t, hashToken(secret), stored.SecretHash)
+		assert.Equal(t, []string{GrantAuthorizationCode, GrantRefreshToken}, stored.GrantTypes)
+	})
+
+	t.Run("invalid settings are rejected", func(t *testing.T) {
+		o := newOAuthTest()
+		valid := NewOAuthClient{
+			Name:         "Wiki",
+			RedirectURIs: []string{"https://wiki.example.com/callback"},
+			GrantTypes:   []string{GrantAuthorizationCode},
+			Scopes:       []string{ScopeOpenID},
+		}
+
+		req := valid
+		req.Scopes = []string{"admin"}
+		_, _, err := o.service.RegisterClient(context.Background(), "", req)
+		assert.ErrorIs(t, err, ErrInvalidScope)
+
+		req = valid
+		req.GrantTypes = []string{"implicit"}
+		_, _, err = o.service.RegisterClient(context.Background(), "", req)
+		assert.ErrorIs(t, err, ErrInvalidGrantTypes)
+
+		req = valid
+		req.RedirectURIs = []string{"/callback"}
+		_, _, err = o.service.RegisterClient(context.Background(), "", req)
+		assert.ErrorIs(t, err, ErrInvalidClientURIs)
+
+		req = valid
+		req.Public = true
+		req.GrantTypes = []string{GrantClientCredentials}
+		_, _, err = o.service.RegisterClient(context.Background(), "", req)
+		assert.ErrorIs(t, err, ErrInvalidGrantTypes)
+
+		// Service accounts only get tokens for themselves
+		req = valid
+		req.ServiceAccount = true
+		req.GrantTypes = []string{GrantClientCredentials, GrantAuthorizationCode}
+		_, _, err = o.service.RegisterClient(context.Background(), "", req)
+		assert.ErrorIs(t, err, ErrInvalidGrantTypes)
+
+		o.clientRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+}
+
+func TestOAuthService_Discovery(t *testing.T) {
+	o := newOAuthTest()
+	discovery := o.service.Discovery()
+	assert.Equal(t, "https://auth.example.com", discovery.Issuer)
+	assert.Equal(t, "https://auth.example.com/oauth/token", discovery.TokenEndpoint)
+	assert.Equal(t, "https://auth.example.com/.well-known/jwks.json", discovery.JWKSURI)
+	assert.Equal(t, []string{"S256"}, discovery.CodeChallengeMethodsSupported)
+	assert.Contains(t, discovery.IDTokenSigningAlgValuesSupported, "EdDSA")
+
+	login := o.service.LoginURL(url.Values{"client_id": {"wiki"}})
+	assert.Equal(t, "https://forum.example.com/login?client_id=wiki", login)
+}
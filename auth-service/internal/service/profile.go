@@ -0,0 +1,337 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"auth-service/internal/mailer"
+	"auth-service/internal/repository"
+)
+
+const (
+	EventProfileUpdated   = "profile_updated"
+	EventPasswordChanged  = "password_changed"
+	EventUsernameChanged  = "username_changed"
+	EventEmailChanged     = "email_changed"
+	EventEmailChangeAsked = "email_change_requested"
+)
+
+const (
+	maxDisplayNameLength = 100
+	maxBioLength         = 1000
+	maxAvatarURLLength   = 2048
+	minUsernameLength    = 3
+	maxUsernameLength    = 30
+	// defaultFeedPageSize and maxFeedPageSize bound one page of the rename
+	// and deletion feeds.
+	defaultFeedPageSize = 100
+	maxFeedPageSize     = 1000
+)
+
+var (
+	ErrInvalidDisplayName = errors.New("display name must be at most 100 characters without control characters")
+	ErrInvalidBio         = errors.New("bio must be at most 1000 characters")
+	ErrInvalidAvatarURL   = errors.New("avatar URL must be an absolute http or https URL")
+	ErrWrongPassword      = errors.New("current password is incorrect")
+	ErrInvalidUsername    = errors.New("username must be 3 to 30 letters, digits, underscores or hyphens")
+	ErrUsernameTaken      = errors.New("username already taken")
+	ErrEmailTaken         = errors.New("email already registered")
+	ErrEmailUnchanged     = errors.New("this is already your email address")
+	ErrInvalidEmailChange = errors.New("invalid or expired email change token")
+)
+
+// ProfileUpdate holds the profile fields to change. Nil fields are left as
+// they are; an empty string clears the field.
+type ProfileUpdate struct {
+	DisplayName *string
+	Bio         *string
+	AvatarURL   *string
+}
+
+// ProfileService lets users manage their own account: profile fields,
+// password, username and email address.
+type ProfileService struct {
+	auth            *AuthService
+	account         *AccountService
+	emailChangeRepo repository.OneTimeTokenRepository
+	identityRepo    repository.ExternalIdentityRepository
+}
+
+func NewProfileService(auth *AuthService, account *AccountService, emailChangeRepo repository.OneTimeTokenRepository, identityRepo repository.ExternalIdentityRepository) *ProfileService {
+	return &ProfileService{
+		auth:            auth,
+		account:         account,
+		emailChangeRepo: emailChangeRepo,
+		identityRepo:    identityRepo,
+	}
+}
+
+func (s *ProfileService) GetProfile(ctx context.Context, userID string) (*repository.User, error) {
+	return s.auth.findUser(ctx, userID)
+}
+
+// UpdateProfile changes the display name, bio and avatar URL and returns the
+// updated user.
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID string, update ProfileUpdate) (*repository.User, error) {
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.DisplayName != nil {
+		user.DisplayName = strings.TrimSpace(*update.DisplayName)
+	}
+	if update.Bio != nil {
+		user.Bio = strings.TrimSpace(*update.Bio)
+	}
+	if update.AvatarURL != nil {
+		user.AvatarURL = strings.TrimSpace(*update.AvatarURL)
+	}
+
+	if utf8.RuneCountInString(user.DisplayName) > maxDisplayNameLength || strings.IndexFunc(user.DisplayName, unicode.IsControl) >= 0 {
+		return nil, ErrInvalidDisplayName
+	}
+	if utf8.RuneCountInString(user.Bio) > maxBioLength {
+		return nil, ErrInvalidBio
+	}
+	if user.AvatarURL != "" && !validAvatarURL(user.AvatarURL) {
+		return nil, ErrInvalidAvatarURL
+	}
+
+	if err := s.auth.userRepo.UpdateProfile(ctx, user.ID, user.DisplayName, user.Bio, user.AvatarURL); err != nil {
+		return nil, err
+	}
+
+	s.auth.recordEvent(ctx, user.ID, EventProfileUpdated, nil)
+	return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one, and
+// logs the user out of every session but currentSessionID. Accounts without
+// a password, such as those created through an external login, have to use
+// the password reset flow instead.
+func (s *ProfileService) ChangePassword(ctx context.Context, userID, currentSessionID, currentPassword, newPassword string) error {
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if ok, _ := s.auth.passwords.Verify(user.PasswordHash, currentPassword); !ok {
+		return ErrWrongPassword
+	}
+
+	if err := s.auth.passwords.Check(newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.auth.passwords.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.auth.userRepo.UpdatePassword(ctx, user.ID, hashedPassword); err != nil {
+		return err
+	}
+
+	// Reset links mailed before the change must not undo it
+	if err := s.account.resetRepo.DeleteAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if currentSessionID == "" {
+		err = s.auth.tokenRepo.DeleteAllForUser(ctx, user.ID)
+	} else {
+		err = s.auth.tokenRepo.DeleteOtherSessions(ctx, user.ID, currentSessionID)
+	}
+	if err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, user.ID, EventPasswordChanged, nil)
+	return nil
+}
+
+// ChangeUsername renames the user. A username cannot be taken while another
+// user holds it or was the last to give it up, so that a rename does not let
+// someone else pose as the old name. Access tokens carry the old name until
+// they are refreshed.
+func (s *ProfileService) ChangeUsername(ctx context.Context, userID, username string) (*repository.User, error) {
+	username = strings.TrimSpace(username)
+	if !validUsername(username) {
+		return nil, ErrInvalidUsername
+	}
+
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if username == user.Username {
+		return user, nil
+	}
+
+	if owner, err := s.auth.userRepo.GetByUsername(ctx, username); err == nil && owner.ID != user.ID {
+		return nil, ErrUsernameTaken
+	}
+	previousOwner, err := s.auth.userRepo.PreviousOwner(ctx, username)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if err == nil && previousOwner != user.ID {
+		return nil, ErrUsernameTaken
+	}
+
+	change, err := s.auth.userRepo.Rename(ctx, user.ID, username)
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, ErrUsernameTaken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	s.auth.recordEvent(ctx, user.ID, EventUsernameChanged, map[string]string{
+		"old_username": change.OldUsername,
+		"new_username": change.NewUsername,
+	})
+	user.Username = username
+	return user, nil
+}
+
+// UsernameHistory returns the user's previous usernames, most recent first.
+func (s *ProfileService) UsernameHistory(ctx context.Context, userID string) ([]repository.UsernameChange, error) {
+	return s.auth.userRepo.UsernameHistory(ctx, userID)
+}
+
+// ListUsernameChanges returns renames of all users after the one with ID
+// afterID, oldest first. Services that store usernames follow this feed to
+// keep them current.
+func (s *ProfileService) ListUsernameChanges(ctx context.Context, afterID int64, limit int) ([]repository.UsernameChange, error) {
+	if limit <= 0 {
+		limit = defaultFeedPageSize
+	}
+	if limit > maxFeedPageSize {
+		limit = maxFeedPageSize
+	}
+	return s.auth.userRepo.ListUsernameChanges(ctx, afterID, limit)
+}
+
+// RequestEmailChange mails a confirmation link to the new address. The
+// address only replaces the current one once the link is opened; until then
+// the old address keeps working and is told about the request.
+func (s *ProfileService) RequestEmailChange(ctx context.Context, userID, email string) error {
+	email = strings.TrimSpace(email)
+
+	user, err := s.auth.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if email == user.Email {
+		return ErrEmailUnchanged
+	}
+	if _, err := s.auth.userRepo.GetByEmail(ctx, email); err == nil {
+		return ErrEmailTaken
+	}
+
+	// Only the latest requested address can be confirmed
+	if err := s.emailChangeRepo.DeleteAllForUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	changeToken := &repository.OneTimeToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.auth.config.EmailVerificationTTL),
+	}
+	if err := s.emailChangeRepo.Create(ctx, changeToken); err != nil {
+		return err
+	}
+
+	if err := s.auth.userRepo.SetPendingEmail(ctx, user.ID, email); err != nil {
+		return err
+	}
+
+	link := s.auth.config.AppURL + "/confirm-email?token=" + url.QueryEscape(token)
+	err = s.account.mailer.Send(ctx, mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm that you want to use this address for your account "+
+			"by opening the link below. It expires in %s.\n\n%s\n\n"+
+			"If you didn't ask for this, you can ignore this email.\n",
+			user.Username, s.auth.config.EmailVerificationTTL, link),
+	})
+	if err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, user.ID, EventEmailChangeAsked, map[string]string{"email": email})
+
+	return s.account.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address is being changed",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to change the email address of your account to %s. "+
+			"It will change once the new address is confirmed.\n\n"+
+			"If this wasn't you, reset your password right away.\n",
+			user.Username, email),
+	})
+}
+
+// ConfirmEmailChange replaces the user's email address with the one the
+// token was sent to.
+func (s *ProfileService) ConfirmEmailChange(ctx context.Context, token string) error {
+	changeToken, err := s.emailChangeRepo.Consume(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidEmailChange
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.auth.userRepo.ConfirmPendingEmail(ctx, changeToken.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidEmailChange
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, changeToken.UserID, EventEmailChanged, nil)
+	return s.emailChangeRepo.DeleteAllForUser(ctx, changeToken.UserID)
+}
+
+// validUsername applies the same rules as registration in the rest of the
+// project: 3 to 30 letters, digits, underscores and hyphens.
+func validUsername(username string) bool {
+	if len(username) < minUsernameLength || len(username) > maxUsernameLength {
+		return false
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_' && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func validAvatarURL(rawURL string) bool {
+	if len(rawURL) > maxAvatarURLLength {
+		return false
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
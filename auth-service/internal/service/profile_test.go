@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"testing"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type profileTestDeps struct {
+	userRepo        *MockUserRepository
+	tokenRepo       *MockTokenRepository
+	resetRepo       *MockOneTimeTokenRepository
+	emailChangeRepo *MockOneTimeTokenRepository
+	identityRepo    *MockExternalIdentityRepository
+	mail            *fakeMailer
+}
+
+func ptr(s string) *string {
+	return &s
+}
+
+func newProfileTestService() (*ProfileService, profileTestDeps) {
+	deps := profileTestDeps{
+		userRepo:        new(MockUserRepository),
+		tokenRepo:       new(MockTokenRepository),
+		resetRepo:       new(MockOneTimeTokenRepository),
+		emailChangeRepo: new(MockOneTimeTokenRepository),
+		identityRepo:    new(MockExternalIdentityRepository),
+		mail:            &fakeMailer{},
+	}
+	cfg := newTestAccountConfig()
+	authService := newRevocationTestService(deps.tokenRepo, deps.userRepo, newMockRevokedTokenRepository())
+	authService.config = cfg
+	accountService := NewAccountService(deps.userRepo, deps.tokenRepo, deps.resetRepo, new(MockOneTimeTokenRepository), newMockSecurityEventRepository(), deps.mail, testPasswords, cfg)
+	return NewProfileService(authService, accountService, deps.emailChangeRepo, deps.identityRepo), deps
+}
+
+func TestProfileService_UpdateProfile(t *testing.T) {
+	t.Run("only given fields change", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), DisplayName: "Alice", Bio: "old bio"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("UpdateProfile", mock.Anything, user.ID, "Alice", "new bio", "https://cdn.example.com/a.png").Return(nil)
+
+		bio, avatar := " new bio ", "https://cdn.example.com/a.png"
+		updated, err := service.UpdateProfile(context.Background(), user.ID, ProfileUpdate{Bio: &bio, AvatarURL: &avatar})
+		require.NoError(t, err)
+		assert.Equal(t, "Alice", updated.DisplayName)
+		assert.Equal(t, "new bio", updated.Bio)
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid fields are rejected", func(t *testing.T) {
+		longName := strings.Repeat("a", 101)
+		longBio := strings.Repeat("a", 1001)
+		cases := map[string]struct {
+			update ProfileUpdate
+			err    error
+		}{
+			"long display name": {ProfileUpdate{DisplayName: &longName}, ErrInvalidDisplayName},
+			"long bio":          {ProfileUpdate{Bio: &longBio}, ErrInvalidBio},
+			"javascript URL":    {ProfileUpdate{AvatarURL: ptr("javascript:alert(1)")}, ErrInvalidAvatarURL},
+			"relative URL":      {ProfileUpdate{AvatarURL: ptr("/relative.png")}, ErrInvalidAvatarURL},
+			"URL without host":  {ProfileUpdate{AvatarURL: ptr("https://")}, ErrInvalidAvatarURL},
+		}
+		for name, tc := range cases {
+			t.Run(name, func(t *testing.T) {
+				service, deps := newProfileTestService()
+
+				user := &repository.User{ID: uuid.New().String()}
+				deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+				_, err := service.UpdateProfile(context.Background(), user.ID, tc.update)
+				assert.ErrorIs(t, err, tc.err)
+				deps.userRepo.AssertNotCalled(t, "UpdateProfile", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			})
+		}
+	})
+}
+
+func TestProfileService_ChangePassword(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+
+	t.Run("other sessions are logged out", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), PasswordHash: string(hashedPassword)}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("UpdatePassword", mock.Anything, user.ID, mock.AnythingOfType("string")).Return(nil)
+		deps.resetRepo.On("DeleteAllForUser", mock.Anything, user.ID).Return(nil)
+		deps.tokenRepo.On("DeleteOtherSessions", mock.Anything, user.ID, "current-session").Return(nil)
+
+		err := service.ChangePassword(context.Background(), user.ID, "current-session", "password123", "N3w-password")
+		require.NoError(t, err)
+		deps.userRepo.AssertExpectations(t)
+		deps.resetRepo.AssertExpectations(t)
+		deps.tokenRepo.AssertExpectations(t)
+		deps.tokenRepo.AssertNotCalled(t, "DeleteAllForUser", mock.Anything, mock.Anything)
+	})
+
+	t.Run("wrong current password", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), PasswordHash: string(hashedPassword)}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		err := service.ChangePassword(context.Background(), user.ID, "current-session", "wrong", "N3w-password")
+		assert.ErrorIs(t, err, ErrWrongPassword)
+		deps.userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("accounts without a password must reset it", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String()}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		err := service.ChangePassword(context.Background(), user.ID, "current-session", "", "N3w-password")
+		assert.ErrorIs(t, err, ErrWrongPassword)
+	})
+
+	t.Run("new password must be strong", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), PasswordHash: string(hashedPassword)}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		err := service.ChangePassword(context.Background(), user.ID, "current-session", "password123", "newpassword456")
+		assert.ErrorIs(t, err, ErrWeakPassword)
+		deps.userRepo.AssertNotCalled(t, "UpdatePassword", mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+func TestProfileService_ChangeUsername(t *testing.T) {
+	t.Run("rename is recorded", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice2").Return(nil, assert.AnError)
+		deps.userRepo.On("PreviousOwner", mock.Anything, "alice2").Return("", repository.ErrNotFound)
+		deps.userRepo.On("Rename", mock.Anything, user.ID, "alice2").
+			Return(&repository.UsernameChange{ID: 1, UserID: user.ID, OldUsername: "alice", NewUsername: "alice2"}, nil)
+
+		updated, err := service.ChangeUsername(context.Background(), user.ID, " alice2 ")
+		require.NoError(t, err)
+		assert.Equal(t, "alice2", updated.Username)
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("taken username", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByUsername", mock.Anything, "bob").Return(&repository.User{ID: uuid.New().String()}, nil)
+
+		_, err := service.ChangeUsername(context.Background(), user.ID, "bob")
+		assert.ErrorIs(t, err, ErrUsernameTaken)
+	})
+
+	t.Run("another user's old username is reserved", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByUsername", mock.Anything, "carol").Return(nil, assert.AnError)
+		deps.userRepo.On("PreviousOwner", mock.Anything, "carol").Return(uuid.New().String(), nil)
+
+		_, err := service.ChangeUsername(context.Background(), user.ID, "carol")
+		assert.ErrorIs(t, err, ErrUsernameTaken)
+		deps.userRepo.AssertNotCalled(t, "Rename", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("own old username can be taken back", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Username: "alice2"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice").Return(nil, assert.AnError)
+		deps.userRepo.On("PreviousOwner", mock.Anything, "alice").Return(user.ID, nil)
+		deps.userRepo.On("Rename", mock.Anything, user.ID, "alice").
+			Return(&repository.UsernameChange{ID: 2, UserID: user.ID, OldUsername: "alice2", NewUsername: "alice"}, nil)
+
+		_, err := service.ChangeUsername(context.Background(), user.ID, "alice")
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid username", func(t *testing.T) {
+		service, _ := newProfileTestService()
+
+		for _, username := range []string{"ab", "has space", strings.Repeat("a", 31), "semi;colon"} {
+			_, err := service.ChangeUsername(context.Background(), uuid.New().String(), username)
+			assert.ErrorIs(t, err, ErrInvalidUsername, username)
+		}
+	})
+}
+
+func TestProfileService_EmailChange(t *testing.T) {
+	t.Run("new address must be confirmed", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByEmail", mock.Anything, "new@example.com").Return(nil, assert.AnError)
+		deps.userRepo.On("SetPendingEmail", mock.Anything, user.ID, "new@example.com").Return(nil)
+		deps.emailChangeRepo.On("DeleteAllForUser", mock.Anything, user.ID).Return(nil)
+
+		var stored *repository.OneTimeToken
+		deps.emailChangeRepo.On("Create", mock.Anything, mock.AnythingOfType("*repository.OneTimeToken")).
+			Run(func(args mock.Arguments) { stored = args.Get(1).(*repository.OneTimeToken) }).
+			Return(nil)
+
+		require.NoError(t, service.RequestEmailChange(context.Background(), user.ID, "new@example.com"))
+		require.Len(t, deps.mail.sent, 2)
+		assert.Equal(t, "new@example.com", deps.mail.sent[0].To)
+		assert.Equal(t, "alice@example.com", deps.mail.sent[1].To)
+
+		// The link carries the token whose hash was stored
+		body := deps.mail.sent[0].Body
+		start := strings.Index(body, "https://forum.example.com/confirm-email?token=")
+		require.NotEqual(t, -1, start)
+		link, err := url.Parse(strings.Fields(body[start:])[0])
+		require.NoError(t, err)
+		token := link.Query().Get("token")
+		assert.Equal(t, hashToken(token), stored.TokenHash)
+
+		deps.emailChangeRepo.On("Consume", mock.Anything, hashToken(token)).Return(stored, nil)
+		deps.userRepo.On("ConfirmPendingEmail", mock.Anything, user.ID).Return(nil)
+
+		require.NoError(t, service.ConfirmEmailChange(context.Background(), token))
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("address already registered", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		user := &repository.User{ID: uuid.New().String(), Email: "alice@example.com"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByEmail", mock.Anything, "bob@example.com").Return(&repository.User{ID: uuid.New().String()}, nil)
+
+		err := service.RequestEmailChange(context.Background(), user.ID, "bob@example.com")
+		assert.ErrorIs(t, err, ErrEmailTaken)
+		assert.Empty(t, deps.mail.sent)
+	})
+
+	t.Run("address taken before confirmation", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		userID := uuid.New().String()
+		deps.emailChangeRepo.On("Consume", mock.Anything, hashToken("token")).Return(&repository.OneTimeToken{UserID: userID}, nil)
+		deps.userRepo.On("ConfirmPendingEmail", mock.Anything, userID).Return(repository.ErrConflict)
+
+		assert.ErrorIs(t, service.ConfirmEmailChange(context.Background(), "token"), ErrEmailTaken)
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		service, deps := newProfileTestService()
+
+		deps.emailChangeRepo.On("Consume", mock.Anything, hashToken("bogus")).Return(nil, repository.ErrNotFound)
+
+		assert.ErrorIs(t, service.ConfirmEmailChange(context.Background(), "bogus"), ErrInvalidEmailChange)
+	})
+}
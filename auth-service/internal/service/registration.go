@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"auth-service/internal/repository"
+)
+
+// Values of config.RegistrationMode.
+const (
+	RegistrationOpen     = "open"
+	RegistrationInvite   = "invite"
+	RegistrationDomain   = "domain"
+	RegistrationApproval = "approval"
+)
+
+const (
+	EventInviteCreated = "invite_created"
+	EventInviteDeleted = "invite_deleted"
+	EventUserApproved  = "user_approved"
+)
+
+const maxInviteNoteLength = 200
+
+var (
+	ErrInviteRequired        = errors.New("an invite code is required to register")
+	ErrInvalidInviteCode     = errors.New("invalid or expired invite code")
+	ErrEmailDomainNotAllowed = errors.New("registration is not open to this email domain")
+	ErrInvalidInvite         = errors.New("invite needs a positive number of uses, a future expiry and a note of at most 200 characters")
+)
+
+// admit checks that an account for email may be created under the
+// registration mode and redeems inviteCode if one is given. A valid invite
+// admits the account in every mode without waiting for approval. It returns
+// the redeemed invite and whether the account must wait for approval.
+func (s *AuthService) admit(ctx context.Context, email, inviteCode string) (*repository.InviteCode, bool, error) {
+	if inviteCode != "" {
+		invite, err := s.inviteRepo.Redeem(ctx, hashToken(inviteCode))
+		if errors.Is(err, repository.ErrNotFound) {
+			return nil, false, ErrInvalidInviteCode
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		return invite, false, nil
+	}
+
+	switch s.config.RegistrationMode {
+	case RegistrationOpen, "":
+		return nil, false, nil
+	case RegistrationInvite:
+		return nil, false, ErrInviteRequired
+	case RegistrationDomain:
+		if !s.emailDomainAllowed(email) {
+			return nil, false, ErrEmailDomainNotAllowed
+		}
+		return nil, false, nil
+	case RegistrationApproval:
+		return nil, true, nil
+	default:
+		return nil, false, fmt.Errorf("unknown registration mode %q", s.config.RegistrationMode)
+	}
+}
+
+// emailDomainAllowed reports whether the domain of email is exactly one of
+// the allowed domains. Subdomains must be listed separately.
+func (s *AuthService) emailDomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := email[at+1:]
+	for _, allowed := range s.config.AllowedEmailDomains {
+		if strings.EqualFold(domain, strings.TrimPrefix(allowed, "@")) {
+			return true
+		}
+	}
+	return false
+}
+
+// releaseInvite gives back the use of an invite redeemed for an account that
+// could not be created.
+func (s *AuthService) releaseInvite(ctx context.Context, invite *repository.InviteCode) {
+	if invite != nil {
+		_ = s.inviteRepo.Release(ctx, invite.ID)
+	}
+}
+
+// CreateInvite creates an invite code that can be used maxUses times until
+// expiresAt, or forever if it is nil. The code is returned only this once.
+func (s *AuthService) CreateInvite(ctx context.Context, actorID, note string, maxUses int, expiresAt *time.Time) (string, *repository.InviteCode, error) {
+	note = strings.TrimSpace(note)
+	if maxUses < 1 || len(note) > maxInviteNoteLength || (expiresAt != nil && !expiresAt.After(time.Now())) {
+		return "", nil, ErrInvalidInvite
+	}
+
+	code, err := generateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	code = strings.TrimRight(code, "=")
+
+	invite := &repository.InviteCode{
+		CodeHash:  hashToken(code),
+		Note:      note,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		CreatedBy: actorID,
+	}
+	if err := s.inviteRepo.Create(ctx, invite); err != nil {
+		return "", nil, err
+	}
+
+	s.recordEvent(ctx, actorID, EventInviteCreated, map[string]string{
+		"invite_id": invite.ID,
+		"max_uses":  strconv.Itoa(maxUses),
+	})
+	return code, invite, nil
+}
+
+func (s *AuthService) ListInvites(ctx context.Context) ([]repository.InviteCode, error) {
+	return s.inviteRepo.List(ctx)
+}
+
+// DeleteInvite deletes an invite code. Users who registered with it keep
+// their accounts but are no longer linked to it.
+func (s *AuthService) DeleteInvite(ctx context.Context, actorID, id string) error {
+	if err := s.inviteRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, actorID, EventInviteDeleted, map[string]string{"invite_id": id})
+	return nil
+}
+
+// ApproveUser lets an account registered under the approval mode use the
+// forum. The restrictions are lifted from the next token the user gets.
+func (s *AuthService) ApproveUser(ctx context.Context, actorID, userID string) error {
+	if err := s.userRepo.Approve(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventUserApproved, map[string]string{"actor_id": actorID})
+	return nil
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockInviteCodeRepository struct {
+	mock.Mock
+}
+
+func (m *MockInviteCodeRepository) Create(ctx context.Context, invite *repository.InviteCode) error {
+	args := m.Called(ctx, invite)
+	return args.Error(0)
+}
+
+func (m *MockInviteCodeRepository) List(ctx context.Context) ([]repository.InviteCode, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]repository.InviteCode), args.Error(1)
+}
+
+func (m *MockInviteCodeRepository) Delete(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockInviteCodeRepository) Redeem(ctx context.Context, codeHash string) (*repository.InviteCode, error) {
+	args := m.Called(ctx, codeHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*repository.InviteCode), args.Error(1)
+}
+
+func (m *MockInviteCodeRepository) Release(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func TestAuthService_RegistrationModes(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(mode string, userRepo *MockUserRepository, roleRepo *MockRoleRepository, inviteRepo *MockInviteCodeRepository) *AuthService {
+		cfg := newTestConfig()
+		cfg.RegistrationMode = mode
+		cfg.AllowedEmailDomains = []string{"example.com"}
+		return NewAuthService(userRepo, new(MockTokenRepository), roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), inviteRepo, new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+	}
+	newUserRepo := func(username, email string) *MockUserRepository {
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByUsername", mock.Anything, username).Return(nil, repository.ErrNotFound)
+		userRepo.On("GetByEmail", mock.Anything, email).Return(nil, repository.ErrNotFound)
+		return userRepo
+	}
+
+	t.Run("invite mode requires a code", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		service := newService(RegistrationInvite, userRepo, new(MockRoleRepository), new(MockInviteCodeRepository))
+
+		err := service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", "")
+		assert.ErrorIs(t, err, ErrInviteRequired)
+		userRepo.AssertNotCalled(t, "CreateWithRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("invite mode records the code used", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		inviteRepo := new(MockInviteCodeRepository)
+		service := newService(RegistrationInvite, userRepo, new(MockRoleRepository), inviteRepo)
+
+		invite := &repository.InviteCode{ID: uuid.New().String(), MaxUses: 5, Uses: 1}
+		inviteRepo.On("Redeem", mock.Anything, hashToken("welcome")).Return(invite, nil)
+		userRepo.On("CreateWithRole", mock.Anything, mock.MatchedBy(func(u *repository.User) bool {
+			return u.InviteCodeID == invite.ID && !u.PendingApproval
+		}), RoleUser, "").Return(nil)
+
+		require.NoError(t, service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", "welcome"))
+		userRepo.AssertExpectations(t)
+	})
+
+	t.Run("unknown or used up code", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		inviteRepo := new(MockInviteCodeRepository)
+		service := newService(RegistrationInvite, userRepo, new(MockRoleRepository), inviteRepo)
+
+		inviteRepo.On("Redeem", mock.Anything, hashToken("stale")).Return(nil, repository.ErrNotFound)
+
+		err := service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", "stale")
+		assert.ErrorIs(t, err, ErrInvalidInviteCode)
+		userRepo.AssertNotCalled(t, "CreateWithRole", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("failed registration gives the use back", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		inviteRepo := new(MockInviteCodeRepository)
+		service := newService(RegistrationInvite, userRepo, new(MockRoleRepository), inviteRepo)
+
+		invite := &repository.InviteCode{ID: uuid.New().String(), MaxUses: 1, Uses: 1}
+		inviteRepo.On("Redeem", mock.Anything, hashToken("welcome")).Return(invite, nil)
+		inviteRepo.On("Release", mock.Anything, invite.ID).Return(nil)
+		userRepo.On("CreateWithRole", mock.Anything, mock.Anything, RoleUser, "").Return(repository.ErrConflict)
+
+		assert.Error(t, service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", "welcome"))
+		inviteRepo.AssertExpectations(t)
+	})
+
+	t.Run("domain mode", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		service := newService(RegistrationDomain, userRepo, new(MockRoleRepository), new(MockInviteCodeRepository))
+
+		err := service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", "")
+		assert.ErrorIs(t, err, ErrEmailDomainNotAllowed)
+
+		userRepo = newUserRepo("bob", "bob@EXAMPLE.com")
+		userRepo.On("CreateWithRole", mock.Anything, mock.Anything, RoleUser, "").Return(nil)
+		service = newService(RegistrationDomain, userRepo, new(MockRoleRepository), new(MockInviteCodeRepository))
+		assert.NoError(t, service.Register(ctx, "bob", "bob@EXAMPLE.com", "Passw0rd!", ""))
+	})
+
+	t.Run("approval mode creates pending accounts", func(t *testing.T) {
+		userRepo := newUserRepo("alice", "alice@example.org")
+		service := newService(RegistrationApproval, userRepo, new(MockRoleRepository), new(MockInviteCodeRepository))
+
+		userRepo.On("CreateWithRole", mock.Anything, mock.MatchedBy(func(u *repository.User) bool {
+			return u.PendingApproval
+		}), RoleUser, "").Return(nil)
+
+		require.NoError(t, service.Register(ctx, "alice", "alice@example.org", "Passw0rd!", ""))
+		userRepo.AssertExpectations(t)
+	})
+
+	t.Run("pending accounts get a restricted token", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		hash, err := testPasswords.Hash("Passw0rd!")
+		require.NoError(t, err)
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", PasswordHash: hash, PendingApproval: true}
+		userRepo.On("GetByUsername", mock.Anything, "alice").Return(user, nil)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		tokens, err := service.Login(ctx, "alice", "Passw0rd!")
+		require.NoError(t, err)
+
+		claims, err := service.ParseToken(ctx, tokens.AccessToken)
+		require.NoError(t, err)
+		assert.True(t, claims.PendingApproval)
+		assert.False(t, claims.CanWrite)
+		assert.Empty(t, claims.Roles)
+	})
+}
+
+func TestAuthService_Invites(t *testing.T) {
+	ctx := context.Background()
+	adminID := uuid.New().String()
+
+	newService := func(userRepo *MockUserRepository, eventRepo *MockSecurityEventRepository, inviteRepo *MockInviteCodeRepository) *AuthService {
+		return NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), inviteRepo, new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+	}
+
+	t.Run("create stores only the hash", func(t *testing.T) {
+		inviteRepo := new(MockInviteCodeRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(new(MockUserRepository), eventRepo, inviteRepo)
+
+		var stored *repository.InviteCode
+		inviteRepo.On("Create", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+			stored = args.Get(1).(*repository.InviteCode)
+			stored.ID = uuid.New().String()
+		}).Return(nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventInviteCreated && e.UserID == adminID
+		})).Return(nil)
+
+		expiresAt := time.Now().Add(24 * time.Hour)
+		code, invite, err := service.CreateInvite(ctx, adminID, " for the book club ", 10, &expiresAt)
+		require.NoError(t, err)
+		assert.NotEmpty(t, code)
+		assert.Equal(t, hashToken(code), stored.CodeHash)
+		assert.Equal(t, "for the book club", invite.Note)
+		assert.Equal(t, 10, invite.MaxUses)
+		assert.Equal(t, adminID, invite.CreatedBy)
+	})
+
+	t.Run("create rejects bad settings", func(t *testing.T) {
+		inviteRepo := new(MockInviteCodeRepository)
+		service := newService(new(MockUserRepository), new(MockSecurityEventRepository), inviteRepo)
+
+		past := time.Now().Add(-time.Minute)
+		_, _, err := service.CreateInvite(ctx, adminID, "", 0, nil)
+		assert.ErrorIs(t, err, ErrInvalidInvite)
+		_, _, err = service.CreateInvite(ctx, adminID, "", 1, &past)
+		assert.ErrorIs(t, err, ErrInvalidInvite)
+		inviteRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("approve user", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		eventRepo := new(MockSecurityEventRepository)
+		service := newService(userRepo, eventRepo, new(MockInviteCodeRepository))
+
+		userID := uuid.New().String()
+		userRepo.On("Approve", mock.Anything, userID).Return(nil)
+		userRepo.On("Approve", mock.Anything, "missing").Return(repository.ErrNotFound)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventUserApproved && e.UserID == userID && e.Details["actor_id"] == adminID
+		})).Return(nil).Once()
+
+		assert.NoError(t, service.ApproveUser(ctx, adminID, userID))
+		assert.ErrorIs(t, service.ApproveUser(ctx, adminID, "missing"), repository.ErrNotFound)
+		eventRepo.AssertExpectations(t)
+	})
+}
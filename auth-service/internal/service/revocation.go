@@ -0,0 +1,206 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Token types reported by introspection, from RFC 7009 section 2.1.
+const (
+	TokenTypeAccessToken  = "access_token"
+	TokenTypeRefreshToken = "refresh_token"
+)
+
+const EventTokenRevoked = "token_revoked"
+
+var (
+	ErrTokenRevoked = errors.New("token has been revoked")
+	// ErrTokenNotOwned is returned when a client tries to revoke a token that
+	// was issued to someone else.
+	ErrTokenNotOwned = errors.New("token was not issued to this client")
+)
+
+// Introspection describes a token as in RFC 7662 section 2.2. Only Active is
+// set for tokens that are invalid, expired or revoked.
+type Introspection struct {
+	Active    bool
+	TokenType string
+	// Subject is the user, or the client for client credentials tokens.
+	Subject   string
+	Username  string
+	ClientID  string
+	Scopes    []string
+	ExpiresAt *time.Time
+	IssuedAt  *time.Time
+}
+
+// verifyAccessToken checks a JWT's signature and expiry and that it has not
+// been revoked.
+func (s *AuthService) verifyAccessToken(ctx context.Context, tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, s.keys.Keyfunc, jwt.WithValidMethods(s.keys.Methods()))
+	if err != nil {
+		return nil, err
+	}
+
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	// Tokens issued before jti was introduced cannot be revoked
+	if claims.ID != "" {
+		revoked, err := s.revokedRepo.IsRevoked(ctx, claims.ID)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	return claims, nil
+}
+
+// Introspect reports whether token is an active access token, personal access
+// token or refresh token, and what it was issued for.
+func (s *AuthService) Introspect(ctx context.Context, token string) *Introspection {
+	switch {
+	case IsPersonalAccessToken(token):
+		claims, _, err := s.parsePersonalAccessToken(ctx, token)
+		if err != nil {
+			return &Introspection{}
+		}
+		return claimsIntrospection(claims)
+	case isJWT(token):
+		claims, err := s.verifyAccessToken(ctx, token)
+		if err != nil {
+			return &Introspection{}
+		}
+		// Client credentials tokens have no user to check, only their client
+		if claims.UserID != "" {
+			if _, err := s.checkAccessTokenHolders(ctx, claims); err != nil {
+				return &Introspection{}
+			}
+		} else if claims.ClientID != "" {
+			if err := s.checkClient(ctx, claims); err != nil {
+				return &Introspection{}
+			}
+		}
+		return claimsIntrospection(claims)
+	}
+
+	refreshToken, err := s.tokenRepo.Get(ctx, token)
+	if err != nil || refreshToken.RotatedAt != nil || time.Now().After(refreshToken.ExpiresAt) {
+		return &Introspection{}
+	}
+	user, err := s.userRepo.GetByID(ctx, refreshToken.UserID)
+	if err != nil {
+		return &Introspection{}
+	}
+
+	return &Introspection{
+		Active:    true,
+		TokenType: TokenTypeRefreshToken,
+		Subject:   user.ID,
+		Username:  user.Username,
+		ClientID:  refreshToken.ClientID,
+		Scopes:    refreshToken.Scopes,
+		ExpiresAt: &refreshToken.ExpiresAt,
+		IssuedAt:  &refreshToken.CreatedAt,
+	}
+}
+
+// RevokeToken revokes an access token, personal access token or refresh
+// token, following RFC 7009. clientID is the OAuth client making the request,
+// or empty for first-party callers; a token issued to another client returns
+// ErrTokenNotOwned. Unknown and already invalid tokens are not an error.
+//
+// Revoking a refresh token ends its whole session.
+func (s *AuthService) RevokeToken(ctx context.Context, token, clientID string) error {
+	switch {
+	case IsPersonalAccessToken(token):
+		return s.revokePersonalAccessToken(ctx, token, clientID)
+	case isJWT(token):
+		return s.revokeAccessToken(ctx, token, clientID)
+	}
+
+	refreshToken, err := s.tokenRepo.Get(ctx, token)
+	if err != nil {
+		return nil
+	}
+	if refreshToken.ClientID != clientID {
+		return ErrTokenNotOwned
+	}
+	if err := s.tokenRepo.DeleteFamily(ctx, refreshToken.FamilyID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, refreshToken.UserID, EventTokenRevoked, map[string]string{
+		"token_type": TokenTypeRefreshToken,
+		"session_id": refreshToken.FamilyID,
+	})
+	return nil
+}
+
+func (s *AuthService) revokeAccessToken(ctx context.Context, token, clientID string) error {
+	claims, err := s.verifyAccessToken(ctx, token)
+	if err != nil || claims.ID == "" {
+		return nil
+	}
+	if claims.ClientID != clientID {
+		return ErrTokenNotOwned
+	}
+	if err := s.revokedRepo.Revoke(ctx, claims.ID, claims.ExpiresAt.Time); err != nil {
+		return err
+	}
+
+	if claims.UserID != "" {
+		s.recordEvent(ctx, claims.UserID, EventTokenRevoked, map[string]string{
+			"token_type": TokenTypeAccessToken,
+			"jti":        claims.ID,
+		})
+	}
+	return nil
+}
+
+func (s *AuthService) revokePersonalAccessToken(ctx context.Context, token, clientID string) error {
+	pat, err := s.patRepo.GetByHash(ctx, hashToken(token))
+	if err != nil {
+		return nil
+	}
+	if clientID != "" {
+		return ErrTokenNotOwned
+	}
+	return s.RevokeAccessToken(ctx, pat.UserID, pat.ID)
+}
+
+func claimsIntrospection(claims *Claims) *Introspection {
+	introspection := &Introspection{
+		Active:    true,
+		TokenType: TokenTypeAccessToken,
+		Subject:   claims.UserID,
+		Username:  claims.Username,
+		ClientID:  claims.ClientID,
+		Scopes:    claims.Scopes,
+	}
+	if introspection.Subject == "" {
+		introspection.Subject = claims.Subject
+	}
+	if claims.ExpiresAt != nil {
+		introspection.ExpiresAt = &claims.ExpiresAt.Time
+	}
+	if claims.IssuedAt != nil {
+		introspection.IssuedAt = &claims.IssuedAt.Time
+	}
+	return introspection
+}
+
+// isJWT reports whether token looks like a JWT rather than an opaque
+// refresh token.
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
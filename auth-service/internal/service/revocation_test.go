@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockRevokedTokenRepository struct {
+	mock.Mock
+}
+
+// newMockRevokedTokenRepository returns a revocation list that is empty
+// unless the test adds expectations.
+func newMockRevokedTokenRepository() *MockRevokedTokenRepository {
+	m := new(MockRevokedTokenRepository)
+	m.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil).Maybe()
+	return m
+}
+
+func (m *MockRevokedTokenRepository) Revoke(ctx context.Context, jti string, expiresAt time.Time) error {
+	args := m.Called(ctx, jti, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockRevokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	args := m.Called(ctx, jti)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func newRevocationTestService(tokenRepo *MockTokenRepository, userRepo *MockUserRepository, revokedRepo *MockRevokedTokenRepository) *AuthService {
+	eventRepo := newMockSecurityEventRepository()
+	eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+	return NewAuthService(userRepo, tokenRepo, new(MockRoleRepository), eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), revokedRepo, new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+}
+
+func issueTestTokens(t *testing.T, service *AuthService, tokenRepo *MockTokenRepository, user *repository.User, sess session) *TokenPair {
+	service.roleRepo.(*MockRoleRepository).On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+	tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil).Once()
+
+	tokens, err := service.generateTokenPair(context.Background(), user, sess)
+	require.NoError(t, err)
+	return tokens
+}
+
+func TestAuthService_RevokeAccessToken(t *testing.T) {
+	user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+
+	t.Run("revoked token is rejected", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		revokedRepo := new(MockRevokedTokenRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, revokedRepo)
+		tokens := issueTestTokens(t, service, tokenRepo, user, newSession())
+
+		revokedRepo.On("IsRevoked", mock.Anything, mock.Anything).Return(false, nil).Twice()
+		revokedRepo.On("IsRevoked", mock.Anything, mock.Anything).Return(true, nil)
+		var revokedID string
+		revokedRepo.On("Revoke", mock.Anything, mock.Anything, mock.AnythingOfType("time.Time")).
+			Run(func(args mock.Arguments) { revokedID = args.String(1) }).
+			Return(nil)
+
+		claims, err := service.ParseToken(context.Background(), tokens.AccessToken)
+		require.NoError(t, err)
+		require.NotEmpty(t, claims.ID)
+
+		require.NoError(t, service.RevokeToken(context.Background(), tokens.AccessToken, ""))
+		assert.Equal(t, claims.ID, revokedID)
+
+		_, err = service.ParseToken(context.Background(), tokens.AccessToken)
+		assert.ErrorIs(t, err, ErrTokenRevoked)
+		assert.False(t, service.Introspect(context.Background(), tokens.AccessToken).Active)
+	})
+
+	t.Run("client tokens can only be revoked by the client", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		service := newRevocationTestService(tokenRepo, new(MockUserRepository), newMockRevokedTokenRepository())
+		sess := newSession()
+		sess.clientID = "wiki"
+		tokens := issueTestTokens(t, service, tokenRepo, user, sess)
+
+		assert.ErrorIs(t, service.RevokeToken(context.Background(), tokens.AccessToken, ""), ErrTokenNotOwned)
+	})
+
+	t.Run("unknown tokens are ignored", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		tokenRepo.On("Get", mock.Anything, "unknown").Return(nil, repository.ErrNotFound)
+		service := newRevocationTestService(tokenRepo, new(MockUserRepository), newMockRevokedTokenRepository())
+
+		assert.NoError(t, service.RevokeToken(context.Background(), "unknown", ""))
+		assert.NoError(t, service.RevokeToken(context.Background(), "a.b.c", ""))
+	})
+}
+
+func TestAuthService_RevokeRefreshToken(t *testing.T) {
+	tokenRepo := new(MockTokenRepository)
+	service := newRevocationTestService(tokenRepo, new(MockUserRepository), newMockRevokedTokenRepository())
+	refreshToken := &repository.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    uuid.New().String(),
+		FamilyID:  uuid.New().String(),
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	tokenRepo.On("Get", mock.Anything, "refresh-token").Return(refreshToken, nil)
+	tokenRepo.On("DeleteFamily", mock.Anything, refreshToken.FamilyID).Return(nil)
+
+	require.NoError(t, service.RevokeToken(context.Background(), "refresh-token", ""))
+	tokenRepo.AssertExpectations(t)
+}
+
+func TestAuthService_Introspect(t *testing.T) {
+	user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+
+	t.Run("access token", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		userRepo := new(MockUserRepository)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+		sess := newSession()
+		sess.clientID = "wiki"
+		sess.scopes = []string{ScopeOpenID, ScopePostsRead}
+		tokens := issueTestTokens(t, service, tokenRepo, user, sess)
+
+		introspection := service.Introspect(context.Background(), tokens.AccessToken)
+		assert.True(t, introspection.Active)
+		assert.Equal(t, TokenTypeAccessToken, introspection.TokenType)
+		assert.Equal(t, user.ID, introspection.Subject)
+		assert.Equal(t, "alice", introspection.Username)
+		assert.Equal(t, "wiki", introspection.ClientID)
+		assert.Equal(t, sess.scopes, introspection.Scopes)
+		require.NotNil(t, introspection.ExpiresAt)
+		require.NotNil(t, introspection.IssuedAt)
+		assert.True(t, introspection.ExpiresAt.After(*introspection.IssuedAt))
+	})
+
+	t.Run("refresh token", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		userRepo := new(MockUserRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+		refreshToken := &repository.RefreshToken{
+			UserID:    user.ID,
+			ExpiresAt: time.Now().Add(time.Hour),
+			CreatedAt: time.Now(),
+		}
+		tokenRepo.On("Get", mock.Anything, "refresh-token").Return(refreshToken, nil)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		introspection := service.Introspect(context.Background(), "refresh-token")
+		assert.True(t, introspection.Active)
+		assert.Equal(t, TokenTypeRefreshToken, introspection.TokenType)
+		assert.Equal(t, "alice", introspection.Username)
+
+		rotatedAt := time.Now()
+		refreshToken.RotatedAt = &rotatedAt
+		assert.Equal(t, &Introspection{}, service.Introspect(context.Background(), "refresh-token"))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		tokenRepo := new(MockTokenRepository)
+		tokenRepo.On("Get", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+		service := newRevocationTestService(tokenRepo, new(MockUserRepository), newMockRevokedTokenRepository())
+
+		assert.False(t, service.Introspect(context.Background(), "garbage").Active)
+		assert.False(t, service.Introspect(context.Background(), "not.a.jwt").Active)
+	})
+}
+
+func TestOAuthService_Introspect(t *testing.T) {
+	o := newOAuthTest()
+	o.clientRepo.On("Get", mock.Anything, "spa").Return(&repository.OAuthClient{ID: "spa"}, nil)
+
+	_, err := o.service.Introspect(context.Background(), "spa", "", "token")
+	var oauthErr *OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	assert.Equal(t, OAuthInvalidClient, oauthErr.Code)
+}
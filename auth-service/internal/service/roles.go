@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"auth-service/internal/repository"
+)
+
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	PermissionPostsModerate    = "posts:moderate"
+	PermissionCommentsModerate = "comments:moderate"
+	PermissionChatModerate     = "chat:moderate"
+	PermissionUsersRead        = "users:read"
+	PermissionUsersManage      = "users:manage"
+	PermissionRolesManage      = "roles:manage"
+	PermissionClientsManage    = "clients:manage"
+	PermissionAuditRead        = "audit:read"
+	PermissionInvitesManage    = "invites:manage"
+	PermissionUsersImpersonate = "users:impersonate"
+	PermissionSCIMProvision    = "scim:provision"
+)
+
+var ErrRevokeOwnAdmin = errors.New("cannot revoke your own admin role")
+
+func (s *AuthService) ListRoles(ctx context.Context) ([]repository.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+func (s *AuthService) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	return s.roleRepo.GetUserRoles(ctx, userID)
+}
+
+func (s *AuthService) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	return s.roleRepo.GetUserPermissions(ctx, userID)
+}
+
+func (s *AuthService) HasPermission(ctx context.Context, userID, permission string) (bool, error) {
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, p := range permissions {
+		if p == permission {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (s *AuthService) IsAdmin(ctx context.Context, userID string) (bool, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, role := range roles {
+		if role == RoleAdmin {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// AssignRole grants role to userID on behalf of actorID.
+func (s *AuthService) AssignRole(ctx context.Context, actorID, userID, role string) error {
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.roleRepo.Assign(ctx, userID, role, actorID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventRoleGranted, map[string]string{"role": role, "actor_id": actorID})
+	return nil
+}
+
+// RevokeRole removes role from userID. Admins cannot drop their own admin
+// role so that the last administrator cannot lock everyone out by accident.
+func (s *AuthService) RevokeRole(ctx context.Context, actorID, userID, role string) error {
+	if actorID == userID && role == RoleAdmin {
+		return ErrRevokeOwnAdmin
+	}
+
+	if err := s.roleRepo.Revoke(ctx, userID, role); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventRoleRevoked, map[string]string{"role": role, "actor_id": actorID})
+	return nil
+}
+
+// BootstrapAdmin grants the admin role to an existing account. It is used at
+// startup so that a fresh installation has someone able to use the admin API.
+func (s *AuthService) BootstrapAdmin(ctx context.Context, username string) error {
+	user, err := s.userRepo.GetByUsername(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	return s.roleRepo.Assign(ctx, user.ID, RoleAdmin, "")
+}
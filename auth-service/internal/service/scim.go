@@ -0,0 +1,1047 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"auth-service/internal/config"
+	"auth-service/internal/repository"
+)
+
+// Schema URNs from RFC 7643 and RFC 7644.
+const (
+	SCIMUserSchema  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	SCIMGroupSchema = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	SCIMListSchema  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	SCIMPatchSchema = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	SCIMErrorSchema = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+const (
+	EventUserProvisioned = "user_provisioned"
+	EventRoleCreated     = "role_created"
+	EventRoleDeleted     = "role_deleted"
+)
+
+// SCIMMaxResults is the largest page of users or groups returned at once.
+const SCIMMaxResults = 100
+
+const (
+	// scimSuspensionReason marks suspensions made by deprovisioning, so that
+	// reactivating a user does not lift a moderator's ban.
+	scimSuspensionReason = "deprovisioned by the directory"
+	maxRoleNameLength    = 50
+)
+
+// SCIMError is an error response of RFC 7644 section 3.12.
+type SCIMError struct {
+	Status int
+	// Type is the scimType, such as "uniqueness" or "invalidFilter".
+	Type   string
+	Detail string
+}
+
+func (e *SCIMError) Error() string {
+	return e.Detail
+}
+
+func scimInvalid(scimType, detail string) *SCIMError {
+	return &SCIMError{Status: http.StatusBadRequest, Type: scimType, Detail: detail}
+}
+
+func scimConflict(detail string) *SCIMError {
+	return &SCIMError{Status: http.StatusConflict, Type: "uniqueness", Detail: detail}
+}
+
+// SCIMUser is the User resource of RFC 7643 section 4.1, limited to the
+// attributes accounts have.
+type SCIMUser struct {
+	Schemas     []string         `json:"schemas"`
+	ID          string           `json:"id,omitempty"`
+	UserName    string           `json:"userName"`
+	Name        *SCIMName        `json:"name,omitempty"`
+	DisplayName string           `json:"displayName,omitempty"`
+	Emails      []SCIMMultiValue `json:"emails,omitempty"`
+	Active      *bool            `json:"active,omitempty"`
+	// Password can be set but is never returned.
+	Password string       `json:"password,omitempty"`
+	Groups   []SCIMMember `json:"groups,omitempty"`
+	Meta     *SCIMMeta    `json:"meta,omitempty"`
+}
+
+type SCIMName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type SCIMMultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// SCIMMember refers to a group member, or to a group a user belongs to.
+type SCIMMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type SCIMMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+	LastModified *time.Time `json:"lastModified,omitempty"`
+	Location     string     `json:"location"`
+}
+
+// SCIMGroup is the Group resource of RFC 7643 section 4.2. Groups are roles,
+// identified by their name.
+type SCIMGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id,omitempty"`
+	DisplayName string       `json:"displayName"`
+	Members     []SCIMMember `json:"members,omitempty"`
+	Meta        *SCIMMeta    `json:"meta,omitempty"`
+}
+
+// SCIMListResponse is a page of query results. Resources holds []SCIMUser or
+// []SCIMGroup.
+type SCIMListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type SCIMPatchRequest struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []SCIMPatchOperation `json:"Operations"`
+}
+
+type SCIMPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// SCIMService provisions accounts from a company directory over SCIM 2.0.
+// Users map onto accounts and groups onto roles. Deactivating a user
+// suspends them, which also logs them out everywhere.
+type SCIMService struct {
+	auth    *AuthService
+	profile *ProfileService
+	config  *config.Config
+}
+
+func NewSCIMService(auth *AuthService, profile *ProfileService, config *config.Config) *SCIMService {
+	return &SCIMService{
+		auth:    auth,
+		profile: profile,
+		config:  config,
+	}
+}
+
+// ListUsers returns the page of users matching filter that starts at the
+// 1-based startIndex.
+func (s *SCIMService) ListUsers(ctx context.Context, filter string, startIndex, count int) (*SCIMListResponse, error) {
+	f, err := parseSCIMFilter(filter, SCIMUserSchema)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count = scimPage(startIndex, count)
+
+	var users []repository.User
+	total := 0
+	if f == nil {
+		// A page of zero still has to report the total
+		limit := count
+		if limit == 0 {
+			limit = 1
+		}
+		users, total, err = s.auth.userRepo.List(ctx, repository.UserFilter{Limit: limit, Offset: startIndex - 1})
+		if err != nil {
+			return nil, err
+		}
+		users = users[:min(count, len(users))]
+	} else {
+		user, err := s.lookupUser(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		if user != nil {
+			total = 1
+			if startIndex == 1 && count > 0 {
+				users = append(users, *user)
+			}
+		}
+	}
+
+	resources := make([]SCIMUser, 0, len(users))
+	for i := range users {
+		resource, err := s.toSCIMUser(ctx, &users[i])
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *resource)
+	}
+	return scimList(total, startIndex, resources, len(resources)), nil
+}
+
+// lookupUser finds the user an equality filter selects, or nil if there is
+// none.
+func (s *SCIMService) lookupUser(ctx context.Context, f *scimFilter) (*repository.User, error) {
+	var user *repository.User
+	var err error
+	switch f.attribute {
+	case "username":
+		user, err = s.auth.userRepo.GetByUsername(ctx, f.value)
+	case "emails", "emails.value":
+		user, err = s.auth.userRepo.GetByEmail(ctx, f.value)
+	case "id":
+		user, err = s.auth.findUser(ctx, f.value)
+	default:
+		return nil, scimInvalid("invalidFilter", "users can only be filtered by id, userName or emails")
+	}
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, nil
+	}
+	return user, err
+}
+
+func (s *SCIMService) GetUser(ctx context.Context, id string) (*SCIMUser, error) {
+	user, err := s.auth.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMUser(ctx, user)
+}
+
+// CreateUser creates an account on behalf of actorID, the owner of the
+// directory's token. The directory vouches for the email address, so it is
+// verified at once, and registration modes do not apply. Accounts without a
+// password log in with a reset link, a login link or an external provider.
+func (s *SCIMService) CreateUser(ctx context.Context, actorID string, resource *SCIMUser) (*SCIMUser, error) {
+	changes, err := changesFromResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	username := strings.TrimSpace(*changes.userName)
+	email := *changes.email
+	if !validUsername(username) {
+		return nil, scimInvalid("invalidValue", ErrInvalidUsername.Error())
+	}
+	if !validEmail(email) {
+		return nil, scimInvalid("invalidValue", "emails must contain a valid address")
+	}
+	if !validDisplayName(*changes.displayName) {
+		return nil, scimInvalid("invalidValue", ErrInvalidDisplayName.Error())
+	}
+
+	if _, err := s.auth.userRepo.GetByUsername(ctx, username); err == nil {
+		return nil, scimConflict(ErrUsernameTaken.Error())
+	}
+	// Names given up by a rename stay reserved, as for users renaming
+	// themselves
+	if _, err := s.auth.userRepo.PreviousOwner(ctx, username); err == nil {
+		return nil, scimConflict(ErrUsernameTaken.Error())
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+	if _, err := s.auth.userRepo.GetByEmail(ctx, email); err == nil {
+		return nil, scimConflict(ErrEmailTaken.Error())
+	}
+
+	var passwordHash string
+	if changes.password != nil {
+		if passwordHash, err = s.hashPassword(*changes.password); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	user := &repository.User{
+		Username:        username,
+		Email:           email,
+		PasswordHash:    passwordHash,
+		EmailVerifiedAt: &now,
+		DisplayName:     *changes.displayName,
+	}
+	// Inactive accounts are created suspended, so that they can never be
+	// used in between
+	if !*changes.active {
+		user.SuspendedAt = &now
+		user.SuspensionReason = scimSuspensionReason
+	}
+	if err := s.auth.userRepo.CreateWithRole(ctx, user, RoleUser, actorID); err != nil {
+		return nil, err
+	}
+	s.auth.recordEvent(ctx, user.ID, EventUserProvisioned, map[string]string{
+		"actor_id": actorID,
+		"username": username,
+	})
+	if user.SuspendedAt != nil {
+		s.auth.recordEvent(ctx, user.ID, EventUserSuspended, map[string]string{
+			"actor_id": actorID,
+			"reason":   scimSuspensionReason,
+		})
+	}
+	return s.GetUser(ctx, user.ID)
+}
+
+// ReplaceUser sets every attribute of the user to those of resource, as for
+// PUT.
+func (s *SCIMService) ReplaceUser(ctx context.Context, actorID, id string, resource *SCIMUser) (*SCIMUser, error) {
+	user, err := s.auth.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := changesFromResource(resource)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.applyUserChanges(ctx, actorID, user, changes); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, user.ID)
+}
+
+// PatchUser applies PATCH operations to the user. Attributes accounts do not
+// have, such as name parts or enterprise extension attributes, are ignored.
+func (s *SCIMService) PatchUser(ctx context.Context, actorID, id string, patch *SCIMPatchRequest) (*SCIMUser, error) {
+	user, err := s.auth.findUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes userChanges
+	for _, op := range patch.Operations {
+		if err := changes.applyPatch(op); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.applyUserChanges(ctx, actorID, user, changes); err != nil {
+		return nil, err
+	}
+	return s.GetUser(ctx, user.ID)
+}
+
+// DeleteUser deletes the account. Directories usually deactivate users
+// instead, which keeps their content and can be undone.
+func (s *SCIMService) DeleteUser(ctx context.Context, actorID, id string) error {
+	err := s.auth.DeleteUser(ctx, actorID, id)
+	if errors.Is(err, ErrManageSelf) {
+		return scimInvalid("mutability", err.Error())
+	}
+	return err
+}
+
+func (s *SCIMService) applyUserChanges(ctx context.Context, actorID string, user *repository.User, changes userChanges) error {
+	if changes.userName != nil && strings.TrimSpace(*changes.userName) != user.Username {
+		_, err := s.profile.ChangeUsername(ctx, user.ID, *changes.userName)
+		switch {
+		case errors.Is(err, ErrInvalidUsername):
+			return scimInvalid("invalidValue", err.Error())
+		case errors.Is(err, ErrUsernameTaken):
+			return scimConflict(err.Error())
+		case err != nil:
+			return err
+		}
+	}
+
+	if changes.email != nil && !strings.EqualFold(*changes.email, user.Email) {
+		if err := s.changeEmail(ctx, actorID, user.ID, *changes.email); err != nil {
+			return err
+		}
+	}
+
+	displayName := changes.displayName
+	if displayName == nil {
+		displayName = changes.formattedName
+	}
+	if displayName != nil && *displayName != user.DisplayName {
+		if !validDisplayName(*displayName) {
+			return scimInvalid("invalidValue", ErrInvalidDisplayName.Error())
+		}
+		if err := s.auth.userRepo.UpdateProfile(ctx, user.ID, *displayName, user.Bio, user.AvatarURL); err != nil {
+			return err
+		}
+		s.auth.recordEvent(ctx, user.ID, EventProfileUpdated, map[string]string{"actor_id": actorID})
+	}
+
+	if changes.password != nil {
+		passwordHash, err := s.hashPassword(*changes.password)
+		if err != nil {
+			return err
+		}
+		if err := s.auth.userRepo.UpdatePassword(ctx, user.ID, passwordHash); err != nil {
+			return err
+		}
+		s.auth.recordEvent(ctx, user.ID, EventPasswordChanged, map[string]string{"actor_id": actorID})
+	}
+
+	if changes.active != nil {
+		if *changes.active {
+			return s.reactivate(ctx, actorID, user)
+		}
+		return s.deactivate(ctx, actorID, user)
+	}
+	return nil
+}
+
+// changeEmail replaces the user's address with one the directory vouches
+// for, without a confirmation link.
+func (s *SCIMService) changeEmail(ctx context.Context, actorID, userID, email string) error {
+	if !validEmail(email) {
+		return scimInvalid("invalidValue", "emails must contain a valid address")
+	}
+	if owner, err := s.auth.userRepo.GetByEmail(ctx, email); err == nil && owner.ID != userID {
+		return scimConflict(ErrEmailTaken.Error())
+	}
+
+	if err := s.auth.userRepo.SetPendingEmail(ctx, userID, email); err != nil {
+		return err
+	}
+	err := s.auth.userRepo.ConfirmPendingEmail(ctx, userID)
+	if errors.Is(err, repository.ErrConflict) {
+		return scimConflict(ErrEmailTaken.Error())
+	}
+	if err != nil {
+		return err
+	}
+
+	s.auth.recordEvent(ctx, userID, EventEmailChanged, map[string]string{"actor_id": actorID})
+	return nil
+}
+
+func (s *SCIMService) hashPassword(password string) (string, error) {
+	if err := s.auth.passwords.Check(password); err != nil {
+		return "", scimInvalid("invalidValue", err.Error())
+	}
+	return s.auth.passwords.Hash(password)
+}
+
+// deactivate suspends user until the directory reactivates them. Users who
+// are already suspended are left as they are.
+func (s *SCIMService) deactivate(ctx context.Context, actorID string, user *repository.User) error {
+	if checkSuspended(user) != nil {
+		return nil
+	}
+	err := s.auth.SuspendUser(ctx, actorID, user.ID, scimSuspensionReason, nil)
+	if errors.Is(err, ErrManageSelf) {
+		return scimInvalid("mutability", "cannot deactivate the owner of the provisioning token")
+	}
+	return err
+}
+
+// reactivate lifts a suspension made by deactivate. Suspensions by
+// moderators stay in place, as directories send active with every update.
+func (s *SCIMService) reactivate(ctx context.Context, actorID string, user *repository.User) error {
+	if user.SuspendedAt == nil || user.SuspensionReason != scimSuspensionReason {
+		return nil
+	}
+	return s.auth.UnsuspendUser(ctx, actorID, user.ID)
+}
+
+func (s *SCIMService) toSCIMUser(ctx context.Context, user *repository.User) (*SCIMUser, error) {
+	roles, err := s.auth.roleRepo.GetUserRoles(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	active := checkSuspended(user) == nil
+	resource := &SCIMUser{
+		Schemas:     []string{SCIMUserSchema},
+		ID:          user.ID,
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Emails:      []SCIMMultiValue{{Value: user.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Meta: &SCIMMeta{
+			ResourceType: "User",
+			Created:      &user.CreatedAt,
+			LastModified: &user.UpdatedAt,
+			Location:     s.location("Users", user.ID),
+		},
+	}
+	if user.DisplayName != "" {
+		resource.Name = &SCIMName{Formatted: user.DisplayName}
+	}
+	for _, role := range roles {
+		resource.Groups = append(resource.Groups, SCIMMember{
+			Value:   role,
+			Display: role,
+			Ref:     s.location("Groups", role),
+		})
+	}
+	return resource, nil
+}
+
+// ListGroups returns the page of groups matching filter that starts at the
+// 1-based startIndex. members is false when the directory asked for groups
+// without their members.
+func (s *SCIMService) ListGroups(ctx context.Context, filter string, startIndex, count int, members bool) (*SCIMListResponse, error) {
+	f, err := parseSCIMFilter(filter, SCIMGroupSchema)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil && f.attribute != "displayname" && f.attribute != "id" {
+		return nil, scimInvalid("invalidFilter", "groups can only be filtered by id or displayName")
+	}
+	startIndex, count = scimPage(startIndex, count)
+
+	roles, err := s.auth.roleRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var matching []repository.Role
+	for _, role := range roles {
+		if f == nil || (f.attribute == "id" && role.Name == f.value) ||
+			(f.attribute == "displayname" && strings.EqualFold(role.Name, f.value)) {
+			matching = append(matching, role)
+		}
+	}
+
+	from := min(startIndex-1, len(matching))
+	to := min(from+count, len(matching))
+	resources := make([]SCIMGroup, 0, to-from)
+	for _, role := range matching[from:to] {
+		group, err := s.toSCIMGroup(ctx, role, members)
+		if err != nil {
+			return nil, err
+		}
+		resources = append(resources, *group)
+	}
+	return scimList(len(matching), startIndex, resources, len(resources)), nil
+}
+
+func (s *SCIMService) GetGroup(ctx context.Context, id string, members bool) (*SCIMGroup, error) {
+	role, err := s.findRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.toSCIMGroup(ctx, *role, members)
+}
+
+// CreateGroup creates a role without permissions for a directory group.
+// Permissions can then be granted to it like to any role.
+func (s *SCIMService) CreateGroup(ctx context.Context, actorID string, group *SCIMGroup) (*SCIMGroup, error) {
+	name := strings.TrimSpace(group.DisplayName)
+	if name == "" || utf8.RuneCountInString(name) > maxRoleNameLength || strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return nil, scimInvalid("invalidValue", "displayName must be 1 to 50 characters without control characters")
+	}
+
+	err := s.auth.roleRepo.Create(ctx, &repository.Role{Name: name, Description: "Directory group"})
+	if errors.Is(err, repository.ErrConflict) {
+		return nil, scimConflict("a group with this displayName already exists")
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.auth.recordEvent(ctx, actorID, EventRoleCreated, map[string]string{"role": name})
+
+	if err := s.setMembers(ctx, actorID, name, group.Members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, name, true)
+}
+
+// ReplaceGroup sets the members of the group, as for PUT. Groups cannot be
+// renamed.
+func (s *SCIMService) ReplaceGroup(ctx context.Context, actorID, id string, group *SCIMGroup) (*SCIMGroup, error) {
+	role, err := s.findRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkGroupName(role, group.DisplayName); err != nil {
+		return nil, err
+	}
+	if err := s.setMembers(ctx, actorID, role.Name, group.Members); err != nil {
+		return nil, err
+	}
+	return s.GetGroup(ctx, role.Name, true)
+}
+
+// PatchGroup adds, removes or replaces members of the group.
+func (s *SCIMService) PatchGroup(ctx context.Context, actorID, id string, patch *SCIMPatchRequest) (*SCIMGroup, error) {
+	role, err := s.findRole(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, op := range patch.Operations {
+		if err := s.patchGroup(ctx, actorID, role, op); err != nil {
+			return nil, err
+		}
+	}
+	return s.GetGroup(ctx, role.Name, true)
+}
+
+func (s *SCIMService) patchGroup(ctx context.Context, actorID string, role *repository.Role, op SCIMPatchOperation) error {
+	operation := strings.ToLower(op.Op)
+	if operation != "add" && operation != "replace" && operation != "remove" {
+		return scimInvalid("invalidSyntax", "unsupported patch operation "+op.Op)
+	}
+
+	// Without a path the value holds the attributes to change
+	if op.Path == "" {
+		if operation == "remove" {
+			return scimInvalid("noTarget", "remove needs a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scimInvalid("invalidValue", "value must be an object when there is no path")
+		}
+		for path, value := range values {
+			err := s.patchGroup(ctx, actorID, role, SCIMPatchOperation{Op: operation, Path: path, Value: value})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	attribute, filter := splitSCIMPath(op.Path, SCIMGroupSchema)
+	switch attribute {
+	case "displayname":
+		if operation == "remove" {
+			return scimInvalid("mutability", "displayName is required")
+		}
+		var name string
+		if err := json.Unmarshal(op.Value, &name); err != nil {
+			return scimInvalid("invalidValue", "displayName must be a string")
+		}
+		return checkGroupName(role, name)
+	case "members":
+	default:
+		// Directories send id and externalId along with a rename
+		return nil
+	}
+
+	// members[value eq "..."] selects one member
+	if filter != "" {
+		f, err := parseSCIMFilter(filter, "")
+		if err != nil || f.attribute != "value" || operation != "remove" {
+			return scimInvalid("invalidPath", "members can only be selected by value for remove")
+		}
+		return s.removeMembers(ctx, actorID, role.Name, []SCIMMember{{Value: f.value}})
+	}
+
+	var members []SCIMMember
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &members); err != nil {
+			return scimInvalid("invalidValue", "members must be a list of {\"value\": user ID}")
+		}
+	}
+	switch operation {
+	case "add":
+		return s.addMembers(ctx, actorID, role.Name, members)
+	case "replace":
+		return s.setMembers(ctx, actorID, role.Name, members)
+	}
+	if members == nil {
+		// Removing members without a value empties the group
+		current, err := s.auth.roleRepo.ListMembers(ctx, role.Name)
+		if err != nil {
+			return err
+		}
+		for _, member := range current {
+			members = append(members, SCIMMember{Value: member.UserID})
+		}
+	}
+	return s.removeMembers(ctx, actorID, role.Name, members)
+}
+
+// DeleteGroup deletes a group created for the directory. Roles that grant
+// permissions, including the built-in ones, cannot be deleted this way.
+func (s *SCIMService) DeleteGroup(ctx context.Context, actorID, id string) error {
+	role, err := s.findRole(ctx, id)
+	if err != nil {
+		return err
+	}
+	if builtInRole(role.Name) || len(role.Permissions) > 0 {
+		return scimInvalid("mutability", "groups that grant permissions cannot be deleted")
+	}
+
+	if err := s.auth.roleRepo.Delete(ctx, role.Name); err != nil {
+		return err
+	}
+	s.auth.recordEvent(ctx, actorID, EventRoleDeleted, map[string]string{"role": role.Name})
+	return nil
+}
+
+// setMembers makes members the exact membership of role.
+func (s *SCIMService) setMembers(ctx context.Context, actorID, role string, members []SCIMMember) error {
+	current, err := s.auth.roleRepo.ListMembers(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	wanted := make(map[string]bool, len(members))
+	for _, member := range members {
+		wanted[member.Value] = true
+	}
+	var removed []SCIMMember
+	for _, member := range current {
+		if !wanted[member.UserID] {
+			removed = append(removed, SCIMMember{Value: member.UserID})
+		}
+	}
+
+	if err := s.addMembers(ctx, actorID, role, members); err != nil {
+		return err
+	}
+	return s.removeMembers(ctx, actorID, role, removed)
+}
+
+func (s *SCIMService) addMembers(ctx context.Context, actorID, role string, members []SCIMMember) error {
+	current, err := s.auth.roleRepo.ListMembers(ctx, role)
+	if err != nil {
+		return err
+	}
+	isMember := make(map[string]bool, len(current))
+	for _, member := range current {
+		isMember[member.UserID] = true
+	}
+
+	for _, member := range members {
+		if isMember[member.Value] {
+			continue
+		}
+		err := s.auth.AssignRole(ctx, actorID, member.Value, role)
+		if errors.Is(err, repository.ErrNotFound) {
+			return scimInvalid("invalidValue", "unknown member "+member.Value)
+		}
+		if err != nil {
+			return err
+		}
+		isMember[member.Value] = true
+	}
+	return nil
+}
+
+func (s *SCIMService) removeMembers(ctx context.Context, actorID, role string, members []SCIMMember) error {
+	for _, member := range members {
+		err := s.auth.RevokeRole(ctx, actorID, member.Value, role)
+		switch {
+		case errors.Is(err, ErrRevokeOwnAdmin):
+			return scimInvalid("mutability", err.Error())
+		case errors.Is(err, repository.ErrNotFound):
+			// Removing someone who is not a member changes nothing
+		case err != nil:
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SCIMService) findRole(ctx context.Context, name string) (*repository.Role, error) {
+	roles, err := s.auth.roleRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		if roles[i].Name == name {
+			return &roles[i], nil
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *SCIMService) toSCIMGroup(ctx context.Context, role repository.Role, members bool) (*SCIMGroup, error) {
+	group := &SCIMGroup{
+		Schemas:     []string{SCIMGroupSchema},
+		ID:          role.Name,
+		DisplayName: role.Name,
+		Meta: &SCIMMeta{
+			ResourceType: "Group",
+			Location:     s.location("Groups", role.Name),
+		},
+	}
+	if !members {
+		return group, nil
+	}
+
+	roleMembers, err := s.auth.roleRepo.ListMembers(ctx, role.Name)
+	if err != nil {
+		return nil, err
+	}
+	for _, member := range roleMembers {
+		group.Members = append(group.Members, SCIMMember{
+			Value:   member.UserID,
+			Display: member.Username,
+			Ref:     s.location("Users", member.UserID),
+		})
+	}
+	return group, nil
+}
+
+func (s *SCIMService) location(resourceType, id string) string {
+	return strings.TrimRight(s.config.OAuthIssuer, "/") + "/scim/v2/" + resourceType + "/" + url.PathEscape(id)
+}
+
+func checkGroupName(role *repository.Role, name string) error {
+	if name != "" && name != role.Name {
+		return scimInvalid("mutability", "groups cannot be renamed")
+	}
+	return nil
+}
+
+func builtInRole(name string) bool {
+	return name == RoleUser || name == RoleModerator || name == RoleAdmin
+}
+
+// userChanges are the attributes a request sets. Nil fields are left as
+// they are.
+type userChanges struct {
+	userName    *string
+	email       *string
+	displayName *string
+	// formattedName is name.formatted, used when displayName is not set.
+	formattedName *string
+	active        *bool
+	password      *string
+}
+
+// changesFromResource sets every attribute from a full resource, as sent to
+// create or replace a user.
+func changesFromResource(resource *SCIMUser) (userChanges, error) {
+	if strings.TrimSpace(resource.UserName) == "" {
+		return userChanges{}, scimInvalid("invalidValue", "userName is required")
+	}
+	email := primaryEmail(resource.Emails)
+	if email == "" {
+		return userChanges{}, scimInvalid("invalidValue", "an email address is required")
+	}
+
+	displayName := strings.TrimSpace(resource.DisplayName)
+	if displayName == "" && resource.Name != nil {
+		displayName = resource.Name.Formatted
+		if displayName == "" {
+			displayName = strings.TrimSpace(resource.Name.GivenName + " " + resource.Name.FamilyName)
+		}
+	}
+	active := resource.Active == nil || *resource.Active
+
+	changes := userChanges{
+		userName:    &resource.UserName,
+		email:       &email,
+		displayName: &displayName,
+		active:      &active,
+	}
+	if resource.Password != "" {
+		changes.password = &resource.Password
+	}
+	return changes, nil
+}
+
+// applyPatch records the change one PATCH operation makes.
+func (c *userChanges) applyPatch(op SCIMPatchOperation) error {
+	operation := strings.ToLower(op.Op)
+	if operation != "add" && operation != "replace" && operation != "remove" {
+		return scimInvalid("invalidSyntax", "unsupported patch operation "+op.Op)
+	}
+
+	if op.Path == "" {
+		if operation == "remove" {
+			return scimInvalid("noTarget", "remove needs a path")
+		}
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(op.Value, &values); err != nil {
+			return scimInvalid("invalidValue", "value must be an object when there is no path")
+		}
+		for path, value := range values {
+			if err := c.set(path, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if operation == "remove" {
+		return c.remove(op.Path)
+	}
+	return c.set(op.Path, op.Value)
+}
+
+func (c *userChanges) set(path string, value json.RawMessage) error {
+	attribute, _ := splitSCIMPath(path, SCIMUserSchema)
+	attribute, sub, _ := strings.Cut(attribute, ".")
+
+	switch attribute {
+	case "username":
+		return scimString(value, "userName", &c.userName)
+	case "displayname":
+		return scimString(value, "displayName", &c.displayName)
+	case "password":
+		return scimString(value, "password", &c.password)
+	case "active":
+		active, err := scimBool(value)
+		if err != nil {
+			return err
+		}
+		c.active = &active
+	case "name":
+		if sub == "formatted" {
+			return scimString(value, "name.formatted", &c.formattedName)
+		}
+		if sub == "" {
+			var name SCIMName
+			if err := json.Unmarshal(value, &name); err != nil {
+				return scimInvalid("invalidValue", "name must be an object")
+			}
+			if name.Formatted != "" {
+				c.formattedName = &name.Formatted
+			}
+		}
+	case "emails":
+		if sub == "value" {
+			return scimString(value, "emails.value", &c.email)
+		}
+		var emails []SCIMMultiValue
+		if err := json.Unmarshal(value, &emails); err != nil {
+			return scimInvalid("invalidValue", "emails must be a list")
+		}
+		if email := primaryEmail(emails); email != "" {
+			c.email = &email
+		}
+	}
+	return nil
+}
+
+func (c *userChanges) remove(path string) error {
+	attribute, _ := splitSCIMPath(path, SCIMUserSchema)
+	empty := ""
+	switch attribute {
+	case "displayname":
+		c.displayName = &empty
+	case "name", "name.formatted":
+		c.formattedName = &empty
+	case "username", "emails", "emails.value", "active", "password":
+		return scimInvalid("mutability", path+" cannot be removed")
+	}
+	return nil
+}
+
+// scimFilter is an equality filter, `attribute eq "value"`, which is what
+// directories use to look resources up. Other filters are not supported.
+type scimFilter struct {
+	// attribute is lower case, without the schema URN.
+	attribute string
+	value     string
+}
+
+func parseSCIMFilter(filter, schema string) (*scimFilter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, nil
+	}
+
+	attribute, rest, ok := strings.Cut(filter, " ")
+	operator, value, ok2 := strings.Cut(strings.TrimSpace(rest), " ")
+	if !ok || !ok2 || !strings.EqualFold(operator, "eq") {
+		return nil, scimInvalid("invalidFilter", `only filters of the form attribute eq "value" are supported`)
+	}
+
+	var parsed string
+	if err := json.Unmarshal([]byte(strings.TrimSpace(value)), &parsed); err != nil {
+		return nil, scimInvalid("invalidFilter", "the filter value must be a quoted string")
+	}
+	attribute, _ = splitSCIMPath(attribute, schema)
+	return &scimFilter{attribute: attribute, value: parsed}, nil
+}
+
+// splitSCIMPath returns the lower-case attribute of a path, without the
+// schema URN or a value filter, and the filter between the brackets if there
+// is one. emails[type eq "work"].value is returned as emails.value.
+func splitSCIMPath(path, schema string) (string, string) {
+	if schema != "" && len(path) > len(schema) && strings.EqualFold(path[:len(schema)+1], schema+":") {
+		path = path[len(schema)+1:]
+	}
+
+	var filter string
+	if open := strings.Index(path, "["); open >= 0 {
+		if end := strings.Index(path[open:], "]"); end >= 0 {
+			filter = path[open+1 : open+end]
+			path = path[:open] + path[open+end+1:]
+		}
+	}
+	return strings.ToLower(path), filter
+}
+
+func scimString(value json.RawMessage, attribute string, target **string) error {
+	var s string
+	if err := json.Unmarshal(value, &s); err != nil {
+		return scimInvalid("invalidValue", attribute+" must be a string")
+	}
+	*target = &s
+	return nil
+}
+
+// scimBool parses a boolean. Some directories send "True" and "False" as
+// strings.
+func scimBool(value json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(value, &b); err == nil {
+		return b, nil
+	}
+	var s string
+	if err := json.Unmarshal(value, &s); err == nil {
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b, nil
+		}
+	}
+	return false, scimInvalid("invalidValue", "active must be a boolean")
+}
+
+// primaryEmail returns the primary address, or the first one if none is
+// marked primary.
+func primaryEmail(emails []SCIMMultiValue) string {
+	for _, email := range emails {
+		if email.Primary {
+			return strings.TrimSpace(email.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return strings.TrimSpace(emails[0].Value)
+	}
+	return ""
+}
+
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
+
+func validDisplayName(name string) bool {
+	return utf8.RuneCountInString(name) <= maxDisplayNameLength && strings.IndexFunc(name, unicode.IsControl) < 0
+}
+
+// scimPage applies the paging rules of RFC 7644 section 3.4.2.4: startIndex
+// is 1-based and count is at most SCIMMaxResults.
+func scimPage(startIndex, count int) (int, int) {
+	if startIndex < 1 {
+		startIndex = 1
+	}
+	return startIndex, max(0, min(count, SCIMMaxResults))
+}
+
+func scimList(total, startIndex int, resources interface{}, items int) *SCIMListResponse {
+	return &SCIMListResponse{
+		Schemas:      []string{SCIMListSchema},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: items,
+		Resources:    resources,
+	}
+}
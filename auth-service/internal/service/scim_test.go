@@ -0,0 +1,364 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// Payloads as sent by Okta and Microsoft Entra ID.
+const (
+	oktaCreateUser = `{
+		"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"],
+		"userName": "alice",
+		"name": {"givenName": "Alice", "familyName": "Smith"},
+		"emails": [{"primary": true, "value": "alice@example.com", "type": "work"}],
+		"displayName": "Alice Smith",
+		"locale": "en-US",
+		"externalId": "00u1ab2cd3EfGhIjK4x7",
+		"groups": [],
+		"active": true
+	}`
+	entraDeactivateUser = `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": "False"}]
+	}`
+	entraReactivateUser = `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{"op": "Replace", "path": "active", "value": "True"}]
+	}`
+	oktaUpdateUser = `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [{
+			"op": "replace",
+			"value": {
+				"name.formatted": "Alice Jones",
+				"emails[type eq \"work\"].value": "alice.jones@example.com",
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department": "Sales"
+			}
+		}]
+	}`
+	entraGroupMembers = `{
+		"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"],
+		"Operations": [
+			{"op": "Add", "path": "members", "value": [{"value": "%s"}]},
+			{"op": "Remove", "path": "members[value eq \"%s\"]"}
+		]
+	}`
+)
+
+type scimTestDeps struct {
+	userRepo  *MockUserRepository
+	tokenRepo *MockTokenRepository
+	roleRepo  *MockRoleRepository
+	eventRepo *MockSecurityEventRepository
+}
+
+func newSCIMTestService() (*SCIMService, scimTestDeps) {
+	deps := scimTestDeps{
+		userRepo:  new(MockUserRepository),
+		tokenRepo: new(MockTokenRepository),
+		roleRepo:  new(MockRoleRepository),
+		eventRepo: new(MockSecurityEventRepository),
+	}
+	deps.eventRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+	cfg := newTestConfig()
+	cfg.OAuthIssuer = "https://auth.example.com"
+	authService := NewAuthService(deps.userRepo, deps.tokenRepo, deps.roleRepo, deps.eventRepo, newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+	profileService := NewProfileService(authService, nil, new(MockOneTimeTokenRepository), new(MockExternalIdentityRepository))
+	return NewSCIMService(authService, profileService, cfg), deps
+}
+
+func decodeSCIM(t *testing.T, payload string, v interface{}) {
+	t.Helper()
+	require.NoError(t, json.Unmarshal([]byte(payload), v))
+}
+
+func requireSCIMError(t *testing.T, err error, status int, scimType string) {
+	t.Helper()
+	var scimErr *SCIMError
+	require.ErrorAs(t, err, &scimErr)
+	assert.Equal(t, status, scimErr.Status)
+	assert.Equal(t, scimType, scimErr.Type)
+}
+
+func TestSCIMService_CreateUser(t *testing.T) {
+	ctx := context.Background()
+	adminID := uuid.New().String()
+
+	t.Run("provisions a verified account", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		created := &repository.User{Username: "alice", Email: "alice@example.com", DisplayName: "Alice Smith"}
+
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice").Return(nil, repository.ErrNotFound)
+		deps.userRepo.On("PreviousOwner", mock.Anything, "alice").Return("", repository.ErrNotFound)
+		deps.userRepo.On("GetByEmail", mock.Anything, "alice@example.com").Return(nil, repository.ErrNotFound)
+		deps.userRepo.On("CreateWithRole", mock.Anything, mock.MatchedBy(func(user *repository.User) bool {
+			return user.Username == "alice" && user.Email == "alice@example.com" && user.PasswordHash == "" &&
+				user.EmailVerifiedAt != nil && user.DisplayName == "Alice Smith" && user.SuspendedAt == nil
+		}), RoleUser, adminID).Run(func(args mock.Arguments) {
+			user := args.Get(1).(*repository.User)
+			user.ID = uuid.New().String()
+			created.ID = user.ID
+		}).Return(nil)
+		deps.userRepo.On("GetByID", mock.Anything, mock.Anything).Return(created, nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{RoleUser}, nil)
+
+		var resource SCIMUser
+		decodeSCIM(t, oktaCreateUser, &resource)
+		user, err := service.CreateUser(ctx, adminID, &resource)
+		require.NoError(t, err)
+
+		assert.Equal(t, created.ID, user.ID)
+		assert.Equal(t, "alice", user.UserName)
+		assert.Equal(t, []SCIMMultiValue{{Value: "alice@example.com", Type: "work", Primary: true}}, user.Emails)
+		assert.True(t, *user.Active)
+		assert.Equal(t, "https://auth.example.com/scim/v2/Users/"+created.ID, user.Meta.Location)
+		assert.Equal(t, []SCIMMember{{Value: RoleUser, Display: RoleUser, Ref: "https://auth.example.com/scim/v2/Groups/user"}}, user.Groups)
+		deps.userRepo.AssertExpectations(t)
+		deps.eventRepo.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.Type == EventUserProvisioned && event.Details["actor_id"] == adminID
+		}))
+	})
+
+	t.Run("inactive accounts are created suspended", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		created := &repository.User{}
+
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice").Return(nil, repository.ErrNotFound)
+		deps.userRepo.On("PreviousOwner", mock.Anything, "alice").Return("", repository.ErrNotFound)
+		deps.userRepo.On("GetByEmail", mock.Anything, "alice@example.com").Return(nil, repository.ErrNotFound)
+		deps.userRepo.On("CreateWithRole", mock.Anything, mock.MatchedBy(func(user *repository.User) bool {
+			return user.SuspendedAt != nil && user.SuspensionReason == scimSuspensionReason
+		}), RoleUser, adminID).Run(func(args mock.Arguments) {
+			user := args.Get(1).(*repository.User)
+			user.ID = uuid.New().String()
+			*created = *user
+		}).Return(nil)
+		deps.userRepo.On("GetByID", mock.Anything, mock.Anything).Return(created, nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{RoleUser}, nil)
+
+		var resource SCIMUser
+		decodeSCIM(t, strings.Replace(oktaCreateUser, `"active": true`, `"active": false`, 1), &resource)
+		user, err := service.CreateUser(ctx, adminID, &resource)
+		require.NoError(t, err)
+
+		assert.False(t, *user.Active)
+		deps.userRepo.AssertExpectations(t)
+		deps.userRepo.AssertNotCalled(t, "Suspend", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		deps.eventRepo.AssertCalled(t, "Create", mock.Anything, mock.MatchedBy(func(event *repository.SecurityEvent) bool {
+			return event.Type == EventUserSuspended && event.Details["reason"] == scimSuspensionReason
+		}))
+	})
+
+	t.Run("taken usernames are a uniqueness error", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice").Return(&repository.User{ID: uuid.New().String()}, nil)
+
+		var resource SCIMUser
+		decodeSCIM(t, oktaCreateUser, &resource)
+		_, err := service.CreateUser(ctx, adminID, &resource)
+		requireSCIMError(t, err, http.StatusConflict, "uniqueness")
+	})
+
+	t.Run("an email address is required", func(t *testing.T) {
+		service, _ := newSCIMTestService()
+
+		_, err := service.CreateUser(ctx, adminID, &SCIMUser{UserName: "alice"})
+		requireSCIMError(t, err, http.StatusBadRequest, "invalidValue")
+	})
+}
+
+func TestSCIMService_ListUsers(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("filters by userName", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com"}
+		deps.userRepo.On("GetByUsername", mock.Anything, "alice").Return(user, nil)
+		deps.userRepo.On("GetByUsername", mock.Anything, "bob").Return(nil, repository.ErrNotFound)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		list, err := service.ListUsers(ctx, `userName eq "alice"`, 1, 100)
+		require.NoError(t, err)
+		assert.Equal(t, 1, list.TotalResults)
+		assert.Equal(t, user.ID, list.Resources.([]SCIMUser)[0].ID)
+
+		list, err = service.ListUsers(ctx, `userName eq "bob"`, 1, 100)
+		require.NoError(t, err)
+		assert.Equal(t, 0, list.TotalResults)
+		assert.Empty(t, list.Resources)
+	})
+
+	t.Run("pages through all users", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		users := []repository.User{
+			{ID: uuid.New().String(), Username: "carol"},
+			{ID: uuid.New().String(), Username: "dave"},
+		}
+		deps.userRepo.On("List", mock.Anything, repository.UserFilter{Limit: 2, Offset: 2}).Return(users, 5, nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{RoleUser}, nil)
+
+		list, err := service.ListUsers(ctx, "", 3, 2)
+		require.NoError(t, err)
+		assert.Equal(t, []string{SCIMListSchema}, list.Schemas)
+		assert.Equal(t, 5, list.TotalResults)
+		assert.Equal(t, 3, list.StartIndex)
+		assert.Equal(t, 2, list.ItemsPerPage)
+	})
+
+	t.Run("unsupported filters are rejected", func(t *testing.T) {
+		service, _ := newSCIMTestService()
+
+		_, err := service.ListUsers(ctx, `userName co "al"`, 1, 100)
+		requireSCIMError(t, err, http.StatusBadRequest, "invalidFilter")
+		_, err = service.ListUsers(ctx, `title eq "CEO"`, 1, 100)
+		requireSCIMError(t, err, http.StatusBadRequest, "invalidFilter")
+	})
+}
+
+func TestSCIMService_PatchUser(t *testing.T) {
+	ctx := context.Background()
+	adminID := uuid.New().String()
+
+	t.Run("deactivation suspends and logs out", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		user := &repository.User{ID: uuid.New().String(), Username: "alice"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("Suspend", mock.Anything, user.ID, scimSuspensionReason, (*time.Time)(nil)).Return(nil)
+		deps.userRepo.On("SetTokensValidAfter", mock.Anything, user.ID, mock.AnythingOfType("time.Time")).Return(nil)
+		deps.tokenRepo.On("DeleteAllForUser", mock.Anything, user.ID).Return(nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		var patch SCIMPatchRequest
+		decodeSCIM(t, entraDeactivateUser, &patch)
+		_, err := service.PatchUser(ctx, adminID, user.ID, &patch)
+		require.NoError(t, err)
+		deps.userRepo.AssertExpectations(t)
+		deps.tokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("reactivation only lifts deprovisioning", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deprovisioned := suspendedUser(nil)
+		deprovisioned.SuspensionReason = scimSuspensionReason
+		banned := suspendedUser(nil)
+		deps.userRepo.On("GetByID", mock.Anything, deprovisioned.ID).Return(deprovisioned, nil)
+		deps.userRepo.On("GetByID", mock.Anything, banned.ID).Return(banned, nil)
+		deps.userRepo.On("Unsuspend", mock.Anything, deprovisioned.ID).Return(nil).Once()
+		deps.roleRepo.On("GetUserRoles", mock.Anything, mock.Anything).Return([]string{RoleUser}, nil)
+
+		var patch SCIMPatchRequest
+		decodeSCIM(t, entraReactivateUser, &patch)
+		_, err := service.PatchUser(ctx, adminID, deprovisioned.ID, &patch)
+		require.NoError(t, err)
+
+		user, err := service.PatchUser(ctx, adminID, banned.ID, &patch)
+		require.NoError(t, err)
+		assert.False(t, *user.Active)
+		deps.userRepo.AssertNotCalled(t, "Unsuspend", mock.Anything, banned.ID)
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("attributes without a path", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		user := &repository.User{ID: uuid.New().String(), Username: "alice", Email: "alice@example.com", DisplayName: "Alice Smith"}
+		deps.userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+		deps.userRepo.On("GetByEmail", mock.Anything, "alice.jones@example.com").Return(nil, repository.ErrNotFound)
+		deps.userRepo.On("SetPendingEmail", mock.Anything, user.ID, "alice.jones@example.com").Return(nil)
+		deps.userRepo.On("ConfirmPendingEmail", mock.Anything, user.ID).Return(nil)
+		deps.userRepo.On("UpdateProfile", mock.Anything, user.ID, "Alice Jones", "", "").Return(nil)
+		deps.roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+
+		var patch SCIMPatchRequest
+		decodeSCIM(t, oktaUpdateUser, &patch)
+		_, err := service.PatchUser(ctx, adminID, user.ID, &patch)
+		require.NoError(t, err)
+		deps.userRepo.AssertExpectations(t)
+	})
+
+	t.Run("unknown users", func(t *testing.T) {
+		service, _ := newSCIMTestService()
+
+		_, err := service.PatchUser(ctx, adminID, "not-a-uuid", &SCIMPatchRequest{})
+		assert.ErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestSCIMService_Groups(t *testing.T) {
+	ctx := context.Background()
+	adminID := uuid.New().String()
+	alice := &repository.User{ID: uuid.New().String(), Username: "alice"}
+	bob := &repository.User{ID: uuid.New().String(), Username: "bob"}
+	roles := []repository.Role{
+		{Name: RoleUser, Permissions: []string{}},
+		{Name: RoleAdmin, Permissions: []string{PermissionUsersManage}},
+		{Name: "engineering", Description: "Directory group"},
+	}
+
+	t.Run("patch adds and removes members", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deps.roleRepo.On("List", mock.Anything).Return(roles, nil)
+		deps.roleRepo.On("ListMembers", mock.Anything, "engineering").Return([]repository.RoleMember{{UserID: bob.ID, Username: "bob"}}, nil)
+		deps.userRepo.On("GetByID", mock.Anything, alice.ID).Return(alice, nil)
+		deps.roleRepo.On("Assign", mock.Anything, alice.ID, "engineering", adminID).Return(nil).Once()
+		deps.roleRepo.On("Revoke", mock.Anything, bob.ID, "engineering").Return(nil).Once()
+
+		var patch SCIMPatchRequest
+		decodeSCIM(t, fmt.Sprintf(entraGroupMembers, alice.ID, bob.ID), &patch)
+		group, err := service.PatchGroup(ctx, adminID, "engineering", &patch)
+		require.NoError(t, err)
+		assert.Equal(t, "engineering", group.DisplayName)
+		deps.roleRepo.AssertExpectations(t)
+	})
+
+	t.Run("lists groups by displayName", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deps.roleRepo.On("List", mock.Anything).Return(roles, nil)
+
+		list, err := service.ListGroups(ctx, `displayName eq "Engineering"`, 1, 100, false)
+		require.NoError(t, err)
+		assert.Equal(t, 1, list.TotalResults)
+		assert.Equal(t, "engineering", list.Resources.([]SCIMGroup)[0].ID)
+
+		list, err = service.ListGroups(ctx, "", 2, 1, false)
+		require.NoError(t, err)
+		assert.Equal(t, 3, list.TotalResults)
+		assert.Equal(t, RoleAdmin, list.Resources.([]SCIMGroup)[0].ID)
+	})
+
+	t.Run("groups cannot be renamed or duplicated", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deps.roleRepo.On("List", mock.Anything).Return(roles, nil)
+		deps.roleRepo.On("Create", mock.Anything, mock.Anything).Return(repository.ErrConflict)
+
+		_, err := service.ReplaceGroup(ctx, adminID, "engineering", &SCIMGroup{DisplayName: "sales"})
+		requireSCIMError(t, err, http.StatusBadRequest, "mutability")
+		_, err = service.CreateGroup(ctx, adminID, &SCIMGroup{DisplayName: "engineering"})
+		requireSCIMError(t, err, http.StatusConflict, "uniqueness")
+	})
+
+	t.Run("only directory groups can be deleted", func(t *testing.T) {
+		service, deps := newSCIMTestService()
+		deps.roleRepo.On("List", mock.Anything).Return(roles, nil)
+		deps.roleRepo.On("Delete", mock.Anything, "engineering").Return(nil).Once()
+
+		require.NoError(t, service.DeleteGroup(ctx, adminID, "engineering"))
+		requireSCIMError(t, service.DeleteGroup(ctx, adminID, RoleUser), http.StatusBadRequest, "mutability")
+		requireSCIMError(t, service.DeleteGroup(ctx, adminID, RoleAdmin), http.StatusBadRequest, "mutability")
+		assert.ErrorIs(t, service.DeleteGroup(ctx, adminID, "sales"), repository.ErrNotFound)
+		deps.roleRepo.AssertExpectations(t)
+	})
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnknownSession is returned when the caller's access token does not name
+// the session it belongs to, which is the case for tokens minted before
+// sessions were tracked.
+var ErrUnknownSession = errors.New("current session is unknown, please log in again")
+
+func (s *AuthService) ListSessions(ctx context.Context, userID string) ([]repository.Session, error) {
+	return s.tokenRepo.ListSessions(ctx, userID)
+}
+
+// RevokeSession logs userID out of one session.
+func (s *AuthService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return repository.ErrNotFound
+	}
+	if err := s.tokenRepo.DeleteSession(ctx, userID, sessionID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventLoggedOut, map[string]string{"session_id": sessionID})
+	return nil
+}
+
+// RevokeOtherSessions logs userID out everywhere except currentSessionID.
+func (s *AuthService) RevokeOtherSessions(ctx context.Context, userID, currentSessionID string) error {
+	if currentSessionID == "" {
+		return ErrUnknownSession
+	}
+	if err := s.tokenRepo.DeleteOtherSessions(ctx, userID, currentSessionID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventLoggedOut, map[string]string{"other_sessions": "true", "session_id": currentSessionID})
+	return nil
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+)
+
+const EventAccountLocked = "account_locked"
+
+// ErrTooManyAttempts matches every RateLimitError.
+var ErrTooManyAttempts = errors.New("too many failed attempts")
+
+// RateLimitError is returned while a login is throttled. RetryAfter is how
+// long the caller has to wait before trying again.
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return "too many failed attempts, try again later"
+}
+
+func (e *RateLimitError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// throttleKey is one counter checked for a login attempt, with the limits
+// that apply to it.
+type throttleKey struct {
+	key              string
+	freeAttempts     int
+	lockoutThreshold int
+	// account marks the per-account key, which is cleared on success.
+	account bool
+}
+
+func (s *AuthService) accountThrottleKey(prefix, id string) throttleKey {
+	return throttleKey{
+		key:              prefix + ":" + strings.ToLower(id),
+		freeAttempts:     s.config.LoginFreeAttempts,
+		lockoutThreshold: s.config.LoginLockoutThreshold,
+		account:          true,
+	}
+}
+
+// loginThrottleKeys returns the per-account key for username and, when the
+// client address is known, the per-IP key.
+func (s *AuthService) loginThrottleKeys(ctx context.Context, username string) []throttleKey {
+	keys := []throttleKey{s.accountThrottleKey("user", username)}
+	if ip := ClientInfoFromContext(ctx).IPAddress; ip != "" {
+		keys = append(keys, throttleKey{
+			key:              "ip:" + ip,
+			freeAttempts:     s.config.LoginIPFreeAttempts,
+			lockoutThreshold: s.config.LoginIPLockoutThreshold,
+		})
+	}
+	return keys
+}
+
+// checkThrottle returns a RateLimitError if any of keys is locked.
+func (s *AuthService) checkThrottle(ctx context.Context, keys []throttleKey) error {
+	var wait time.Duration
+	for _, k := range keys {
+		attempt, err := s.attemptRepo.Get(ctx, k.key)
+		if err != nil {
+			return err
+		}
+		if d := time.Until(attempt.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		return &RateLimitError{RetryAfter: wait}
+	}
+	return nil
+}
+
+// recordFailure counts a failed attempt against every key and locks the
+// ones that are over their limits.
+func (s *AuthService) recordFailure(ctx context.Context, keys []throttleKey, userID string) error {
+	for _, k := range keys {
+		failures, err := s.attemptRepo.RecordFailure(ctx, k.key, s.config.LoginFailureWindow)
+		if err != nil {
+			return err
+		}
+
+		delay := s.backoff(failures, k)
+		if delay == 0 {
+			continue
+		}
+		if err := s.attemptRepo.Lock(ctx, k.key, time.Now().Add(delay)); err != nil {
+			return err
+		}
+
+		if failures == k.lockoutThreshold {
+			s.recordEvent(ctx, userID, EventAccountLocked, map[string]string{
+				"key":   k.key,
+				"until": time.Now().Add(delay).UTC().Format(time.RFC3339),
+			})
+		}
+	}
+	return nil
+}
+
+// resetThrottle clears the per-account counters after a successful login.
+// Per-IP counters are left alone so that an attacker cannot reset them by
+// logging into an account of their own.
+func (s *AuthService) resetThrottle(ctx context.Context, keys []throttleKey) error {
+	for _, k := range keys {
+		if !k.account {
+			continue
+		}
+		if err := s.attemptRepo.Reset(ctx, k.key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backoff returns how long a key is locked after its nth consecutive failure.
+func (s *AuthService) backoff(failures int, k throttleKey) time.Duration {
+	if k.lockoutThreshold > 0 && failures >= k.lockoutThreshold {
+		return s.config.LoginLockoutDuration
+	}
+	if failures <= k.freeAttempts {
+		return 0
+	}
+
+	delay := s.config.LoginBackoffBase
+	for i := k.freeAttempts + 1; i < failures && delay < s.config.LoginBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > s.config.LoginBackoffMax {
+		delay = s.config.LoginBackoffMax
+	}
+	return delay
+}
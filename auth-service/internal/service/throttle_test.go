@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestAuthService_Backoff(t *testing.T) {
+	service := NewAuthService(new(MockUserRepository), new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), repository.NewInMemoryLoginAttemptRepository(), new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+	key := service.accountThrottleKey("user", "testuser")
+
+	assert.Equal(t, time.Duration(0), service.backoff(3, key))
+	assert.Equal(t, time.Second, service.backoff(4, key))
+	assert.Equal(t, 2*time.Second, service.backoff(5, key))
+	assert.Equal(t, 32*time.Second, service.backoff(9, key))
+	assert.Equal(t, 15*time.Minute, service.backoff(10, key), "lockout")
+
+	// Backoff is capped below the lockout threshold
+	key.lockoutThreshold = 0
+	assert.Equal(t, time.Minute, service.backoff(50, key))
+}
+
+func TestAuthService_LoginThrottling(t *testing.T) {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	user := &repository.User{
+		ID:           uuid.New().String(),
+		Username:     "testuser",
+		PasswordHash: string(hashedPassword),
+	}
+
+	t.Run("account is throttled after repeated failures", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		eventRepo := newMockSecurityEventRepository()
+		attempts := repository.NewInMemoryLoginAttemptRepository()
+		cfg := newTestConfig()
+		cfg.LoginLockoutThreshold = 4
+		service := NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), eventRepo, newMockMFARepository(), attempts, new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		eventRepo.On("Create", mock.Anything, mock.MatchedBy(func(e *repository.SecurityEvent) bool {
+			return e.Type == EventAccountLocked && e.UserID == user.ID
+		})).Return(nil).Once()
+
+		for i := 0; i < 4; i++ {
+			_, err := service.Login(context.Background(), "testuser", "wrong")
+			assert.EqualError(t, err, "invalid credentials")
+		}
+
+		// Even the right password is refused while locked
+		_, err := service.Login(context.Background(), "TestUser", "password123")
+		var rateErr *RateLimitError
+		if assert.True(t, errors.As(err, &rateErr)) {
+			assert.InDelta(t, cfg.LoginLockoutDuration.Seconds(), rateErr.RetryAfter.Seconds(), 5)
+		}
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+
+		eventRepo.AssertExpectations(t)
+	})
+
+	t.Run("successful login resets the account counter", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		roleRepo := new(MockRoleRepository)
+		tokenRepo := new(MockTokenRepository)
+		attempts := repository.NewInMemoryLoginAttemptRepository()
+		service := NewAuthService(userRepo, tokenRepo, roleRepo, newMockSecurityEventRepository(), newMockMFARepository(), attempts, new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, newTestConfig())
+
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.7"})
+		for i := 0; i < 3; i++ {
+			_, err := service.Login(ctx, "testuser", "wrong")
+			assert.Error(t, err)
+		}
+
+		_, err := service.Login(ctx, "testuser", "password123")
+		assert.NoError(t, err)
+
+		account, _ := attempts.Get(ctx, "user:testuser")
+		assert.Equal(t, 0, account.Failures)
+
+		ip, _ := attempts.Get(ctx, "ip:203.0.113.7")
+		assert.Equal(t, 3, ip.Failures)
+	})
+
+	t.Run("client address is throttled across accounts", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		attempts := repository.NewInMemoryLoginAttemptRepository()
+		cfg := newTestConfig()
+		cfg.LoginIPFreeAttempts = 2
+		service := NewAuthService(userRepo, new(MockTokenRepository), new(MockRoleRepository), newMockSecurityEventRepository(), newMockMFARepository(), attempts, new(MockPersonalAccessTokenRepository), newMockRevokedTokenRepository(), new(MockInviteCodeRepository), new(MockOAuthClientRepository), testKeys, testPasswords, cfg)
+
+		userRepo.On("GetByUsername", mock.Anything, mock.Anything).Return(nil, repository.ErrNotFound)
+
+		ctx := WithClientInfo(context.Background(), ClientInfo{IPAddress: "203.0.113.8"})
+		for _, username := range []string{"alice", "bob", "carol"} {
+			_, err := service.Login(ctx, username, "guess")
+			assert.EqualError(t, err, "invalid credentials")
+		}
+
+		_, err := service.Login(ctx, "dave", "guess")
+		assert.ErrorIs(t, err, ErrTooManyAttempts)
+	})
+}
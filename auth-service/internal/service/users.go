@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+)
+
+const (
+	EventUserSuspended   = "user_suspended"
+	EventUserUnsuspended = "user_unsuspended"
+	EventUserDeleted     = "user_deleted"
+)
+
+const (
+	defaultUserPageSize       = 20
+	maxUserPageSize           = 100
+	maxSuspensionReasonLength = 500
+)
+
+var (
+	ErrSuspensionReason  = errors.New("a suspension reason of at most 500 characters is required")
+	ErrSuspensionExpired = errors.New("suspension end must be in the future")
+	ErrManageSelf        = errors.New("cannot suspend or delete your own account")
+)
+
+// AccountSuspendedError is returned when a suspended user tries to log in or
+// use a token.
+type AccountSuspendedError struct {
+	Reason string
+	// Until is nil for a ban.
+	Until *time.Time
+}
+
+func (e *AccountSuspendedError) Error() string {
+	if e.Until == nil {
+		return "account is banned: " + e.Reason
+	}
+	return "account is suspended until " + e.Until.UTC().Format(time.RFC3339) + ": " + e.Reason
+}
+
+// UserDetails is what an administrator sees about one user.
+type UserDetails struct {
+	User     *repository.User
+	Roles    []string
+	Sessions []repository.Session
+}
+
+// checkSuspended returns an AccountSuspendedError if user is suspended.
+// Suspensions that have run out are ignored.
+func checkSuspended(user *repository.User) error {
+	if user.SuspendedAt == nil {
+		return nil
+	}
+	if user.SuspendedUntil != nil && time.Now().After(*user.SuspendedUntil) {
+		return nil
+	}
+	return &AccountSuspendedError{Reason: user.SuspensionReason, Until: user.SuspendedUntil}
+}
+
+// ListUsers returns a page of users and the total number matching filter.
+func (s *AuthService) ListUsers(ctx context.Context, filter repository.UserFilter) ([]repository.User, int, error) {
+	filter.Query = strings.TrimSpace(filter.Query)
+	if filter.Limit <= 0 {
+		filter.Limit = defaultUserPageSize
+	}
+	if filter.Limit > maxUserPageSize {
+		filter.Limit = maxUserPageSize
+	}
+	if filter.Offset < 0 {
+		filter.Offset = 0
+	}
+	return s.userRepo.List(ctx, filter)
+}
+
+// GetUserDetails returns a user with their roles and active sessions.
+func (s *AuthService) GetUserDetails(ctx context.Context, userID string) (*UserDetails, error) {
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UserDetails{User: user, Roles: roles, Sessions: sessions}, nil
+}
+
+// SuspendUser suspends userID until the given time, or bans them if until is
+// nil, and logs them out of every session. Access tokens already issued are
+// revoked, so they stay invalid after the suspension is lifted, but services
+// that verify them locally may accept them until they expire.
+func (s *AuthService) SuspendUser(ctx context.Context, actorID, userID, reason string, until *time.Time) error {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > maxSuspensionReasonLength {
+		return ErrSuspensionReason
+	}
+	if until != nil && !until.After(time.Now()) {
+		return ErrSuspensionExpired
+	}
+	if actorID == userID {
+		return ErrManageSelf
+	}
+	if _, err := s.findUser(ctx, userID); err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Suspend(ctx, userID, reason, until); err != nil {
+		return err
+	}
+	if err := s.userRepo.SetTokensValidAfter(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	if err := s.tokenRepo.DeleteAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	details := map[string]string{"actor_id": actorID, "reason": reason}
+	if until != nil {
+		details["until"] = until.UTC().Format(time.RFC3339)
+	}
+	s.recordEvent(ctx, userID, EventUserSuspended, details)
+	return nil
+}
+
+// UnsuspendUser lifts a suspension or ban.
+func (s *AuthService) UnsuspendUser(ctx context.Context, actorID, userID string) error {
+	if _, err := uuid.Parse(userID); err != nil {
+		return repository.ErrNotFound
+	}
+	if err := s.userRepo.Unsuspend(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, userID, EventUserUnsuspended, map[string]string{"actor_id": actorID})
+	return nil
+}
+
+// DeleteUser deletes an account with its sessions, roles and tokens. The
+// event is recorded against the administrator, as the user's own events are
+// deleted with the account.
+func (s *AuthService) DeleteUser(ctx context.Context, actorID, userID string) error {
+	if actorID == userID {
+		return ErrManageSelf
+	}
+	user, err := s.findUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.Delete(ctx, userID); err != nil {
+		return err
+	}
+
+	s.recordEvent(ctx, actorID, EventUserDeleted, map[string]string{
+		"user_id":  user.ID,
+		"username": user.Username,
+	})
+	return nil
+}
+
+// findUser loads a user by ID, returning ErrNotFound for unknown or
+// malformed IDs.
+func (s *AuthService) findUser(ctx context.Context, userID string) (*repository.User, error) {
+	if _, err := uuid.Parse(userID); err != nil {
+		return nil, repository.ErrNotFound
+	}
+	return s.userRepo.GetByID(ctx, userID)
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"auth-service/internal/repository"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func suspendedUser(until *time.Time) *repository.User {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	suspendedAt := time.Now().Add(-time.Hour)
+	return &repository.User{
+		ID:               uuid.New().String(),
+		Username:         "testuser",
+		PasswordHash:     string(hashedPassword),
+		SuspendedAt:      &suspendedAt,
+		SuspendedUntil:   until,
+		SuspensionReason: "spam",
+	}
+}
+
+func TestAuthService_SuspendUser(t *testing.T) {
+	adminID := uuid.New().String()
+
+	t.Run("suspension logs the user out and revokes their tokens", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+
+		userID := uuid.New().String()
+		until := time.Now().Add(24 * time.Hour)
+		userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID}, nil)
+		userRepo.On("Suspend", mock.Anything, userID, "spam", &until).Return(nil)
+		userRepo.On("SetTokensValidAfter", mock.Anything, userID, mock.AnythingOfType("time.Time")).Return(nil)
+		tokenRepo.On("DeleteAllForUser", mock.Anything, userID).Return(nil)
+
+		require.NoError(t, service.SuspendUser(context.Background(), adminID, userID, " spam ", &until))
+		userRepo.AssertExpectations(t)
+		tokenRepo.AssertExpectations(t)
+	})
+
+	t.Run("invalid requests are rejected", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := newRevocationTestService(new(MockTokenRepository), userRepo, newMockRevokedTokenRepository())
+		past := time.Now().Add(-time.Minute)
+
+		assert.ErrorIs(t, service.SuspendUser(context.Background(), adminID, uuid.New().String(), "  ", nil), ErrSuspensionReason)
+		assert.ErrorIs(t, service.SuspendUser(context.Background(), adminID, uuid.New().String(), "spam", &past), ErrSuspensionExpired)
+		assert.ErrorIs(t, service.SuspendUser(context.Background(), adminID, adminID, "spam", nil), ErrManageSelf)
+		assert.ErrorIs(t, service.SuspendUser(context.Background(), adminID, "not-a-uuid", "spam", nil), repository.ErrNotFound)
+		userRepo.AssertNotCalled(t, "Suspend", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("database errors are not reported as unknown users", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := newRevocationTestService(new(MockTokenRepository), userRepo, newMockRevokedTokenRepository())
+
+		dbErr := errors.New("connection refused")
+		userID := uuid.New().String()
+		userRepo.On("GetByID", mock.Anything, userID).Return(nil, dbErr)
+
+		err := service.SuspendUser(context.Background(), adminID, userID, "spam", nil)
+		assert.ErrorIs(t, err, dbErr)
+		assert.NotErrorIs(t, err, repository.ErrNotFound)
+	})
+}
+
+func TestAuthService_Suspension(t *testing.T) {
+	t.Run("suspended user cannot log in", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+
+		until := time.Now().Add(time.Hour)
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(suspendedUser(&until), nil)
+
+		_, err := service.Login(context.Background(), "testuser", "password123")
+		var suspendedErr *AccountSuspendedError
+		require.ErrorAs(t, err, &suspendedErr)
+		assert.Equal(t, "spam", suspendedErr.Reason)
+		assert.Equal(t, &until, suspendedErr.Until)
+		tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("expired suspension is ignored", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		roleRepo := new(MockRoleRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+		service.roleRepo = roleRepo
+
+		until := time.Now().Add(-time.Minute)
+		user := suspendedUser(&until)
+		userRepo.On("GetByUsername", mock.Anything, "testuser").Return(user, nil)
+		roleRepo.On("GetUserRoles", mock.Anything, user.ID).Return([]string{RoleUser}, nil)
+		tokenRepo.On("Create", mock.Anything, mock.Anything).Return(nil)
+
+		_, err := service.Login(context.Background(), "testuser", "password123")
+		assert.NoError(t, err)
+	})
+
+	t.Run("banned user cannot refresh", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+
+		user := suspendedUser(nil)
+		refreshToken := &repository.RefreshToken{
+			ID:        uuid.New().String(),
+			UserID:    user.ID,
+			FamilyID:  uuid.New().String(),
+			ExpiresAt: time.Now().Add(time.Hour),
+		}
+		tokenRepo.On("Get", mock.Anything, "refresh-token").Return(refreshToken, nil)
+		tokenRepo.On("MarkRotated", mock.Anything, refreshToken.ID).Return(nil)
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(user, nil)
+
+		_, err := service.RefreshTokens(context.Background(), "refresh-token")
+		var suspendedErr *AccountSuspendedError
+		require.ErrorAs(t, err, &suspendedErr)
+		assert.Nil(t, suspendedErr.Until)
+		tokenRepo.AssertNotCalled(t, "Create", mock.Anything, mock.Anything)
+	})
+
+	t.Run("tokens of a suspended user do not validate", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		tokenRepo := new(MockTokenRepository)
+		service := newRevocationTestService(tokenRepo, userRepo, newMockRevokedTokenRepository())
+
+		user := &repository.User{ID: uuid.New().String(), Username: "testuser"}
+		tokens := issueTestTokens(t, service, tokenRepo, user, newSession())
+
+		suspended := suspendedUser(nil)
+		suspended.ID = user.ID
+		userRepo.On("GetByID", mock.Anything, user.ID).Return(suspended, nil)
+
+		_, _, err := service.ValidateToken(context.Background(), tokens.AccessToken)
+		var suspendedErr *AccountSuspendedError
+		assert.ErrorAs(t, err, &suspendedErr)
+	})
+}
+
+func TestAuthService_ListUsers(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	service := newRevocationTestService(new(MockTokenRepository), userRepo, newMockRevokedTokenRepository())
+
+	userRepo.On("List", mock.Anything, repository.UserFilter{Query: "alice", Limit: maxUserPageSize}).
+		Return([]repository.User{{ID: uuid.New().String()}}, 1, nil)
+
+	users, total, err := service.ListUsers(context.Background(), repository.UserFilter{Query: " alice ", Limit: 1000, Offset: -5})
+	require.NoError(t, err)
+	assert.Len(t, users, 1)
+	assert.Equal(t, 1, total)
+	userRepo.AssertExpectations(t)
+}
+
+func TestAuthService_DeleteUser(t *testing.T) {
+	adminID := uuid.New().String()
+
+	t.Run("admins cannot delete themselves", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := newRevocationTestService(new(MockTokenRepository), userRepo, newMockRevokedTokenRepository())
+
+		assert.ErrorIs(t, service.DeleteUser(context.Background(), adminID, adminID), ErrManageSelf)
+		userRepo.AssertNotCalled(t, "Delete", mock.Anything, mock.Anything)
+	})
+
+	t.Run("user is deleted", func(t *testing.T) {
+		userRepo := new(MockUserRepository)
+		service := newRevocationTestService(new(MockTokenRepository), userRepo, newMockRevokedTokenRepository())
+
+		userID := uuid.New().String()
+		userRepo.On("GetByID", mock.Anything, userID).Return(&repository.User{ID: userID, Username: "spammer"}, nil)
+		userRepo.On("Delete", mock.Anything, userID).Return(nil)
+
+		require.NoError(t, service.DeleteUser(context.Background(), adminID, userID))
+		userRepo.AssertExpectations(t)
+	})
+}
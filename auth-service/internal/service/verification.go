@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"auth-service/internal/mailer"
+	"auth-service/internal/repository"
+)
+
+// Values of config.EmailVerification.
+const (
+	EmailVerificationOff   = "off"
+	EmailVerificationLogin = "login"
+	EmailVerificationWrite = "write"
+)
+
+var (
+	ErrEmailNotVerified         = errors.New("email address is not verified")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+)
+
+// RequestEmailVerification mails a verification link to the account
+// registered with email. Unknown and already verified addresses are ignored.
+func (s *AccountService) RequestEmailVerification(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	token, err := generateOpaqueToken()
+	if err != nil {
+		return err
+	}
+
+	verifyToken := &repository.OneTimeToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: time.Now().Add(s.config.EmailVerificationTTL),
+	}
+	if err := s.verifyRepo.Create(ctx, verifyToken); err != nil {
+		return err
+	}
+
+	link := s.config.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. "+
+			"It expires in %s.\n\n%s\n\n"+
+			"If you didn't create an account, you can ignore this email.\n",
+			user.Username, s.config.EmailVerificationTTL, link),
+	})
+}
+
+// VerifyEmail marks the address of the token's owner as verified.
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	verifyToken, err := s.verifyRepo.Consume(ctx, hashToken(token))
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, verifyToken.UserID); err != nil {
+		return err
+	}
+
+	return s.verifyRepo.DeleteAllForUser(ctx, verifyToken.UserID)
+}
+
+// CanWrite reports whether user may post in the forum under the configured
+// email verification policy. Accounts waiting for approval cannot write.
+func (s *AuthService) CanWrite(user *repository.User) bool {
+	if user.PendingApproval {
+		return false
+	}
+	return s.config.EmailVerification != EmailVerificationWrite || user.EmailVerifiedAt != nil
+}
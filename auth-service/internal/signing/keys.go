@@ -0,0 +1,338 @@
+// Package signing holds the asymmetric keys access tokens are signed with and
+// publishes their public halves as a JSON Web Key Set.
+package signing
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"auth-service/internal/config"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+// minRSABits is the smallest RSA modulus accepted for signing keys.
+const minRSABits = 2048
+
+var (
+	ErrNoSigningKey = errors.New("no signing key configured")
+	ErrUnknownKey   = errors.New("unknown signing key")
+)
+
+// Key is a single signing or verification key.
+type Key struct {
+	// ID is the RFC 7638 thumbprint of the public key and is sent as the
+	// "kid" token header.
+	ID     string
+	Method jwt.SigningMethod
+	Public crypto.PublicKey
+	// private is nil for keys that are only used to verify tokens.
+	private crypto.Signer
+}
+
+// NewKey wraps an RSA or Ed25519 key. Private keys can sign and verify,
+// public keys can only verify.
+func NewKey(key interface{}) (*Key, error) {
+	k := &Key{}
+	switch key := key.(type) {
+	case *rsa.PrivateKey:
+		k.private = key
+		k.Public = &key.PublicKey
+	case *rsa.PublicKey:
+		k.Public = key
+	case ed25519.PrivateKey:
+		k.private = key
+		k.Public = key.Public()
+	case ed25519.PublicKey:
+		k.Public = key
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key)
+	}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSABits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSABits)
+		}
+		k.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.Method = jwt.SigningMethodEdDSA
+	}
+
+	k.ID = thumbprint(k.JWK())
+	return k, nil
+}
+
+// ParsePEM reads a PKCS#8 or PKCS#1 private key, or a PKIX public key.
+func ParsePEM(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(key)
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(key)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return NewKey(key)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// GenerateKey returns a new Ed25519 signing key.
+func GenerateKey() (*Key, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return NewKey(private)
+}
+
+// KeySet is every key the service accepts. New tokens are signed with the
+// first signing key only; the other keys stay valid so that a replacement key
+// can be published before it is used and a retired key keeps verifying the
+// tokens it signed until they expire.
+type KeySet struct {
+	signing *Key
+	keys    []*Key
+	byID    map[string]*Key
+}
+
+// NewKeySet builds a key set from the active signing keys, the first of which
+// signs new tokens, and retired keys that are only used for verification.
+func NewKeySet(signing []*Key, verification []*Key) (*KeySet, error) {
+	if len(signing) == 0 || signing[0].private == nil {
+		return nil, ErrNoSigningKey
+	}
+
+	set := &KeySet{
+		signing: signing[0],
+		byID:    make(map[string]*Key),
+	}
+	for _, key := range append(signing, verification...) {
+		if _, ok := set.byID[key.ID]; ok {
+			continue
+		}
+		set.keys = append(set.keys, key)
+		set.byID[key.ID] = key
+	}
+	return set, nil
+}
+
+// Load reads the keys named in the configuration. Without any signing key a
+// temporary one is generated, which is only suitable for development since
+// tokens stop verifying when the process restarts.
+func Load(cfg *config.Config, logger zerolog.Logger) (*KeySet, error) {
+	verification, err := loadFiles(cfg.JWTVerificationKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cfg.JWTSigningKeyFiles) == 0 {
+		logger.Warn().Msg("JWT_SIGNING_KEYS is not set, signing tokens with a temporary key")
+		key, err := GenerateKey()
+		if err != nil {
+			return nil, err
+		}
+		return NewKeySet([]*Key{key}, verification)
+	}
+
+	signing, err := loadFiles(cfg.JWTSigningKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range signing {
+		if key.private == nil {
+			return nil, fmt.Errorf("signing key %s has no private key", key.ID)
+		}
+	}
+	return NewKeySet(signing, verification)
+}
+
+func loadFiles(paths []string) ([]*Key, error) {
+	var keys []*Key
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ParsePEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// Sign signs claims with the current signing key.
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(s.signing.Method, claims)
+	token.Header["kid"] = s.signing.ID
+	return token.SignedString(s.signing.private)
+}
+
+// Keyfunc picks the verification key named by the token's kid header. It is
+// meant to be passed to jwt.Parse together with jwt.WithValidMethods(s.Methods()).
+func (s *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.byID[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("key %s does not use %s", kid, token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// Methods returns the algorithms of all keys in the set.
+func (s *KeySet) Methods() []string {
+	var methods []string
+	seen := make(map[string]bool)
+	for _, key := range s.keys {
+		if alg := key.Method.Alg(); !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// SigningKeyID is the kid of the key new tokens are signed with.
+func (s *KeySet) SigningKeyID() string {
+	return s.signing.ID
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid,omitempty"`
+	Use       string `json:"use,omitempty"`
+	Algorithm string `json:"alg,omitempty"`
+	// RSA
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Ed25519
+	Curve string `json:"crv,omitempty"`
+	X     string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK returns the public half of the key.
+func (k *Key) JWK() JWK {
+	jwk := JWK{KeyID: k.ID, Use: "sig"}
+	if k.Method != nil {
+		jwk.Algorithm = k.Method.Alg()
+	}
+
+	switch pub := k.Public.(type) {
+	case *rsa.PublicKey:
+		jwk.KeyType = "RSA"
+		jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+	}
+	return jwk
+}
+
+// PublicKey parses an RSA or Ed25519 JWK, such as one published by another
+// identity provider.
+func (j JWK) PublicKey() (crypto.PublicKey, error) {
+	switch j.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if j.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", j.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.KeyType)
+	}
+}
+
+// JWKS returns the public keys of the set, signing key first.
+func (s *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: make([]JWK, 0, len(s.keys))}
+	for _, key := range s.keys {
+		jwks.Keys = append(jwks.Keys, key.JWK())
+	}
+	return jwks
+}
+
+// thumbprint computes the RFC 7638 thumbprint from the required members of a
+// JWK, which encoding/json writes in the required lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members interface{}
+	switch jwk.KeyType {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.KeyType, jwk.N}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Curve, jwk.KeyType, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
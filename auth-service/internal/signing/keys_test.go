@@ -0,0 +1,116 @@
+package signing
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThumbprint(t *testing.T) {
+	// Example key from RFC 7638 section 3.1
+	n, err := base64.RawURLEncoding.DecodeString("0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw")
+	require.NoError(t, err)
+
+	key, err := NewKey(&rsa.PublicKey{N: new(big.Int).SetBytes(n), E: 65537})
+	require.NoError(t, err)
+	assert.Equal(t, "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs", key.ID)
+	assert.Equal(t, "AQAB", key.JWK().E)
+}
+
+func TestParsePEM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	require.NoError(t, err)
+	key, err := ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, jwt.SigningMethodRS256, key.Method)
+
+	der, err = x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	public, err := ParsePEM(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+	require.NoError(t, err)
+	assert.Equal(t, key.ID, public.ID)
+
+	_, err = NewKeySet([]*Key{public}, nil)
+	assert.ErrorIs(t, err, ErrNoSigningKey, "public keys cannot sign")
+
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	require.NoError(t, err)
+	_, err = NewKey(small)
+	assert.Error(t, err)
+}
+
+func TestKeySet_Rotation(t *testing.T) {
+	claims := jwt.RegisteredClaims{
+		Subject:   "user",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+	parse := func(keys *KeySet, token string) error {
+		_, err := jwt.ParseWithClaims(token, &jwt.RegisteredClaims{}, keys.Keyfunc, jwt.WithValidMethods(keys.Methods()))
+		return err
+	}
+
+	oldKey, err := GenerateKey()
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	newKey, err := NewKey(rsaKey)
+	require.NoError(t, err)
+
+	before, err := NewKeySet([]*Key{oldKey}, nil)
+	require.NoError(t, err)
+	oldToken, err := before.Sign(claims)
+	require.NoError(t, err)
+
+	// The new key signs while the old one is kept for verification only
+	after, err := NewKeySet([]*Key{newKey}, []*Key{oldKey})
+	require.NoError(t, err)
+	newToken, err := after.Sign(claims)
+	require.NoError(t, err)
+
+	header, _, err := jwt.NewParser().ParseUnverified(newToken, &jwt.RegisteredClaims{})
+	require.NoError(t, err)
+	assert.Equal(t, newKey.ID, header.Header["kid"])
+	assert.Equal(t, "RS256", header.Method.Alg())
+
+	assert.NoError(t, parse(after, oldToken))
+	assert.NoError(t, parse(after, newToken))
+	assert.Error(t, parse(before, newToken))
+	assert.ElementsMatch(t, []string{"RS256", "EdDSA"}, after.Methods())
+
+	jwks := after.JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, newKey.ID, jwks.Keys[0].KeyID)
+	assert.Equal(t, "RSA", jwks.Keys[0].KeyType)
+	assert.Equal(t, "OKP", jwks.Keys[1].KeyType)
+	assert.Equal(t, "Ed25519", jwks.Keys[1].Curve)
+}
+
+func TestJWK_PublicKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	rsaSigningKey, err := NewKey(rsaKey)
+	require.NoError(t, err)
+	edKey, err := GenerateKey()
+	require.NoError(t, err)
+
+	for _, key := range []*Key{rsaSigningKey, edKey} {
+		public, err := key.JWK().PublicKey()
+		require.NoError(t, err)
+		assert.Equal(t, key.Public, public)
+	}
+
+	_, err = JWK{KeyType: "EC"}.PublicKey()
+	assert.Error(t, err)
+}
@@ -9,39 +9,99 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
 
+	"auth-service/internal/repository"
 	"auth-service/internal/service"
 
 	authv1 "protos/auth/v1"
 
 	"go.uber.org/zap"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/reflection"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
 )
 
+// Server is a gRPC server with the standard health service, server
+// reflection and logging and recovery interceptors.
 type Server struct {
 	*grpc.Server
+	health *health.Server
 }
 
-func NewServer() *Server {
+func NewServer(logger *zap.Logger) *Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(LoggingUnaryInterceptor(logger), RecoveryUnaryInterceptor(logger)),
+		grpc.ChainStreamInterceptor(LoggingStreamInterceptor(logger), RecoveryStreamInterceptor(logger)),
+	)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(server, healthServer)
+	reflection.Register(server)
+
 	return &Server{
-		Server: grpc.NewServer(),
+		Server: server,
+		health: healthServer,
+	}
+}
+
+// RegisterService registers a service and reports it as serving in the health
+// service.
+func (s *Server) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	s.Server.RegisterService(desc, impl)
+	s.health.SetServingStatus(desc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+}
+
+// Shutdown reports every service as not serving, stops accepting connections
+// and waits for in-flight calls to finish. Calls still running when ctx is
+// done are cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.health.Shutdown()
+
+	stopped := make(chan struct{})
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		s.Stop()
+		return ctx.Err()
 	}
 }
 
 // AuthServer implements the gRPC auth service.
 type AuthServer struct {
 	authv1.UnimplementedAuthServiceServer
-	authService *service.AuthService
-	logger      *zap.Logger
+	authService    *service.AuthService
+	accountService *service.AccountService
+	profileService *service.ProfileService
+	logger         *zap.Logger
 }
 
 // NewAuthServer creates a new instance of AuthServer.
-func NewAuthServer(authService *service.AuthService, logger *zap.Logger) *AuthServer {
+func NewAuthServer(authService *service.AuthService, accountService *service.AccountService, profileService *service.ProfileService, logger *zap.Logger) *AuthServer {
 	return &AuthServer{
-		authService: authService,
-		logger:      logger,
+		authService:    authService,
+		accountService: accountService,
+		profileService: profileService,
+		logger:         logger,
 	}
 }
 
@@ -58,7 +118,15 @@ func NewAuthServer(authService *service.AuthService, logger *zap.Logger) *AuthSe
 // @Failure 500 {object} status.Status "Internal server error"
 // @Router /register [post]
 func (s *AuthServer) Register(ctx context.Context, req *authv1.RegisterRequest) (*authv1.RegisterResponse, error) {
-	if err := s.authService.Register(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword()); err != nil {
+	ctx = withClientInfo(ctx)
+
+	if err := s.authService.Register(ctx, req.GetUsername(), req.GetEmail(), req.GetPassword(), req.GetInviteCode()); err != nil {
+		if isRejectedPassword(err) || errors.Is(err, service.ErrInvalidInviteCode) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, service.ErrInviteRequired) || errors.Is(err, service.ErrEmailDomainNotAllowed) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		s.logger.Error("failed to register user", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to register user")
 	}
@@ -69,17 +137,30 @@ func (s *AuthServer) Register(ctx context.Context, req *authv1.RegisterRequest)
 		return nil, status.Error(codes.Internal, "failed to get user")
 	}
 
+	if err := s.accountService.RequestEmailVerification(ctx, user.Email); err != nil {
+		s.logger.Error("failed to send verification email", zap.Error(err))
+	}
+
 	tokens, err := s.authService.Login(ctx, req.GetUsername(), req.GetPassword())
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		// The account exists but cannot be used until the address is verified
+		return &authv1.RegisterResponse{
+			UserId:          user.ID,
+			Username:        user.Username,
+			PendingApproval: user.PendingApproval,
+		}, nil
+	}
 	if err != nil {
 		s.logger.Error("failed to login after registration", zap.Error(err))
 		return nil, status.Error(codes.Internal, "failed to login")
 	}
 
 	return &authv1.RegisterResponse{
-		UserId:       user.ID,
-		Username:     user.Username,
-		AccessToken:  tokens.AccessToken,
-		RefreshToken: tokens.RefreshToken,
+		UserId:          user.ID,
+		Username:        user.Username,
+		AccessToken:     tokens.AccessToken,
+		RefreshToken:    tokens.RefreshToken,
+		PendingApproval: user.PendingApproval,
 	}, nil
 }
 
@@ -96,8 +177,20 @@ func (s *AuthServer) Register(ctx context.Context, req *authv1.RegisterRequest)
 // @Failure 500 {object} status.Status "Internal server error"
 // @Router /login [post]
 func (s *AuthServer) Login(ctx context.Context, req *authv1.LoginRequest) (*authv1.LoginResponse, error) {
+	ctx = withClientInfo(ctx)
+
 	tokens, err := s.authService.Login(ctx, req.GetUsername(), req.GetPassword())
-	if err != nil {
+	var mfaErr *service.MFARequiredError
+	if errors.Is(err, service.ErrTooManyAttempts) {
+		return nil, rateLimitStatus(ctx, err)
+	}
+	if errors.Is(err, service.ErrEmailNotVerified) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if isSuspended(err) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil && !errors.As(err, &mfaErr) {
 		s.logger.Error("failed to login", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "invalid credentials")
 	}
@@ -108,6 +201,15 @@ func (s *AuthServer) Login(ctx context.Context, req *authv1.LoginRequest) (*auth
 		return nil, status.Error(codes.Internal, "failed to get user")
 	}
 
+	if mfaErr != nil {
+		return &authv1.LoginResponse{
+			UserId:      user.ID,
+			Username:    user.Username,
+			MfaRequired: true,
+			MfaToken:    mfaErr.ChallengeToken,
+		}, nil
+	}
+
 	return &authv1.LoginResponse{
 		UserId:       user.ID,
 		Username:     user.Username,
@@ -119,7 +221,7 @@ func (s *AuthServer) Login(ctx context.Context, req *authv1.LoginRequest) (*auth
 // IsAdmin checks if a user is an admin.
 //
 // @Summary Check if a user is an admin
-// @Description Check if the user with the provided ID has admin privileges
+// @Description Check if the user with the provided ID has admin privileges. Callers pass a service account token, the user's own token, or the token of an admin who may read users
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -127,19 +229,102 @@ func (s *AuthServer) Login(ctx context.Context, req *authv1.LoginRequest) (*auth
 // @Success 200 {object} authv1.IsAdminResponse
 // @Router /is-admin [post]
 func (s *AuthServer) IsAdmin(ctx context.Context, req *authv1.IsAdminRequest) (*authv1.IsAdminResponse, error) {
-	// For simplicity, let's consider user with ID 1 as admin
+	if err := s.authorizeUserLookup(ctx, req.GetAccessToken(), req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	isAdmin, err := s.authService.IsAdmin(ctx, req.GetUserId())
+	if err != nil {
+		s.logger.Error("failed to check admin role", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check admin role")
+	}
+
 	return &authv1.IsAdminResponse{
-		IsAdmin: req.GetUserId() == "1",
+		IsAdmin: isAdmin,
+	}, nil
+}
+
+// GetUserRoles returns the roles and effective permissions of a user.
+//
+// @Summary Get user roles
+// @Description Get the roles and effective permissions of the user with the provided ID. The access token is authorized as for IsAdmin
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body authv1.GetUserRolesRequest true "User roles request"
+// @Success 200 {object} authv1.GetUserRolesResponse
+// @Failure 500 {object} status.Status "Internal server error"
+// @Router /user-roles [post]
+func (s *AuthServer) GetUserRoles(ctx context.Context, req *authv1.GetUserRolesRequest) (*authv1.GetUserRolesResponse, error) {
+	if err := s.authorizeUserLookup(ctx, req.GetAccessToken(), req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.authService.GetUserRoles(ctx, req.GetUserId())
+	if err != nil {
+		s.logger.Error("failed to get user roles", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get user roles")
+	}
+
+	permissions, err := s.authService.GetUserPermissions(ctx, req.GetUserId())
+	if err != nil {
+		s.logger.Error("failed to get user permissions", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get user permissions")
+	}
+
+	return &authv1.GetUserRolesResponse{
+		Roles:       roles,
+		Permissions: permissions,
+	}, nil
+}
+
+// CheckPermission checks whether a user holds a permission through any of their roles.
+//
+// @Summary Check a user permission
+// @Description Check whether the user with the provided ID has the given permission. The access token is authorized as for IsAdmin
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param request body authv1.CheckPermissionRequest true "Permission check request"
+// @Success 200 {object} authv1.CheckPermissionResponse
+// @Failure 400 {object} status.Status "Invalid request"
+// @Failure 500 {object} status.Status "Internal server error"
+// @Router /check-permission [post]
+func (s *AuthServer) CheckPermission(ctx context.Context, req *authv1.CheckPermissionRequest) (*authv1.CheckPermissionResponse, error) {
+	if req.GetPermission() == "" {
+		return nil, status.Error(codes.InvalidArgument, "permission is required")
+	}
+	if err := s.authorizeUserLookup(ctx, req.GetAccessToken(), req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.authService.HasPermission(ctx, req.GetUserId(), req.GetPermission())
+	if err != nil {
+		s.logger.Error("failed to check permission", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check permission")
+	}
+
+	return &authv1.CheckPermissionResponse{
+		Allowed: allowed,
 	}, nil
 }
 
 // RegisterGRPC registers the auth server with the gRPC server.
-func (s *AuthServer) RegisterGRPC(grpcServer *grpc.Server) {
+func (s *AuthServer) RegisterGRPC(grpcServer grpc.ServiceRegistrar) {
 	authv1.RegisterAuthServiceServer(grpcServer, s)
 }
 
 func (s *AuthServer) RefreshToken(ctx context.Context, req *authv1.RefreshTokenRequest) (*authv1.RefreshTokenResponse, error) {
+	ctx = withClientInfo(ctx)
+
 	tokens, err := s.authService.RefreshTokens(ctx, req.GetRefreshToken())
+	if isSuspended(err) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, service.ErrRefreshTokenReuse) {
+		s.logger.Warn("refresh token reuse detected, token family revoked", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "refresh token reuse detected")
+	}
 	if err != nil {
 		s.logger.Error("failed to refresh token", zap.Error(err))
 		return nil, status.Error(codes.Unauthenticated, "invalid refresh token")
@@ -152,21 +337,1004 @@ func (s *AuthServer) RefreshToken(ctx context.Context, req *authv1.RefreshTokenR
 }
 
 func (s *AuthServer) ValidateToken(ctx context.Context, req *authv1.ValidateTokenRequest) (*authv1.ValidateTokenResponse, error) {
-	userID, err := s.authService.ValidateToken(ctx, req.GetAccessToken())
+	claims, user, err := s.authService.ValidateToken(ctx, req.GetAccessToken())
 	if err != nil {
 		s.logger.Error("failed to validate token", zap.Error(err))
 		return &authv1.ValidateTokenResponse{IsValid: false}, nil
 	}
-
-	user, err := s.authService.GetUserByID(ctx, userID)
-	if err != nil {
-		s.logger.Error("failed to get user from token", zap.Error(err))
+	// The response describes a user, which service accounts do not have
+	if user == nil {
 		return &authv1.ValidateTokenResponse{IsValid: false}, nil
 	}
 
 	return &authv1.ValidateTokenResponse{
-		UserId:   user.ID,
-		Username: user.Username,
-		IsValid:  true,
+		UserId:          user.ID,
+		Username:        user.Username,
+		IsValid:         true,
+		Roles:           claims.Roles,
+		EmailVerified:   user.EmailVerifiedAt != nil,
+		CanWrite:        s.authService.CanWrite(user),
+		Scopes:          claims.Scopes,
+		PendingApproval: user.PendingApproval,
+		ImpersonatorId:  impersonatorID(claims),
+	}, nil
+}
+
+// impersonatorID returns the admin acting through an impersonation token, or
+// "" for other tokens.
+func impersonatorID(claims *service.Claims) string {
+	if claims.Actor == nil {
+		return ""
+	}
+	return claims.Actor.Subject
+}
+
+// ListSessions returns the active sessions of the token's owner.
+func (s *AuthServer) ListSessions(ctx context.Context, req *authv1.ListSessionsRequest) (*authv1.ListSessionsResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	sessions, err := s.authService.ListSessions(ctx, claims.UserID)
+	if err != nil {
+		s.logger.Error("failed to list sessions", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list sessions")
+	}
+
+	return &authv1.ListSessionsResponse{
+		Sessions: toProtoSessions(sessions, claims.SessionID),
 	}, nil
 }
+
+// RevokeSession logs the token's owner out of one session.
+func (s *AuthServer) RevokeSession(ctx context.Context, req *authv1.RevokeSessionRequest) (*authv1.RevokeSessionResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.RevokeSession(ctx, claims.UserID, req.GetSessionId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "session not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to revoke session", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to revoke session")
+	}
+
+	return &authv1.RevokeSessionResponse{
+		Success: true,
+	}, nil
+}
+
+// RevokeOtherSessions logs the token's owner out everywhere except the session the token belongs to.
+func (s *AuthServer) RevokeOtherSessions(ctx context.Context, req *authv1.RevokeOtherSessionsRequest) (*authv1.RevokeOtherSessionsResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.RevokeOtherSessions(ctx, claims.UserID, claims.SessionID)
+	if errors.Is(err, service.ErrUnknownSession) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to revoke other sessions", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to revoke sessions")
+	}
+
+	return &authv1.RevokeOtherSessionsResponse{
+		Success: true,
+	}, nil
+}
+
+// LogoutAll revokes every refresh token of the token's owner.
+func (s *AuthServer) LogoutAll(ctx context.Context, req *authv1.LogoutAllRequest) (*authv1.LogoutAllResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.authService.LogoutAll(ctx, claims.UserID); err != nil {
+		s.logger.Error("failed to log out all sessions", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to log out")
+	}
+
+	return &authv1.LogoutAllResponse{
+		Success: true,
+	}, nil
+}
+
+// RequestPasswordReset mails a password reset link. It succeeds for unknown addresses too.
+func (s *AuthServer) RequestPasswordReset(ctx context.Context, req *authv1.RequestPasswordResetRequest) (*authv1.RequestPasswordResetResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := s.accountService.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		s.logger.Error("failed to request password reset", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to send reset email")
+	}
+
+	return &authv1.RequestPasswordResetResponse{
+		Success: true,
+	}, nil
+}
+
+// ResetPassword sets a new password using a reset token.
+func (s *AuthServer) ResetPassword(ctx context.Context, req *authv1.ResetPasswordRequest) (*authv1.ResetPasswordResponse, error) {
+	if req.GetToken() == "" || req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token and new password are required")
+	}
+
+	err := s.accountService.ResetPassword(ctx, req.GetToken(), req.GetNewPassword())
+	if errors.Is(err, service.ErrInvalidResetToken) || isRejectedPassword(err) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to reset password", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to reset password")
+	}
+
+	return &authv1.ResetPasswordResponse{
+		Success: true,
+	}, nil
+}
+
+// VerifyEmail confirms a user's email address using a verification token.
+func (s *AuthServer) VerifyEmail(ctx context.Context, req *authv1.VerifyEmailRequest) (*authv1.VerifyEmailResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	err := s.accountService.VerifyEmail(ctx, req.GetToken())
+	if errors.Is(err, service.ErrInvalidVerificationToken) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to verify email", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to verify email")
+	}
+
+	return &authv1.VerifyEmailResponse{
+		Success: true,
+	}, nil
+}
+
+// ResendVerificationEmail mails a new verification link. It succeeds for unknown and already verified addresses too.
+func (s *AuthServer) ResendVerificationEmail(ctx context.Context, req *authv1.ResendVerificationEmailRequest) (*authv1.ResendVerificationEmailResponse, error) {
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	if err := s.accountService.RequestEmailVerification(ctx, req.GetEmail()); err != nil {
+		s.logger.Error("failed to resend verification email", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to send verification email")
+	}
+
+	return &authv1.ResendVerificationEmailResponse{
+		Success: true,
+	}, nil
+}
+
+// VerifyMFA completes a login that returned mfa_required.
+func (s *AuthServer) VerifyMFA(ctx context.Context, req *authv1.VerifyMFARequest) (*authv1.VerifyMFAResponse, error) {
+	ctx = withClientInfo(ctx)
+
+	tokens, err := s.authService.VerifyMFA(ctx, req.GetMfaToken(), req.GetCode())
+	if errors.Is(err, service.ErrTooManyAttempts) {
+		return nil, rateLimitStatus(ctx, err)
+	}
+	if isSuspended(err) {
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if errors.Is(err, service.ErrInvalidMFAToken) || errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnabled) {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to verify mfa code", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to verify code")
+	}
+
+	return &authv1.VerifyMFAResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+	}, nil
+}
+
+// EnrollMFA starts TOTP enrollment for the token's owner.
+func (s *AuthServer) EnrollMFA(ctx context.Context, req *authv1.EnrollMFARequest) (*authv1.EnrollMFAResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	enrollment, err := s.authService.EnrollMFA(ctx, claims.UserID)
+	if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to start mfa enrollment", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to start enrollment")
+	}
+
+	return &authv1.EnrollMFAResponse{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.URI,
+	}, nil
+}
+
+// ConfirmMFA enables two-factor authentication and returns the recovery codes.
+func (s *AuthServer) ConfirmMFA(ctx context.Context, req *authv1.ConfirmMFARequest) (*authv1.ConfirmMFAResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryCodes, err := s.authService.ConfirmMFA(ctx, claims.UserID, req.GetCode())
+	if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnrolled) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrMFAAlreadyEnabled) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to confirm mfa enrollment", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to enable two-factor authentication")
+	}
+
+	return &authv1.ConfirmMFAResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+// DisableMFA turns two-factor authentication off for the token's owner.
+func (s *AuthServer) DisableMFA(ctx context.Context, req *authv1.DisableMFARequest) (*authv1.DisableMFAResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.DisableMFA(ctx, claims.UserID, req.GetCode())
+	if errors.Is(err, service.ErrInvalidMFACode) || errors.Is(err, service.ErrMFANotEnabled) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to disable mfa", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to disable two-factor authentication")
+	}
+
+	return &authv1.DisableMFAResponse{
+		Success: true,
+	}, nil
+}
+
+// CreateAccessToken issues a personal access token for the token's owner.
+func (s *AuthServer) CreateAccessToken(ctx context.Context, req *authv1.CreateAccessTokenRequest) (*authv1.CreateAccessTokenResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetExpiresInDays() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "expires_in_days must not be negative")
+	}
+	ttl := time.Duration(req.GetExpiresInDays()) * 24 * time.Hour
+
+	token, pat, err := s.authService.CreateAccessToken(ctx, claims.UserID, req.GetName(), req.GetScopes(), ttl)
+	if errors.Is(err, service.ErrInvalidScope) || errors.Is(err, service.ErrInvalidTokenName) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to create access token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to create token")
+	}
+
+	return &authv1.CreateAccessTokenResponse{
+		Token:           token,
+		AccessTokenInfo: toProtoAccessToken(*pat),
+	}, nil
+}
+
+// ListAccessTokens returns the personal access tokens of the token's owner.
+func (s *AuthServer) ListAccessTokens(ctx context.Context, req *authv1.ListAccessTokensRequest) (*authv1.ListAccessTokensResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.authService.ListAccessTokens(ctx, claims.UserID)
+	if err != nil {
+		s.logger.Error("failed to list access tokens", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list tokens")
+	}
+
+	protoTokens := make([]*authv1.AccessToken, len(tokens))
+	for i, token := range tokens {
+		protoTokens[i] = toProtoAccessToken(token)
+	}
+
+	return &authv1.ListAccessTokensResponse{
+		Tokens: protoTokens,
+	}, nil
+}
+
+// RevokeAccessToken deletes one of the token owner's personal access tokens.
+func (s *AuthServer) RevokeAccessToken(ctx context.Context, req *authv1.RevokeAccessTokenRequest) (*authv1.RevokeAccessTokenResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.RevokeAccessToken(ctx, claims.UserID, req.GetTokenId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "token not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to revoke access token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to revoke token")
+	}
+
+	return &authv1.RevokeAccessTokenResponse{
+		Success: true,
+	}, nil
+}
+
+// IntrospectToken describes a token to a confidential client or service
+// account, as in RFC 7662.
+func (s *AuthServer) IntrospectToken(ctx context.Context, req *authv1.IntrospectTokenRequest) (*authv1.IntrospectTokenResponse, error) {
+	if _, err := s.authenticateClient(ctx, req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+
+	introspection := s.authService.Introspect(ctx, req.GetToken())
+
+	resp := &authv1.IntrospectTokenResponse{
+		Active:    introspection.Active,
+		Sub:       introspection.Subject,
+		Username:  introspection.Username,
+		Scopes:    introspection.Scopes,
+		ClientId:  introspection.ClientID,
+		TokenType: introspection.TokenType,
+	}
+	if introspection.ExpiresAt != nil {
+		resp.Exp = introspection.ExpiresAt.Unix()
+	}
+	if introspection.IssuedAt != nil {
+		resp.Iat = introspection.IssuedAt.Unix()
+	}
+	return resp, nil
+}
+
+// RevokeToken revokes a token, as in RFC 7009. Confidential clients may
+// only revoke tokens issued to them; service accounts act for first-party
+// services and revoke tokens from first-party logins.
+func (s *AuthServer) RevokeToken(ctx context.Context, req *authv1.RevokeTokenRequest) (*authv1.RevokeTokenResponse, error) {
+	claims, err := s.authenticateClient(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	clientID := claims.ClientID
+	if claims.ServiceAccount {
+		clientID = ""
+	}
+	err = s.authService.RevokeToken(ctx, req.GetToken(), clientID)
+	if errors.Is(err, service.ErrTokenNotOwned) {
+		return nil, status.Error(codes.PermissionDenied, "tokens must be revoked by the client they were issued to")
+	}
+	if err != nil {
+		s.logger.Error("failed to revoke token", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to revoke token")
+	}
+
+	return &authv1.RevokeTokenResponse{
+		Success: true,
+	}, nil
+}
+
+// ListUsers searches users for an administrator.
+func (s *AuthServer) ListUsers(ctx context.Context, req *authv1.ListUsersRequest) (*authv1.ListUsersResponse, error) {
+	if _, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.authService.ListUsers(ctx, repository.UserFilter{
+		Query:         req.GetQuery(),
+		SuspendedOnly: req.GetSuspendedOnly(),
+		PendingOnly:   req.GetPendingOnly(),
+		Limit:         int(req.GetLimit()),
+		Offset:        int(req.GetOffset()),
+	})
+	if err != nil {
+		s.logger.Error("failed to list users", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list users")
+	}
+
+	protoUsers := make([]*authv1.User, len(users))
+	for i := range users {
+		protoUsers[i] = toProtoUser(&users[i])
+	}
+
+	return &authv1.ListUsersResponse{
+		Users: protoUsers,
+		Total: int32(total),
+	}, nil
+}
+
+// GetUser returns a user with their roles and sessions for an administrator.
+func (s *AuthServer) GetUser(ctx context.Context, req *authv1.GetUserRequest) (*authv1.GetUserResponse, error) {
+	if _, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersRead); err != nil {
+		return nil, err
+	}
+
+	details, err := s.authService.GetUserDetails(ctx, req.GetUserId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to get user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get user")
+	}
+
+	return &authv1.GetUserResponse{
+		User:     toProtoUser(details.User),
+		Roles:    details.Roles,
+		Sessions: toProtoSessions(details.Sessions, ""),
+	}, nil
+}
+
+// SuspendUser suspends or bans a user and logs them out everywhere.
+func (s *AuthServer) SuspendUser(ctx context.Context, req *authv1.SuspendUserRequest) (*authv1.SuspendUserResponse, error) {
+	claims, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersManage)
+	if err != nil {
+		return nil, err
+	}
+
+	var until *time.Time
+	if req.GetExpiresAt() != 0 {
+		t := time.Unix(req.GetExpiresAt(), 0)
+		until = &t
+	}
+
+	err = s.authService.SuspendUser(ctx, claims.UserID, req.GetUserId(), req.GetReason(), until)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrSuspensionReason) || errors.Is(err, service.ErrSuspensionExpired) || errors.Is(err, service.ErrManageSelf) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to suspend user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to suspend user")
+	}
+
+	return &authv1.SuspendUserResponse{
+		Success: true,
+	}, nil
+}
+
+// UnsuspendUser lifts a suspension or ban.
+func (s *AuthServer) UnsuspendUser(ctx context.Context, req *authv1.UnsuspendUserRequest) (*authv1.UnsuspendUserResponse, error) {
+	claims, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersManage)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.UnsuspendUser(ctx, claims.UserID, req.GetUserId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to unsuspend user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to unsuspend user")
+	}
+
+	return &authv1.UnsuspendUserResponse{
+		Success: true,
+	}, nil
+}
+
+// ForcePasswordReset clears a user's password and mails them a reset link.
+func (s *AuthServer) ForcePasswordReset(ctx context.Context, req *authv1.ForcePasswordResetRequest) (*authv1.ForcePasswordResetResponse, error) {
+	claims, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersManage)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.accountService.ForcePasswordReset(ctx, claims.UserID, req.GetUserId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to force password reset", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to reset password")
+	}
+
+	return &authv1.ForcePasswordResetResponse{
+		Success: true,
+	}, nil
+}
+
+// DeleteUser deletes a user's account.
+func (s *AuthServer) DeleteUser(ctx context.Context, req *authv1.DeleteUserRequest) (*authv1.DeleteUserResponse, error) {
+	claims, err := s.authorize(ctx, req.GetAccessToken(), service.PermissionUsersManage)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.authService.DeleteUser(ctx, claims.UserID, req.GetUserId())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrManageSelf) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to delete user", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to delete user")
+	}
+
+	return &authv1.DeleteUserResponse{
+		Success: true,
+	}, nil
+}
+
+// GetProfile returns the profile of the token's owner.
+func (s *AuthServer) GetProfile(ctx context.Context, req *authv1.GetProfileRequest) (*authv1.GetProfileResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.profileService.GetProfile(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to get profile", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to get profile")
+	}
+
+	return &authv1.GetProfileResponse{
+		Profile: toProtoProfile(user),
+	}, nil
+}
+
+// UpdateProfile changes the display name, bio or avatar URL of the token's owner.
+func (s *AuthServer) UpdateProfile(ctx context.Context, req *authv1.UpdateProfileRequest) (*authv1.UpdateProfileResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.profileService.UpdateProfile(ctx, claims.UserID, service.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		Bio:         req.Bio,
+		AvatarURL:   req.AvatarUrl,
+	})
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrInvalidDisplayName) || errors.Is(err, service.ErrInvalidBio) || errors.Is(err, service.ErrInvalidAvatarURL) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to update profile", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to update profile")
+	}
+
+	return &authv1.UpdateProfileResponse{
+		Profile: toProtoProfile(user),
+	}, nil
+}
+
+// ChangePassword sets a new password and logs the token's owner out of every other session.
+func (s *AuthServer) ChangePassword(ctx context.Context, req *authv1.ChangePasswordRequest) (*authv1.ChangePasswordResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetNewPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "new password is required")
+	}
+
+	err = s.profileService.ChangePassword(ctx, claims.UserID, claims.SessionID, req.GetCurrentPassword(), req.GetNewPassword())
+	if errors.Is(err, service.ErrWrongPassword) || isRejectedPassword(err) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to change password", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to change password")
+	}
+
+	return &authv1.ChangePasswordResponse{
+		Success: true,
+	}, nil
+}
+
+// ChangeUsername renames the token's owner.
+func (s *AuthServer) ChangeUsername(ctx context.Context, req *authv1.ChangeUsernameRequest) (*authv1.ChangeUsernameResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.profileService.ChangeUsername(ctx, claims.UserID, req.GetUsername())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrInvalidUsername) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrUsernameTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to change username", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to change username")
+	}
+
+	return &authv1.ChangeUsernameResponse{
+		Profile: toProtoProfile(user),
+	}, nil
+}
+
+// ChangeEmail mails a confirmation link to the new address of the token's owner.
+func (s *AuthServer) ChangeEmail(ctx context.Context, req *authv1.ChangeEmailRequest) (*authv1.ChangeEmailResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+	if req.GetEmail() == "" {
+		return nil, status.Error(codes.InvalidArgument, "email is required")
+	}
+
+	err = s.profileService.RequestEmailChange(ctx, claims.UserID, req.GetEmail())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrEmailUnchanged) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to request email change", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to send confirmation email")
+	}
+
+	return &authv1.ChangeEmailResponse{
+		Success: true,
+	}, nil
+}
+
+// ConfirmEmailChange switches to the new email address using the token from the confirmation link.
+func (s *AuthServer) ConfirmEmailChange(ctx context.Context, req *authv1.ConfirmEmailChangeRequest) (*authv1.ConfirmEmailChangeResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	err := s.profileService.ConfirmEmailChange(ctx, req.GetToken())
+	if errors.Is(err, service.ErrInvalidEmailChange) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if errors.Is(err, service.ErrEmailTaken) {
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to confirm email change", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to change email")
+	}
+
+	return &authv1.ConfirmEmailChangeResponse{
+		Success: true,
+	}, nil
+}
+
+// ListUsernameChanges returns renames after after_id so that other services can update the usernames they store.
+// Only service accounts can follow the feed.
+func (s *AuthServer) ListUsernameChanges(ctx context.Context, req *authv1.ListUsernameChangesRequest) (*authv1.ListUsernameChangesResponse, error) {
+	if err := s.authenticateServiceAccount(ctx, req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+
+	changes, err := s.profileService.ListUsernameChanges(ctx, req.GetAfterId(), int(req.GetLimit()))
+	if err != nil {
+		s.logger.Error("failed to list username changes", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list username changes")
+	}
+
+	resp := &authv1.ListUsernameChangesResponse{
+		Changes: make([]*authv1.UsernameChange, len(changes)),
+	}
+	for i, change := range changes {
+		resp.Changes[i] = &authv1.UsernameChange{
+			Id:          change.ID,
+			UserId:      change.UserID,
+			OldUsername: change.OldUsername,
+			NewUsername: change.NewUsername,
+			ChangedAt:   change.ChangedAt.Unix(),
+		}
+	}
+	return resp, nil
+}
+
+// ExportAccountData returns everything the auth service stores about the token's owner as JSON.
+func (s *AuthServer) ExportAccountData(ctx context.Context, req *authv1.ExportAccountDataRequest) (*authv1.ExportAccountDataResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	export, err := s.profileService.ExportData(ctx, claims.UserID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if err != nil {
+		s.logger.Error("failed to export account data", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to export account data")
+	}
+
+	data, err := json.Marshal(export)
+	if err != nil {
+		s.logger.Error("failed to encode account data", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to export account data")
+	}
+
+	return &authv1.ExportAccountDataResponse{
+		Data: data,
+	}, nil
+}
+
+// DeleteAccount deletes the token's owner.
+func (s *AuthServer) DeleteAccount(ctx context.Context, req *authv1.DeleteAccountRequest) (*authv1.DeleteAccountResponse, error) {
+	claims, err := s.authenticate(ctx, req.GetAccessToken())
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.profileService.DeleteAccount(ctx, claims.UserID, req.GetPassword())
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	if errors.Is(err, service.ErrWrongPassword) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err != nil {
+		s.logger.Error("failed to delete account", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to delete account")
+	}
+
+	return &authv1.DeleteAccountResponse{
+		Success: true,
+	}, nil
+}
+
+// ListUserDeletions returns deletions after after_id so that other services can remove the users' content.
+// Only service accounts can follow the feed.
+func (s *AuthServer) ListUserDeletions(ctx context.Context, req *authv1.ListUserDeletionsRequest) (*authv1.ListUserDeletionsResponse, error) {
+	if err := s.authenticateServiceAccount(ctx, req.GetAccessToken()); err != nil {
+		return nil, err
+	}
+
+	deletions, err := s.profileService.ListDeletions(ctx, req.GetAfterId(), int(req.GetLimit()))
+	if err != nil {
+		s.logger.Error("failed to list user deletions", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to list user deletions")
+	}
+
+	resp := &authv1.ListUserDeletionsResponse{
+		Deletions: make([]*authv1.UserDeletion, len(deletions)),
+	}
+	for i, deletion := range deletions {
+		resp.Deletions[i] = &authv1.UserDeletion{
+			Id:        deletion.ID,
+			UserId:    deletion.UserID,
+			DeletedAt: deletion.DeletedAt.Unix(),
+		}
+	}
+	return resp, nil
+}
+
+func toProtoProfile(user *repository.User) *authv1.Profile {
+	return &authv1.Profile{
+		Id:            user.ID,
+		Username:      user.Username,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		PendingEmail:  user.PendingEmail,
+		DisplayName:   user.DisplayName,
+		Bio:           user.Bio,
+		AvatarUrl:     user.AvatarURL,
+		CreatedAt:     user.CreatedAt.Unix(),
+	}
+}
+
+func toProtoUser(user *repository.User) *authv1.User {
+	protoUser := &authv1.User{
+		Id:               user.ID,
+		Username:         user.Username,
+		Email:            user.Email,
+		EmailVerified:    user.EmailVerifiedAt != nil,
+		CreatedAt:        user.CreatedAt.Unix(),
+		SuspensionReason: user.SuspensionReason,
+		PendingApproval:  user.PendingApproval,
+	}
+	if user.SuspendedAt != nil {
+		protoUser.SuspendedAt = user.SuspendedAt.Unix()
+	}
+	if user.SuspendedUntil != nil {
+		protoUser.SuspendedUntil = user.SuspendedUntil.Unix()
+	}
+	return protoUser
+}
+
+func toProtoSessions(sessions []repository.Session, currentSessionID string) []*authv1.Session {
+	protoSessions := make([]*authv1.Session, len(sessions))
+	for i, session := range sessions {
+		protoSessions[i] = &authv1.Session{
+			Id:         session.ID,
+			UserAgent:  session.UserAgent,
+			IpAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt.Unix(),
+			LastUsedAt: session.LastUsedAt.Unix(),
+			ExpiresAt:  session.ExpiresAt.Unix(),
+			Current:    session.ID == currentSessionID,
+		}
+	}
+	return protoSessions
+}
+
+func toProtoAccessToken(token repository.PersonalAccessToken) *authv1.AccessToken {
+	protoToken := &authv1.AccessToken{
+		Id:        token.ID,
+		Name:      token.Name,
+		Scopes:    token.Scopes,
+		CreatedAt: token.CreatedAt.Unix(),
+	}
+	if token.ExpiresAt != nil {
+		protoToken.ExpiresAt = token.ExpiresAt.Unix()
+	}
+	if token.LastUsedAt != nil {
+		protoToken.LastUsedAt = token.LastUsedAt.Unix()
+	}
+	return protoToken
+}
+
+// authenticate verifies an access token passed in a request message.
+// Personal access tokens cannot manage the account they belong to.
+func (s *AuthServer) authenticate(ctx context.Context, accessToken string) (*service.Claims, error) {
+	claims, err := s.authService.ParseToken(ctx, accessToken)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+	if claims.Scopes != nil {
+		return nil, status.Error(codes.PermissionDenied, "personal access tokens cannot be used for this call")
+	}
+	if claims.Actor != nil {
+		return nil, status.Error(codes.PermissionDenied, "impersonation tokens cannot be used for this call")
+	}
+	return claims, nil
+}
+
+// authorize authenticates accessToken and checks that its owner holds
+// permission.
+func (s *AuthServer) authorize(ctx context.Context, accessToken, permission string) (*service.Claims, error) {
+	claims, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := s.authService.HasPermission(ctx, claims.UserID, permission)
+	if err != nil {
+		s.logger.Error("failed to check permission", zap.Error(err))
+		return nil, status.Error(codes.Internal, "failed to check permission")
+	}
+	if !allowed {
+		return nil, status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return claims, nil
+}
+
+// authenticateClient verifies the client credentials token of a confidential
+// client or service account passed in a request message.
+func (s *AuthServer) authenticateClient(ctx context.Context, accessToken string) (*service.Claims, error) {
+	claims, err := s.authService.ParseClientToken(ctx, accessToken)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid client token")
+	}
+	return claims, nil
+}
+
+// authenticateServiceAccount checks that accessToken is a client credentials
+// token of a service account.
+func (s *AuthServer) authenticateServiceAccount(ctx context.Context, accessToken string) error {
+	claims, err := s.authenticateClient(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if !claims.ServiceAccount {
+		return status.Error(codes.PermissionDenied, "only service accounts can use this call")
+	}
+	return nil
+}
+
+// authorizeUserLookup lets service accounts look up any user's roles and
+// users look up their own. Other users need permission to read users.
+func (s *AuthServer) authorizeUserLookup(ctx context.Context, accessToken, userID string) error {
+	if claims, err := s.authService.ParseClientToken(ctx, accessToken); err == nil {
+		if !claims.ServiceAccount {
+			return status.Error(codes.PermissionDenied, "only service accounts can use this call")
+		}
+		return nil
+	}
+
+	claims, err := s.authenticate(ctx, accessToken)
+	if err != nil {
+		return err
+	}
+	if claims.UserID == userID {
+		return nil
+	}
+
+	allowed, err := s.authService.HasPermission(ctx, claims.UserID, service.PermissionUsersRead)
+	if err != nil {
+		s.logger.Error("failed to check permission", zap.Error(err))
+		return status.Error(codes.Internal, "failed to check permission")
+	}
+	if !allowed {
+		return status.Error(codes.PermissionDenied, "permission denied")
+	}
+	return nil
+}
+
+// withClientInfo attaches the caller's user agent and address to ctx.
+func withClientInfo(ctx context.Context) context.Context {
+	var info service.ClientInfo
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		info.UserAgent = strings.Join(md.Get("user-agent"), " ")
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		info.IPAddress = host
+	}
+	return service.WithClientInfo(ctx, info)
+}
+
+// isSuspended reports whether err is an AccountSuspendedError.
+func isSuspended(err error) bool {
+	var suspendedErr *service.AccountSuspendedError
+	return errors.As(err, &suspendedErr)
+}
+
+// isRejectedPassword reports whether a new password was refused by the
+// password policy.
+func isRejectedPassword(err error) bool {
+	return errors.Is(err, service.ErrWeakPassword) || errors.Is(err, service.ErrBreachedPassword)
+}
+
+// rateLimitStatus converts a RateLimitError into ResourceExhausted with a
+// RetryInfo detail and a retry-after header in seconds.
+func rateLimitStatus(ctx context.Context, err error) error {
+	var rateErr *service.RateLimitError
+	if !errors.As(err, &rateErr) {
+		return status.Error(codes.ResourceExhausted, err.Error())
+	}
+
+	seconds := int(math.Ceil(rateErr.RetryAfter.Seconds()))
+	grpc.SetHeader(ctx, metadata.Pairs("retry-after", strconv.Itoa(seconds)))
+
+	st, detailErr := status.New(codes.ResourceExhausted, rateErr.Error()).WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(rateErr.RetryAfter),
+	})
+	if detailErr != nil {
+		return status.Error(codes.ResourceExhausted, rateErr.Error())
+	}
+	return st.Err()
+}
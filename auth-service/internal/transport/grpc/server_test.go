@@ -0,0 +1,73 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	authv1 "protos/auth/v1"
+)
+
+// panickingAuthServer panics in every implemented method.
+type panickingAuthServer struct {
+	authv1.UnimplementedAuthServiceServer
+}
+
+func (panickingAuthServer) IsAdmin(context.Context, *authv1.IsAdminRequest) (*authv1.IsAdminResponse, error) {
+	panic("boom")
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer(zap.NewNop())
+	authv1.RegisterAuthServiceServer(server, panickingAuthServer{})
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	ctx := context.Background()
+	health := healthpb.NewHealthClient(conn)
+
+	t.Run("reports registered services as serving", func(t *testing.T) {
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{Service: authv1.AuthService_ServiceDesc.ServiceName})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	})
+
+	t.Run("recovers from panics", func(t *testing.T) {
+		_, err := authv1.NewAuthServiceClient(conn).IsAdmin(ctx, &authv1.IsAdminRequest{})
+		assert.Equal(t, codes.Internal, status.Code(err))
+
+		resp, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+		require.NoError(t, err)
+		assert.Equal(t, healthpb.HealthCheckResponse_SERVING, resp.GetStatus())
+	})
+
+	t.Run("shutdown stops serving", func(t *testing.T) {
+		shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		defer cancel()
+		require.NoError(t, server.Shutdown(shutdownCtx))
+
+		_, err := health.Check(ctx, &healthpb.HealthCheckRequest{})
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS security_events;
+
+DROP INDEX IF EXISTS idx_tokens_family_id;
+ALTER TABLE tokens DROP COLUMN IF EXISTS rotated_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS family_id;
\ No newline at end of file
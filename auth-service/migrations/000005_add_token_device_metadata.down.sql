@@ -0,0 +1,3 @@
+ALTER TABLE tokens DROP COLUMN IF EXISTS session_started_at;
+ALTER TABLE tokens DROP COLUMN IF EXISTS ip_address;
+ALTER TABLE tokens DROP COLUMN IF EXISTS user_agent;
\ No newline at end of file
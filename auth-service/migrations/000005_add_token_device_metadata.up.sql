@@ -0,0 +1,7 @@
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE tokens ADD COLUMN IF NOT EXISTS session_started_at TIMESTAMP WITH TIME ZONE;
+
+UPDATE tokens SET session_started_at = created_at WHERE session_started_at IS NULL;
+ALTER TABLE tokens ALTER COLUMN session_started_at SET DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE tokens ALTER COLUMN session_started_at SET NOT NULL;
\ No newline at end of file
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS username_history;
+DROP TABLE IF EXISTS email_change_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS pending_email;
+ALTER TABLE users DROP COLUMN IF EXISTS avatar_url;
+ALTER TABLE users DROP COLUMN IF EXISTS bio;
+ALTER TABLE users DROP COLUMN IF EXISTS display_name;
\ No newline at end of file
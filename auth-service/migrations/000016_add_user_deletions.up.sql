@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS user_deletions (
+    id BIGSERIAL PRIMARY KEY,
+    -- no foreign key: the user is gone by the time the row is read
+    user_id UUID NOT NULL,
+    deleted_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
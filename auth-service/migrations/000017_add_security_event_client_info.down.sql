@@ -0,0 +1,9 @@
+DELETE FROM permissions WHERE name = 'audit:read';
+
+DROP INDEX IF EXISTS idx_security_events_event_type;
+
+DELETE FROM security_events WHERE user_id IS NOT NULL AND user_id NOT IN (SELECT id FROM users);
+ALTER TABLE security_events ADD CONSTRAINT security_events_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+ALTER TABLE security_events DROP COLUMN IF EXISTS user_agent;
+ALTER TABLE security_events DROP COLUMN IF EXISTS ip_address;
\ No newline at end of file
@@ -0,0 +1,18 @@
+-- Security events double as the authentication audit log, so they record
+-- where each event came from.
+ALTER TABLE security_events ADD COLUMN IF NOT EXISTS ip_address VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE security_events ADD COLUMN IF NOT EXISTS user_agent TEXT NOT NULL DEFAULT '';
+
+-- The audit log outlives the accounts it is about: deleting a user keeps
+-- their events and the ID they were recorded under.
+ALTER TABLE security_events DROP CONSTRAINT IF EXISTS security_events_user_id_fkey;
+
+CREATE INDEX IF NOT EXISTS idx_security_events_event_type ON security_events(event_type, created_at);
+
+INSERT INTO permissions (name, description) VALUES
+    ('audit:read', 'View the authentication audit log')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'audit:read')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
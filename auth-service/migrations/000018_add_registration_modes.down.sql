@@ -0,0 +1,8 @@
+DELETE FROM permissions WHERE name = 'invites:manage';
+
+DROP INDEX IF EXISTS idx_users_pending_approval;
+
+ALTER TABLE users DROP COLUMN IF EXISTS pending_approval;
+ALTER TABLE users DROP COLUMN IF EXISTS invite_code_id;
+
+DROP TABLE IF EXISTS invite_codes;
\ No newline at end of file
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS invite_codes (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    -- SHA-256 of the code; the code itself is only shown once
+    code_hash VARCHAR(64) NOT NULL UNIQUE,
+    note VARCHAR(200) NOT NULL DEFAULT '',
+    max_uses INTEGER NOT NULL CHECK (max_uses > 0),
+    uses INTEGER NOT NULL DEFAULT 0,
+    -- NULL for codes that never expire
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE users ADD COLUMN IF NOT EXISTS invite_code_id UUID REFERENCES invite_codes(id) ON DELETE SET NULL;
+-- Accounts waiting for an admin to approve them under the approval
+-- registration mode
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_approval BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_pending_approval ON users(created_at) WHERE pending_approval;
+
+INSERT INTO permissions (name, description) VALUES
+    ('invites:manage', 'Create and delete invite codes')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'invites:manage')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,4 @@
+-- Service accounts are confidential clients that only use the client
+-- credentials grant. Their tokens identify the client itself, so internal
+-- services can call each other as a machine identity.
+ALTER TABLE oauth_clients ADD COLUMN IF NOT EXISTS service_account BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
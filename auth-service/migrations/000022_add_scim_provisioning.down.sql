@@ -0,0 +1 @@
+DELETE FROM permissions WHERE name = 'scim:provision';
\ No newline at end of file
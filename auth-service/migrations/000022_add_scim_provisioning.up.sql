@@ -0,0 +1,7 @@
+INSERT INTO permissions (name, description) VALUES
+    ('scim:provision', 'Provision users and groups from a directory over SCIM')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('admin', 'scim:provision')
+ON CONFLICT DO NOTHING;
\ No newline at end of file
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_login_attempts_last_failure_at;
+DROP INDEX IF EXISTS idx_tokens_expires_at;
\ No newline at end of file
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -12,6 +14,11 @@ import (
 	"github.com/greygn/forum-service/internal/service"
 	httpTransport "github.com/greygn/forum-service/internal/transport/http"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	authv1 "github.com/greygn/protos/auth/v1"
+	"github.com/greygn/protos/proto/forum"
 )
 
 func main() {
@@ -19,6 +26,9 @@ func main() {
 	defer logger.Sync()
 
 	cfg := config.Load()
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal("invalid configuration", zap.Error(err))
+	}
 
 	// Initialize PostgreSQL connection
 	db, err := repository.NewPostgresDB(cfg.PostgresURL)
@@ -34,15 +44,35 @@ func main() {
 
 	// Initialize repositories
 	messageRepo := repository.NewMessageRepository(db)
+	postRepo := repository.NewPostRepository(db)
 
 	// Initialize services
 	chatService := service.NewChatService(messageRepo, cfg, logger)
+	postService := service.NewPostService(postRepo)
 
 	// Start chat service
 	go chatService.Run()
 
+	// Keep authors of posts, comments and messages in step with renames and
+	// account deletions
+	authConn, err := grpc.NewClient(cfg.AuthServiceAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		logger.Fatal("failed to connect to auth service", zap.Error(err))
+	}
+	defer authConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	authClient := authv1.NewAuthServiceClient(authConn)
+	clientTokens := service.NewClientTokenSource(cfg.AuthServiceURL, cfg.AuthClientID, cfg.AuthClientSecret)
+	userSync := service.NewUserSync(authClient, clientTokens, repository.NewUserSyncRepository(db), cfg.UserSyncInterval, cfg.DeletedUserPolicy, logger)
+	go userSync.Run(ctx)
+
+	exportService := service.NewExportService(authClient, repository.NewUserExportRepository(db))
+
 	// Initialize HTTP server
-	httpServer := httpTransport.NewServer(chatService, logger)
+	httpServer := httpTransport.NewServer(chatService, postService, exportService, logger)
 
 	// Initialize auth middleware
 	authMiddleware := middleware.NewAuthMiddleware(cfg, logger)
@@ -51,6 +81,25 @@ func main() {
 	mux := http.NewServeMux()
 	mux.Handle("/", authMiddleware.Authenticate(httpServer))
 
+	// Serve the forum gRPC API. Callers authenticate with a user's access
+	// token or a service account token, never with request fields
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(authMiddleware.UnaryInterceptor()),
+		grpc.StreamInterceptor(authMiddleware.StreamInterceptor()),
+	)
+	forum.RegisterForumServiceServer(grpcServer, service.NewGRPCService(postService))
+
+	go func() {
+		listener, err := net.Listen("tcp", cfg.GRPCAddr)
+		if err != nil {
+			logger.Fatal("failed to listen for gRPC", zap.Error(err))
+		}
+		logger.Info("starting gRPC server", zap.String("addr", cfg.GRPCAddr))
+		if err := grpcServer.Serve(listener); err != nil {
+			logger.Fatal("failed to serve gRPC", zap.Error(err))
+		}
+	}()
+
 	// Start HTTP server
 	go func() {
 		logger.Info("starting HTTP server", zap.String("addr", cfg.HTTPAddr))
@@ -65,4 +114,5 @@ func main() {
 	<-quit
 
 	logger.Info("shutting down server")
+	grpcServer.GracefulStop()
 }
@@ -0,0 +1,19 @@
+package config
+
+import "testing"
+
+func TestValidate(t *testing.T) {
+	for _, policy := range []string{"anonymize", "delete"} {
+		t.Setenv("DELETED_USER_POLICY", policy)
+		if err := Load().Validate(); err != nil {
+			t.Errorf("expected policy %q to be accepted, got %v", policy, err)
+		}
+	}
+
+	for _, policy := range []string{"", "anonymise", "Delete"} {
+		t.Setenv("DELETED_USER_POLICY", policy)
+		if err := Load().Validate(); err == nil {
+			t.Errorf("expected policy %q to be rejected", policy)
+		}
+	}
+}
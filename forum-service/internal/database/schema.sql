@@ -5,7 +5,8 @@ CREATE TABLE IF NOT EXISTS posts (
     username VARCHAR(255) NOT NULL,
     title VARCHAR(255) NOT NULL,
     content TEXT NOT NULL,
-    created_at TIMESTAMP NOT NULL
+    created_at TIMESTAMP NOT NULL,
+    impersonator_id VARCHAR(36)
 );
 
 -- Create comments table
@@ -16,6 +17,7 @@ CREATE TABLE IF NOT EXISTS comments (
     username VARCHAR(255) NOT NULL,
     content TEXT NOT NULL,
     created_at TIMESTAMP NOT NULL,
+    impersonator_id VARCHAR(36),
     FOREIGN KEY (post_id) REFERENCES posts(id) ON DELETE CASCADE
 );
 
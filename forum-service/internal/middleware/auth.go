@@ -3,22 +3,76 @@ package middleware
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/golang-jwt/jwt/v5"
 	"github.com/greygn/forum-service/internal/config"
 	"go.uber.org/zap"
 )
 
+// signingMethods are the algorithms the auth service signs access tokens with.
+var signingMethods = []string{"RS256", "EdDSA"}
+
+// personalAccessTokenPrefix starts every personal access token issued by the
+// auth service.
+const personalAccessTokenPrefix = "gfp_"
+
+// tokenCheckInterval is how often the token of a connection that outlives its
+// request, such as a chat websocket, is checked again.
+const tokenCheckInterval = time.Minute
+
+// accessClaims are the fields of an auth service access token the forum uses.
+// The JSON names match both the token payload and the validate response.
+type accessClaims struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	CanWrite bool   `json:"can_write"`
+	// Scopes is only set for personal access tokens and tokens issued to
+	// OAuth clients; other tokens may be used for everything.
+	Scopes []string `json:"scopes"`
+	// ServiceAccount is set for client credentials tokens of service
+	// accounts, which have no user and act as the account named by the
+	// subject.
+	ServiceAccount bool `json:"service_account"`
+	// Actor names the admin acting as the user with an impersonation token.
+	Actor *actorClaim `json:"act"`
+	jwt.RegisteredClaims
+}
+
+type actorClaim struct {
+	Subject  string `json:"sub"`
+	Username string `json:"username"`
+}
+
+func (c *accessClaims) hasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
 type AuthMiddleware struct {
 	config *config.Config
 	logger *zap.Logger
+	keys   *KeySet
+	client *http.Client
+	// checkInterval is tokenCheckInterval, shortened in tests.
+	checkInterval time.Duration
 }
 
 func NewAuthMiddleware(config *config.Config, logger *zap.Logger) *AuthMiddleware {
 	return &AuthMiddleware{
 		config: config,
 		logger: logger,
+		keys:   NewKeySet(config.AuthJWKSURL, logger),
+		client: &http.Client{Timeout: 5 * time.Second},
+
+		checkInterval: tokenCheckInterval,
 	}
 }
 
@@ -36,50 +90,189 @@ func (m *AuthMiddleware) Authenticate(next http.Handler) http.Handler {
 			return
 		}
 
-		// Call auth service to validate token
-		client := &http.Client{}
-		req, err := http.NewRequest("GET", m.config.AuthServiceURL+"/api/v1/auth/validate", nil)
-		if err != nil {
-			m.logger.Error("failed to create request", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		// Service accounts are for internal calls over gRPC only
+		claims, err := m.verify(r.Context(), parts[1])
+		if err != nil || claims.UserID == "" {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
 			return
 		}
-		req.Header.Set("Authorization", authHeader)
 
-		resp, err := client.Do(req)
+		canWrite, err := authorize(claims, scopeArea(r), isWrite(r))
 		if err != nil {
-			m.logger.Error("failed to validate token", zap.Error(err))
-			http.Error(w, "Failed to validate token", http.StatusUnauthorized)
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
+		// Add user info to context
+		ctx := context.WithValue(r.Context(), "user_id", claims.UserID)
+		ctx = context.WithValue(ctx, "username", claims.Username)
+		ctx = context.WithValue(ctx, "can_write", canWrite)
+		if claims.Actor != nil {
+			// Let clients show that someone else is acting as the user
+			w.Header().Set("X-Impersonated-By", claims.Actor.Subject)
+			ctx = m.withImpersonator(ctx, claims, r.Method+" "+r.URL.Path)
 		}
-
-		// Parse response to get user info
-		var validateResp struct {
-			UserID   string `json:"user_id"`
-			Username string `json:"username"`
-			IsValid  bool   `json:"is_valid"`
+		// Chat sockets stay open long after this check
+		if scopeArea(r) == "chat" {
+			var stop context.CancelFunc
+			ctx, stop = m.watch(ctx, parts[1])
+			defer stop()
 		}
-		if err := json.NewDecoder(resp.Body).Decode(&validateResp); err != nil {
-			m.logger.Error("failed to decode response", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
-			return
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// withImpersonator records the admin acting through an impersonation token
+// in ctx, where handlers store it with what they write, and logs the request
+// so that everything done with the token can be traced back to the admin.
+func (m *AuthMiddleware) withImpersonator(ctx context.Context, claims *accessClaims, operation string) context.Context {
+	m.logger.Info("impersonated request",
+		zap.String("operation", operation),
+		zap.String("user_id", claims.UserID),
+		zap.String("impersonator_id", claims.Actor.Subject),
+		zap.String("impersonator", claims.Actor.Username),
+		zap.String("token_id", claims.ID),
+	)
+	ctx = context.WithValue(ctx, "impersonator_id", claims.Actor.Subject)
+	return context.WithValue(ctx, "impersonator_username", claims.Actor.Username)
+}
+
+// watch returns a context that is cancelled once token expires, is revoked
+// or its holder is suspended, so that connections opened with it can be
+// closed. Calling the returned function stops the checks.
+func (m *AuthMiddleware) watch(ctx context.Context, token string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		ticker := time.NewTicker(m.checkInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := m.verify(ctx, token); err != nil {
+					userID, _ := ctx.Value("user_id").(string)
+					m.logger.Info("closing connection of invalid token", zap.String("user_id", userID), zap.Error(err))
+					cancel()
+					return
+				}
+			}
 		}
+	}()
+	return ctx, cancel
+}
 
-		if !validateResp.IsValid {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
-			return
+// authorize checks that claims may be used for a request to area and
+// returns whether the caller may write there.
+func authorize(claims *accessClaims, area string, write bool) (bool, error) {
+	// Users who still have to verify their email may read but not post
+	canWrite := claims.CanWrite
+	if !canWrite && write {
+		return false, errors.New("Email address must be verified before posting")
+	}
+
+	// Personal access tokens and OAuth client tokens are limited to their scopes
+	if claims.Scopes != nil {
+		scope := area + ":read"
+		if write {
+			scope = area + ":write"
+		}
+		if !claims.hasScope(scope) {
+			return false, errors.New("Token is missing the " + scope + " scope")
 		}
+		// Chat messages are sent over the websocket opened with GET
+		if !claims.hasScope(area + ":write") {
+			canWrite = false
+		}
+	}
+	return canWrite, nil
+}
 
-		// Add user info to context
-		ctx := context.WithValue(r.Context(), "user_id", validateResp.UserID)
-		ctx = context.WithValue(ctx, "username", validateResp.Username)
+// verify checks a bearer token and returns its claims. The token belongs
+// either to a user or, with no UserID, to a service account.
+func (m *AuthMiddleware) verify(ctx context.Context, token string) (*accessClaims, error) {
+	if strings.HasPrefix(token, personalAccessTokenPrefix) {
+		// Personal access tokens are opaque, so only the auth service can check them
+		return m.validateRemote(ctx, "Bearer "+token)
+	}
 
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+	// Reject forged and expired tokens without a round trip
+	claims, err := m.verifyLocal(token)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the auth service knows which tokens have been revoked, and which
+	// service accounts have been deleted
+	active, err := m.validateRemote(ctx, "Bearer "+token)
+	if err != nil {
+		return nil, err
+	}
+	// The validate response has no registered claims; keep the token's
+	active.RegisteredClaims = claims.RegisteredClaims
+	return active, nil
+}
+
+func (m *AuthMiddleware) verifyLocal(token string) (*accessClaims, error) {
+	claims := &accessClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, m.keys.Keyfunc, jwt.WithValidMethods(signingMethods))
+	if err != nil {
+		return nil, err
+	}
+	if claims.UserID == "" && (!claims.ServiceAccount || claims.Subject == "") {
+		return nil, errors.New("invalid user id in token")
+	}
+	return claims, nil
+}
+
+// validateRemote asks the auth service to validate the token.
+func (m *AuthMiddleware) validateRemote(ctx context.Context, authHeader string) (*accessClaims, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, m.config.AuthServiceURL+"/api/v1/auth/validate", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", authHeader)
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		m.logger.Error("failed to validate token", zap.Error(err))
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New("invalid token")
+	}
+
+	var validateResp struct {
+		accessClaims
+		IsValid bool `json:"is_valid"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&validateResp); err != nil {
+		m.logger.Error("failed to decode response", zap.Error(err))
+		return nil, err
+	}
+
+	if !validateResp.IsValid {
+		return nil, errors.New("invalid token")
+	}
+	return &validateResp.accessClaims, nil
+}
+
+// scopeArea returns which group of scopes guards the request.
+func scopeArea(r *http.Request) string {
+	if strings.HasSuffix(r.URL.Path, "/ws") {
+		return "chat"
+	}
+	return "posts"
+}
+
+func isWrite(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
 }
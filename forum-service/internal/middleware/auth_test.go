@@ -0,0 +1,354 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/greygn/forum-service/internal/config"
+	"go.uber.org/zap"
+)
+
+const testKeyID = "test-key"
+
+// fakeAuthService publishes a signing key and validates tokens signed with
+// it, like the auth service's JWKS and validate endpoints.
+type fakeAuthService struct {
+	public  ed25519.PublicKey
+	private ed25519.PrivateKey
+
+	mu sync.Mutex
+	// revoked holds the jti of revoked tokens.
+	revoked map[string]bool
+	// suspended holds the IDs of suspended users.
+	suspended map[string]bool
+	// deleted holds the IDs of deleted service accounts.
+	deleted map[string]bool
+	// validations counts requests to the validate endpoint.
+	validations int
+}
+
+func (a *fakeAuthService) revoke(jti string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.revoked[jti] = true
+}
+
+func (a *fakeAuthService) suspend(userID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.suspended[userID] = true
+}
+
+func (a *fakeAuthService) deleteClient(clientID string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.deleted[clientID] = true
+}
+
+func (a *fakeAuthService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.URL.Path {
+	case "/.well-known/jwks.json":
+		json.NewEncoder(w).Encode(map[string]any{
+			"keys": []jwk{{
+				KeyType: "OKP",
+				KeyID:   testKeyID,
+				Curve:   "Ed25519",
+				X:       base64.RawURLEncoding.EncodeToString(a.public),
+			}},
+		})
+	case "/api/v1/auth/validate":
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		a.validations++
+
+		claims := &accessClaims{}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (interface{}, error) {
+			return a.public, nil
+		})
+		if err != nil || a.revoked[claims.ID] || a.deleted[claims.Subject] {
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid token"})
+			return
+		}
+		if a.suspended[claims.UserID] {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{"error": "account suspended"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"user_id":         claims.UserID,
+			"username":        claims.Username,
+			"can_write":       claims.CanWrite,
+			"scopes":          claims.Scopes,
+			"act":             claims.Actor,
+			"service_account": claims.ServiceAccount,
+			"is_valid":        true,
+		})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// newTestMiddleware returns a middleware that trusts tokens signed by the
+// returned fake auth service.
+func newTestMiddleware(t *testing.T) (*AuthMiddleware, *fakeAuthService) {
+	t.Helper()
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	auth := &fakeAuthService{public: public, private: private, revoked: make(map[string]bool), suspended: make(map[string]bool), deleted: make(map[string]bool)}
+
+	server := httptest.NewServer(auth)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{AuthServiceURL: server.URL, AuthJWKSURL: server.URL + "/.well-known/jwks.json"}
+	return NewAuthMiddleware(cfg, zap.NewNop()), auth
+}
+
+func signToken(t *testing.T, key ed25519.PrivateKey, claims *accessClaims) string {
+	t.Helper()
+
+	claims.ID = uuid.New().String()
+	claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(time.Hour))
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthenticate(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		claims *accessClaims
+		// wantCode is the response status; 200 means the request reached
+		// the handler.
+		wantCode     int
+		wantCanWrite bool
+	}{
+		{
+			name:         "verified user writes",
+			method:       http.MethodPost,
+			path:         "/api/v1/posts",
+			claims:       &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true},
+			wantCode:     http.StatusOK,
+			wantCanWrite: true,
+		},
+		{
+			name:     "unverified user reads",
+			method:   http.MethodGet,
+			path:     "/api/v1/posts",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice"},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "unverified user writes",
+			method:   http.MethodPut,
+			path:     "/api/v1/posts/post-1",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice"},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:         "scoped token writes",
+			method:       http.MethodDelete,
+			path:         "/api/v1/posts/post-1",
+			claims:       &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true, Scopes: []string{"posts:read", "posts:write"}},
+			wantCode:     http.StatusOK,
+			wantCanWrite: true,
+		},
+		{
+			name:     "read-only token reads",
+			method:   http.MethodGet,
+			path:     "/api/v1/posts",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true, Scopes: []string{"posts:read"}},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "read-only token writes",
+			method:   http.MethodPost,
+			path:     "/api/v1/posts/post-1/comments",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true, Scopes: []string{"posts:read"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "token without scopes for the area",
+			method:   http.MethodGet,
+			path:     "/api/v1/posts",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true, Scopes: []string{"chat:read", "chat:write"}},
+			wantCode: http.StatusForbidden,
+		},
+		{
+			name:     "chat token without write scope",
+			method:   http.MethodGet,
+			path:     "/api/v1/ws",
+			claims:   &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true, Scopes: []string{"chat:read"}},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:     "service account",
+			method:   http.MethodGet,
+			path:     "/api/v1/posts",
+			claims:   &accessClaims{ServiceAccount: true, RegisteredClaims: jwt.RegisteredClaims{Subject: "client-1"}},
+			wantCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var canWrite bool
+			handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				canWrite, _ = r.Context().Value("can_write").(bool)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+signToken(t, auth.private, tt.claims))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantCode, rec.Code, rec.Body.String())
+			}
+			if canWrite != tt.wantCanWrite {
+				t.Errorf("expected can_write %v, got %v", tt.wantCanWrite, canWrite)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRejectsBadTokens(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+	_, otherKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be reached")
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+	}{
+		{"missing header", ""},
+		{"not bearer", "Basic dXNlcjpwYXNz"},
+		{"garbage", "Bearer not-a-token"},
+		{"unknown signer", "Bearer " + signToken(t, otherKey, &accessClaims{UserID: "user-1", CanWrite: true})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/posts", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+			}
+		})
+	}
+
+	// Forged tokens are rejected without asking the auth service
+	if auth.validations != 0 {
+		t.Errorf("expected no validate requests, got %d", auth.validations)
+	}
+}
+
+func TestAuthenticateRejectsRevokedTokens(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+	handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	claims := &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true}
+	token := signToken(t, auth.private, claims)
+	send := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/posts", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	if code := send(); code != http.StatusOK {
+		t.Fatalf("expected status %d before revocation, got %d", http.StatusOK, code)
+	}
+
+	// The token is still signed and unexpired, but the auth service has revoked it
+	auth.revoke(claims.ID)
+	if code := send(); code != http.StatusUnauthorized {
+		t.Errorf("expected status %d after revocation, got %d", http.StatusUnauthorized, code)
+	}
+}
+
+func TestAuthenticateRejectsSuspendedUsers(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+	handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	token := signToken(t, auth.private, &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true})
+	auth.suspend("user-1")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/posts", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+	}
+}
+
+func TestAuthenticateEndsChatOfSuspendedUsers(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+	m.checkInterval = 10 * time.Millisecond
+
+	opened := make(chan struct{})
+	ended := make(chan struct{})
+	handler := m.Authenticate(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(opened)
+		// Stands in for a websocket, which is closed when the context ends
+		select {
+		case <-r.Context().Done():
+			close(ended)
+		case <-time.After(5 * time.Second):
+		}
+	}))
+
+	token := signToken(t, auth.private, &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true})
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/ws", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	go handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	<-opened
+	select {
+	case <-ended:
+		t.Fatal("expected the connection to stay open while the token is valid")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	auth.suspend("user-1")
+	select {
+	case <-ended:
+	case <-time.After(time.Second):
+		t.Fatal("expected the connection to be closed after the suspension")
+	}
+}
@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryInterceptor(t *testing.T) {
+	m, auth := newTestMiddleware(t)
+	interceptor := m.UnaryInterceptor()
+
+	// call sends token to CreatePost and returns the acting user the handler
+	// saw, or the error.
+	call := func(token string) (string, error) {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+		info := &grpc.UnaryServerInfo{FullMethod: "/forum.ForumService/CreatePost"}
+		resp, err := interceptor(ctx, nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+			userID, _ := ctx.Value("user_id").(string)
+			return userID, nil
+		})
+		if err != nil {
+			return "", err
+		}
+		return resp.(string), nil
+	}
+
+	t.Run("user", func(t *testing.T) {
+		token := signToken(t, auth.private, &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true})
+
+		userID, err := call(token)
+		if err != nil {
+			t.Fatalf("expected the call to be allowed, got %v", err)
+		}
+		if userID != "user-1" {
+			t.Errorf("expected the call to act as user-1, got %q", userID)
+		}
+	})
+
+	t.Run("service account", func(t *testing.T) {
+		claims := &accessClaims{
+			Username:         "importer",
+			CanWrite:         true,
+			Scopes:           []string{"posts:write"},
+			ServiceAccount:   true,
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "client-1"},
+		}
+		token := signToken(t, auth.private, claims)
+
+		userID, err := call(token)
+		if err != nil {
+			t.Fatalf("expected the call to be allowed, got %v", err)
+		}
+		if userID != "client-1" {
+			t.Errorf("expected the call to act as client-1, got %q", userID)
+		}
+
+		// The account is deleted, which revokes its tokens
+		auth.deleteClient("client-1")
+		if _, err := call(token); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("expected %s after the account was deleted, got %v", codes.Unauthenticated, err)
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		claims := &accessClaims{UserID: "user-1", Username: "alice", CanWrite: true}
+		token := signToken(t, auth.private, claims)
+		auth.revoke(claims.ID)
+
+		if _, err := call(token); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("expected %s, got %v", codes.Unauthenticated, err)
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched keys are trusted before the
+	// set is downloaded again.
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval limits how often a token with an unknown kid
+	// can trigger a download.
+	jwksMinRefreshInterval = time.Minute
+)
+
+var errUnknownKey = errors.New("unknown signing key")
+
+// jwk is one key of the auth service's /.well-known/jwks.json.
+type jwk struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	N       string `json:"n"`
+	E       string `json:"e"`
+	Curve   string `json:"crv"`
+	X       string `json:"x"`
+}
+
+// KeySet caches the auth service's public keys so that access tokens can be
+// verified without a request per token. Keys are looked up by the token's
+// kid header, and an unknown kid makes the set refresh so that rotated keys
+// are picked up.
+type KeySet struct {
+	url    string
+	client *http.Client
+	logger *zap.Logger
+
+	mu        sync.Mutex
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+func NewKeySet(url string, logger *zap.Logger) *KeySet {
+	return &KeySet{
+		url:    url,
+		client: &http.Client{Timeout: 5 * time.Second},
+		logger: logger,
+		keys:   make(map[string]interface{}),
+	}
+}
+
+// Keyfunc returns the public key for a token, for use with jwt.Parse.
+func (k *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	key, ok := k.keys[kid]
+	stale := time.Since(k.fetchedAt) > jwksRefreshInterval
+	if (!ok || stale) && time.Since(k.fetchedAt) > jwksMinRefreshInterval {
+		if err := k.refresh(); err != nil {
+			k.logger.Error("failed to fetch jwks", zap.Error(err))
+		}
+		key, ok = k.keys[kid]
+	}
+	if !ok {
+		return nil, errUnknownKey
+	}
+	return key, nil
+}
+
+// refresh downloads the key set. The caller must hold k.mu.
+func (k *KeySet) refresh() error {
+	k.fetchedAt = time.Now()
+
+	resp, err := k.client.Get(k.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return err
+	}
+
+	keys := make(map[string]interface{})
+	for _, key := range set.Keys {
+		public, err := key.publicKey()
+		if err != nil {
+			k.logger.Warn("skipping jwks key", zap.String("kid", key.KeyID), zap.Error(err))
+			continue
+		}
+		keys[key.KeyID] = public
+	}
+	k.keys = keys
+	return nil
+}
+
+func (key jwk) publicKey() (interface{}, error) {
+	switch key.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "OKP":
+		if key.Curve != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", key.Curve)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", key.KeyType)
+	}
+}
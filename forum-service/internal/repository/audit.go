@@ -0,0 +1,60 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// Actions and targets recorded in the audit log.
+const (
+	AuditCreate = "create"
+	AuditUpdate = "update"
+	AuditDelete = "delete"
+
+	AuditTargetPost    = "post"
+	AuditTargetComment = "comment"
+	AuditTargetMessage = "message"
+)
+
+// AuditEntry is one row of the audit log: ActorID changed the target, with
+// ImpersonatorID acting as them if it is set.
+type AuditEntry struct {
+	ActorID        string
+	ImpersonatorID string
+	Action         string
+	TargetType     string
+	TargetID       string
+}
+
+// execAudited runs a write and, if it changed a row, records entry in the
+// audit log within the same transaction, so that nothing is written without
+// a record of who wrote it.
+func execAudited(ctx context.Context, db *sql.DB, entry AuditEntry, query string, args ...interface{}) (int64, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, nil
+	}
+
+	auditQuery := `
+		INSERT INTO audit_log (actor_id, impersonator_id, action, target_type, target_id)
+		VALUES ($1, NULLIF($2, ''), $3, $4, $5)
+	`
+	if _, err := tx.ExecContext(ctx, auditQuery, entry.ActorID, entry.ImpersonatorID, entry.Action, entry.TargetType, entry.TargetID); err != nil {
+		return 0, err
+	}
+
+	return rows, tx.Commit()
+}
@@ -15,6 +15,9 @@ type Message struct {
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// ImpersonatorID is the admin who last wrote the message while acting
+	// as the user, if any. Every write is also kept in the audit log.
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
 }
 
 type MessageRepository interface {
@@ -22,7 +25,7 @@ type MessageRepository interface {
 	GetAll(ctx context.Context) ([]Message, error)
 	GetByID(ctx context.Context, id string) (*Message, error)
 	Update(ctx context.Context, message *Message) error
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id, userID, impersonatorID string) error
 	DeleteOld(ctx context.Context, olderThan time.Duration) error
 }
 
@@ -36,18 +39,19 @@ func NewMessageRepository(db *sql.DB) MessageRepository {
 
 func (r *messageRepository) Create(ctx context.Context, message *Message) error {
 	query := `
-		INSERT INTO messages (id, user_id, username, content, created_at)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO messages (id, user_id, username, content, created_at, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
 	`
 	message.ID = uuid.New().String()
 	message.CreatedAt = time.Now()
-	_, err := r.db.ExecContext(ctx, query, message.ID, message.UserID, message.Username, message.Content, message.CreatedAt)
+	entry := AuditEntry{ActorID: message.UserID, ImpersonatorID: message.ImpersonatorID, Action: AuditCreate, TargetType: AuditTargetMessage, TargetID: message.ID}
+	_, err := execAudited(ctx, r.db, entry, query, message.ID, message.UserID, message.Username, message.Content, message.CreatedAt, message.ImpersonatorID)
 	return err
 }
 
 func (r *messageRepository) GetAll(ctx context.Context) ([]Message, error) {
 	query := `
-		SELECT id, user_id, username, content, created_at
+		SELECT id, user_id, username, content, created_at, COALESCE(impersonator_id, '')
 		FROM messages
 		ORDER BY created_at DESC
 	`
@@ -60,7 +64,7 @@ func (r *messageRepository) GetAll(ctx context.Context) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt, &msg.ImpersonatorID); err != nil {
 			return nil, err
 		}
 		messages = append(messages, msg)
@@ -70,12 +74,12 @@ func (r *messageRepository) GetAll(ctx context.Context) ([]Message, error) {
 
 func (r *messageRepository) GetByID(ctx context.Context, id string) (*Message, error) {
 	query := `
-		SELECT id, user_id, username, content, created_at
+		SELECT id, user_id, username, content, created_at, COALESCE(impersonator_id, '')
 		FROM messages
 		WHERE id = $1
 	`
 	var msg Message
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&msg.ID, &msg.UserID, &msg.Username, &msg.Content, &msg.CreatedAt, &msg.ImpersonatorID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -88,14 +92,11 @@ func (r *messageRepository) GetByID(ctx context.Context, id string) (*Message, e
 func (r *messageRepository) Update(ctx context.Context, message *Message) error {
 	query := `
 		UPDATE messages
-		SET content = $1
+		SET content = $1, impersonator_id = NULLIF($4, '')
 		WHERE id = $2 AND user_id = $3
 	`
-	result, err := r.db.ExecContext(ctx, query, message.Content, message.ID, message.UserID)
-	if err != nil {
-		return err
-	}
-	rows, err := result.RowsAffected()
+	entry := AuditEntry{ActorID: message.UserID, ImpersonatorID: message.ImpersonatorID, Action: AuditUpdate, TargetType: AuditTargetMessage, TargetID: message.ID}
+	rows, err := execAudited(ctx, r.db, entry, query, message.Content, message.ID, message.UserID, message.ImpersonatorID)
 	if err != nil {
 		return err
 	}
@@ -105,12 +106,13 @@ func (r *messageRepository) Update(ctx context.Context, message *Message) error
 	return nil
 }
 
-func (r *messageRepository) Delete(ctx context.Context, id string) error {
+func (r *messageRepository) Delete(ctx context.Context, id, userID, impersonatorID string) error {
 	query := `
 		DELETE FROM messages
-		WHERE id = $1
+		WHERE id = $1 AND user_id = $2
 	`
-	_, err := r.db.ExecContext(ctx, query, id)
+	entry := AuditEntry{ActorID: userID, ImpersonatorID: impersonatorID, Action: AuditDelete, TargetType: AuditTargetMessage, TargetID: id}
+	_, err := execAudited(ctx, r.db, entry, query, id, userID)
 	return err
 }
 
@@ -16,6 +16,9 @@ type Post struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// ImpersonatorID is the admin who last wrote the post while acting as
+	// the user, if any. Every write is also kept in the audit log.
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
 }
 
 type Comment struct {
@@ -25,6 +28,9 @@ type Comment struct {
 	Username  string    `json:"username"`
 	Content   string    `json:"content"`
 	CreatedAt time.Time `json:"created_at"`
+	// ImpersonatorID is the admin who last wrote the comment while acting
+	// as the user, if any. Every write is also kept in the audit log.
+	ImpersonatorID string `json:"impersonator_id,omitempty"`
 }
 
 type PostRepository interface {
@@ -33,7 +39,7 @@ type PostRepository interface {
 	GetAllPosts(ctx context.Context) ([]Post, error)
 	GetPostByID(ctx context.Context, id string) (*Post, error)
 	UpdatePost(ctx context.Context, post *Post) error
-	DeletePost(ctx context.Context, id string) error
+	DeletePost(ctx context.Context, id, userID, impersonatorID string) error
 	DeleteOldPosts(ctx context.Context, olderThan time.Duration) error
 
 	// Comment operations
@@ -41,7 +47,7 @@ type PostRepository interface {
 	CreateComment(ctx context.Context, comment *Comment) error
 	GetCommentByID(ctx context.Context, id string) (*Comment, error)
 	UpdateComment(ctx context.Context, comment *Comment) error
-	DeleteComment(ctx context.Context, id string) error
+	DeleteComment(ctx context.Context, id, userID, impersonatorID string) error
 }
 
 type postRepository struct {
@@ -54,18 +60,19 @@ func NewPostRepository(db *sql.DB) PostRepository {
 
 func (r *postRepository) CreatePost(ctx context.Context, post *Post) error {
 	query := `
-		INSERT INTO posts (id, user_id, username, title, content, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO posts (id, user_id, username, title, content, created_at, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
 	`
 	post.ID = uuid.New().String()
 	post.CreatedAt = time.Now()
-	_, err := r.db.ExecContext(ctx, query, post.ID, post.UserID, post.Username, post.Title, post.Content, post.CreatedAt)
+	entry := AuditEntry{ActorID: post.UserID, ImpersonatorID: post.ImpersonatorID, Action: AuditCreate, TargetType: AuditTargetPost, TargetID: post.ID}
+	_, err := execAudited(ctx, r.db, entry, query, post.ID, post.UserID, post.Username, post.Title, post.Content, post.CreatedAt, post.ImpersonatorID)
 	return err
 }
 
 func (r *postRepository) GetAllPosts(ctx context.Context) ([]Post, error) {
 	query := `
-		SELECT id, user_id, username, title, content, created_at
+		SELECT id, user_id, username, title, content, created_at, COALESCE(impersonator_id, '')
 		FROM posts
 		ORDER BY created_at DESC
 	`
@@ -78,7 +85,7 @@ func (r *postRepository) GetAllPosts(ctx context.Context) ([]Post, error) {
 	var posts []Post
 	for rows.Next() {
 		var post Post
-		if err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedAt); err != nil {
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedAt, &post.ImpersonatorID); err != nil {
 			return nil, err
 		}
 		posts = append(posts, post)
@@ -88,12 +95,12 @@ func (r *postRepository) GetAllPosts(ctx context.Context) ([]Post, error) {
 
 func (r *postRepository) GetPostByID(ctx context.Context, id string) (*Post, error) {
 	query := `
-		SELECT id, user_id, username, title, content, created_at
+		SELECT id, user_id, username, title, content, created_at, COALESCE(impersonator_id, '')
 		FROM posts
 		WHERE id = $1
 	`
 	var post Post
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedAt, &post.ImpersonatorID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -106,14 +113,11 @@ func (r *postRepository) GetPostByID(ctx context.Context, id string) (*Post, err
 func (r *postRepository) UpdatePost(ctx context.Context, post *Post) error {
 	query := `
 		UPDATE posts
-		SET title = $1, content = $2
+		SET title = $1, content = $2, impersonator_id = NULLIF($5, '')
 		WHERE id = $3 AND user_id = $4
 	`
-	result, err := r.db.ExecContext(ctx, query, post.Title, post.Content, post.ID, post.UserID)
-	if err != nil {
-		return err
-	}
-	rows, err := result.RowsAffected()
+	entry := AuditEntry{ActorID: post.UserID, ImpersonatorID: post.ImpersonatorID, Action: AuditUpdate, TargetType: AuditTargetPost, TargetID: post.ID}
+	rows, err := execAudited(ctx, r.db, entry, query, post.Title, post.Content, post.ID, post.UserID, post.ImpersonatorID)
 	if err != nil {
 		return err
 	}
@@ -123,12 +127,13 @@ func (r *postRepository) UpdatePost(ctx context.Context, post *Post) error {
 	return nil
 }
 
-func (r *postRepository) DeletePost(ctx context.Context, id string) error {
+func (r *postRepository) DeletePost(ctx context.Context, id, userID, impersonatorID string) error {
 	query := `
 		DELETE FROM posts
-		WHERE id = $1
+		WHERE id = $1 AND user_id = $2
 	`
-	_, err := r.db.ExecContext(ctx, query, id)
+	entry := AuditEntry{ActorID: userID, ImpersonatorID: impersonatorID, Action: AuditDelete, TargetType: AuditTargetPost, TargetID: id}
+	_, err := execAudited(ctx, r.db, entry, query, id, userID)
 	return err
 }
 
@@ -143,7 +148,7 @@ func (r *postRepository) DeleteOldPosts(ctx context.Context, olderThan time.Dura
 
 func (r *postRepository) GetComments(ctx context.Context, postID string) ([]Comment, error) {
 	query := `
-		SELECT id, post_id, user_id, username, content, created_at
+		SELECT id, post_id, user_id, username, content, created_at, COALESCE(impersonator_id, '')
 		FROM comments
 		WHERE post_id = $1
 		ORDER BY created_at ASC
@@ -157,7 +162,7 @@ func (r *postRepository) GetComments(ctx context.Context, postID string) ([]Comm
 	var comments []Comment
 	for rows.Next() {
 		var comment Comment
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content, &comment.CreatedAt); err != nil {
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.ImpersonatorID); err != nil {
 			return nil, err
 		}
 		comments = append(comments, comment)
@@ -167,23 +172,24 @@ func (r *postRepository) GetComments(ctx context.Context, postID string) ([]Comm
 
 func (r *postRepository) CreateComment(ctx context.Context, comment *Comment) error {
 	query := `
-		INSERT INTO comments (id, post_id, user_id, username, content, created_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		INSERT INTO comments (id, post_id, user_id, username, content, created_at, impersonator_id)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
 	`
 	comment.ID = uuid.New().String()
 	comment.CreatedAt = time.Now()
-	_, err := r.db.ExecContext(ctx, query, comment.ID, comment.PostID, comment.UserID, comment.Username, comment.Content, comment.CreatedAt)
+	entry := AuditEntry{ActorID: comment.UserID, ImpersonatorID: comment.ImpersonatorID, Action: AuditCreate, TargetType: AuditTargetComment, TargetID: comment.ID}
+	_, err := execAudited(ctx, r.db, entry, query, comment.ID, comment.PostID, comment.UserID, comment.Username, comment.Content, comment.CreatedAt, comment.ImpersonatorID)
 	return err
 }
 
 func (r *postRepository) GetCommentByID(ctx context.Context, id string) (*Comment, error) {
 	query := `
-		SELECT id, post_id, user_id, username, content, created_at
+		SELECT id, post_id, user_id, username, content, created_at, COALESCE(impersonator_id, '')
 		FROM comments
 		WHERE id = $1
 	`
 	var comment Comment
-	err := r.db.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content, &comment.CreatedAt)
+	err := r.db.QueryRowContext(ctx, query, id).Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content, &comment.CreatedAt, &comment.ImpersonatorID)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, nil
@@ -196,14 +202,11 @@ func (r *postRepository) GetCommentByID(ctx context.Context, id string) (*Commen
 func (r *postRepository) UpdateComment(ctx context.Context, comment *Comment) error {
 	query := `
 		UPDATE comments
-		SET content = $1
+		SET content = $1, impersonator_id = NULLIF($4, '')
 		WHERE id = $2 AND user_id = $3
 	`
-	result, err := r.db.ExecContext(ctx, query, comment.Content, comment.ID, comment.UserID)
-	if err != nil {
-		return err
-	}
-	rows, err := result.RowsAffected()
+	entry := AuditEntry{ActorID: comment.UserID, ImpersonatorID: comment.ImpersonatorID, Action: AuditUpdate, TargetType: AuditTargetComment, TargetID: comment.ID}
+	rows, err := execAudited(ctx, r.db, entry, query, comment.Content, comment.ID, comment.UserID, comment.ImpersonatorID)
 	if err != nil {
 		return err
 	}
@@ -213,11 +216,12 @@ func (r *postRepository) UpdateComment(ctx context.Context, comment *Comment) er
 	return nil
 }
 
-func (r *postRepository) DeleteComment(ctx context.Context, id string) error {
+func (r *postRepository) DeleteComment(ctx context.Context, id, userID, impersonatorID string) error {
 	query := `
 		DELETE FROM comments
-		WHERE id = $1
+		WHERE id = $1 AND user_id = $2
 	`
-	_, err := r.db.ExecContext(ctx, query, id)
+	entry := AuditEntry{ActorID: userID, ImpersonatorID: impersonatorID, Action: AuditDelete, TargetType: AuditTargetComment, TargetID: id}
+	_, err := execAudited(ctx, r.db, entry, query, id, userID)
 	return err
 }
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// UserContent is everything a user has written on the forum.
+type UserContent struct {
+	Posts    []Post    `json:"posts"`
+	Comments []Comment `json:"comments"`
+	Messages []Message `json:"messages"`
+}
+
+// UserExportRepository loads a user's content for their data export.
+type UserExportRepository interface {
+	GetUserContent(ctx context.Context, userID string) (*UserContent, error)
+}
+
+type userExportRepository struct {
+	db *sql.DB
+}
+
+func NewUserExportRepository(db *sql.DB) UserExportRepository {
+	return &userExportRepository{db: db}
+}
+
+func (r *userExportRepository) GetUserContent(ctx context.Context, userID string) (*UserContent, error) {
+	content := &UserContent{
+		Posts:    []Post{},
+		Comments: []Comment{},
+		Messages: []Message{},
+	}
+
+	query := `
+		SELECT id, user_id, username, title, content, created_at
+		FROM posts
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+	rows, err := r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var post Post
+		if err := rows.Scan(&post.ID, &post.UserID, &post.Username, &post.Title, &post.Content, &post.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		content.Posts = append(content.Posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, post_id, user_id, username, content, created_at
+		FROM comments
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+	rows, err = r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var comment Comment
+		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Username, &comment.Content, &comment.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		content.Comments = append(content.Comments, comment)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	query = `
+		SELECT id, user_id, username, content, created_at
+		FROM messages
+		WHERE user_id = $1
+		ORDER BY created_at ASC
+	`
+	rows, err = r.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var message Message
+		if err := rows.Scan(&message.ID, &message.UserID, &message.Username, &message.Content, &message.CreatedAt); err != nil {
+			return nil, err
+		}
+		content.Messages = append(content.Messages, message)
+	}
+	return content, rows.Err()
+}
@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+// DeletedUserID and DeletedUsername replace the author of content whose
+// author deleted their account, when the content is kept.
+const (
+	DeletedUserID   = "00000000-0000-0000-0000-000000000000"
+	DeletedUsername = "deleted user"
+)
+
+// UserSyncRepository keeps the usernames copied into posts, comments and
+// messages in step with the auth service.
+type UserSyncRepository interface {
+	// RenameUser sets the username on everything the user has written.
+	RenameUser(ctx context.Context, userID, username string) error
+	// DeleteUser removes everything the user has written, along with the
+	// comments other users left on their posts.
+	DeleteUser(ctx context.Context, userID string) error
+	// AnonymizeUser hands everything the user has written to the deleted
+	// user placeholder.
+	AnonymizeUser(ctx context.Context, userID string) error
+	// GetCursor returns how far the named feed has been read, or 0.
+	GetCursor(ctx context.Context, name string) (int64, error)
+	SetCursor(ctx context.Context, name string, position int64) error
+}
+
+type userSyncRepository struct {
+	db *sql.DB
+}
+
+func NewUserSyncRepository(db *sql.DB) UserSyncRepository {
+	return &userSyncRepository{db: db}
+}
+
+func (r *userSyncRepository) RenameUser(ctx context.Context, userID, username string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`UPDATE posts SET username = $1 WHERE user_id = $2`,
+		`UPDATE comments SET username = $1 WHERE user_id = $2`,
+		`UPDATE messages SET username = $1 WHERE user_id = $2`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, username, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *userSyncRepository) DeleteUser(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`DELETE FROM comments WHERE post_id IN (SELECT id FROM posts WHERE user_id = $1)`,
+		`DELETE FROM comments WHERE user_id = $1`,
+		`DELETE FROM posts WHERE user_id = $1`,
+		`DELETE FROM messages WHERE user_id = $1`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *userSyncRepository) AnonymizeUser(ctx context.Context, userID string) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		`UPDATE posts SET user_id = $1, username = $2 WHERE user_id = $3`,
+		`UPDATE comments SET user_id = $1, username = $2 WHERE user_id = $3`,
+		`UPDATE messages SET user_id = $1, username = $2 WHERE user_id = $3`,
+	} {
+		if _, err := tx.ExecContext(ctx, query, DeletedUserID, DeletedUsername, userID); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (r *userSyncRepository) GetCursor(ctx context.Context, name string) (int64, error) {
+	query := `
+		SELECT position
+		FROM sync_cursors
+		WHERE name = $1
+	`
+	var position int64
+	err := r.db.QueryRowContext(ctx, query, name).Scan(&position)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return position, err
+}
+
+func (r *userSyncRepository) SetCursor(ctx context.Context, name string, position int64) error {
+	query := `
+		INSERT INTO sync_cursors (name, position)
+		VALUES ($1, $2)
+		ON CONFLICT (name) DO UPDATE SET position = EXCLUDED.position
+	`
+	_, err := r.db.ExecContext(ctx, query, name, position)
+	return err
+}
@@ -26,6 +26,10 @@ type Client struct {
 	Send     chan []byte
 	UserID   string
 	Username string
+	// CanWrite is false for users who must verify their email first.
+	CanWrite bool
+	// ImpersonatorID is the admin acting as the user, if any.
+	ImpersonatorID string
 }
 
 type ChatService struct {
@@ -92,16 +96,17 @@ func (s *ChatService) Broadcast(message []byte) {
 	s.broadcast <- message
 }
 
-func (s *ChatService) SaveMessage(ctx context.Context, userID string, username string, content string) error {
+func (s *ChatService) SaveMessage(ctx context.Context, userID, username, impersonatorID, content string) error {
 	if content == "" {
 		return errors.New("content is required")
 	}
 
 	message := &repository.Message{
-		UserID:    userID,
-		Username:  username,
-		Content:   content,
-		CreatedAt: time.Now(),
+		UserID:         userID,
+		Username:       username,
+		Content:        content,
+		CreatedAt:      time.Now(),
+		ImpersonatorID: impersonatorID,
 	}
 
 	if err := s.messageRepo.Create(ctx, message); err != nil {
@@ -127,7 +132,7 @@ func (s *ChatService) GetMessage(ctx context.Context, messageID string) (*reposi
 	return s.messageRepo.GetByID(ctx, messageID)
 }
 
-func (s *ChatService) UpdateMessage(ctx context.Context, messageID string, userID string, content string) error {
+func (s *ChatService) UpdateMessage(ctx context.Context, messageID, userID, impersonatorID, content string) error {
 	if content == "" {
 		return errors.New("content is required")
 	}
@@ -142,10 +147,11 @@ func (s *ChatService) UpdateMessage(ctx context.Context, messageID string, userI
 	}
 
 	message.Content = content
+	message.ImpersonatorID = impersonatorID
 	return s.messageRepo.Update(ctx, message)
 }
 
-func (s *ChatService) DeleteMessage(ctx context.Context, messageID string, userID string) error {
+func (s *ChatService) DeleteMessage(ctx context.Context, messageID, userID, impersonatorID string) error {
 	message, err := s.messageRepo.GetByID(ctx, messageID)
 	if err != nil {
 		return err
@@ -155,5 +161,5 @@ func (s *ChatService) DeleteMessage(ctx context.Context, messageID string, userI
 		return errors.New("unauthorized: only message owner can delete")
 	}
 
-	return s.messageRepo.Delete(ctx, messageID)
+	return s.messageRepo.Delete(ctx, messageID, userID, impersonatorID)
 }
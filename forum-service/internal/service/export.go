@@ -0,0 +1,84 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/greygn/forum-service/internal/repository"
+
+	authv1 "github.com/greygn/protos/auth/v1"
+)
+
+// DataExport is a user's complete data: the account as exported by the auth
+// service and everything they have written on the forum.
+type DataExport struct {
+	Account  json.RawMessage      `json:"account"`
+	Posts    []repository.Post    `json:"posts"`
+	Comments []repository.Comment `json:"comments"`
+	Messages []repository.Message `json:"messages"`
+}
+
+// ExportService builds "download my data" archives.
+type ExportService struct {
+	authClient authv1.AuthServiceClient
+	repo       repository.UserExportRepository
+}
+
+func NewExportService(authClient authv1.AuthServiceClient, repo repository.UserExportRepository) *ExportService {
+	return &ExportService{
+		authClient: authClient,
+		repo:       repo,
+	}
+}
+
+// Export collects the data of the user the access token belongs to. The
+// token is passed on to the auth service, which only exports its owner.
+func (s *ExportService) Export(ctx context.Context, accessToken, userID string) (*DataExport, error) {
+	resp, err := s.authClient.ExportAccountData(ctx, &authv1.ExportAccountDataRequest{AccessToken: accessToken})
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := s.repo.GetUserContent(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &DataExport{
+		Account:  resp.GetData(),
+		Posts:    content.Posts,
+		Comments: content.Comments,
+		Messages: content.Messages,
+	}, nil
+}
+
+// WriteZip writes the export as a ZIP archive with one JSON file per kind
+// of data.
+func (e *DataExport) WriteZip(w io.Writer) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"account.json", e.Account},
+		{"posts.json", e.Posts},
+		{"comments.json", e.Comments},
+		{"messages.json", e.Messages},
+	}
+	for _, file := range files {
+		f, err := archive.Create(file.name)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
@@ -2,6 +2,7 @@ package service
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/greygn/forum-service/internal/repository"
@@ -24,23 +25,63 @@ func NewGRPCService(postService PostService) *GRPCService {
 	}
 }
 
+// actor returns the ID and name of the user a call acts as. They come from
+// the token verified by the auth interceptor; the user_id and username
+// fields of requests are ignored.
+func actor(ctx context.Context) (string, string, error) {
+	userID, _ := ctx.Value("user_id").(string)
+	username, _ := ctx.Value("username").(string)
+	if userID == "" {
+		return "", "", status.Error(codes.Unauthenticated, "authentication required")
+	}
+	return userID, username, nil
+}
+
+// impersonator returns the admin acting as the user through an impersonation
+// token, or "" when users act for themselves. It is stored with what they
+// write.
+func impersonator(ctx context.Context) string {
+	impersonatorID, _ := ctx.Value("impersonator_id").(string)
+	return impersonatorID
+}
+
+// postStatus converts an error of the post service to a gRPC status.
+func postStatus(err error) error {
+	var invalid *ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, ErrPostNotFound), errors.Is(err, ErrCommentNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, ErrNotAuthor):
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
 // Post operations
 func (s *GRPCService) CreatePost(ctx context.Context, req *forum.CreatePostRequest) (*forum.CreatePostResponse, error) {
 	if req.Title == "" || req.Content == "" {
 		return nil, status.Error(codes.InvalidArgument, "title and content are required")
 	}
 
+	userID, username, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	post := &repository.Post{
-		ID:        uuid.New().String(),
-		UserID:    req.UserId,
-		Username:  req.Username,
-		Title:     req.Title,
-		Content:   req.Content,
-		CreatedAt: time.Now(),
+		ID:             uuid.New().String(),
+		UserID:         userID,
+		Username:       username,
+		Title:          req.Title,
+		Content:        req.Content,
+		CreatedAt:      time.Now(),
+		ImpersonatorID: impersonator(ctx),
 	}
 
 	if err := s.postService.CreatePost(ctx, post); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.CreatePostResponse{
@@ -59,7 +100,7 @@ func (s *GRPCService) CreatePost(ctx context.Context, req *forum.CreatePostReque
 func (s *GRPCService) GetPosts(ctx context.Context, req *forum.GetPostsRequest) (*forum.GetPostsResponse, error) {
 	posts, err := s.postService.GetAllPosts(ctx)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	protoPosts := make([]*forum.Post, len(posts))
@@ -82,7 +123,7 @@ func (s *GRPCService) GetPosts(ctx context.Context, req *forum.GetPostsRequest)
 func (s *GRPCService) GetPost(ctx context.Context, req *forum.GetPostRequest) (*forum.GetPostResponse, error) {
 	post, err := s.postService.GetPostByID(ctx, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.GetPostResponse{
@@ -103,15 +144,21 @@ func (s *GRPCService) UpdatePost(ctx context.Context, req *forum.UpdatePostReque
 		return nil, status.Error(codes.InvalidArgument, "title and content are required")
 	}
 
+	userID, _, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	post := &repository.Post{
-		ID:      req.Id,
-		UserID:  req.UserId,
-		Title:   req.Title,
-		Content: req.Content,
+		ID:             req.Id,
+		UserID:         userID,
+		Title:          req.Title,
+		Content:        req.Content,
+		ImpersonatorID: impersonator(ctx),
 	}
 
 	if err := s.postService.UpdatePost(ctx, post); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.UpdatePostResponse{
@@ -120,8 +167,13 @@ func (s *GRPCService) UpdatePost(ctx context.Context, req *forum.UpdatePostReque
 }
 
 func (s *GRPCService) DeletePost(ctx context.Context, req *forum.DeletePostRequest) (*forum.DeletePostResponse, error) {
-	if err := s.postService.DeletePost(ctx, req.Id, req.UserId); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	userID, _, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.postService.DeletePost(ctx, req.Id, userID, impersonator(ctx)); err != nil {
+		return nil, postStatus(err)
 	}
 
 	return &forum.DeletePostResponse{
@@ -135,17 +187,23 @@ func (s *GRPCService) CreateComment(ctx context.Context, req *forum.CreateCommen
 		return nil, status.Error(codes.InvalidArgument, "content is required")
 	}
 
+	userID, username, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	comment := &repository.Comment{
-		ID:        uuid.New().String(),
-		PostID:    req.PostId,
-		UserID:    req.UserId,
-		Username:  req.Username,
-		Content:   req.Content,
-		CreatedAt: time.Now(),
+		ID:             uuid.New().String(),
+		PostID:         req.PostId,
+		UserID:         userID,
+		Username:       username,
+		Content:        req.Content,
+		CreatedAt:      time.Now(),
+		ImpersonatorID: impersonator(ctx),
 	}
 
 	if err := s.postService.CreateComment(ctx, comment); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.CreateCommentResponse{
@@ -164,7 +222,7 @@ func (s *GRPCService) CreateComment(ctx context.Context, req *forum.CreateCommen
 func (s *GRPCService) GetComments(ctx context.Context, req *forum.GetCommentsRequest) (*forum.GetCommentsResponse, error) {
 	comments, err := s.postService.GetComments(ctx, req.PostId)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	protoComments := make([]*forum.Comment, len(comments))
@@ -187,7 +245,7 @@ func (s *GRPCService) GetComments(ctx context.Context, req *forum.GetCommentsReq
 func (s *GRPCService) GetComment(ctx context.Context, req *forum.GetCommentRequest) (*forum.GetCommentResponse, error) {
 	comment, err := s.postService.GetCommentByID(ctx, req.Id)
 	if err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.GetCommentResponse{
@@ -208,14 +266,20 @@ func (s *GRPCService) UpdateComment(ctx context.Context, req *forum.UpdateCommen
 		return nil, status.Error(codes.InvalidArgument, "content is required")
 	}
 
+	userID, _, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	comment := &repository.Comment{
-		ID:      req.Id,
-		UserID:  req.UserId,
-		Content: req.Content,
+		ID:             req.Id,
+		UserID:         userID,
+		Content:        req.Content,
+		ImpersonatorID: impersonator(ctx),
 	}
 
 	if err := s.postService.UpdateComment(ctx, comment); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+		return nil, postStatus(err)
 	}
 
 	return &forum.UpdateCommentResponse{
@@ -224,8 +288,13 @@ func (s *GRPCService) UpdateComment(ctx context.Context, req *forum.UpdateCommen
 }
 
 func (s *GRPCService) DeleteComment(ctx context.Context, req *forum.DeleteCommentRequest) (*forum.DeleteCommentResponse, error) {
-	if err := s.postService.DeleteComment(ctx, req.Id, req.UserId); err != nil {
-		return nil, status.Error(codes.Internal, err.Error())
+	userID, _, err := actor(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.postService.DeleteComment(ctx, req.Id, userID, impersonator(ctx)); err != nil {
+		return nil, postStatus(err)
 	}
 
 	return &forum.DeleteCommentResponse{
@@ -4,17 +4,43 @@ import (
 	"context"
 	"errors"
 	"time"
+	"unicode/utf8"
 
 	"github.com/greygn/forum-service/internal/repository"
 )
 
+// Limits on what users write. Titles are stored as VARCHAR(255).
+const (
+	MaxTitleLength   = 255
+	MaxContentLength = 10000
+)
+
+var (
+	ErrPostNotFound    = errors.New("post not found")
+	ErrCommentNotFound = errors.New("comment not found")
+	// ErrNotAuthor is returned when a user changes a post or comment
+	// written by someone else.
+	ErrNotAuthor = errors.New("only the author can change it")
+)
+
+// ValidationError reports a post or comment that cannot be saved as sent.
+type ValidationError struct {
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
 type PostService interface {
 	// Post operations
 	CreatePost(ctx context.Context, post *repository.Post) error
 	GetAllPosts(ctx context.Context) ([]repository.Post, error)
 	GetPostByID(ctx context.Context, id string) (*repository.Post, error)
 	UpdatePost(ctx context.Context, post *repository.Post) error
-	DeletePost(ctx context.Context, id string, userID string) error
+	// DeletePost deletes the post if userID wrote it. impersonatorID is the
+	// admin acting as the user, if any.
+	DeletePost(ctx context.Context, id, userID, impersonatorID string) error
 	DeleteOldPosts(ctx context.Context, olderThan time.Duration) error
 
 	// Comment operations
@@ -22,7 +48,9 @@ type PostService interface {
 	CreateComment(ctx context.Context, comment *repository.Comment) error
 	GetCommentByID(ctx context.Context, id string) (*repository.Comment, error)
 	UpdateComment(ctx context.Context, comment *repository.Comment) error
-	DeleteComment(ctx context.Context, id string, userID string) error
+	// DeleteComment deletes the comment if userID wrote it. impersonatorID is
+	// the admin acting as the user, if any.
+	DeleteComment(ctx context.Context, id, userID, impersonatorID string) error
 }
 
 type postService struct {
@@ -33,12 +61,29 @@ func NewPostService(repo repository.PostRepository) PostService {
 	return &postService{repo: repo}
 }
 
-func (s *postService) CreatePost(ctx context.Context, post *repository.Post) error {
+func validatePost(post *repository.Post) error {
 	if post.Title == "" {
-		return errors.New("title is required")
+		return &ValidationError{Message: "title is required"}
 	}
-	if post.Content == "" {
-		return errors.New("content is required")
+	if utf8.RuneCountInString(post.Title) > MaxTitleLength {
+		return &ValidationError{Message: "title is too long"}
+	}
+	return validateContent(post.Content)
+}
+
+func validateContent(content string) error {
+	if content == "" {
+		return &ValidationError{Message: "content is required"}
+	}
+	if utf8.RuneCountInString(content) > MaxContentLength {
+		return &ValidationError{Message: "content is too long"}
+	}
+	return nil
+}
+
+func (s *postService) CreatePost(ctx context.Context, post *repository.Post) error {
+	if err := validatePost(post); err != nil {
+		return err
 	}
 
 	return s.repo.CreatePost(ctx, post)
@@ -49,22 +94,45 @@ func (s *postService) GetAllPosts(ctx context.Context) ([]repository.Post, error
 }
 
 func (s *postService) GetPostByID(ctx context.Context, id string) (*repository.Post, error) {
-	return s.repo.GetPostByID(ctx, id)
+	post, err := s.repo.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	return post, nil
+}
+
+// authorOf returns the post with the given ID if userID wrote it.
+func (s *postService) authorOf(ctx context.Context, id, userID string) (*repository.Post, error) {
+	post, err := s.GetPostByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if post.UserID != userID {
+		return nil, ErrNotAuthor
+	}
+	return post, nil
 }
 
 func (s *postService) UpdatePost(ctx context.Context, post *repository.Post) error {
-	if post.Title == "" {
-		return errors.New("title is required")
+	if err := validatePost(post); err != nil {
+		return err
 	}
-	if post.Content == "" {
-		return errors.New("content is required")
+	if _, err := s.authorOf(ctx, post.ID, post.UserID); err != nil {
+		return err
 	}
 
 	return s.repo.UpdatePost(ctx, post)
 }
 
-func (s *postService) DeletePost(ctx context.Context, id string, userID string) error {
-	return s.repo.DeletePost(ctx, id)
+func (s *postService) DeletePost(ctx context.Context, id, userID, impersonatorID string) error {
+	if _, err := s.authorOf(ctx, id, userID); err != nil {
+		return err
+	}
+
+	return s.repo.DeletePost(ctx, id, userID, impersonatorID)
 }
 
 func (s *postService) DeleteOldPosts(ctx context.Context, olderThan time.Duration) error {
@@ -72,29 +140,62 @@ func (s *postService) DeleteOldPosts(ctx context.Context, olderThan time.Duratio
 }
 
 func (s *postService) GetComments(ctx context.Context, postID string) ([]repository.Comment, error) {
+	if _, err := s.GetPostByID(ctx, postID); err != nil {
+		return nil, err
+	}
+
 	return s.repo.GetComments(ctx, postID)
 }
 
 func (s *postService) CreateComment(ctx context.Context, comment *repository.Comment) error {
-	if comment.Content == "" {
-		return errors.New("content is required")
+	if err := validateContent(comment.Content); err != nil {
+		return err
+	}
+	if _, err := s.GetPostByID(ctx, comment.PostID); err != nil {
+		return err
 	}
 
 	return s.repo.CreateComment(ctx, comment)
 }
 
 func (s *postService) GetCommentByID(ctx context.Context, id string) (*repository.Comment, error) {
-	return s.repo.GetCommentByID(ctx, id)
+	comment, err := s.repo.GetCommentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return nil, ErrCommentNotFound
+	}
+	return comment, nil
+}
+
+// commentAuthorOf returns the comment with the given ID if userID wrote it.
+func (s *postService) commentAuthorOf(ctx context.Context, id, userID string) (*repository.Comment, error) {
+	comment, err := s.GetCommentByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment.UserID != userID {
+		return nil, ErrNotAuthor
+	}
+	return comment, nil
 }
 
 func (s *postService) UpdateComment(ctx context.Context, comment *repository.Comment) error {
-	if comment.Content == "" {
-		return errors.New("content is required")
+	if err := validateContent(comment.Content); err != nil {
+		return err
+	}
+	if _, err := s.commentAuthorOf(ctx, comment.ID, comment.UserID); err != nil {
+		return err
 	}
 
 	return s.repo.UpdateComment(ctx, comment)
 }
 
-func (s *postService) DeleteComment(ctx context.Context, id string, userID string) error {
-	return s.repo.DeleteComment(ctx, id)
+func (s *postService) DeleteComment(ctx context.Context, id, userID, impersonatorID string) error {
+	if _, err := s.commentAuthorOf(ctx, id, userID); err != nil {
+		return err
+	}
+
+	return s.repo.DeleteComment(ctx, id, userID, impersonatorID)
 }
@@ -0,0 +1,161 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/greygn/forum-service/internal/repository"
+	"go.uber.org/zap"
+
+	authv1 "github.com/greygn/protos/auth/v1"
+)
+
+const (
+	usernameFeed          = "auth.username_changes"
+	deletionFeed          = "auth.user_deletions"
+	usernameSyncBatchSize = 100
+)
+
+// Deleted user policies decide what happens to the content of users who
+// delete their account.
+const (
+	DeletedUserAnonymize = "anonymize"
+	DeletedUserDelete    = "delete"
+)
+
+// UserSync follows the auth service's feeds of username changes and account
+// deletions and updates the authors of posts, comments and messages to
+// match. The feeds are only open to service accounts, so it authenticates
+// with the forum's client credentials.
+type UserSync struct {
+	authClient    authv1.AuthServiceClient
+	tokens        *ClientTokenSource
+	repo          repository.UserSyncRepository
+	interval      time.Duration
+	deletedPolicy string
+	logger        *zap.Logger
+}
+
+func NewUserSync(authClient authv1.AuthServiceClient, tokens *ClientTokenSource, repo repository.UserSyncRepository, interval time.Duration, deletedPolicy string, logger *zap.Logger) *UserSync {
+	return &UserSync{
+		authClient:    authClient,
+		tokens:        tokens,
+		repo:          repo,
+		interval:      interval,
+		deletedPolicy: deletedPolicy,
+		logger:        logger,
+	}
+}
+
+// Run applies new renames and deletions every interval until ctx is
+// cancelled.
+func (s *UserSync) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.Sync(ctx); err != nil {
+			s.logger.Error("failed to sync users", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync applies every rename and deletion the forum has not seen yet. The
+// cursors move after each change, so a failure resumes where it stopped.
+func (s *UserSync) Sync(ctx context.Context) error {
+	if err := s.syncRenames(ctx); err != nil {
+		return err
+	}
+	return s.syncDeletions(ctx)
+}
+
+func (s *UserSync) syncRenames(ctx context.Context) error {
+	cursor, err := s.repo.GetCursor(ctx, usernameFeed)
+	if err != nil {
+		return err
+	}
+
+	for {
+		token, err := s.tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.authClient.ListUsernameChanges(ctx, &authv1.ListUsernameChangesRequest{
+			AfterId:     cursor,
+			Limit:       usernameSyncBatchSize,
+			AccessToken: token,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, change := range resp.GetChanges() {
+			if err := s.repo.RenameUser(ctx, change.GetUserId(), change.GetNewUsername()); err != nil {
+				return err
+			}
+			cursor = change.GetId()
+			if err := s.repo.SetCursor(ctx, usernameFeed, cursor); err != nil {
+				return err
+			}
+			s.logger.Info("renamed user",
+				zap.String("user_id", change.GetUserId()),
+				zap.String("username", change.GetNewUsername()))
+		}
+
+		if len(resp.GetChanges()) < usernameSyncBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *UserSync) syncDeletions(ctx context.Context) error {
+	cursor, err := s.repo.GetCursor(ctx, deletionFeed)
+	if err != nil {
+		return err
+	}
+
+	for {
+		token, err := s.tokens.Token(ctx)
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.authClient.ListUserDeletions(ctx, &authv1.ListUserDeletionsRequest{
+			AfterId:     cursor,
+			Limit:       usernameSyncBatchSize,
+			AccessToken: token,
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, deletion := range resp.GetDeletions() {
+			if s.deletedPolicy == DeletedUserDelete {
+				err = s.repo.DeleteUser(ctx, deletion.GetUserId())
+			} else {
+				err = s.repo.AnonymizeUser(ctx, deletion.GetUserId())
+			}
+			if err != nil {
+				return err
+			}
+			cursor = deletion.GetId()
+			if err := s.repo.SetCursor(ctx, deletionFeed, cursor); err != nil {
+				return err
+			}
+			s.logger.Info("removed deleted user",
+				zap.String("user_id", deletion.GetUserId()),
+				zap.String("policy", s.deletedPolicy))
+		}
+
+		if len(resp.GetDeletions()) < usernameSyncBatchSize {
+			return nil
+		}
+	}
+}
@@ -3,19 +3,29 @@ package http
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strings"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/greygn/forum-service/internal/repository"
 	"github.com/greygn/forum-service/internal/service"
 	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// maxBodySize limits the JSON bodies of requests that create or change
+// posts and comments.
+const maxBodySize = 1 << 20
+
 type Server struct {
-	chatService *service.ChatService
-	logger      *zap.Logger
-	upgrader    websocket.Upgrader
+	chatService   *service.ChatService
+	postService   service.PostService
+	exportService *service.ExportService
+	logger        *zap.Logger
+	upgrader      websocket.Upgrader
 }
 
 type CreateMessageRequest struct {
@@ -26,6 +36,16 @@ type UpdateMessageRequest struct {
 	Content string `json:"content"`
 }
 
+type CreatePostRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+type UpdatePostRequest struct {
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
 type CreateCommentRequest struct {
 	Content string `json:"content"`
 }
@@ -34,10 +54,32 @@ type UpdateCommentRequest struct {
 	Content string `json:"content"`
 }
 
-func NewServer(chatService *service.ChatService, logger *zap.Logger) *Server {
+// ErrorResponse is the body of failed requests to the posts and comments API.
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// SessionResponse describes who the caller is acting as, so that clients can
+// show when an admin is impersonating the user.
+type SessionResponse struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	CanWrite bool   `json:"can_write"`
+	// ImpersonatedBy is set when an admin acts as the user.
+	ImpersonatedBy *Impersonator `json:"impersonated_by,omitempty"`
+}
+
+type Impersonator struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+}
+
+func NewServer(chatService *service.ChatService, postService service.PostService, exportService *service.ExportService, logger *zap.Logger) *Server {
 	return &Server{
-		chatService: chatService,
-		logger:      logger,
+		chatService:   chatService,
+		postService:   postService,
+		exportService: exportService,
+		logger:        logger,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
@@ -56,29 +98,42 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		case strings.HasPrefix(path, "/messages/"):
 			// Handle message-specific operations
 			parts := strings.Split(path, "/")
-			if len(parts) >= 3 {
-				messageID := parts[2]
-				if len(parts) >= 4 && parts[3] == "comments" {
-					s.handleComments(w, r, messageID)
-				} else {
-					s.handleMessage(w, r, messageID)
-				}
+			if len(parts) >= 3 && parts[2] != "" {
+				s.handleMessage(w, r, parts[2])
 			} else {
 				s.handleMessages(w, r)
 			}
+		case path == "/posts" || path == "/posts/":
+			s.handlePosts(w, r)
+		case strings.HasPrefix(path, "/posts/"):
+			// /posts/{id} and /posts/{id}/comments
+			parts := strings.Split(strings.TrimPrefix(path, "/posts/"), "/")
+			switch {
+			case parts[0] == "":
+				s.writeError(w, http.StatusNotFound, "Not found")
+			case len(parts) == 1:
+				s.handlePost(w, r, parts[0])
+			case len(parts) == 2 && parts[1] == "comments":
+				s.handleComments(w, r, parts[0])
+			default:
+				s.writeError(w, http.StatusNotFound, "Not found")
+			}
 		case strings.HasPrefix(path, "/comments/"):
 			// Handle comment-specific operations
-			parts := strings.Split(path, "/")
-			if len(parts) >= 3 {
-				commentID := parts[2]
-				s.handleComment(w, r, commentID)
-			} else {
-				http.NotFound(w, r)
+			commentID := strings.TrimPrefix(path, "/comments/")
+			if commentID == "" || strings.Contains(commentID, "/") {
+				s.writeError(w, http.StatusNotFound, "Not found")
+				return
 			}
+			s.handleComment(w, r, commentID)
 		case strings.HasPrefix(path, "/messages"):
 			s.handleMessages(w, r)
 		case strings.HasPrefix(path, "/ws"):
 			s.handleWebSocket(w, r)
+		case path == "/export":
+			s.handleExport(w, r)
+		case path == "/session":
+			s.handleSession(w, r)
 		default:
 			http.NotFound(w, r)
 		}
@@ -106,17 +161,29 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 	// Get user info from context
 	userID := r.Context().Value("user_id").(string)
 	username := r.Context().Value("username").(string)
+	canWrite, _ := r.Context().Value("can_write").(bool)
 
 	client := &service.Client{
-		Conn:     conn,
-		Send:     make(chan []byte, 256),
-		UserID:   userID,
-		Username: username,
+		Conn:           conn,
+		Send:           make(chan []byte, 256),
+		UserID:         userID,
+		Username:       username,
+		CanWrite:       canWrite,
+		ImpersonatorID: impersonator(r),
 	}
 
 	s.chatService.Register(client)
 	defer s.chatService.Unregister(client)
 
+	// The auth middleware cancels the context once the token stops being
+	// valid, for instance because its user was suspended
+	go func() {
+		<-r.Context().Done()
+		closeMessage := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "session ended")
+		client.Conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second))
+		client.Conn.Close()
+	}()
+
 	go s.writePump(client)
 	s.readPump(r.Context(), client)
 }
@@ -171,8 +238,13 @@ func (s *Server) readPump(ctx context.Context, client *service.Client) {
 			break
 		}
 
+		// Read-only clients can follow the chat but not post to it
+		if !client.CanWrite {
+			continue
+		}
+
 		// Process message
-		if err := s.chatService.SaveMessage(ctx, client.UserID, client.Username, string(message)); err != nil {
+		if err := s.chatService.SaveMessage(ctx, client.UserID, client.Username, client.ImpersonatorID, string(message)); err != nil {
 			s.logger.Error("failed to save message", zap.Error(err))
 			continue
 		}
@@ -205,7 +277,7 @@ func (s *Server) handleMessages(w http.ResponseWriter, r *http.Request) {
 		userID := r.Context().Value("user_id").(string)
 		username := r.Context().Value("username").(string)
 
-		if err := s.chatService.SaveMessage(r.Context(), userID, username, req.Content); err != nil {
+		if err := s.chatService.SaveMessage(r.Context(), userID, username, impersonator(r), req.Content); err != nil {
 			s.logger.Error("failed to save message", zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -239,7 +311,7 @@ func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request, messageID
 		}
 
 		userID := r.Context().Value("user_id").(string)
-		if err := s.chatService.UpdateMessage(r.Context(), messageID, userID, req.Content); err != nil {
+		if err := s.chatService.UpdateMessage(r.Context(), messageID, userID, impersonator(r), req.Content); err != nil {
 			s.logger.Error("failed to update message", zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -249,7 +321,7 @@ func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request, messageID
 
 	case http.MethodDelete:
 		userID := r.Context().Value("user_id").(string)
-		if err := s.chatService.DeleteMessage(r.Context(), messageID, userID); err != nil {
+		if err := s.chatService.DeleteMessage(r.Context(), messageID, userID, impersonator(r)); err != nil {
 			s.logger.Error("failed to delete message", zap.Error(err))
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -262,71 +334,326 @@ func (s *Server) handleMessage(w http.ResponseWriter, r *http.Request, messageID
 	}
 }
 
-func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, messageID string) {
+// handlePosts lists posts, newest first, and creates them.
+func (s *Server) handlePosts(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
 	case http.MethodGet:
-		comments, err := s.chatService.GetComments(r.Context(), messageID)
+		posts, err := s.postService.GetAllPosts(r.Context())
 		if err != nil {
-			s.logger.Error("failed to get comments", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			s.writeServiceError(w, "failed to get posts", err)
 			return
 		}
+		if posts == nil {
+			posts = []repository.Post{}
+		}
 
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(comments)
+		s.writeJSON(w, http.StatusOK, posts)
 
 	case http.MethodPost:
-		var req CreateCommentRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		var req CreatePostRequest
+		if !s.decode(w, r, &req) {
 			return
 		}
 
-		userID := r.Context().Value("user_id").(string)
-		username := r.Context().Value("username").(string)
+		userID, username := currentUser(r)
+		post := &repository.Post{
+			UserID:         userID,
+			Username:       username,
+			Title:          req.Title,
+			Content:        req.Content,
+			ImpersonatorID: impersonator(r),
+		}
+		if err := s.postService.CreatePost(r.Context(), post); err != nil {
+			s.writeServiceError(w, "failed to create post", err)
+			return
+		}
 
-		if err := s.chatService.CreateComment(r.Context(), messageID, userID, username, req.Content); err != nil {
-			s.logger.Error("failed to create comment", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		w.Header().Set("Location", "/api/v1/posts/"+post.ID)
+		s.writeJSON(w, http.StatusCreated, post)
+
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handlePost reads, updates and deletes a post. Only its author may change
+// it.
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, postID string) {
+	switch r.Method {
+	case http.MethodGet:
+		post, err := s.postService.GetPostByID(r.Context(), postID)
+		if err != nil {
+			s.writeServiceError(w, "failed to get post", err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
+		s.writeJSON(w, http.StatusOK, post)
+
+	case http.MethodPut:
+		var req UpdatePostRequest
+		if !s.decode(w, r, &req) {
+			return
+		}
+
+		userID, _ := currentUser(r)
+		post := &repository.Post{
+			ID:             postID,
+			UserID:         userID,
+			Title:          req.Title,
+			Content:        req.Content,
+			ImpersonatorID: impersonator(r),
+		}
+		if err := s.postService.UpdatePost(r.Context(), post); err != nil {
+			s.writeServiceError(w, "failed to update post", err)
+			return
+		}
+
+		updated, err := s.postService.GetPostByID(r.Context(), postID)
+		if err != nil {
+			s.writeServiceError(w, "failed to get post", err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, updated)
+
+	case http.MethodDelete:
+		userID, _ := currentUser(r)
+		if err := s.postService.DeletePost(r.Context(), postID, userID, impersonator(r)); err != nil {
+			s.writeServiceError(w, "failed to delete post", err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleComments lists the comments on a post, oldest first, and adds to
+// them.
+func (s *Server) handleComments(w http.ResponseWriter, r *http.Request, postID string) {
+	switch r.Method {
+	case http.MethodGet:
+		comments, err := s.postService.GetComments(r.Context(), postID)
+		if err != nil {
+			s.writeServiceError(w, "failed to get comments", err)
+			return
+		}
+		if comments == nil {
+			comments = []repository.Comment{}
+		}
+
+		s.writeJSON(w, http.StatusOK, comments)
+
+	case http.MethodPost:
+		var req CreateCommentRequest
+		if !s.decode(w, r, &req) {
+			return
+		}
+
+		userID, username := currentUser(r)
+		comment := &repository.Comment{
+			PostID:         postID,
+			UserID:         userID,
+			Username:       username,
+			Content:        req.Content,
+			ImpersonatorID: impersonator(r),
+		}
+		if err := s.postService.CreateComment(r.Context(), comment); err != nil {
+			s.writeServiceError(w, "failed to create comment", err)
+			return
+		}
+
+		w.Header().Set("Location", "/api/v1/comments/"+comment.ID)
+		s.writeJSON(w, http.StatusCreated, comment)
+
+	default:
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPost)
 	}
 }
 
+// handleComment reads, updates and deletes a comment. Only its author may
+// change it.
 func (s *Server) handleComment(w http.ResponseWriter, r *http.Request, commentID string) {
 	switch r.Method {
+	case http.MethodGet:
+		comment, err := s.postService.GetCommentByID(r.Context(), commentID)
+		if err != nil {
+			s.writeServiceError(w, "failed to get comment", err)
+			return
+		}
+
+		s.writeJSON(w, http.StatusOK, comment)
+
 	case http.MethodPut:
 		var req UpdateCommentRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request body", http.StatusBadRequest)
+		if !s.decode(w, r, &req) {
 			return
 		}
 
-		userID := r.Context().Value("user_id").(string)
-		if err := s.chatService.UpdateComment(r.Context(), commentID, userID, req.Content); err != nil {
-			s.logger.Error("failed to update comment", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		userID, _ := currentUser(r)
+		comment := &repository.Comment{
+			ID:             commentID,
+			UserID:         userID,
+			Content:        req.Content,
+			ImpersonatorID: impersonator(r),
+		}
+		if err := s.postService.UpdateComment(r.Context(), comment); err != nil {
+			s.writeServiceError(w, "failed to update comment", err)
 			return
 		}
 
-		w.WriteHeader(http.StatusOK)
+		updated, err := s.postService.GetCommentByID(r.Context(), commentID)
+		if err != nil {
+			s.writeServiceError(w, "failed to get comment", err)
+			return
+		}
+		s.writeJSON(w, http.StatusOK, updated)
 
 	case http.MethodDelete:
-		userID := r.Context().Value("user_id").(string)
-		if err := s.chatService.DeleteComment(r.Context(), commentID, userID); err != nil {
-			s.logger.Error("failed to delete comment", zap.Error(err))
-			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		userID, _ := currentUser(r)
+		if err := s.postService.DeleteComment(r.Context(), commentID, userID, impersonator(r)); err != nil {
+			s.writeServiceError(w, "failed to delete comment", err)
 			return
 		}
 
 		w.WriteHeader(http.StatusNoContent)
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		s.methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// currentUser returns the ID and name of the user the request acts as.
+func currentUser(r *http.Request) (string, string) {
+	userID, _ := r.Context().Value("user_id").(string)
+	username, _ := r.Context().Value("username").(string)
+	return userID, username
+}
+
+// impersonator returns the admin acting as the user through an impersonation
+// token, or "" when users act for themselves.
+func impersonator(r *http.Request) string {
+	impersonatorID, _ := r.Context().Value("impersonator_id").(string)
+	return impersonatorID
+}
+
+// decode reads the JSON body of r into v. It writes a 400 response and
+// returns false if the body is malformed.
+func (s *Server) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			s.writeError(w, http.StatusRequestEntityTooLarge, "Request body is too large")
+			return false
+		}
+		s.writeError(w, http.StatusBadRequest, "Invalid request body")
+		return false
+	}
+	return true
+}
+
+func (s *Server) writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) writeError(w http.ResponseWriter, code int, message string) {
+	s.writeJSON(w, code, ErrorResponse{Error: message})
+}
+
+func (s *Server) methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	s.writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+}
+
+// writeServiceError answers with the status matching an error of the post
+// service, logging errors that are not the caller's fault.
+func (s *Server) writeServiceError(w http.ResponseWriter, msg string, err error) {
+	var invalid *service.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		s.writeError(w, http.StatusBadRequest, invalid.Message)
+	case errors.Is(err, service.ErrPostNotFound):
+		s.writeError(w, http.StatusNotFound, "Post not found")
+	case errors.Is(err, service.ErrCommentNotFound):
+		s.writeError(w, http.StatusNotFound, "Comment not found")
+	case errors.Is(err, service.ErrNotAuthor):
+		s.writeError(w, http.StatusForbidden, "Only the author can change it")
+	default:
+		s.logger.Error(msg, zap.Error(err))
+		s.writeError(w, http.StatusInternalServerError, "Internal server error")
+	}
+}
+
+// handleSession describes the caller's session.
+func (s *Server) handleSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	ctx := r.Context()
+	session := SessionResponse{
+		UserID:   ctx.Value("user_id").(string),
+		Username: ctx.Value("username").(string),
+	}
+	session.CanWrite, _ = ctx.Value("can_write").(bool)
+	if impersonatorID, _ := ctx.Value("impersonator_id").(string); impersonatorID != "" {
+		impersonatorName, _ := ctx.Value("impersonator_username").(string)
+		session.ImpersonatedBy = &Impersonator{ID: impersonatorID, Username: impersonatorName}
+	}
+
+	s.writeJSON(w, http.StatusOK, session)
+}
+
+// handleExport sends the caller all their data, as a ZIP archive by default
+// or as one JSON document with ?format=json.
+func (s *Server) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "zip"
+	}
+	if format != "zip" && format != "json" {
+		s.writeError(w, http.StatusBadRequest, "Format must be zip or json")
+		return
+	}
+
+	// The auth service exports the account the token belongs to
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	userID := r.Context().Value("user_id").(string)
+
+	export, err := s.exportService.Export(r.Context(), token, userID)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.Unauthenticated:
+			s.writeError(w, http.StatusUnauthorized, "Invalid token")
+		case codes.PermissionDenied:
+			s.writeError(w, http.StatusForbidden, "Forbidden")
+		default:
+			s.logger.Error("failed to export user data", zap.Error(err))
+			s.writeError(w, http.StatusInternalServerError, "Internal server error")
+		}
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Disposition", `attachment; filename="export.json"`)
+		s.writeJSON(w, http.StatusOK, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.zip"`)
+	if err := export.WriteZip(w); err != nil {
+		s.logger.Error("failed to write export archive", zap.Error(err))
 	}
 }
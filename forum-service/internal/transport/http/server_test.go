@@ -0,0 +1,474 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/greygn/forum-service/internal/config"
+	"github.com/greygn/forum-service/internal/repository"
+	"github.com/greygn/forum-service/internal/service"
+	"go.uber.org/zap"
+)
+
+// fakePostRepository keeps posts and comments in memory and, like the
+// Postgres repository, only changes rows of the given user.
+type fakePostRepository struct {
+	posts    map[string]*repository.Post
+	comments map[string]*repository.Comment
+	// deletedBy records the impersonator passed with each delete.
+	deletedBy map[string]string
+}
+
+func newFakePostRepository() *fakePostRepository {
+	return &fakePostRepository{
+		posts:     make(map[string]*repository.Post),
+		comments:  make(map[string]*repository.Comment),
+		deletedBy: make(map[string]string),
+	}
+}
+
+func (r *fakePostRepository) CreatePost(ctx context.Context, post *repository.Post) error {
+	post.ID = uuid.New().String()
+	post.CreatedAt = time.Now()
+	stored := *post
+	r.posts[post.ID] = &stored
+	return nil
+}
+
+func (r *fakePostRepository) GetAllPosts(ctx context.Context) ([]repository.Post, error) {
+	var posts []repository.Post
+	for _, post := range r.posts {
+		posts = append(posts, *post)
+	}
+	return posts, nil
+}
+
+func (r *fakePostRepository) GetPostByID(ctx context.Context, id string) (*repository.Post, error) {
+	post, ok := r.posts[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *post
+	return &found, nil
+}
+
+func (r *fakePostRepository) UpdatePost(ctx context.Context, post *repository.Post) error {
+	stored, ok := r.posts[post.ID]
+	if !ok || stored.UserID != post.UserID {
+		return errors.New("post not found or unauthorized")
+	}
+	stored.Title = post.Title
+	stored.Content = post.Content
+	stored.ImpersonatorID = post.ImpersonatorID
+	return nil
+}
+
+func (r *fakePostRepository) DeletePost(ctx context.Context, id, userID, impersonatorID string) error {
+	if post, ok := r.posts[id]; ok && post.UserID == userID {
+		delete(r.posts, id)
+		r.deletedBy[id] = impersonatorID
+	}
+	return nil
+}
+
+func (r *fakePostRepository) DeleteOldPosts(ctx context.Context, olderThan time.Duration) error {
+	return nil
+}
+
+func (r *fakePostRepository) GetComments(ctx context.Context, postID string) ([]repository.Comment, error) {
+	var comments []repository.Comment
+	for _, comment := range r.comments {
+		if comment.PostID == postID {
+			comments = append(comments, *comment)
+		}
+	}
+	return comments, nil
+}
+
+func (r *fakePostRepository) CreateComment(ctx context.Context, comment *repository.Comment) error {
+	comment.ID = uuid.New().String()
+	comment.CreatedAt = time.Now()
+	stored := *comment
+	r.comments[comment.ID] = &stored
+	return nil
+}
+
+func (r *fakePostRepository) GetCommentByID(ctx context.Context, id string) (*repository.Comment, error) {
+	comment, ok := r.comments[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *comment
+	return &found, nil
+}
+
+func (r *fakePostRepository) UpdateComment(ctx context.Context, comment *repository.Comment) error {
+	stored, ok := r.comments[comment.ID]
+	if !ok || stored.UserID != comment.UserID {
+		return errors.New("comment not found or unauthorized")
+	}
+	stored.Content = comment.Content
+	stored.ImpersonatorID = comment.ImpersonatorID
+	return nil
+}
+
+func (r *fakePostRepository) DeleteComment(ctx context.Context, id, userID, impersonatorID string) error {
+	if comment, ok := r.comments[id]; ok && comment.UserID == userID {
+		delete(r.comments, id)
+		r.deletedBy[id] = impersonatorID
+	}
+	return nil
+}
+
+const (
+	authorID = "11111111-1111-1111-1111-111111111111"
+	otherID  = "22222222-2222-2222-2222-222222222222"
+	adminID  = "33333333-3333-3333-3333-333333333333"
+)
+
+func newTestServer() (*Server, *fakePostRepository) {
+	repo := newFakePostRepository()
+	return NewServer(nil, service.NewPostService(repo), nil, zap.NewNop()), repo
+}
+
+// do sends a request as userID, the way the auth middleware passes the
+// caller on, and returns the response. impersonatorID may be "".
+func do(t *testing.T, s *Server, method, path, body, userID, impersonatorID string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	ctx := context.WithValue(req.Context(), "user_id", userID)
+	ctx = context.WithValue(ctx, "username", "user-"+userID[:4])
+	ctx = context.WithValue(ctx, "can_write", true)
+	if impersonatorID != "" {
+		ctx = context.WithValue(ctx, "impersonator_id", impersonatorID)
+	}
+
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req.WithContext(ctx))
+	return rec
+}
+
+func decodeBody(t *testing.T, rec *httptest.ResponseRecorder, v any) {
+	t.Helper()
+
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatalf("failed to decode response %q: %v", rec.Body.String(), err)
+	}
+}
+
+func expectStatus(t *testing.T, rec *httptest.ResponseRecorder, code int) {
+	t.Helper()
+
+	if rec.Code != code {
+		t.Fatalf("expected status %d, got %d: %s", code, rec.Code, rec.Body.String())
+	}
+}
+
+func createPost(t *testing.T, s *Server, userID string) repository.Post {
+	t.Helper()
+
+	rec := do(t, s, http.MethodPost, "/api/v1/posts", `{"title":"Hello","content":"First post"}`, userID, "")
+	expectStatus(t, rec, http.StatusCreated)
+	var post repository.Post
+	decodeBody(t, rec, &post)
+	return post
+}
+
+func TestCreatePost(t *testing.T) {
+	t.Run("success", func(t *testing.T) {
+		s, repo := newTestServer()
+
+		rec := do(t, s, http.MethodPost, "/api/v1/posts", `{"title":"Hello","content":"First post"}`, authorID, adminID)
+		expectStatus(t, rec, http.StatusCreated)
+
+		var post repository.Post
+		decodeBody(t, rec, &post)
+		if post.ID == "" || post.UserID != authorID || post.Title != "Hello" || post.Content != "First post" {
+			t.Errorf("unexpected post %+v", post)
+		}
+		if got := rec.Header().Get("Location"); got != "/api/v1/posts/"+post.ID {
+			t.Errorf("unexpected Location %q", got)
+		}
+		if stored := repo.posts[post.ID]; stored == nil || stored.ImpersonatorID != adminID {
+			t.Errorf("expected the post to be stored with the impersonator, got %+v", stored)
+		}
+	})
+
+	t.Run("bad request", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"malformed JSON", `{"title":`},
+			{"unknown field", `{"title":"Hello","content":"First post","user_id":"` + otherID + `"}`},
+			{"missing title", `{"content":"First post"}`},
+			{"missing content", `{"title":"Hello"}`},
+			{"title too long", `{"title":"` + strings.Repeat("a", service.MaxTitleLength+1) + `","content":"First post"}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				s, repo := newTestServer()
+
+				rec := do(t, s, http.MethodPost, "/api/v1/posts", tt.body, authorID, "")
+				expectStatus(t, rec, http.StatusBadRequest)
+				if len(repo.posts) != 0 {
+					t.Errorf("expected no post to be stored, got %d", len(repo.posts))
+				}
+			})
+		}
+	})
+
+	t.Run("body too large", func(t *testing.T) {
+		s, _ := newTestServer()
+
+		body := `{"title":"Hello","content":"` + strings.Repeat("a", maxBodySize) + `"}`
+		rec := do(t, s, http.MethodPost, "/api/v1/posts", body, authorID, "")
+		expectStatus(t, rec, http.StatusRequestEntityTooLarge)
+	})
+}
+
+func TestUpdatePost(t *testing.T) {
+	t.Run("author", func(t *testing.T) {
+		s, _ := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPut, "/api/v1/posts/"+post.ID, `{"title":"Edited","content":"Changed"}`, authorID, "")
+		expectStatus(t, rec, http.StatusOK)
+
+		var updated repository.Post
+		decodeBody(t, rec, &updated)
+		if updated.ID != post.ID || updated.Title != "Edited" || updated.Content != "Changed" {
+			t.Errorf("unexpected post %+v", updated)
+		}
+	})
+
+	t.Run("not the author", func(t *testing.T) {
+		s, repo := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPut, "/api/v1/posts/"+post.ID, `{"title":"Edited","content":"Changed"}`, otherID, "")
+		expectStatus(t, rec, http.StatusForbidden)
+		if repo.posts[post.ID].Title != "Hello" {
+			t.Errorf("expected the post to be unchanged, got %+v", repo.posts[post.ID])
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, _ := newTestServer()
+
+		rec := do(t, s, http.MethodPut, "/api/v1/posts/"+uuid.New().String(), `{"title":"Edited","content":"Changed"}`, authorID, "")
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		s, _ := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPut, "/api/v1/posts/"+post.ID, `not json`, authorID, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("missing title", func(t *testing.T) {
+		s, _ := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPut, "/api/v1/posts/"+post.ID, `{"content":"Changed"}`, authorID, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+}
+
+func TestDeletePost(t *testing.T) {
+	t.Run("author", func(t *testing.T) {
+		s, repo := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodDelete, "/api/v1/posts/"+post.ID, "", authorID, adminID)
+		expectStatus(t, rec, http.StatusNoContent)
+		if _, ok := repo.posts[post.ID]; ok {
+			t.Error("expected the post to be deleted")
+		}
+		if repo.deletedBy[post.ID] != adminID {
+			t.Errorf("expected the delete to be attributed to the impersonator, got %q", repo.deletedBy[post.ID])
+		}
+
+		rec = do(t, s, http.MethodGet, "/api/v1/posts/"+post.ID, "", authorID, "")
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("not the author", func(t *testing.T) {
+		s, repo := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodDelete, "/api/v1/posts/"+post.ID, "", otherID, "")
+		expectStatus(t, rec, http.StatusForbidden)
+		if _, ok := repo.posts[post.ID]; !ok {
+			t.Error("expected the post to be kept")
+		}
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		s, _ := newTestServer()
+
+		rec := do(t, s, http.MethodDelete, "/api/v1/posts/"+uuid.New().String(), "", authorID, "")
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
+
+func TestComments(t *testing.T) {
+	t.Run("create", func(t *testing.T) {
+		s, _ := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPost, "/api/v1/posts/"+post.ID+"/comments", `{"content":"Nice"}`, otherID, "")
+		expectStatus(t, rec, http.StatusCreated)
+
+		var comment repository.Comment
+		decodeBody(t, rec, &comment)
+		if comment.ID == "" || comment.PostID != post.ID || comment.UserID != otherID {
+			t.Errorf("unexpected comment %+v", comment)
+		}
+		if got := rec.Header().Get("Location"); got != "/api/v1/comments/"+comment.ID {
+			t.Errorf("unexpected Location %q", got)
+		}
+	})
+
+	t.Run("create on missing post", func(t *testing.T) {
+		s, _ := newTestServer()
+
+		rec := do(t, s, http.MethodPost, "/api/v1/posts/"+uuid.New().String()+"/comments", `{"content":"Nice"}`, otherID, "")
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+
+	t.Run("create with malformed JSON", func(t *testing.T) {
+		s, _ := newTestServer()
+		post := createPost(t, s, authorID)
+
+		rec := do(t, s, http.MethodPost, "/api/v1/posts/"+post.ID+"/comments", `{"content":`, otherID, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+	})
+
+	t.Run("update and delete", func(t *testing.T) {
+		s, repo := newTestServer()
+		post := createPost(t, s, authorID)
+		rec := do(t, s, http.MethodPost, "/api/v1/posts/"+post.ID+"/comments", `{"content":"Nice"}`, otherID, "")
+		expectStatus(t, rec, http.StatusCreated)
+		var comment repository.Comment
+		decodeBody(t, rec, &comment)
+
+		// The author of the post does not own comments on it
+		rec = do(t, s, http.MethodPut, "/api/v1/comments/"+comment.ID, `{"content":"Rude"}`, authorID, "")
+		expectStatus(t, rec, http.StatusForbidden)
+		rec = do(t, s, http.MethodDelete, "/api/v1/comments/"+comment.ID, "", authorID, "")
+		expectStatus(t, rec, http.StatusForbidden)
+
+		rec = do(t, s, http.MethodPut, "/api/v1/comments/"+comment.ID, `{"content":"Very nice"}`, otherID, "")
+		expectStatus(t, rec, http.StatusOK)
+		var updated repository.Comment
+		decodeBody(t, rec, &updated)
+		if updated.Content != "Very nice" {
+			t.Errorf("unexpected comment %+v", updated)
+		}
+
+		rec = do(t, s, http.MethodPut, "/api/v1/comments/"+comment.ID, `{"content":""}`, otherID, "")
+		expectStatus(t, rec, http.StatusBadRequest)
+
+		rec = do(t, s, http.MethodDelete, "/api/v1/comments/"+comment.ID, "", otherID, "")
+		expectStatus(t, rec, http.StatusNoContent)
+		if _, ok := repo.comments[comment.ID]; ok {
+			t.Error("expected the comment to be deleted")
+		}
+
+		rec = do(t, s, http.MethodDelete, "/api/v1/comments/"+comment.ID, "", otherID, "")
+		expectStatus(t, rec, http.StatusNotFound)
+	})
+}
+
+func TestPostRoutes(t *testing.T) {
+	s, _ := newTestServer()
+
+	rec := do(t, s, http.MethodPatch, "/api/v1/posts", "", authorID, "")
+	expectStatus(t, rec, http.StatusMethodNotAllowed)
+	if got := rec.Header().Get("Allow"); got != "GET, POST" {
+		t.Errorf("unexpected Allow %q", got)
+	}
+
+	rec = do(t, s, http.MethodGet, "/api/v1/posts/a/b/c", "", authorID, "")
+	expectStatus(t, rec, http.StatusNotFound)
+
+	rec = do(t, s, http.MethodGet, "/api/v1/comments/a/b", "", authorID, "")
+	expectStatus(t, rec, http.StatusNotFound)
+}
+
+func TestSessionAndExportRoutes(t *testing.T) {
+	s, _ := newTestServer()
+
+	rec := do(t, s, http.MethodGet, "/api/v1/session", "", authorID, adminID)
+	expectStatus(t, rec, http.StatusOK)
+	var session SessionResponse
+	decodeBody(t, rec, &session)
+	if session.UserID != authorID || session.ImpersonatedBy == nil || session.ImpersonatedBy.ID != adminID {
+		t.Errorf("unexpected session %+v", session)
+	}
+
+	// Errors are JSON like those of every other route
+	for _, tc := range []struct {
+		method, path string
+		code         int
+	}{
+		{http.MethodPost, "/api/v1/session", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/api/v1/export", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/api/v1/export?format=csv", http.StatusBadRequest},
+	} {
+		rec := do(t, s, tc.method, tc.path, "", authorID, "")
+		expectStatus(t, rec, tc.code)
+		if got := rec.Header().Get("Content-Type"); got != "application/json" {
+			t.Errorf("%s %s: expected a JSON error, got %q", tc.method, tc.path, got)
+		}
+		var resp ErrorResponse
+		decodeBody(t, rec, &resp)
+		if resp.Error == "" {
+			t.Errorf("%s %s: expected an error message", tc.method, tc.path)
+		}
+		if tc.code == http.StatusMethodNotAllowed && rec.Header().Get("Allow") != "GET" {
+			t.Errorf("%s %s: unexpected Allow %q", tc.method, tc.path, rec.Header().Get("Allow"))
+		}
+	}
+}
+
+func TestWebSocketClosedWhenSessionEnds(t *testing.T) {
+	chatService := service.NewChatService(nil, &config.Config{}, zap.NewNop())
+	go chatService.Run()
+	s := NewServer(chatService, nil, nil, zap.NewNop())
+
+	// end stands in for the auth middleware finding the token no longer valid
+	ctx, end := context.WithCancel(context.Background())
+	defer end()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(ctx, "user_id", authorID)
+		ctx = context.WithValue(ctx, "username", "alice")
+		s.ServeHTTP(w, r.WithContext(ctx))
+	}))
+	defer server.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/v1/ws", nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	end()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+		t.Errorf("expected the socket to be closed with a policy violation, got %v", err)
+	}
+}
@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS sync_cursors (
+    name VARCHAR(64) PRIMARY KEY,
+    position BIGINT NOT NULL
+); 
\ No newline at end of file
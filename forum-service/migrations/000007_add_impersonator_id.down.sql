@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_messages_impersonator_id;
+
+ALTER TABLE messages DROP COLUMN IF EXISTS impersonator_id;
+ALTER TABLE comments DROP COLUMN IF EXISTS impersonator_id;
+ALTER TABLE posts DROP COLUMN IF EXISTS impersonator_id;
\ No newline at end of file
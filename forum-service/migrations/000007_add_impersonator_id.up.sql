@@ -0,0 +1,7 @@
+-- The admin who last wrote a row while acting as its author with an
+-- impersonation token; NULL when users wrote it themselves
+ALTER TABLE posts ADD COLUMN IF NOT EXISTS impersonator_id VARCHAR(36);
+ALTER TABLE comments ADD COLUMN IF NOT EXISTS impersonator_id VARCHAR(36);
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS impersonator_id VARCHAR(36);
+
+CREATE INDEX IF NOT EXISTS idx_messages_impersonator_id ON messages(impersonator_id) WHERE impersonator_id IS NOT NULL;
\ No newline at end of file
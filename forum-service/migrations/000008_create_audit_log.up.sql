@@ -0,0 +1,16 @@
+-- Append-only record of who created, changed and deleted posts, comments
+-- and messages, including admins acting as users with impersonation tokens.
+-- Rows are never updated or deleted, so they outlive later edits and the
+-- content itself.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    actor_id VARCHAR(36) NOT NULL,
+    impersonator_id VARCHAR(36),
+    action VARCHAR(16) NOT NULL,
+    target_type VARCHAR(16) NOT NULL,
+    target_id VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_log_impersonator_id ON audit_log(impersonator_id) WHERE impersonator_id IS NOT NULL;
\ No newline at end of file